@@ -0,0 +1,515 @@
+// Package debugger implements interactive, line oriented debugger of TAC programs
+// on top of resumable tac.Machine.
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/tac"
+)
+
+const prompt = "(wdb) "
+
+// Session is debugger state: module under test, breakpoints and current evaluation.
+type Session struct {
+	mod   tac.Module
+	opts  tac.EvalOptions
+	out   io.Writer
+	entry string
+
+	m           *tac.Machine
+	breakpoints []breakpoint
+	nextID      int
+	// lastLine is source line of last instruction executed by frame at each depth.
+	lastLine []int
+}
+
+type breakpoint struct {
+	id       int
+	function string
+	label    string
+	line     int
+	// file of line breakpoint, empty for line of any file
+	file string
+}
+
+func (b breakpoint) String() string {
+	switch {
+	case b.line > 0 && b.file != "":
+		return fmt.Sprintf("%s:%d", b.file, b.line)
+	case b.line > 0:
+		return fmt.Sprintf("line %d", b.line)
+	case b.label != "":
+		return b.function + " " + b.label
+	default:
+		return b.function
+	}
+}
+
+// New creates session evaluating entry function of mod, "@main" if entry is empty.
+func New(mod tac.Module, entry string, opts tac.EvalOptions, out io.Writer) *Session {
+	if entry == "" {
+		entry = "@main"
+	}
+	return &Session{mod: mod, opts: opts, out: out, entry: symbol(entry), nextID: 1}
+}
+
+// Run reads commands from in until quit or end of input.
+func (s *Session) Run(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, prompt)
+		if !sc.Scan() {
+			fmt.Fprintln(s.out)
+			return sc.Err()
+		}
+		quit, err := s.Exec(sc.Text())
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Exec executes one command line. Errors are about command itself,
+// runtime errors of evaluated program are reported to output.
+func (s *Session) Exec(line string) (quit bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "break", "b":
+		return false, s.cmdBreak(args)
+	case "delete", "d":
+		return false, s.cmdDelete(args)
+	case "info":
+		return false, s.cmdInfo(args)
+	case "run", "r":
+		return false, s.cmdRun(args)
+	case "continue", "c":
+		return false, s.resume(nil)
+	case "stepi", "si":
+		return false, s.resume(func() bool { return true })
+	case "step", "s":
+		return false, s.resume(s.stepDone(false))
+	case "next", "n":
+		return false, s.resume(s.stepDone(true))
+	case "print", "p":
+		return false, s.cmdPrint(args)
+	case "locals":
+		return false, s.cmdInfo([]string{"locals"})
+	case "backtrace", "bt":
+		return false, s.cmdBacktrace()
+	case "list", "l":
+		return false, s.cmdList()
+	case "help", "h":
+		s.help()
+		return false, nil
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", cmd)
+	}
+}
+
+func (s *Session) help() {
+	fmt.Fprint(s.out, `commands:
+  break @fn | break @fn .Lx | break [file:]line   set breakpoint
+  delete N                                        delete breakpoint
+  info breakpoints | info locals                  list breakpoints or values of current frame
+  run [args...]                                   (re)start entry function
+  continue                                        run to next breakpoint
+  stepi | step | next                             step instruction, statement, or statement over calls
+  print NAME                                      print temporary, parameter or stack slot
+  backtrace                                       print call stack
+  list                                            print instructions around current one
+  quit
+`)
+}
+
+func (s *Session) cmdBreak(args []string) error {
+	bp := breakpoint{id: s.nextID}
+	switch {
+	case len(args) == 1 && isLineSpec(args[0]):
+		colon := strings.LastIndex(args[0], ":")
+		line, err := strconv.Atoi(args[0][colon+1:])
+		if err != nil || line <= 0 {
+			return fmt.Errorf("invalid line %q", args[0])
+		}
+		bp.line = line
+		if colon > 0 {
+			bp.file = path.Clean(filepath.ToSlash(args[0][:colon]))
+		}
+	case len(args) == 1 || len(args) == 2:
+		fn, ok := s.function(symbol(args[0]))
+		if !ok {
+			return fmt.Errorf("no function %s", symbol(args[0]))
+		}
+		bp.function = fn.Name
+		if len(args) == 2 {
+			if !hasLabel(fn, args[1]) {
+				return fmt.Errorf("no label %s in %s", args[1], fn.Name)
+			}
+			bp.label = args[1]
+		}
+	default:
+		return fmt.Errorf("usage: break @fn [.label] | break [file:]line")
+	}
+	s.nextID++
+	s.breakpoints = append(s.breakpoints, bp)
+	fmt.Fprintf(s.out, "breakpoint %d at %s\n", bp.id, bp)
+	return nil
+}
+
+func (s *Session) cmdDelete(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: delete N")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid breakpoint number %q", args[0])
+	}
+	for i, bp := range s.breakpoints {
+		if bp.id == id {
+			s.breakpoints = append(s.breakpoints[:i], s.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %d", id)
+}
+
+func (s *Session) cmdInfo(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: info breakpoints | info locals")
+	}
+	switch args[0] {
+	case "breakpoints", "b":
+		if len(s.breakpoints) == 0 {
+			fmt.Fprintln(s.out, "no breakpoints")
+		}
+		for _, bp := range s.breakpoints {
+			fmt.Fprintf(s.out, "%d\t%s\n", bp.id, bp)
+		}
+		return nil
+	case "locals":
+		frame, err := s.current()
+		if err != nil {
+			return err
+		}
+		for _, v := range frame.Values {
+			fmt.Fprintf(s.out, "%s = %s\n", v.Name, v)
+		}
+		for _, slot := range frame.Slots {
+			fmt.Fprintln(s.out, formatSlot(slot))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown info topic %q", args[0])
+	}
+}
+
+func (s *Session) cmdRun(args []string) error {
+	argv := make([]int32, 0, len(args))
+	for _, a := range args {
+		n, err := strconv.ParseInt(a, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid argument %q", a)
+		}
+		argv = append(argv, int32(n))
+	}
+	m, err := tac.NewMachine(s.mod, s.opts)
+	if err != nil {
+		return err
+	}
+	s.m = m
+	s.lastLine = nil
+	if err := m.Start(s.entry, argv); err != nil {
+		fmt.Fprintf(s.out, "program failed: %v\n", err)
+		return nil
+	}
+	if s.reportFinished() {
+		return nil
+	}
+	if bp, ok := s.breakpointHit(); ok {
+		s.reportStop(fmt.Sprintf("breakpoint %d", bp.id))
+		return nil
+	}
+	return s.resume(nil)
+}
+
+// resume steps program until it finishes, fails, hits breakpoint or stop reports true.
+func (s *Session) resume(stop func() bool) error {
+	if s.m == nil {
+		return fmt.Errorf("program is not running, use run")
+	}
+	if s.m.Done() || s.m.Err() != nil {
+		return fmt.Errorf("program is not running, use run")
+	}
+	for {
+		s.recordLine()
+		if err := s.m.Step(); err != nil {
+			s.reportFailure(err)
+			return nil
+		}
+		if s.reportFinished() {
+			return nil
+		}
+		if bp, ok := s.breakpointHit(); ok {
+			s.reportStop(fmt.Sprintf("breakpoint %d", bp.id))
+			return nil
+		}
+		if stop != nil && stop() {
+			s.reportStop("")
+			return nil
+		}
+	}
+}
+
+// stepDone returns stop condition of step and next: reaching new source line,
+// for next only in the same or outer frame. Without line info it steps single instructions.
+func (s *Session) stepDone(over bool) func() bool {
+	if s.m == nil {
+		return nil
+	}
+	start, ok := s.m.Location()
+	if !ok || !start.Instruction.Pos.IsValid() {
+		return func() bool { return true }
+	}
+	return func() bool {
+		loc, _ := s.m.Location()
+		if over && loc.Depth > start.Depth {
+			return false
+		}
+		return s.onNewLine()
+	}
+}
+
+// recordLine remembers line of instruction about to execute, for its frame.
+func (s *Session) recordLine() {
+	loc, _ := s.m.Location()
+	for len(s.lastLine) <= loc.Depth {
+		s.lastLine = append(s.lastLine, 0)
+	}
+	s.lastLine = s.lastLine[:loc.Depth+1]
+	s.lastLine[loc.Depth] = loc.Instruction.Pos.Line
+}
+
+// onNewLine reports if current instruction starts source line in its frame.
+func (s *Session) onNewLine() bool {
+	loc, _ := s.m.Location()
+	line := loc.Instruction.Pos.Line
+	if line == 0 {
+		return false
+	}
+	if loc.Index == 0 || loc.Depth >= len(s.lastLine) {
+		return true
+	}
+	return s.lastLine[loc.Depth] != line
+}
+
+func (s *Session) breakpointHit() (breakpoint, bool) {
+	top, ok := s.m.Location()
+	if !ok {
+		return breakpoint{}, false
+	}
+	for _, bp := range s.breakpoints {
+		switch {
+		case bp.line > 0:
+			pos := top.Instruction.Pos
+			if pos.Line == bp.line && sameFile(pos.File, bp.file) && s.onNewLine() {
+				return bp, true
+			}
+		case bp.label != "":
+			inst := top.Instruction
+			if top.Function == bp.function && inst.Kind == tac.InstructionLabel && inst.Label == bp.label {
+				return bp, true
+			}
+		default:
+			if top.Function == bp.function && top.Index == 0 {
+				return bp, true
+			}
+		}
+	}
+	return breakpoint{}, false
+}
+
+func (s *Session) reportStop(reason string) {
+	top, _ := s.m.Location()
+	if reason != "" {
+		fmt.Fprintf(s.out, "%s, ", reason)
+	}
+	fmt.Fprintf(s.out, "stopped at %s\n", formatLocation(top))
+}
+
+func (s *Session) reportFinished() bool {
+	if s.m.Err() != nil {
+		s.reportFailure(s.m.Err())
+		return true
+	}
+	if !s.m.Done() {
+		return false
+	}
+	ret, err := s.m.Result()
+	if err != nil {
+		s.reportFailure(err)
+		return true
+	}
+	fmt.Fprintf(s.out, "%s returned %d after %d steps\n", s.entry, ret, s.m.Steps())
+	return true
+}
+
+func (s *Session) reportFailure(err error) {
+	var rt *tac.RuntimeError
+	if errors.As(err, &rt) {
+		// location is printed below
+		err = rt.Err
+	}
+	fmt.Fprintf(s.out, "program failed: %v\n", err)
+	if loc, ok := s.m.Location(); ok {
+		fmt.Fprintf(s.out, "at %s\n", formatLocation(loc))
+	}
+}
+
+func (s *Session) cmdPrint(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: print NAME")
+	}
+	frame, err := s.current()
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	if !strings.HasPrefix(name, "%") {
+		name = "%" + name
+	}
+	for _, v := range frame.Values {
+		if v.Name == name {
+			fmt.Fprintf(s.out, "%s = %s\n", v.Name, v)
+			return nil
+		}
+	}
+	for _, slot := range frame.Slots {
+		if slot.Name == name {
+			fmt.Fprintln(s.out, formatSlot(slot))
+			return nil
+		}
+	}
+	return fmt.Errorf("no value %s in %s", name, frame.Function)
+}
+
+func (s *Session) cmdBacktrace() error {
+	if _, err := s.current(); err != nil {
+		return err
+	}
+	frames := s.m.Frames()
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		loc := tac.Location{Function: f.Function, Index: f.Index, Depth: i, Instruction: f.Instruction}
+		fmt.Fprintf(s.out, "#%d %s\n", len(frames)-1-i, formatLocation(loc))
+	}
+	return nil
+}
+
+func (s *Session) cmdList() error {
+	frame, err := s.current()
+	if err != nil {
+		return err
+	}
+	fn, _ := s.function(frame.Function)
+	from, to := max(frame.Index-3, 0), min(frame.Index+4, len(fn.Instructions))
+	for i := from; i < to; i++ {
+		marker := "  "
+		if i == frame.Index {
+			marker = "=>"
+		}
+		fmt.Fprintf(s.out, "%s %4d  %s\n", marker, i, formatInstruction(fn.Instructions[i]))
+	}
+	return nil
+}
+
+func (s *Session) current() (tac.Frame, error) {
+	if s.m == nil {
+		return tac.Frame{}, fmt.Errorf("program is not running, use run")
+	}
+	frames := s.m.Frames()
+	if len(frames) == 0 {
+		return tac.Frame{}, fmt.Errorf("program is not running, use run")
+	}
+	return frames[len(frames)-1], nil
+}
+
+func (s *Session) function(name string) (tac.Function, bool) {
+	for _, fn := range s.mod.Functions {
+		if fn.Name == name {
+			return fn, true
+		}
+	}
+	return tac.Function{}, false
+}
+
+func hasLabel(fn tac.Function, label string) bool {
+	for _, inst := range fn.Instructions {
+		if inst.Kind == tac.InstructionLabel && inst.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+func isLineSpec(arg string) bool {
+	last := arg[strings.LastIndex(arg, ":")+1:]
+	_, err := strconv.Atoi(last)
+	return err == nil
+}
+
+// sameFile reports if source file name, as lexer shows it, is file of breakpoint,
+// given as path or its trailing part like name of header. Breakpoint without
+// file, or position without one, e.g. of single file lexer, match any file.
+func sameFile(name, file string) bool {
+	if name == "" || file == "" {
+		return true
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	return name == file || strings.HasSuffix(name, "/"+file)
+}
+
+func symbol(name string) string {
+	if strings.HasPrefix(name, "@") {
+		return name
+	}
+	return "@" + name
+}
+
+func formatLocation(f tac.Location) string {
+	loc := fmt.Sprintf("%s#%d", f.Function, f.Index)
+	if f.Instruction.Pos.IsValid() {
+		loc += fmt.Sprintf(" line %d", f.Instruction.Pos.Line)
+	}
+	return loc + ": " + formatInstruction(f.Instruction)
+}
+
+func formatSlot(slot tac.Slot) string {
+	if !slot.Initialized {
+		return fmt.Sprintf("%s = %#x (%s) -> <uninitialized>", slot.Name, slot.Address, slot.Type)
+	}
+	return fmt.Sprintf("%s = %#x (%s) -> %s", slot.Name, slot.Address, slot.Type, slot.Value)
+}
+
+func formatInstruction(inst tac.Instruction) string {
+	text, err := tac.FormatInstruction(inst)
+	if err != nil {
+		return "?"
+	}
+	return text
+}
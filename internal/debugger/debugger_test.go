@@ -0,0 +1,210 @@
+package debugger_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/SQLek/wihajster/internal/debugger"
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+	"github.com/SQLek/wihajster/internal/sema"
+	"github.com/SQLek/wihajster/internal/tac"
+)
+
+const program = `int twice(int v) {
+	int r = v + v;
+	return r;
+}
+int main() {
+	int x = 20;
+	int y = twice(x);
+	return y + 2;
+}
+`
+
+func TestSession_BreakOnLineAndInspect(t *testing.T) {
+	out := runSession(t, program, `
+break 7
+run
+print x
+locals
+stepi
+print %s4
+step
+bt
+next
+print %s1
+continue
+`)
+
+	for _, want := range []string{
+		"breakpoint 1 at line 7",
+		"breakpoint 1, stopped at @main#3 line 7: %s4 = alloca i32",
+		"error: no value %x in @main",
+		"%t2 = 20\n%s1 = 0x8000fffc (i32) -> 20\n",
+		"stopped at @main#4 line 7: %t5 = load %s1",
+		"%s4 = 0x8000fff8 (i32) -> <uninitialized>",
+		"stopped at @twice#0 line 1: %s1 = alloca i32",
+		"#0 @twice#0 line 1: %s1 = alloca i32\n#1 @main#5 line 7: %t6 = call @twice(%t5)",
+		"stopped at @twice#2 line 2: %s3 = alloca i32",
+		"%s1 = 0x8000fff4 (i32) -> 20",
+		"@main returned 42 after 20 steps",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestSession_BreakOnFunctionAndLabel(t *testing.T) {
+	src := `int abs(int v) {
+	if (v < 0) {
+		return -v;
+	}
+	return v;
+}
+int main() {
+	int a = abs(-40);
+	return a + 2;
+}
+`
+	out := runSession(t, src, `
+break abs
+break @abs .L0
+info breakpoints
+run
+continue
+next
+next
+delete 1
+delete 7
+continue
+`)
+
+	for _, want := range []string{
+		"breakpoint 1 at @abs",
+		"breakpoint 2 at @abs .L0",
+		"1\t@abs\n2\t@abs .L0",
+		"breakpoint 1, stopped at @abs#0 line 1: %s1 = alloca i32",
+		"breakpoint 2, stopped at @abs#6 line 2: .L0:",
+		"stopped at @abs#7 line 3: %t5 = load %s1",
+		"stopped at @main#5 line 9: %t5 = load %s1",
+		"error: no breakpoint 7",
+		"@main returned 42 after",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestSession_ReportsRuntimeFailure(t *testing.T) {
+	out := runSession(t, "int main() {\n\tint *p = (int *)0;\n\treturn *p;\n}\n", "run\ncontinue\n")
+
+	for _, want := range []string{
+		"program failed: memory fault: load of 4 bytes at 0x0: unmapped address",
+		"at @main#",
+		"error: program is not running, use run",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestSession_RejectsUnknownBreakpoints(t *testing.T) {
+	out := runSession(t, program, "break nope\nbreak main .L9\nfrobnicate\n")
+
+	for _, want := range []string{
+		"error: no function @nope",
+		"error: no label .L9 in @main",
+		`error: unknown command "frobnicate", try help`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestSession_BreakOnLineOfFile(t *testing.T) {
+	mod := compileFS(t, fstest.MapFS{
+		"inc/hh.h": {Data: []byte("int helper(int v) {\n\tint r = v + 1;\n\treturn r;\n}\n")},
+		"main.c":   {Data: []byte("#include \"inc/hh.h\"\nint main() {\n\tint x = helper(1);\n\treturn x;\n}\n")},
+	}, "main.c")
+	var out strings.Builder
+	s := debugger.New(mod, "", tac.EvalOptions{}, &out)
+	if err := s.Run(strings.NewReader("break hh.h:3\nbreak ./main.c:3\nrun\ncontinue\ncontinue\n")); err != nil {
+		t.Fatalf("run session: %v", err)
+	}
+
+	// main.c:3 runs first, breakpoint of header is hit only in helper
+	for _, want := range []string{
+		"breakpoint 1 at hh.h:3",
+		"breakpoint 2 at main.c:3",
+		"breakpoint 2, stopped at @main#",
+		"breakpoint 1, stopped at @helper#",
+		"@main returned 2",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Index(out.String(), "breakpoint 2, stopped") > strings.Index(out.String(), "breakpoint 1, stopped") {
+		t.Fatalf("expected main.c:3 hit before hh.h:3, got:\n%s", out.String())
+	}
+}
+
+func runSession(t *testing.T, src, commands string) string {
+	t.Helper()
+	mod := compile(t, src)
+	var out strings.Builder
+	s := debugger.New(mod, "", tac.EvalOptions{}, &out)
+	if err := s.Run(strings.NewReader(commands)); err != nil {
+		t.Fatalf("run session: %v", err)
+	}
+	return out.String()
+}
+
+// compileFS compiles file name of fsys, so positions have file names.
+func compileFS(t *testing.T, fsys fstest.MapFS, name string) tac.Module {
+	t.Helper()
+	lex, err := lexer.NewLexerFS(fsys, name, lexer.Options{})
+	if err != nil {
+		t.Fatalf("open source: %v", err)
+	}
+	tu, err := parser.Parse(lex)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	mod, err := sema.Lower(tu)
+	if err != nil {
+		t.Fatalf("lower: %v", err)
+	}
+	return mod
+}
+
+func compile(t *testing.T, src string) tac.Module {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.c")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open source: %v", err)
+	}
+	defer f.Close()
+
+	tu, err := parser.Parse(lexer.NewLexer(f))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	mod, err := sema.Lower(tu)
+	if err != nil {
+		t.Fatalf("lower: %v", err)
+	}
+	return mod
+}
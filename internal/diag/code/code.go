@@ -0,0 +1,59 @@
+// Package code is registry of stable codes of diagnostics. Code names kind of
+// diagnostic independently of its wording, so tools and tests can match on it.
+//
+// Codes are letter of severity, E for errors and W for warnings, and four digits:
+// 01xx are codes of preprocessor, 02xx of parser and 03xx of semantic analysis.
+// Codes are never reused for other kind of diagnostic.
+package code
+
+import (
+	"slices"
+	"strings"
+)
+
+// Code is stable code of diagnostic, like E0307.
+type Code string
+
+// IsWarning reports if code is code of warning.
+func (c Code) IsWarning() bool {
+	return strings.HasPrefix(string(c), "W")
+}
+
+// Info describes diagnostic, for explain command.
+type Info struct {
+	Code Code
+	// Title is short description, like message of diagnostic without details.
+	Title string
+	// Flag is name of -W flag controlling warning, empty when there is none.
+	Flag string
+	// Text explains when diagnostic is reported and how to fix code.
+	Text string
+	// Rejected is source diagnostic is reported for, Accepted is the same fixed.
+	Rejected, Accepted string
+}
+
+// Lookup returns description of code, case of letter does not matter.
+func Lookup(name string) (Info, bool) {
+	i := slices.IndexFunc(registry, func(info Info) bool {
+		return strings.EqualFold(string(info.Code), name)
+	})
+	if i < 0 {
+		return Info{}, false
+	}
+	return registry[i], true
+}
+
+// ForFlag returns code of warning controlled by -Wname flag, empty when there is none.
+func ForFlag(name string) Code {
+	for _, info := range registry {
+		if info.Flag == name {
+			return info.Code
+		}
+	}
+	return ""
+}
+
+// All returns descriptions of all codes, ordered by code.
+func All() []Info {
+	return slices.Clone(registry)
+}
@@ -0,0 +1,96 @@
+package code_test
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/SQLek/wihajster/internal/diag"
+	"github.com/SQLek/wihajster/internal/diag/code"
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+	"github.com/SQLek/wihajster/internal/sema"
+)
+
+func TestRegistry(t *testing.T) {
+	format := regexp.MustCompile(`^[EW]0[1-3]\d\d$`)
+	infos := code.All()
+	if !slices.IsSortedFunc(infos, func(a, b code.Info) int { return cmp.Compare(a.Code, b.Code) }) {
+		t.Fatal("registry is not ordered by code")
+	}
+	for i, info := range infos {
+		if !format.MatchString(string(info.Code)) {
+			t.Errorf("invalid code %q", info.Code)
+		}
+		if i > 0 && infos[i-1].Code == info.Code {
+			t.Errorf("duplicate code %s", info.Code)
+		}
+		if info.Title == "" || info.Text == "" || info.Rejected == "" || info.Accepted == "" {
+			t.Errorf("%s is not fully described", info.Code)
+		}
+		if info.Flag != "" && !info.Code.IsWarning() {
+			t.Errorf("error %s has flag %s", info.Code, info.Flag)
+		}
+	}
+	for _, name := range append(sema.Warnings(), "unknown-pragmas") {
+		if code.ForFlag(name) == "" {
+			t.Errorf("warning %s has no code", name)
+		}
+	}
+	if info, ok := code.Lookup("e0307"); !ok || info.Code != code.UndeclaredIdentifier {
+		t.Errorf("lookup ignoring case failed, got %+v", info)
+	}
+}
+
+// TestExamples checks that rejected example of each code gives diagnostic with
+// it and accepted one compiles without it, so explain shows true examples.
+func TestExamples(t *testing.T) {
+	for _, info := range code.All() {
+		t.Run(string(info.Code), func(t *testing.T) {
+			if codes := compile(t, info.Rejected); !slices.Contains(codes, info.Code) {
+				t.Errorf("rejected example gives %v, expected %s", codes, info.Code)
+			}
+			for _, c := range compile(t, info.Accepted) {
+				if c == info.Code || !c.IsWarning() {
+					t.Errorf("accepted example gives %s", c)
+				}
+			}
+		})
+	}
+}
+
+// compile returns codes of diagnostics of src, with all warnings enabled.
+func compile(t *testing.T, src string) []code.Code {
+	t.Helper()
+	files := fstest.MapFS{
+		"main.c":   {Data: []byte(src)},
+		"config.h": {Data: []byte("#define CONFIG 1\n")},
+	}
+	lex, err := lexer.NewLexerFS(files, "main.c", lexer.Options{WarnUnknownPragmas: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lex.Close()
+	tu, err := parser.Parse(lex)
+	var warnings []sema.Warning
+	if err == nil {
+		all := map[string]bool{}
+		for _, name := range sema.Warnings() {
+			all[name] = true
+		}
+		_, warnings, err = sema.LowerOptions(tu, sema.Options{Warnings: all})
+	}
+	diags := diag.FromWarnings(lex.Warnings())
+	diags = append(diags, diag.FromSemaWarnings(warnings)...)
+	diags = append(diags, diag.FromError(err)...)
+	var codes []code.Code
+	for _, d := range diags {
+		if d.Code == "" {
+			t.Errorf("diagnostic without code: %s", d.Message)
+		}
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
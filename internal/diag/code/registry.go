@@ -0,0 +1,904 @@
+package code
+
+// Codes of preprocessor diagnostics.
+const (
+	InvalidDirective       Code = "E0101"
+	UnbalancedConditional  Code = "E0102"
+	InvalidCondition       Code = "E0103"
+	InvalidMacroDefinition Code = "E0104"
+	InvalidMacroInvocation Code = "E0105"
+	InvalidTokenPaste      Code = "E0106"
+	InvalidUndef           Code = "E0107"
+	IncludeFailed          Code = "E0108"
+	InvalidLineDirective   Code = "E0109"
+	ErrorDirective         Code = "E0110"
+	InvalidToken           Code = "E0111"
+	UnterminatedLiteral    Code = "E0112"
+	UnsupportedFloat       Code = "E0113"
+	UnsupportedEscape      Code = "E0114"
+	UnsupportedComment     Code = "E0115"
+
+	MacroRedefined   Code = "W0101"
+	UnknownPragma    Code = "W0102"
+	WarningDirective Code = "W0103"
+)
+
+// Codes of parser diagnostics.
+const (
+	ExpectedToken         Code = "E0201"
+	ExpectedExpression    Code = "E0202"
+	ExpectedType          Code = "E0203"
+	UnsupportedType       Code = "E0204"
+	UnsupportedDeclarator Code = "E0205"
+	VariadicFunction      Code = "E0206"
+	VoidObject            Code = "E0207"
+	UnsupportedStatement  Code = "E0208"
+	UnsupportedOperator   Code = "E0209"
+)
+
+// Codes of semantic analysis diagnostics.
+const (
+	GlobalDeclaration      Code = "E0301"
+	ConflictingDeclaration Code = "E0302"
+	Redefinition           Code = "E0303"
+	Redeclaration          Code = "E0304"
+	MissingReturn          Code = "E0305"
+	VoidReturnValue        Code = "E0306"
+	UndeclaredIdentifier   Code = "E0307"
+	UndeclaredFunction     Code = "E0308"
+	ArgumentCount          Code = "E0309"
+	IncompatibleTypes      Code = "E0310"
+	AssignToConst          Code = "E0311"
+	InvalidDereference     Code = "E0312"
+	VoidValue              Code = "E0313"
+	InvalidOperands        Code = "E0314"
+	InvalidLiteral         Code = "E0315"
+	Unsupported            Code = "E0316"
+
+	UnusedVariable        Code = "W0301"
+	UnusedParameter       Code = "W0302"
+	Shadow                Code = "W0303"
+	ImplicitIntConversion Code = "W0304"
+	TautologicalCompare   Code = "W0305"
+	UnusedValue           Code = "W0306"
+)
+
+// registry describes all codes, ordered by code. Examples are compiled by tests,
+// rejected one must give its code and accepted one no errors and not that code.
+var registry = []Info{
+	{
+		Code:  InvalidDirective,
+		Title: "invalid preprocessing directive",
+		Text: `Line starting with # must be one of directives the preprocessor knows:
+#include, #define, #undef, #if, #ifdef, #ifndef, #elif, #else, #endif, #line,
+#pragma, #error and #warning. Directive must be first on its line and # must be
+followed by its name.`,
+		Rejected: `#import "config.h"
+int main() {
+	return CONFIG;
+}
+`,
+		Accepted: `#include "config.h"
+int main() {
+	return CONFIG;
+}
+`,
+	},
+	{
+		Code:  UnbalancedConditional,
+		Title: "unbalanced conditional directive",
+		Text: `Every #if, #ifdef and #ifndef must be closed by #endif in the same file.
+#elif, #else and #endif need #if before them, and #else must be the last branch.`,
+		Rejected: `#ifdef DEBUG
+#define LEVEL 2
+#else
+#define LEVEL 0
+int main() {
+	return LEVEL;
+}
+`,
+		Accepted: `#ifdef DEBUG
+#define LEVEL 2
+#else
+#define LEVEL 0
+#endif
+int main() {
+	return LEVEL;
+}
+`,
+	},
+	{
+		Code:  InvalidCondition,
+		Title: "invalid condition of conditional directive",
+		Text: `#ifdef and #ifndef take exactly one macro name. #if and #elif take integer
+constant expression, made of integer and character constants, operators and
+defined(NAME). Identifiers that are not macros are 0.`,
+		Rejected: `#ifdef
+#endif
+int main() {
+	return 0;
+}
+`,
+		Accepted: `#ifdef DEBUG
+#endif
+int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  InvalidMacroDefinition,
+		Title: "invalid macro definition",
+		Text: `#define needs macro name, other than "defined". Parameters of function-like
+macro are distinct identifiers, optionally followed by ... in variadic macro, and
+only variadic macro can use __VA_ARGS__. In body # must be followed by parameter
+and ## can not be first or last token.`,
+		Rejected: `#define ADD(a, a) ((a) + (a))
+int main() {
+	return ADD(1, 2);
+}
+`,
+		Accepted: `#define ADD(a, b) ((a) + (b))
+int main() {
+	return ADD(1, 2);
+}
+`,
+	},
+	{
+		Code:  InvalidMacroInvocation,
+		Title: "invalid invocation of function-like macro",
+		Text: `Function-like macro must be given as many arguments as it has parameters, at
+least as many for variadic macro, and the argument list must be closed by ).`,
+		Rejected: `#define ADD(a, b) ((a) + (b))
+int main() {
+	return ADD(1);
+}
+`,
+		Accepted: `#define ADD(a, b) ((a) + (b))
+int main() {
+	return ADD(1, 0);
+}
+`,
+	},
+	{
+		Code:  InvalidTokenPaste,
+		Title: "pasting does not give valid token",
+		Text: `Operator ## joins two tokens into one, so the joined text must be single valid
+token, like identifier or number.`,
+		Rejected: `#define CAT(a, b) a ## b
+int main() {
+	return CAT(1, +);
+}
+`,
+		Accepted: `#define CAT(a, b) a ## b
+int main() {
+	return CAT(1, 0);
+}
+`,
+	},
+	{
+		Code:  InvalidUndef,
+		Title: "invalid #undef",
+		Text:  `#undef takes exactly one macro name, nothing can follow it.`,
+		Rejected: `#define DEBUG 1
+#undef DEBUG 1
+int main() {
+	return 0;
+}
+`,
+		Accepted: `#define DEBUG 1
+#undef DEBUG
+int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  IncludeFailed,
+		Title: "#include failed",
+		Text: `#include takes "file", searched first next to the including file, or <file>,
+searched in -I directories. The file must exist and be readable. Includes nest up
+to 64 levels. File included again while it is being included is include cycle,
+unless its first directive skips it, as include guard #ifndef does.`,
+		Rejected: `#include "missing.h"
+int main() {
+	return CONFIG;
+}
+`,
+		Accepted: `#include "config.h"
+int main() {
+	return CONFIG;
+}
+`,
+	},
+	{
+		Code:  InvalidLineDirective,
+		Title: "invalid #line",
+		Text: `#line takes line number between 1 and 2147483647, optionally followed by file
+name in quotes, after macro expansion.`,
+		Rejected: `#line 0
+int main() {
+	return 0;
+}
+`,
+		Accepted: `#line 10 "generated.c"
+int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  ErrorDirective,
+		Title: "#error directive",
+		Text: `#error stops compilation with its message. It usually guards against
+configuration the code does not support, fix the configuration it reports.`,
+		Rejected: `#ifndef TARGET
+#error TARGET must be defined
+#endif
+int main() {
+	return 0;
+}
+`,
+		Accepted: `#define TARGET 1
+#ifndef TARGET
+#error TARGET must be defined
+#endif
+int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  InvalidToken,
+		Title: "invalid token",
+		Text:  `Source contains characters that do not form any C token, like two dots.`,
+		Rejected: `int main() {
+	return 1 .. 2;
+}
+`,
+		Accepted: `int main() {
+	return 1;
+}
+`,
+	},
+	{
+		Code:  UnterminatedLiteral,
+		Title: "unterminated literal",
+		Text: `String literal or character constant must be closed by its quote on the same
+line. Literal can continue on next line after backslash ending the line.`,
+		Rejected: `int main() {
+	return 'a;
+}
+`,
+		Accepted: `int main() {
+	return 'a';
+}
+`,
+	},
+	{
+		Code:  UnsupportedFloat,
+		Title: "floating constant",
+		Text: `The v0 C subset has no floating types, so constants like 1.5 or 1e3 are
+rejected. Integer arithmetic, e.g. fixed point, can be used instead.`,
+		Rejected: `int main() {
+	return 1.5;
+}
+`,
+		Accepted: `int main() {
+	return 3 / 2;
+}
+`,
+	},
+	{
+		Code:  UnsupportedEscape,
+		Title: "unsupported escape sequence",
+		Text: `Character constants support escape sequences \', \\, \n, \t, \r and \0,
+string literals only \". Other escapes, like \x41, are not in the v0 C subset.`,
+		Rejected: `int main() {
+	return '\x41';
+}
+`,
+		Accepted: `int main() {
+	return 'A';
+}
+`,
+	},
+	{
+		Code:  UnsupportedComment,
+		Title: "block comment",
+		Text:  `Comments /* ... */ are not in the v0 C subset, // comments are.`,
+		Rejected: `/* exit status */
+int main() {
+	return 0;
+}
+`,
+		Accepted: `// exit status
+int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  ExpectedToken,
+		Title: "expected token",
+		Text: `Parser expected other token, like ; ending statement or ) closing
+parentheses. The error is at the token found instead, the missing one is
+usually just before it.`,
+		Rejected: `int main() {
+	return 0
+}
+`,
+		Accepted: `int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  ExpectedExpression,
+		Title: "expected expression",
+		Text:  `Operator or statement needs expression where other token is found.`,
+		Rejected: `int main() {
+	return 1 + ;
+}
+`,
+		Accepted: `int main() {
+	return 1 + 2;
+}
+`,
+	},
+	{
+		Code:  ExpectedType,
+		Title: "expected type specifier",
+		Text: `Declarations and parameters start with type, int, char or void, optionally
+qualified. Parameters without type of old style definitions are not supported.`,
+		Rejected: `int twice(x) {
+	return x + x;
+}
+`,
+		Accepted: `int twice(int x) {
+	return x + x;
+}
+`,
+	},
+	{
+		Code:  UnsupportedType,
+		Title: "unsupported type",
+		Text: `Supported subset has only int, char, void and pointers to them. struct, union,
+enum, float and double are not supported.`,
+		Rejected: `float half(float x) {
+	return x / 2;
+}
+`,
+		Accepted: `int half(int x) {
+	return x / 2;
+}
+`,
+	},
+	{
+		Code:  UnsupportedDeclarator,
+		Title: "unsupported declarator",
+		Text: `Declaration declares one variable of scalar or pointer type. Arrays, function
+pointers and many variables in one declaration are not supported.`,
+		Rejected: `int main() {
+	int a, b;
+	a = 1;
+	b = 2;
+	return a + b;
+}
+`,
+		Accepted: `int main() {
+	int a = 1;
+	int b = 2;
+	return a + b;
+}
+`,
+	},
+	{
+		Code:  VariadicFunction,
+		Title: "variadic function",
+		Text: `Functions have fixed number of parameters, ... in parameter list is not
+supported. Pass values through pointer instead.`,
+		Rejected: `int sum(int n, ...);
+`,
+		Accepted: `int sum(int n, int *values);
+`,
+	},
+	{
+		Code:  VoidObject,
+		Title: "object of void type",
+		Text: `Variables and parameters can not have void type, as void has no values.
+Pointer to void is allowed.`,
+		Rejected: `int main() {
+	void x;
+	return 0;
+}
+`,
+		Accepted: `int main() {
+	int x = 0;
+	void *p = &x;
+	return *(int *)p;
+}
+`,
+	},
+	{
+		Code:  UnsupportedStatement,
+		Title: "unsupported statement",
+		Text: `Supported statements are blocks, declarations, expressions, if, while, for and
+return. switch, goto, do-while, break and continue are not supported, loops end
+by their condition.`,
+		Rejected: `int main() {
+	int i = 0;
+	while (1) {
+		if (i == 10)
+			break;
+		i = i + 1;
+	}
+	return i;
+}
+`,
+		Accepted: `int main() {
+	int i = 0;
+	while (i != 10) {
+		i = i + 1;
+	}
+	return i;
+}
+`,
+	},
+	{
+		Code:  UnsupportedOperator,
+		Title: "unsupported operator",
+		Text: `Ternary, comma, compound assignment like += and increment and decrement
+operators are not supported. Write them with if and plain assignment.`,
+		Rejected: `int main() {
+	int x = 1;
+	x += 2;
+	return x;
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	x = x + 2;
+	return x;
+}
+`,
+	},
+	{
+		Code:  GlobalDeclaration,
+		Title: "global variable",
+		Text:  `Variables outside of functions are not supported, declare them in function.`,
+		Rejected: `int counter;
+int main() {
+	return counter;
+}
+`,
+		Accepted: `int main() {
+	int counter = 0;
+	return counter;
+}
+`,
+	},
+	{
+		Code:  ConflictingDeclaration,
+		Title: "conflicting declarations of function",
+		Text: `All prototypes and definition of function must have the same return and
+parameter types.`,
+		Rejected: `int twice(int x);
+int twice(char x) {
+	return x + x;
+}
+`,
+		Accepted: `int twice(int x);
+int twice(int x) {
+	return x + x;
+}
+`,
+	},
+	{
+		Code:  Redefinition,
+		Title: "function defined multiple times",
+		Text:  `Function can be declared many times, but has only one definition.`,
+		Rejected: `int one() {
+	return 1;
+}
+int one() {
+	return 1;
+}
+`,
+		Accepted: `int one();
+int one() {
+	return 1;
+}
+`,
+	},
+	{
+		Code:  Redeclaration,
+		Title: "identifier redeclared",
+		Text: `Names of parameters and variables declared in one block must differ.
+Variable of inner block can hide one of outer block.`,
+		Rejected: `int main() {
+	int x = 1;
+	int x = 2;
+	return x;
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	x = 2;
+	return x;
+}
+`,
+	},
+	{
+		Code:  MissingReturn,
+		Title: "missing return value",
+		Text: `Function with non-void return type must return value on every path through
+its body, by return with expression.`,
+		Rejected: `int sign(int x) {
+	if (x < 0)
+		return -1;
+}
+`,
+		Accepted: `int sign(int x) {
+	if (x < 0)
+		return -1;
+	return 1;
+}
+`,
+	},
+	{
+		Code:  VoidReturnValue,
+		Title: "void function returns value",
+		Text:  `Function returning void can only use return without expression.`,
+		Rejected: `void check(int *p) {
+	*p = 1;
+	return 1;
+}
+`,
+		Accepted: `void check(int *p) {
+	*p = 1;
+	return;
+}
+`,
+	},
+	{
+		Code:  UndeclaredIdentifier,
+		Title: "use of undeclared identifier",
+		Text: `Variable must be declared before it is used, in the same block or one
+enclosing it.`,
+		Rejected: `int main() {
+	return count;
+}
+`,
+		Accepted: `int main() {
+	int count = 0;
+	return count;
+}
+`,
+	},
+	{
+		Code:  UndeclaredFunction,
+		Title: "call to undeclared function",
+		Text: `Called function must be declared by prototype or defined in the same file.
+Builtins like putchar and malloc are declared implicitly.`,
+		Rejected: `int main() {
+	return twice(2);
+}
+`,
+		Accepted: `int twice(int x) {
+	return x + x;
+}
+int main() {
+	return twice(2);
+}
+`,
+	},
+	{
+		Code:  ArgumentCount,
+		Title: "wrong number of arguments",
+		Text:  `Function is called with as many arguments as it has parameters.`,
+		Rejected: `int add(int a, int b) {
+	return a + b;
+}
+int main() {
+	return add(1);
+}
+`,
+		Accepted: `int add(int a, int b) {
+	return a + b;
+}
+int main() {
+	return add(1, 0);
+}
+`,
+	},
+	{
+		Code:  IncompatibleTypes,
+		Title: "incompatible types",
+		Text: `Value assigned, used to initialize variable, passed as argument or returned
+must have type convertible to type of its destination. Integer types convert to
+each other, pointers only to pointers to the same type with the same or more
+qualifiers, or to and from void pointer. Use cast to convert between integer and
+pointer.`,
+		Rejected: `int main() {
+	int x = 1;
+	int *p = x;
+	return *p;
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	int *p = &x;
+	return *p;
+}
+`,
+	},
+	{
+		Code:  AssignToConst,
+		Title: "assignment to const object",
+		Text:  `Object qualified with const can only be initialized, not assigned.`,
+		Rejected: `int main() {
+	const int limit = 10;
+	limit = 20;
+	return limit;
+}
+`,
+		Accepted: `int main() {
+	int limit = 10;
+	limit = 20;
+	return limit;
+}
+`,
+	},
+	{
+		Code:  InvalidDereference,
+		Title: "invalid dereference",
+		Text: `Operator * needs pointer to object type. Pointer to void must be cast to
+pointer to the type of object first.`,
+		Rejected: `int main() {
+	int x = 1;
+	void *p = &x;
+	return *p;
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	void *p = &x;
+	return *(int *)p;
+}
+`,
+	},
+	{
+		Code:  VoidValue,
+		Title: "use of void value",
+		Text: `Call of function returning void has no value, it can not be operand,
+condition or cast to other type than void.`,
+		Rejected: `void reset(int *p) {
+	*p = 0;
+}
+int main() {
+	int x = 1;
+	return reset(&x) + x;
+}
+`,
+		Accepted: `void reset(int *p) {
+	*p = 0;
+}
+int main() {
+	int x = 1;
+	reset(&x);
+	return x;
+}
+`,
+	},
+	{
+		Code:  InvalidOperands,
+		Title: "invalid operands",
+		Text: `Pointers can only be compared, subtracted when they point to the same type and
+offset by integer, other operators need integer operands. Arithmetic on pointer
+to void is not allowed.`,
+		Rejected: `int main() {
+	int x = 1;
+	int *p = &x;
+	int *q = &x;
+	return p + q;
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	int *p = &x;
+	int *q = &x;
+	return p - q;
+}
+`,
+	},
+	{
+		Code:  InvalidLiteral,
+		Title: "invalid literal",
+		Text: `Decimal integer constants must fit in int. Octal and hexadecimal ones must fit
+in 32 bits, from 0x80000000 up they wrap to negative int. Character constants
+hold one character or one of escapes \n, \t, \r, \0, \\ and \'.`,
+		Rejected: `int main() {
+	return 'ab';
+}
+`,
+		Accepted: `int main() {
+	return 'a';
+}
+`,
+	},
+	{
+		Code:  Unsupported,
+		Title: "unsupported construct",
+		Text: `Construct is valid C, but not in the supported subset. For example only
+variables and dereferenced pointers can be assigned to.`,
+		Rejected: `int main() {
+	int x = 1;
+	x + 1 = 2;
+	return x;
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	x = 2;
+	return x;
+}
+`,
+	},
+	{
+		Code:  MacroRedefined,
+		Title: "macro redefined",
+		Text: `Macro is defined again with other body or parameters, the new definition is
+used. Identical redefinition is allowed. Use #undef before redefining macro on
+purpose.`,
+		Rejected: `#define SIZE 4
+#define SIZE 8
+int main() {
+	return SIZE;
+}
+`,
+		Accepted: `#define SIZE 4
+#undef SIZE
+#define SIZE 8
+int main() {
+	return SIZE;
+}
+`,
+	},
+	{
+		Code:  UnknownPragma,
+		Title: "unknown pragma ignored",
+		Flag:  "unknown-pragmas",
+		Text:  `Only #pragma once is supported, other pragmas are ignored.`,
+		Rejected: `#pragma pack(1)
+int main() {
+	return 0;
+}
+`,
+		Accepted: `#pragma once
+int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  WarningDirective,
+		Title: "#warning directive",
+		Text: `#warning reports its message and compilation continues. Remove it when
+the problem it reports is solved.`,
+		Rejected: `#warning not tested on this target
+int main() {
+	return 0;
+}
+`,
+		Accepted: `int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  UnusedVariable,
+		Title: "unused variable",
+		Flag:  "unused-variable",
+		Text:  `Variable is declared but never used, remove it.`,
+		Rejected: `int main() {
+	int unused = 1;
+	return 0;
+}
+`,
+		Accepted: `int main() {
+	return 0;
+}
+`,
+	},
+	{
+		Code:  UnusedParameter,
+		Title: "unused parameter",
+		Flag:  "unused-parameter",
+		Text: `Parameter is never used. Cast it to void to mark it unused on purpose, like
+when function must match other signature.`,
+		Rejected: `int handler(int event) {
+	return 0;
+}
+`,
+		Accepted: `int handler(int event) {
+	(void)event;
+	return 0;
+}
+`,
+	},
+	{
+		Code:  Shadow,
+		Title: "declaration shadows other",
+		Flag:  "shadow",
+		Text: `Variable hides variable or parameter of the same name in outer block, uses
+in inner block refer to the new one.`,
+		Rejected: `int main() {
+	int x = 1;
+	{
+		int x = 2;
+		return x;
+	}
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	{
+		int y = 2;
+		return x + y;
+	}
+}
+`,
+	},
+	{
+		Code:  ImplicitIntConversion,
+		Title: "implicit conversion may change value",
+		Flag:  "implicit-int-conversion",
+		Text: `Value of int is stored in char without cast, values outside of -128..127
+change. Cast value when it is known to fit.`,
+		Rejected: `char low(int x) {
+	return x;
+}
+`,
+		Accepted: `char low(int x) {
+	return (char)x;
+}
+`,
+	},
+	{
+		Code:  TautologicalCompare,
+		Title: "comparison is always true or false",
+		Flag:  "tautological-compare",
+		Text: `Comparison has the same result for all values, like comparison of variable
+with itself or of char with constant out of its range.`,
+		Rejected: `int main() {
+	char c = 'a';
+	return c < 200;
+}
+`,
+		Accepted: `int main() {
+	char c = 'a';
+	return c < 100;
+}
+`,
+	},
+	{
+		Code:  UnusedValue,
+		Title: "statement with no effect",
+		Flag:  "unused-value",
+		Text: `Expression statement computes value and throws it away, it probably misses
+assignment or call. Cast it to void to evaluate it on purpose.`,
+		Rejected: `int main() {
+	int x = 1;
+	x + 1;
+	return x;
+}
+`,
+		Accepted: `int main() {
+	int x = 1;
+	x = x + 1;
+	return x;
+}
+`,
+	},
+}
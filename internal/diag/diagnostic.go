@@ -0,0 +1,206 @@
+// Package diag collects diagnostics of compiler phases and prints them
+// as text with source excerpts, as JSON or as SARIF.
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+	"github.com/SQLek/wihajster/internal/sema"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is message about source position. File, Line and Column are as #line
+// sets them, Span is range in file as read. Diagnostic of error without position,
+// like failed read, has only Severity and Message.
+type Diagnostic struct {
+	Severity Severity
+	// Code is stable code of diagnostic, see package code. Notes and errors
+	// without position, like failed read, have none.
+	Code         code.Code
+	File         string
+	Line, Column int
+	Span         lexer.Span
+	Message      string
+	// Flag is flag controlling diagnostic, like -Wshadow, shown after message.
+	Flag string
+	// Notes explain primary diagnostic, they have SeverityNote.
+	Notes []Diagnostic
+}
+
+// Position is file:line:col of diagnostic, empty when it has none.
+func (d Diagnostic) Position() string {
+	if d.Line <= 0 {
+		return ""
+	}
+	return lexer.Position(d.File, d.Line, d.Column)
+}
+
+// FromError converts error of lexer, parser or sema to diagnostics, all of them
+// when error carries many. Other errors are diagnostics without position.
+func FromError(err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+	var (
+		parseErrs *parser.ParseErrors
+		parseErr  *parser.Error
+		semaErrs  *sema.Errors
+		semaErr   *sema.Error
+		lexErr    *lexer.Error
+	)
+	switch {
+	case errors.As(err, &parseErrs):
+		var diags []Diagnostic
+		for _, e := range parseErrs.Diagnostics {
+			diags = append(diags, FromError(e)...)
+		}
+		if parseErrs.FatalLexer != nil {
+			diags = append(diags, FromError(parseErrs.FatalLexer)...)
+		}
+		if len(diags) == 0 {
+			diags = append(diags, Diagnostic{Severity: SeverityError, Message: parseErrs.Error()})
+		}
+		return diags
+	case errors.As(err, &parseErr):
+		return []Diagnostic{newDiagnostic(SeverityError, parseErr.Code, parseErr.File, parseErr.Line, parseErr.Column, parseErr.Span, parseErr.Message, parseErr.Notes)}
+	case errors.As(err, &semaErrs):
+		var diags []Diagnostic
+		for _, e := range semaErrs.Diagnostics {
+			diags = append(diags, FromError(e)...)
+		}
+		if semaErrs.Limit > 0 {
+			diags = append(diags, tooManyErrors(semaErrs.Limit))
+		}
+		return diags
+	case errors.As(err, &semaErr):
+		return []Diagnostic{newDiagnostic(SeverityError, semaErr.Code, semaErr.File, semaErr.Line, semaErr.Column, semaErr.Span, semaErr.Message, semaErr.Notes)}
+	case errors.As(err, &lexErr):
+		return []Diagnostic{newDiagnostic(SeverityError, lexErr.Code, lexErr.File, lexErr.Line, lexErr.Column, lexErr.Span, lexErr.Msg, lexErr.Notes)}
+	}
+	return []Diagnostic{{Severity: SeverityError, Message: err.Error()}}
+}
+
+// FromWarnings converts preprocessor warnings to diagnostics, with flag of
+// warnings that have one.
+func FromWarnings(warnings []lexer.Warning) []Diagnostic {
+	diags := make([]Diagnostic, 0, len(warnings))
+	for _, w := range warnings {
+		d := newDiagnostic(SeverityWarning, w.Code, w.File, w.Line, w.Column, w.Span, w.Msg, w.Notes)
+		if info, ok := code.Lookup(string(w.Code)); ok && info.Flag != "" {
+			d.Flag = "-W" + info.Flag
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// FromSemaWarnings converts warnings of semantic analysis to diagnostics.
+func FromSemaWarnings(warnings []sema.Warning) []Diagnostic {
+	diags := make([]Diagnostic, 0, len(warnings))
+	for _, w := range warnings {
+		d := newDiagnostic(SeverityWarning, w.Code, w.File, w.Line, w.Column, w.Span, w.Message, w.Notes)
+		d.Flag = "-W" + w.Name
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// Werror turns warnings into errors, as -Werror does.
+func Werror(diags []Diagnostic) {
+	for i, d := range diags {
+		if d.Severity != SeverityWarning {
+			continue
+		}
+		diags[i].Severity = SeverityError
+		diags[i].Flag = strings.TrimSuffix("-Werror,"+d.Flag, ",")
+	}
+}
+
+// Limit drops diagnostics from error after first n of them, as -error-limit does,
+// and ends diagnostics with error telling the rest is not shown. Zero n means no limit.
+func Limit(diags []Diagnostic, n int) []Diagnostic {
+	if n <= 0 {
+		return diags
+	}
+	errs := 0
+	for i, d := range diags {
+		if d.Severity != SeverityError {
+			continue
+		}
+		if errs == n {
+			return append(slices.Clip(diags[:i]), tooManyErrors(n))
+		}
+		errs++
+	}
+	return diags
+}
+
+func tooManyErrors(limit int) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityError,
+		Message:  "too many errors emitted, stopping now",
+		Flag:     fmt.Sprintf("-error-limit=%d", limit),
+	}
+}
+
+func newDiagnostic(severity Severity, c code.Code, file string, line, column int, span lexer.Span, msg string, notes []lexer.Note) Diagnostic {
+	d := Diagnostic{
+		Severity: severity,
+		Code:     c,
+		File:     file,
+		Line:     line,
+		Column:   column,
+		Span:     span,
+		Message:  msg,
+	}
+	for _, n := range notes {
+		d.Notes = append(d.Notes, Diagnostic{
+			Severity: SeverityNote,
+			File:     n.File,
+			Line:     n.Line,
+			Column:   n.Column,
+			Span:     n.Span,
+			Message:  n.Message,
+		})
+	}
+	return d
+}
+
+// Count returns number of errors and warnings, notes are not counted.
+func Count(diags []Diagnostic) (errs, warnings int) {
+	for _, d := range diags {
+		switch d.Severity {
+		case SeverityError:
+			errs++
+		case SeverityWarning:
+			warnings++
+		}
+	}
+	return errs, warnings
+}
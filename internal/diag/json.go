@@ -0,0 +1,61 @@
+package diag
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonReport struct {
+	Diagnostics []jsonDiagnostic `json:"diagnostics"`
+	Errors      int              `json:"errors"`
+	Warnings    int              `json:"warnings"`
+}
+
+type jsonDiagnostic struct {
+	Severity string           `json:"severity"`
+	Code     string           `json:"code,omitempty"`
+	File     string           `json:"file,omitempty"`
+	Line     int              `json:"line,omitempty"`
+	Column   int              `json:"column,omitempty"`
+	Span     *jsonSpan        `json:"span,omitempty"`
+	Message  string           `json:"message"`
+	Flag     string           `json:"flag,omitempty"`
+	Notes    []jsonDiagnostic `json:"notes,omitempty"`
+}
+
+// jsonSpan is byte range in file as read, independent of #line.
+type jsonSpan struct {
+	File  string `json:"file"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+func (p *Printer) printJSON(w io.Writer, diags []Diagnostic) error {
+	report := jsonReport{Diagnostics: []jsonDiagnostic{}}
+	report.Errors, report.Warnings = Count(diags)
+	for _, d := range diags {
+		report.Diagnostics = append(report.Diagnostics, toJSON(d))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func toJSON(d Diagnostic) jsonDiagnostic {
+	jd := jsonDiagnostic{
+		Severity: d.Severity.String(),
+		Code:     string(d.Code),
+		File:     d.File,
+		Line:     d.Line,
+		Column:   d.Column,
+		Message:  d.Message,
+		Flag:     d.Flag,
+	}
+	if d.Span.File != "" {
+		jd.Span = &jsonSpan{File: d.Span.File, Start: d.Span.Start, End: d.Span.End}
+	}
+	for _, note := range d.Notes {
+		jd.Notes = append(jd.Notes, toJSON(note))
+	}
+	return jd
+}
@@ -0,0 +1,216 @@
+package diag
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// Format is how diagnostics are printed.
+type Format string
+
+const (
+	FormatText  Format = "text"
+	FormatJSON  Format = "json"
+	FormatSARIF Format = "sarif"
+)
+
+// Formats returns names of formats, text first.
+func Formats() []string {
+	return []string{string(FormatText), string(FormatJSON), string(FormatSARIF)}
+}
+
+// ParseFormat returns format of name, empty name is text.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case "":
+		return FormatText, nil
+	case FormatText, FormatJSON, FormatSARIF:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown diagnostics format %q, known are %s", name, strings.Join(Formats(), ", "))
+}
+
+// Printer prints diagnostics in format. Text is printed only when there are
+// diagnostics, JSON and SARIF always, so their consumers get valid document.
+type Printer struct {
+	Format Format
+	// Files has sources of diagnostics, by names spans have, for excerpts. Without it
+	// text has no excerpts and SARIF no end columns.
+	Files fs.FS
+	// Root is URI of directory file names are relative to, used by SARIF.
+	Root string
+
+	sources map[string][]byte
+}
+
+func (p *Printer) Print(w io.Writer, diags []Diagnostic) error {
+	switch p.Format {
+	case FormatJSON:
+		return p.printJSON(w, diags)
+	case FormatSARIF:
+		return p.printSARIF(w, diags)
+	}
+	return p.printText(w, diags)
+}
+
+func (p *Printer) printText(w io.Writer, diags []Diagnostic) error {
+	bw := bufio.NewWriter(w)
+	for _, d := range diags {
+		p.writeText(bw, d)
+		for _, note := range d.Notes {
+			p.writeText(bw, note)
+		}
+	}
+	if summary := Summary(diags); summary != "" {
+		fmt.Fprintln(bw, summary)
+	}
+	return bw.Flush()
+}
+
+// writeText writes diagnostic like compilers do:
+//
+//	main.c:3:9: error[E0307]: use of undeclared identifier y
+//	    3 | 	return y;
+//	      | 	       ^
+func (p *Printer) writeText(w *bufio.Writer, d Diagnostic) {
+	if pos := d.Position(); pos != "" {
+		fmt.Fprintf(w, "%s: ", pos)
+	}
+	w.WriteString(d.Severity.String())
+	if d.Code != "" {
+		fmt.Fprintf(w, "[%s]", d.Code)
+	}
+	fmt.Fprintf(w, ": %s", d.Message)
+	if d.Flag != "" {
+		fmt.Fprintf(w, " [%s]", d.Flag)
+	}
+	w.WriteByte('\n')
+	ex, ok := p.excerpt(d)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(w, "%5d | %s\n", ex.line, ex.text)
+	// tabs are kept, so marker is under the same columns whatever tab width is
+	marker := []byte(ex.text[:ex.start])
+	for i, b := range marker {
+		if b != '\t' {
+			marker[i] = ' '
+		}
+	}
+	fmt.Fprintf(w, "      | %s^%s\n", marker, strings.Repeat("~", ex.end-ex.start-1))
+}
+
+// Summary counts errors and warnings like "2 errors and 1 warning generated.",
+// it is empty when there are none.
+func Summary(diags []Diagnostic) string {
+	errs, warnings := Count(diags)
+	var parts []string
+	if errs > 0 {
+		parts = append(parts, plural(errs, "error"))
+	}
+	if warnings > 0 {
+		parts = append(parts, plural(warnings, "warning"))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, " and ") + " generated."
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// excerpt is source line diagnostic is at, with byte range of text to underline.
+type excerpt struct {
+	line       int
+	text       string
+	start, end int
+	// fromSpan reports if range is span of diagnostic, not just its column
+	fromSpan bool
+}
+
+// excerpt finds line of diagnostic by span, as it is independent of #line,
+// or by position for diagnostics without one. Line is numbered as position
+// of diagnostic is, so after #line it is presumed line, not line in file.
+func (p *Printer) excerpt(d Diagnostic) (excerpt, bool) {
+	if d.Span.File != "" && d.Span.End > d.Span.Start {
+		src, ok := p.source(d.Span.File)
+		if !ok || d.Span.End > len(src) {
+			return excerpt{}, false
+		}
+		lineStart := bytes.LastIndexByte(src[:d.Span.Start], '\n') + 1
+		lineEnd := d.Span.Start + lineLength(src[d.Span.Start:])
+		ex := excerpt{
+			line:     bytes.Count(src[:lineStart], []byte{'\n'}) + 1,
+			text:     string(src[lineStart:lineEnd]),
+			start:    d.Span.Start - lineStart,
+			end:      max(min(d.Span.End, lineEnd), d.Span.Start+1) - lineStart,
+			fromSpan: true,
+		}
+		// span starting at column of diagnostic is of its token, so they are on the same line
+		if d.Line > 0 && d.Column == ex.start+1 {
+			ex.line = d.Line
+		}
+		return ex, true
+	}
+
+	if d.File == "" || d.Line <= 0 || d.Column <= 0 {
+		return excerpt{}, false
+	}
+	src, ok := p.source(d.File)
+	if !ok {
+		return excerpt{}, false
+	}
+	for line := 1; line < d.Line; line++ {
+		i := bytes.IndexByte(src, '\n')
+		if i < 0 {
+			return excerpt{}, false
+		}
+		src = src[i+1:]
+	}
+	text := string(src[:lineLength(src)])
+	if d.Column-1 > len(text) {
+		return excerpt{}, false
+	}
+	return excerpt{line: d.Line, text: text, start: d.Column - 1, end: d.Column}, true
+}
+
+// lineLength is length of first line of src, without line terminator.
+func lineLength(src []byte) int {
+	n := bytes.IndexByte(src, '\n')
+	if n < 0 {
+		n = len(src)
+	}
+	if n > 0 && src[n-1] == '\r' {
+		n--
+	}
+	return n
+}
+
+// source reads file of diagnostic once, files that can not be read have no excerpts.
+func (p *Printer) source(name string) ([]byte, bool) {
+	if p.Files == nil {
+		return nil, false
+	}
+	if p.sources == nil {
+		p.sources = map[string][]byte{}
+	}
+	src, ok := p.sources[name]
+	if !ok {
+		var err error
+		src, err = fs.ReadFile(p.Files, name)
+		if err != nil {
+			src = nil
+		}
+		p.sources[name] = src
+	}
+	return src, src != nil
+}
@@ -0,0 +1,289 @@
+package diag_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/SQLek/wihajster/internal/diag"
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+	"github.com/SQLek/wihajster/internal/sema"
+)
+
+var testFS = fstest.MapFS{
+	"main.c":  {Data: []byte("#define VALUE y\n#warning careful\nint main() {\n\treturn VALUE;\n}\n")},
+	"sema.c":  {Data: []byte("int main() {\n\treturn y;\n}\n")},
+	"line.c":  {Data: []byte("int main() {\n#line 100 \"gen.c\"\n\treturn y;\n}\n")},
+	"redef.c": {Data: []byte("#define A 1\n#define A 2\nint main() {\n\treturn A;\n}\n")},
+}
+
+// compile returns diagnostics of compiling name in testFS.
+func compile(t *testing.T, name string) []diag.Diagnostic {
+	t.Helper()
+	lex, err := lexer.NewLexerFS(testFS, name, lexer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lex.Close()
+	tu, err := parser.Parse(lex)
+	if err == nil {
+		_, err = sema.Lower(tu)
+	}
+	return append(diag.FromWarnings(lex.Warnings()), diag.FromError(err)...)
+}
+
+func TestPrinter_Text(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "main.c",
+			want: `main.c:2:1: warning[W0103]: #warning careful
+    2 | #warning careful
+      | ^
+main.c:1:15: error[E0307]: use of undeclared identifier y
+    1 | #define VALUE y
+      |               ^
+main.c:4:9: note: in expansion of macro VALUE
+    4 | 	return VALUE;
+      | 	       ^~~~~
+main.c:1:9: note: macro VALUE defined here
+    1 | #define VALUE y
+      |         ^~~~~
+1 error and 1 warning generated.
+`,
+		},
+		{
+			name: "sema.c",
+			want: `sema.c:2:9: error[E0307]: use of undeclared identifier y
+    2 | 	return y;
+      | 	       ^
+1 error generated.
+`,
+		},
+		{
+			name: "line.c",
+			want: `gen.c:100:9: error[E0307]: use of undeclared identifier y
+  100 | 	return y;
+      | 	       ^
+1 error generated.
+`,
+		},
+		{
+			name: "redef.c",
+			want: `redef.c:2:9: warning[W0101]: macro A redefined
+    2 | #define A 2
+      |         ^
+redef.c:1:9: note: previous definition is here
+    1 | #define A 1
+      |         ^
+1 warning generated.
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			p := diag.Printer{Format: diag.FormatText, Files: testFS}
+			if err := p.Print(&out, compile(t, tt.name)); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestPrinter_TextWithoutSources(t *testing.T) {
+	diags := []diag.Diagnostic{
+		{Severity: diag.SeverityError, File: "gone.c", Line: 3, Column: 1, Message: "broken"},
+		{Severity: diag.SeverityError, Message: "read failed"},
+	}
+	var out strings.Builder
+	p := diag.Printer{Format: diag.FormatText}
+	if err := p.Print(&out, diags); err != nil {
+		t.Fatal(err)
+	}
+	want := "gone.c:3:1: error: broken\nerror: read failed\n2 errors generated.\n"
+	if out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestPrinter_NothingToReport(t *testing.T) {
+	for _, format := range diag.Formats() {
+		t.Run(format, func(t *testing.T) {
+			var out strings.Builder
+			p := diag.Printer{Format: diag.Format(format)}
+			if err := p.Print(&out, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); (got == "") != (format == "text") {
+				t.Fatalf("unexpected output %q", got)
+			}
+		})
+	}
+}
+
+func TestPrinter_JSON(t *testing.T) {
+	var out strings.Builder
+	p := diag.Printer{Format: diag.FormatJSON, Files: testFS}
+	if err := p.Print(&out, compile(t, "main.c")); err != nil {
+		t.Fatal(err)
+	}
+
+	var report struct {
+		Diagnostics []struct {
+			Severity string
+			Code     string
+			File     string
+			Line     int
+			Column   int
+			Span     struct {
+				File       string
+				Start, End int
+			}
+			Message string
+			Notes   []struct{ Severity, Message string }
+		}
+		Errors, Warnings int
+	}
+	if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if report.Errors != 1 || report.Warnings != 1 || len(report.Diagnostics) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	d := report.Diagnostics[1]
+	if d.Severity != "error" || d.Code != "E0307" || d.File != "main.c" || d.Line != 1 || d.Column != 15 ||
+		d.Span.File != "main.c" || d.Span.Start != 14 || d.Span.End != 15 {
+		t.Fatalf("unexpected diagnostic %+v", d)
+	}
+	if len(d.Notes) != 2 || d.Notes[0].Severity != "note" || d.Notes[0].Message != "in expansion of macro VALUE" {
+		t.Fatalf("unexpected notes %+v", d.Notes)
+	}
+}
+
+func TestPrinter_SARIF(t *testing.T) {
+	var out strings.Builder
+	p := diag.Printer{Format: diag.FormatSARIF, Files: testFS, Root: "file:///src/"}
+	if err := p.Print(&out, compile(t, "main.c")); err != nil {
+		t.Fatal(err)
+	}
+
+	type location struct {
+		ID               int
+		PhysicalLocation struct {
+			ArtifactLocation struct{ URI, URIBaseID string }
+			Region           struct{ StartLine, StartColumn, EndColumn int }
+		}
+		Message struct{ Text string }
+	}
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID               string
+						ShortDescription struct{ Text string }
+					}
+				}
+			}
+			OriginalURIBaseIDs map[string]struct{ URI string }
+			Results            []struct {
+				RuleID           string
+				Level            string
+				Message          struct{ Text string }
+				Locations        []location
+				RelatedLocations []location
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(out.String()), &log); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].OriginalURIBaseIDs["ROOT"].URI != "file:///src/" {
+		t.Fatalf("unexpected log %+v", log)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 2 || results[0].Level != "warning" || results[1].Level != "error" || results[1].RuleID != "E0307" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	rules := log.Runs[0].Tool.Driver.Rules
+	if len(rules) != 2 || rules[1].ID != "E0307" || rules[1].ShortDescription.Text != "use of undeclared identifier" {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+	loc := results[1].Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "main.c" || loc.ArtifactLocation.URIBaseID != "ROOT" ||
+		loc.Region.StartLine != 1 || loc.Region.StartColumn != 15 || loc.Region.EndColumn != 16 {
+		t.Fatalf("unexpected location %+v", loc)
+	}
+	related := results[1].RelatedLocations
+	if len(related) != 2 || related[1].ID != 1 || related[1].Message.Text != "macro VALUE defined here" {
+		t.Fatalf("unexpected related locations %+v", related)
+	}
+}
+
+func TestWerror(t *testing.T) {
+	diags := []diag.Diagnostic{
+		{Severity: diag.SeverityWarning, File: "a.c", Line: 1, Column: 5, Message: "unused variable x", Flag: "-Wunused-variable"},
+		{Severity: diag.SeverityWarning, File: "a.c", Line: 2, Column: 1, Message: "#warning later"},
+	}
+	diag.Werror(diags)
+	var out strings.Builder
+	p := diag.Printer{Format: diag.FormatText}
+	if err := p.Print(&out, diags); err != nil {
+		t.Fatal(err)
+	}
+	want := "a.c:1:5: error: unused variable x [-Werror,-Wunused-variable]\n" +
+		"a.c:2:1: error: #warning later [-Werror]\n" +
+		"2 errors generated.\n"
+	if out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestLimit(t *testing.T) {
+	diags := []diag.Diagnostic{
+		{Severity: diag.SeverityError, File: "a.c", Line: 1, Column: 1, Message: "first"},
+		{Severity: diag.SeverityWarning, File: "a.c", Line: 2, Column: 1, Message: "between"},
+		{Severity: diag.SeverityError, File: "a.c", Line: 3, Column: 1, Message: "second"},
+		{Severity: diag.SeverityWarning, File: "a.c", Line: 4, Column: 1, Message: "after"},
+		{Severity: diag.SeverityError, File: "a.c", Line: 5, Column: 1, Message: "third"},
+	}
+	if got := diag.Limit(diags, 0); len(got) != len(diags) {
+		t.Fatalf("expected no limit, got %d diagnostics", len(got))
+	}
+	if got := diag.Limit(diags, 3); len(got) != len(diags) {
+		t.Fatalf("expected all errors within limit, got %d diagnostics", len(got))
+	}
+	var out strings.Builder
+	p := diag.Printer{Format: diag.FormatText}
+	if err := p.Print(&out, diag.Limit(diags, 2)); err != nil {
+		t.Fatal(err)
+	}
+	want := "a.c:1:1: error: first\n" +
+		"a.c:2:1: warning: between\n" +
+		"a.c:3:1: error: second\n" +
+		"a.c:4:1: warning: after\n" +
+		"error: too many errors emitted, stopping now [-error-limit=2]\n" +
+		"3 errors and 2 warnings generated.\n"
+	if out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := diag.ParseFormat(""); err != nil || f != diag.FormatText {
+		t.Fatalf("expected text for empty name, got %q, %v", f, err)
+	}
+	if _, err := diag.ParseFormat("xml"); err == nil || !strings.Contains(err.Error(), "known are text, json, sarif") {
+		t.Fatalf("expected unknown format error, got %v", err)
+	}
+}
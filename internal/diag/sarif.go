@@ -0,0 +1,146 @@
+package diag
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
+// SARIF 2.1.0 log, only parts diagnostics need, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	// columns are counted in bytes, which are code points of ASCII sources
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules,omitempty"`
+}
+
+// sarifRule describes code of diagnostics, results refer to it by ruleId.
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId,omitempty"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarifRoot is base id of Printer.Root in artifact locations.
+const sarifRoot = "ROOT"
+
+func (p *Printer) printSARIF(w io.Writer, diags []Diagnostic) error {
+	run := sarifRun{
+		Tool:       sarifTool{Driver: sarifDriver{Name: "wihajster"}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+	if p.Root != "" {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{sarifRoot: {URI: p.Root}}
+	}
+	// rules of codes diagnostics have, in order of first use
+	rules := map[code.Code]bool{}
+	for _, d := range diags {
+		result := sarifResult{
+			RuleID:  string(d.Code),
+			Level:   d.Severity.String(),
+			Message: sarifMessage{Text: d.Message},
+		}
+		if info, ok := code.Lookup(string(d.Code)); ok && !rules[d.Code] {
+			rules[d.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               string(info.Code),
+				ShortDescription: sarifMessage{Text: info.Title},
+				FullDescription:  sarifMessage{Text: info.Text},
+			})
+		}
+		if loc, ok := p.sarifLocation(d); ok {
+			result.Locations = []sarifLocation{loc}
+		}
+		for _, note := range d.Notes {
+			loc, ok := p.sarifLocation(note)
+			if !ok {
+				continue
+			}
+			id := len(result.RelatedLocations)
+			loc.ID = &id
+			loc.Message = &sarifMessage{Text: note.Message}
+			result.RelatedLocations = append(result.RelatedLocations, loc)
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+func (p *Printer) sarifLocation(d Diagnostic) (sarifLocation, bool) {
+	if d.File == "" || d.Line <= 0 {
+		return sarifLocation{}, false
+	}
+	artifact := sarifArtifactLocation{URI: (&url.URL{Path: d.File}).String()}
+	if p.Root != "" {
+		artifact.URIBaseID = sarifRoot
+	}
+	region := sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+	if ex, ok := p.excerpt(d); ok && ex.fromSpan {
+		region.EndColumn = d.Column + ex.end - ex.start
+	}
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: artifact,
+		Region:           region,
+	}}, true
+}
@@ -10,6 +10,26 @@ var (
 	ErrNotImplementedInV0 = errors.New("feature not implemented in v0 c subset")
 )
 
+const defaultMaxIncludeDepth = 64
+
+// Options configure lexer created by NewLexerFS.
+type Options struct {
+	// IncludePaths are directories of fs.FS searched in order for #include <file>,
+	// and for #include "file" not found next to including file.
+	IncludePaths []string
+	// MaxIncludeDepth limits nesting of included files, 64 by default.
+	MaxIncludeDepth int
+	// Target is target profile selecting predefined macros, DefaultTarget if empty.
+	Target string
+	// Defines are applied in order after predefined macros, like -D and -U flags.
+	Defines []Define
+	// WarnUnknownPragmas reports ignored #pragma as warning.
+	WarnUnknownPragmas bool
+	// FileName maps name of file in fs.FS to name tokens, diagnostics and __FILE__
+	// show, e.g. path as given on command line. Name in fs.FS is shown when nil.
+	FileName func(name string) string
+}
+
 type Lexer struct {
 	mx sync.Mutex
 
@@ -19,15 +39,60 @@ type Lexer struct {
 	nextTok Token
 }
 
-func NewLexer(fd fs.File /* fs.FS for include in future */) *Lexer {
+// NewLexer lexes single file with macros of DefaultTarget.
+// Without file system #include is an error, see NewLexerFS.
+func NewLexer(fd fs.File) *Lexer {
 	s := newScanner(fd, 0)
 	p := newPreprocesor(s)
+	// default target is always known
+	_ = p.predefine(Options{})
 	return &Lexer{
 		s: s,
 		p: p,
 	}
 }
 
+// NewLexerFS lexes file name of fsys. Included files are resolved in fsys too,
+// so names are slash separated and relative to its root, as fs.FS requires.
+// Tokens carry name of file they come from. Lexer must be closed.
+func NewLexerFS(fsys fs.FS, name string, opts Options) (*Lexer, error) {
+	fd, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s := newScanner(fd, 0)
+	p := newPreprocesor(s)
+	p.fsys = fsys
+	p.includePaths = opts.IncludePaths
+	p.maxIncludeDepth = opts.MaxIncludeDepth
+	p.warnUnknownPragmas = opts.WarnUnknownPragmas
+	p.fileName = opts.FileName
+	if p.maxIncludeDepth <= 0 {
+		p.maxIncludeDepth = defaultMaxIncludeDepth
+	}
+	p.file().name = name
+	p.file().shown = p.shownName(name)
+	p.file().close = fd.Close
+	if err := p.predefine(opts); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return &Lexer{
+		s: s,
+		p: p,
+	}, nil
+}
+
+// Close closes files opened by lexer, file passed to NewLexer stays open.
+func (l *Lexer) Close() error {
+	return l.p.closeFiles()
+}
+
+// Warnings returns warnings of tokens lexed so far.
+func (l *Lexer) Warnings() []Warning {
+	return l.p.warnings
+}
+
 func (l *Lexer) Peek() (Token, error) {
 	if tok := l.nextTok; tok.Type != tokenNil {
 		return tok, nil
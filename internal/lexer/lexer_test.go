@@ -1,9 +1,12 @@
 package lexer_test
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/SQLek/wihajster/internal/lexer"
 )
@@ -66,3 +69,412 @@ func findToken(tokens []lexer.Token, tokType lexer.TokenType, tokRaw string) lex
 	}
 	return lexer.Token{}
 }
+
+func TestLexerFS_Include(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/main.c":           {Data: []byte("#include \"config.h\"\n#include <board/uart.h>\nint x = UART_BASE;\n")},
+		"src/config.h":         {Data: []byte("#define SPEED 9600 // baud\n#define UNUSED\n")},
+		"include/board/uart.h": {Data: []byte("// uart registers\n#define UART_BASE SPEED\nint uart;\n")},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "src/main.c", lexer.Options{IncludePaths: []string{"include"}})
+	if err != nil {
+		t.Fatal("create lexer:", err)
+	}
+	defer lex.Close()
+	tokens, err := lexAll(lex)
+	if err != nil {
+		t.Fatal("tokenization failed:", err)
+	}
+
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, fmt.Sprintf("%s:%d:%d %s", tok.File, tok.Line, tok.Column, tok.Raw))
+	}
+	want := []string{
+		"include/board/uart.h:3:1 int",
+		"include/board/uart.h:3:5 uart",
+		"include/board/uart.h:3:9 ;",
+		"src/main.c:3:1 int",
+		"src/main.c:3:5 x",
+		"src/main.c:3:7 =",
+		// substituted token keeps position of its definition
+		"src/config.h:1:15 9600",
+		"src/main.c:3:18 ;",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected tokens:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestLexerFS_FileName(t *testing.T) {
+	fsys := fstest.MapFS{
+		"home/user/main.c": {Data: []byte("#include \"a.h\"\nconst char *f = __FILE__;\n")},
+		"home/user/a.h":    {Data: []byte("int a;\n")},
+	}
+	shown := func(name string) string { return strings.TrimPrefix(name, "home/user/") }
+	lex, err := lexer.NewLexerFS(fsys, "home/user/main.c", lexer.Options{FileName: shown})
+	if err != nil {
+		t.Fatal("create lexer:", err)
+	}
+	defer lex.Close()
+	tokens, err := lexAll(lex)
+	if err != nil {
+		t.Fatal("tokenization failed:", err)
+	}
+	if tok := tokens[0]; tok.File != "a.h" || tok.Span.File != "a.h" {
+		t.Fatalf("expected a.h as file of token, got %q and span of %q", tok.File, tok.Span.File)
+	}
+	if tok := findToken(tokens, lexer.TokenStringLiteral, `"main.c"`); tok.File != "main.c" {
+		t.Fatalf("expected __FILE__ to be \"main.c\", got %+v", tokens)
+	}
+}
+
+func TestLexerFS_IncludeGuardedMutualInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c": {Data: []byte("#include \"a.h\"\nint main;\n")},
+		"a.h":    {Data: []byte("#ifndef A_H\n#define A_H\n#include \"b.h\"\nint a;\n#endif\n")},
+		"b.h":    {Data: []byte("#ifndef B_H\n#define B_H\n#include \"a.h\"\nint b;\n#endif\n")},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{})
+	if err != nil {
+		t.Fatal("create lexer:", err)
+	}
+	defer lex.Close()
+	tokens, err := lexAll(lex)
+	if err != nil {
+		t.Fatal("tokenization failed:", err)
+	}
+
+	var got []string
+	for _, tok := range tokens {
+		if tok.Type == lexer.TokenIdentifier {
+			got = append(got, tok.File+" "+string(tok.Raw))
+		}
+	}
+	if want := "b.h b\na.h a\nmain.c main"; strings.Join(got, "\n") != want {
+		t.Fatalf("unexpected identifiers:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestLexerFS_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		opts  lexer.Options
+		msg   string
+	}{
+		{
+			name:  "not found",
+			files: fstest.MapFS{"main.c": {Data: []byte("#include \"missing.h\"\n")}},
+			msg:   "main.c:1:10 #include missing.h: file does not exist",
+		},
+		{
+			name:  "angled ignores current directory",
+			files: fstest.MapFS{"main.c": {Data: []byte("#include <a.h>\n")}, "a.h": {}},
+			msg:   "#include a.h: file does not exist",
+		},
+		{
+			name: "cycle without guard",
+			files: fstest.MapFS{
+				"main.c": {Data: []byte("#include \"a.h\"\n")},
+				"a.h":    {Data: []byte("#include \"b.h\"\n")},
+				"b.h":    {Data: []byte("\n#include \"a.h\"\n")},
+			},
+			msg: "b.h:2:10 #include a.h: include cycle a.h -> b.h -> a.h without include guard",
+		},
+		{
+			name: "guard defined after include",
+			files: fstest.MapFS{
+				"main.c": {Data: []byte("#include \"a.h\"\n")},
+				"a.h":    {Data: []byte("#ifndef A\n#include \"b.h\"\n#define A\n#endif\n")},
+				"b.h":    {Data: []byte("#include \"a.h\"\n")},
+			},
+			msg: "b.h:1:10 #include a.h: include cycle a.h -> b.h -> a.h without include guard",
+		},
+		{
+			name:  "self include",
+			files: fstest.MapFS{"main.c": {Data: []byte("int x;\n#include \"main.c\"\n")}},
+			msg:   "main.c:2:10 #include main.c: include cycle main.c -> main.c without include guard",
+		},
+		{
+			name: "depth limit",
+			files: fstest.MapFS{
+				"main.c": {Data: []byte("#include \"a.h\"\n")},
+				"a.h":    {Data: []byte("#include \"b.h\"\n")},
+				"b.h":    {Data: []byte("int b;\n")},
+			},
+			opts: lexer.Options{MaxIncludeDepth: 2},
+			msg:  "include depth limit of 2 exceeded: main.c -> a.h -> b.h",
+		},
+		{
+			name:  "extra tokens",
+			files: fstest.MapFS{"main.c": {Data: []byte("#include \"a.h\" x\n")}, "a.h": {}},
+			msg:   "extra tokens after #include a.h",
+		},
+		{
+			name:  "missing name",
+			files: fstest.MapFS{"main.c": {Data: []byte("#include\nint x;\n")}},
+			msg:   "expected \"file\" or <file> after #include",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex, err := lexer.NewLexerFS(tt.files, "main.c", tt.opts)
+			if err != nil {
+				t.Fatal("create lexer:", err)
+			}
+			defer lex.Close()
+			_, err = lexAll(lex)
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Fatalf("expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+
+	t.Run("single file lexer", func(t *testing.T) {
+		fd, err := fstest.MapFS{"main.c": {Data: []byte("#include \"a.h\"\n")}}.Open("main.c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = lexAll(lexer.NewLexer(fd))
+		if err == nil || !strings.Contains(err.Error(), "no file system") {
+			t.Fatalf("expected missing file system error, got %v", err)
+		}
+	})
+}
+
+func lexAll(lex *lexer.Lexer) ([]lexer.Token, error) {
+	var tokens []lexer.Token
+	for {
+		tok, err := lex.Next()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+func TestLexerFS_Predefined(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c": {Data: []byte("#ifdef __CH32V003__\nch32\n#endif\n#ifdef __QEMU_VIRT__\nvirt\n#endif\n" +
+			"__STDC__ __riscv __riscv_xlen __wihajster__ SPEED DEBUG SQR(3) __FILE__ __LINE__\n")},
+	}
+	opts := lexer.Options{
+		Target: "ch32v003",
+		Defines: []lexer.Define{
+			lexer.ParseDefine("SPEED=9600"),
+			lexer.ParseDefine("DEBUG"),
+			lexer.ParseDefine("SQR(x)=((x)*(x))"),
+			lexer.ParseDefine("__riscv_xlen=32"),
+			{Name: "__riscv", Undef: true},
+		},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "main.c", opts)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer lex.Close()
+	tokens, err := lexAll(lex)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, string(tok.Raw))
+	}
+	want := `ch32 1 __riscv 32 100 9600 1 ( ( 3 ) * ( 3 ) ) "main.c" 7`
+	if strings.Join(got, " ") != want {
+		t.Fatalf("expected %q, got %q", want, strings.Join(got, " "))
+	}
+	if w := lex.Warnings(); len(w) != 0 {
+		t.Fatalf("identical redefinition should not warn, got %v", w)
+	}
+
+	if _, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{Target: "avr"}); err == nil || !strings.Contains(err.Error(), `unknown target "avr"`) {
+		t.Fatalf("expected unknown target error, got %v", err)
+	}
+}
+
+func TestLexerFS_Redefinition(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c": {Data: []byte("#include \"a.h\"\n#define A 2\n#define B (1)\n#define B  (1)\n#define __LINE__ 0\nA B\n")},
+		"a.h":    {Data: []byte("#define A 1\n")},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{Defines: []lexer.Define{lexer.ParseDefine("B=(2)")}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer lex.Close()
+	if _, err := lexAll(lex); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	var got []string
+	for _, w := range lex.Warnings() {
+		got = append(got, w.String())
+	}
+	want := []string{
+		"main.c:2:9 warning: macro A redefined\na.h:1:9: note: previous definition is here",
+		"main.c:3:9 warning: macro B redefined\n<command line>:1:9: note: previous definition is here",
+		"main.c:5:9 warning: redefining builtin macro __LINE__",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected warnings:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestLexerFS_PragmaOnce(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c":      {Data: []byte("#include \"a.h\"\n#include \"inc/../a.h\"\n#include \"b.h\"\nmain\n")},
+		"a.h":         {Data: []byte("#pragma once\n#include \"b.h\"\na\n")},
+		"b.h":         {Data: []byte("#pragma once\n#include \"a.h\"\nb\n")},
+		"inc/ignored": {},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer lex.Close()
+	tokens, err := lexAll(lex)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, string(tok.Raw))
+	}
+	// b.h includes a.h while a.h is open, it is already marked once
+	if want := "b a main"; strings.Join(got, " ") != want {
+		t.Fatalf("expected %q, got %q", want, strings.Join(got, " "))
+	}
+}
+
+func TestWritePreprocessed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c": {Data: []byte("#include \"a.h\"\n#define N 3\n#define PLUS +\n#define F(a, b) [a b]\n#define P(a, b) a + b\nint x = N;\n  x = x PLUS+N;\nF(1,\n  N) P(x,y)\n\n\n\n\n\n\n\n\n\n\nlast\n")},
+		"a.h":    {Data: []byte("#line 40 \"gen.h\"\nint a;\n")},
+	}
+	tests := []struct {
+		name     string
+		annotate bool
+		want     string
+	}{
+		{
+			name: "plain",
+			want: "# 40 \"gen.h\"\nint a;\n# 6 \"main.c\"\nint x = 3;\n  x = x + +3;\n[1 3]\n     x + y\n# 20 \"main.c\"\nlast\n",
+		},
+		{
+			name:     "annotated",
+			annotate: true,
+			want:     "# 40 \"gen.h\"\nint a;\n# 6 \"main.c\"\nint x = /*N{*/3/*}*/;\n  x = x /*PLUS{*/+/*}*/+/*N{*/3/*}*/;\n/*F{*/[1 3]/*}*/\n     /*P{*/x + y/*}*/\n# 20 \"main.c\"\nlast\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{})
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			defer lex.Close()
+			var out strings.Builder
+			if err := lexer.WritePreprocessed(&out, lex, tt.annotate); err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestWritePreprocessed_RoundTrip(t *testing.T) {
+	fd, err := os.Open("../../examples/hello_uart.c")
+	if err != nil {
+		t.Fatal("error opening file: ", err)
+	}
+	defer fd.Close()
+	want, err := lexAll(lexer.NewLexer(fd))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := lexer.WritePreprocessed(&out, lexer.NewLexer(fd), false); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	fsys := fstest.MapFS{"out.c": {Data: []byte(out.String())}}
+	lex, err := lexer.NewLexerFS(fsys, "out.c", lexer.Options{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	got, err := lexAll(lex)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d tokens, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if string(got[i].Raw) != string(want[i].Raw) {
+			t.Fatalf("token %d: expected %s, got %s", i, want[i].Raw, got[i].Raw)
+		}
+	}
+	// tokens of source keep positions, expanded ones are at macro use
+	uartIdent := findToken(got, lexer.TokenIdentifier, "uart")
+	exclamationChar := findToken(got, lexer.TokenCharacterConstant, "'!'")
+	if uartIdent.Line != 5 || uartIdent.Column != 20 || exclamationChar.Line != 22 || exclamationChar.Column != 15 {
+		t.Fatalf("positions changed, uart at %d:%d, '!' at %d:%d",
+			uartIdent.Line, uartIdent.Column, exclamationChar.Line, exclamationChar.Column)
+	}
+}
+
+func TestLexerFS_SpansAndExpansions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c": {Data: []byte("#include \"a.h\"\n#define TWICE(x) (x + x)\nint value = TWICE(N);\n\"s\"\n")},
+		"a.h":    {Data: []byte("// limits\n#define N 10\n")},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer lex.Close()
+	tokens, err := lexAll(lex)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	value := findToken(tokens, lexer.TokenIdentifier, "value")
+	if want := (lexer.Span{File: "main.c", Start: 44, End: 49}); value.Span != want || value.Expansion != nil {
+		t.Fatalf("expected value at %v, got %v", want, value.Span)
+	}
+	str := findToken(tokens, lexer.TokenStringLiteral, `"s"`)
+	if want := (lexer.Span{File: "main.c", Start: 62, End: 65}); str.Span != want {
+		t.Fatalf("expected string at %v, got %v", want, str.Span)
+	}
+
+	ten := findToken(tokens, lexer.TokenIntegerConstant, "10")
+	if want := (lexer.Span{File: "a.h", Start: 20, End: 22}); ten.Span != want {
+		t.Fatalf("expected 10 spelled at %v, got %v", want, ten.Span)
+	}
+	var notes []string
+	for _, note := range lexer.ExpansionNotes(ten) {
+		notes = append(notes, note.String())
+	}
+	want := []string{
+		"main.c:3:13: note: in expansion of macro TWICE",
+		"main.c:2:9: note: macro TWICE defined here",
+	}
+	if strings.Join(notes, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected notes:\n%s", strings.Join(notes, "\n"))
+	}
+
+	plus := findToken(tokens, lexer.TokenPlus, "+")
+	if plus.Line != 2 || plus.Expansion == nil || plus.Expansion.Macro != "TWICE" || plus.Expansion.Site.Line != 3 {
+		t.Fatalf("expected + spelled in #define and expanded at line 3, got %d:%d", plus.Line, plus.Column)
+	}
+}
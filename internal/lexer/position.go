@@ -0,0 +1,105 @@
+package lexer
+
+import (
+	"fmt"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
+// Span is byte range of source file, End is exclusive. File is name of file as
+// Options.FileName shows it, #line does not change it.
+type Span struct {
+	File       string
+	Start, End int
+}
+
+// Cover returns span from start of s to end of other. Spans of different files,
+// e.g. of macro defined in header, can not be joined and s is returned.
+func (s Span) Cover(other Span) Span {
+	if s.File != other.File || other.End < s.Start {
+		return s
+	}
+	s.End = max(s.End, other.End)
+	return s
+}
+
+// Expansion is macro expansion producing token.
+type Expansion struct {
+	Macro string
+	// Site is macro name expanded, it comes from other expansion when macro is used
+	// in body of other macro.
+	Site Token
+	// Defined is macro name in its #define, zero for builtin macros like __LINE__.
+	Defined Token
+}
+
+// Note is location explaining diagnostic, like macro expansion its token comes from.
+type Note struct {
+	File         string
+	Line, Column int
+	Span         Span
+	Message      string
+}
+
+func (n Note) String() string {
+	return fmt.Sprintf("%s: note: %s", Position(n.File, n.Line, n.Column), n.Message)
+}
+
+// Error is error of preprocessing, at position in source.
+type Error struct {
+	Code         code.Code
+	File         string
+	Line, Column int
+	// Span is zero when error is not at token, e.g. at missing one.
+	Span  Span
+	Msg   string
+	Notes []Note
+}
+
+func (e *Error) Error() string {
+	msg := Position(e.File, e.Line, e.Column) + " " + e.Msg
+	for _, note := range e.Notes {
+		msg += "\n" + note.String()
+	}
+	return msg
+}
+
+// Position formats location as file:line:col, or line:col when file is unknown.
+func Position(file string, line, column int) string {
+	if file == "" {
+		return fmt.Sprintf("%d:%d", line, column)
+	}
+	return fmt.Sprintf("%s:%d:%d", file, line, column)
+}
+
+// ExpansionNotes explains macro expansions tok comes from, innermost first.
+func ExpansionNotes(tok Token) []Note {
+	var notes []Note
+	for e := tok.Expansion; e != nil; e = e.Site.Expansion {
+		notes = append(notes, Note{
+			File:    e.Site.File,
+			Line:    e.Site.Line,
+			Column:  e.Site.Column,
+			Span:    e.Site.Span,
+			Message: "in expansion of macro " + e.Macro,
+		})
+		if e.Defined.Line > 0 {
+			notes = append(notes, Note{
+				File:    e.Defined.File,
+				Line:    e.Defined.Line,
+				Column:  e.Defined.Column,
+				Span:    e.Defined.Span,
+				Message: "macro " + e.Macro + " defined here",
+			})
+		}
+	}
+	return notes
+}
+
+// SourceSpan is span of tok in source, for expanded token span of macro name used in source.
+func SourceSpan(tok Token) Span {
+	for tok.Expansion != nil {
+		tok = tok.Expansion.Site
+	}
+	return tok.Span
+}
@@ -2,63 +2,169 @@ package lexer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
 )
 
 type preprocesor struct {
-	// in future milestone, this will be stack of scanners
+	// stack of files, innermost #include last
+	files []*sourceFile
+	// s is scanner of innermost file
 	s *scanner
 
-	// fs.FS in future
+	// fsys resolves #include, nil for lexer of single file
+	fsys            fs.FS
+	includePaths    []string
+	maxIncludeDepth int
+	// fileName maps name in fsys to name tokens carry, nil for identity
+	fileName func(string) string
 
 	// macro substitution can produce more than one token
 	// tokenDots can produce more than one token
+	// tokens read past function-like macro name are put back here too
 	readyTokens []Token
 
 	// accumulator for forming tokens
 	accumulator []byte
+	// space is true when whitespace or comment was lexed since last token
+	space bool
+
+	macros map[string]*macro
+	// invocation is last token of source checked for macro, __LINE__ and __FILE__ use it
+	invocation Token
 
-	macros map[string][]Token
+	warnings           []Warning
+	warnUnknownPragmas bool
+	// once are resolved names of files with #pragma once
+	once map[string]bool
 
 	// macro directive only fire at start of text line ignoring whitespaces
 	// to not bother with many unnesesary tokens we store on what line ended last seen token
 	// we also store line on which preprocesor directive ocured
 	lastSeenLine, ppLine int
+	// ppColumn is column of '#' starting directive
+	ppColumn int
 
 	// we capturing token start from scanner
 	line, column int
+	// start and end are byte offsets of token in file
+	start, end int
+}
+
+// sourceFile is file on include stack.
+type sourceFile struct {
+	// name is path in fs.FS, empty for lexer of single file
+	name string
+	// shown is name tokens carry, see Options.FileName
+	shown string
+	s     *scanner
+	close func() error
+
+	// lastSeenLine of file, saved while included file is read
+	lastSeenLine int
+	// pending is token lexed past end of directive line, lexed again by next lex
+	pending *pendingToken
+	// conds are open conditional groups, innermost last
+	conds []conditional
+
+	// cycle is error of including file while it is already included, reported
+	// unless first directive of file is false conditional, like include guard
+	cycle error
+
+	// #line makes token positions differ from lines of file
+	presumedName string
+	lineDelta    int
+}
+
+// displayName is file name tokens and diagnostics use, set by #line.
+func (f *sourceFile) displayName() string {
+	if f.presumedName != "" {
+		return f.presumedName
+	}
+	return f.shown
+}
+
+type pendingToken struct {
+	tokType      TokenType
+	raw          []byte
+	line, column int
+	start, end   int
+	spaceBefore  bool
+	// err is error of tokenizer lexing token, reported when it is lexed again
+	err *tokenError
 }
 
 func newPreprocesor(s *scanner) *preprocesor {
-	return &preprocesor{
+	p := &preprocesor{
+		files:        []*sourceFile{{s: s}},
 		s:            s,
 		line:         s.line,
 		column:       s.column,
 		lastSeenLine: s.line - 1,
-		macros:       make(map[string][]Token),
+		macros:       make(map[string]*macro),
+		once:         make(map[string]bool),
+	}
+	for name, fn := range dynamicMacros {
+		p.macros[name] = &macro{name: name, dynamic: fn}
 	}
+	return p
 }
 
+func (p *preprocesor) file() *sourceFile {
+	return p.files[len(p.files)-1]
+}
+
+// next returns token with macros expanded.
 func (p *preprocesor) next() (Token, error) {
+	return p.expandNext(p)
+}
+
+// nextUnexpanded returns token after directives are handled, but before macro expansion.
+func (p *preprocesor) nextUnexpanded() (Token, error) {
 	if tok, ok := p.popFromReady(); ok {
 		return tok, nil
 	}
 
+	if p.skipping() {
+		if err := p.skipInactive(); err != nil {
+			return Token{}, err
+		}
+	}
+
 	tokType, err := p.lex()
+	if err == io.EOF {
+		if err := p.checkConditionals(); err != nil {
+			return Token{}, err
+		}
+	}
+	if err == io.EOF && len(p.files) > 1 {
+		// end of included file, continuing with one including it
+		if err := p.popFile(); err != nil {
+			return Token{}, err
+		}
+		return p.nextUnexpanded()
+	}
 	if err != nil {
-		return Token{}, err
+		return Token{}, p.lexError(err)
+	}
+	if f := p.file(); f.cycle != nil && tokType != tokenWhitespace && tokType != tokenPreprocStart {
+		return Token{}, f.cycle
 	}
 
 	switch tokType {
 	case tokenWhitespace:
-		return p.next()
+		return p.nextUnexpanded()
 	case TokenIdentifier:
-		return p.handleKeywordOrSubsitution()
+		return p.makeToken(keywordType(p.accumulatorString())), nil
 	case tokenDots:
 		return p.handleDots()
 	case tokenPreprocStart:
 		if p.lastSeenLine >= p.line {
-			return p.errorf("preprocesor directive not on line start")
+			return p.errorf(code.InvalidDirective, "preprocesor directive not on line start")
 		}
 		return p.handleDirective()
 	}
@@ -66,29 +172,83 @@ func (p *preprocesor) next() (Token, error) {
 	return p.makeToken(tokType), nil
 }
 
-func (p *preprocesor) errorf(format string, args ...any) (Token, error) {
-	format = "%d:%d " + format
-	args = append([]any{
-		p.line, p.column,
-	}, args...)
-	return Token{}, fmt.Errorf(format, args...)
+func (p *preprocesor) errorf(c code.Code, format string, args ...any) (Token, error) {
+	return Token{}, &Error{
+		Code:   c,
+		File:   p.file().displayName(),
+		Line:   p.line + p.file().lineDelta,
+		Column: p.column,
+		Msg:    fmt.Sprintf(format, args...),
+	}
 }
 
 func (p *preprocesor) lex() (TokenType, error) {
-	p.line = p.s.line
-	p.column = p.s.column
-
 	p.clearAccumulator()
-	return lex(p.s, p.tokenBuildFn)
+	if pending := p.file().pending; pending != nil {
+		p.file().pending = nil
+		p.accumulator = append(p.accumulator, pending.raw...)
+		p.line, p.column = pending.line, pending.column
+		p.start, p.end = pending.start, pending.end
+		p.space = pending.spaceBefore
+		if pending.err != nil {
+			return tokenNil, pending.err
+		}
+		return pending.tokType, nil
+	}
+
+	// token start is corrected by tokenBuildFn, comments before token are skipped by lex
+	line, column := p.s.line, p.s.column
+	p.line, p.column = line, column
+	p.start = p.s.offset
+	tokType, err := lex(p.s, p.tokenBuildFn)
+	p.end = p.s.offset
+	if tokType == tokenWhitespace || p.line != line || p.column != column {
+		p.space = true
+	}
+	return tokType, err
+}
+
+// lexError adds position of token just lexed to error of tokenizer.
+func (p *preprocesor) lexError(err error) error {
+	var tokErr *tokenError
+	if !errors.As(err, &tokErr) {
+		return err
+	}
+	return &Error{
+		Code:   tokErr.code,
+		File:   p.file().displayName(),
+		Line:   p.line + p.file().lineDelta,
+		Column: p.column,
+		Span:   Span{File: p.file().shown, Start: p.start, End: p.end},
+		Msg:    tokErr.msg,
+	}
+}
+
+// unlex makes next lex return token just lexed again.
+func (p *preprocesor) unlex(tokType TokenType) {
+	p.file().pending = &pendingToken{
+		tokType:     tokType,
+		raw:         bytes.Clone(p.accumulator),
+		line:        p.line,
+		column:      p.column,
+		start:       p.start,
+		end:         p.end,
+		spaceBefore: p.space,
+	}
 }
 
 func (p *preprocesor) makeToken(tokType TokenType) Token {
 	tok := Token{
 		Type:   tokType,
-		Line:   p.line,
+		File:   p.file().displayName(),
+		Line:   p.line + p.file().lineDelta,
 		Column: p.column,
 		Raw:    bytes.Clone(p.accumulator),
+		Span:   Span{File: p.file().shown, Start: p.start, End: p.end},
+
+		spaceBefore: p.space,
 	}
+	p.space = false
 	p.lastSeenLine = p.s.line
 	return tok
 }
@@ -102,6 +262,12 @@ func (p *preprocesor) accumulatorString() string {
 }
 
 func (p *preprocesor) tokenBuildFn(data []byte) {
+	if len(p.accumulator) == 0 && len(data) > 0 {
+		// scanner is already past first data of token, which never spans lines
+		p.line = p.s.line
+		p.column = p.s.column - len(data)
+		p.start = p.s.offset - len(data)
+	}
 	// in future milesone there will be state when we will ignore this data
 	// mostly in if/ifdef/ifndef situation
 	p.accumulator = append(p.accumulator, data...)
@@ -0,0 +1,208 @@
+package lexer
+
+import (
+	"io"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
+// conditional is open #if, #ifdef or #ifndef group of file.
+type conditional struct {
+	// directive opened group, at line and column of its '#'
+	directive    string
+	line, column int
+
+	// parentActive is false for group nested in skipped region, all its branches are skipped
+	parentActive bool
+	// active is true while lines of current branch are kept
+	active bool
+	// taken is true once some branch was active, later branches are skipped
+	taken   bool
+	sawElse bool
+}
+
+var lineBody = byteClassChars('\n').negate()
+
+func isConditionalDirective(name string) bool {
+	switch name {
+	case "if", "ifdef", "ifndef", "elif", "else", "endif":
+		return true
+	}
+	return false
+}
+
+func isOpeningConditional(name string) bool {
+	return name == "if" || name == "ifdef" || name == "ifndef"
+}
+
+// skipping reports if lines of current file are in inactive branch.
+func (p *preprocesor) skipping() bool {
+	conds := p.file().conds
+	return len(conds) > 0 && !conds[len(conds)-1].active
+}
+
+func (p *preprocesor) handleConditional(name string) (Token, error) {
+	conds := &p.file().conds
+	switch name {
+	case "if", "ifdef", "ifndef":
+		c := conditional{directive: name, line: p.ppLine, column: p.ppColumn, parentActive: !p.skipping()}
+		if !c.parentActive {
+			*conds = append(*conds, c)
+			return p.skipDirective()
+		}
+		cond, err := p.condition(name)
+		if err != nil {
+			return Token{}, err
+		}
+		c.active, c.taken = cond, cond
+		*conds = append(*conds, c)
+		if f := p.file(); f.cycle != nil {
+			// first directive of file included again must skip it
+			if cond {
+				return Token{}, f.cycle
+			}
+			f.cycle = nil
+		}
+		return p.nextUnexpanded()
+	}
+
+	if len(*conds) == 0 {
+		return p.errorf(code.UnbalancedConditional, "#%s without #if", name)
+	}
+	c := &(*conds)[len(*conds)-1]
+	switch name {
+	case "elif":
+		if c.sawElse {
+			return p.errorf(code.UnbalancedConditional, "#elif after #else")
+		}
+		if !c.parentActive || c.taken {
+			c.active = false
+			return p.skipDirective()
+		}
+		cond, err := p.condition(name)
+		if err != nil {
+			return Token{}, err
+		}
+		c.active, c.taken = cond, cond
+		return p.nextUnexpanded()
+	case "else":
+		if c.sawElse {
+			return p.errorf(code.UnbalancedConditional, "#else after #else")
+		}
+		c.sawElse = true
+		c.active = c.parentActive && !c.taken
+		c.taken = true
+	default:
+		*conds = (*conds)[:len(*conds)-1]
+	}
+	return p.skipDirective()
+}
+
+// condition evaluates rest of #if, #elif, #ifdef or #ifndef line.
+func (p *preprocesor) condition(name string) (bool, error) {
+	toks, err := p.directiveTokens()
+	if err != nil {
+		return false, err
+	}
+	// errors are reported at directive
+	p.line, p.column = p.ppLine, p.ppColumn
+
+	if name == "ifdef" || name == "ifndef" {
+		if len(toks) == 0 || !isMacroName(toks[0]) {
+			_, err := p.errorf(code.InvalidCondition, "macro name missing after #%s", name)
+			return false, err
+		}
+		if len(toks) > 1 {
+			_, err := p.errorf(code.InvalidCondition, "extra tokens after #%s %s", name, toks[0].Raw)
+			return false, err
+		}
+		_, defined := p.macros[string(toks[0].Raw)]
+		return defined == (name == "ifdef"), nil
+	}
+
+	if len(toks) == 0 {
+		_, err := p.errorf(code.InvalidCondition, "#%s with no expression", name)
+		return false, err
+	}
+	value, err := p.evalCondition(toks)
+	if err != nil {
+		_, err := p.errorf(code.InvalidCondition, "invalid #%s expression: %v", name, err)
+		return false, err
+	}
+	return value.n != 0, nil
+}
+
+// skipDirective discards rest of directive line without lexing it.
+func (p *preprocesor) skipDirective() (Token, error) {
+	if p.file().pending == nil {
+		if err := p.skipBytes(lineBody); err != nil && err != io.EOF {
+			return Token{}, err
+		}
+	}
+	p.lastSeenLine = p.ppLine
+	return p.nextUnexpanded()
+}
+
+// skipInactive discards lines of skipped branch up to next directive or end of file.
+// Skipped lines are not lexed, so they can hold anything, e.g. unsupported syntax.
+func (p *preprocesor) skipInactive() error {
+	if pending := p.file().pending; pending != nil {
+		if pending.tokType == tokenPreprocStart {
+			return nil
+		}
+		p.file().pending = nil
+		if err := p.skipBytes(lineBody); err != nil {
+			return ignoreEOF(err)
+		}
+	}
+	for {
+		if err := p.skipBytes(whiteByteClass); err != nil {
+			return ignoreEOF(err)
+		}
+		b, err := p.s.peekOne()
+		if err != nil {
+			return ignoreEOF(err)
+		}
+		if b == '#' {
+			p.lastSeenLine = p.s.line - 1
+			return nil
+		}
+		if err := p.skipBytes(lineBody); err != nil {
+			return ignoreEOF(err)
+		}
+	}
+}
+
+// skipBytes consumes bytes in class.
+func (p *preprocesor) skipBytes(cls byteClass) error {
+	for {
+		_, isPartial, err := p.s.readBytesInClass(cls)
+		if err != nil || !isPartial {
+			return err
+		}
+	}
+}
+
+// ignoreEOF turns end of file into success, next lex reports it.
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// checkConditionals diagnoses group left open at end of file at its opening directive.
+func (p *preprocesor) checkConditionals() error {
+	conds := p.file().conds
+	if len(conds) == 0 {
+		return nil
+	}
+	c := conds[len(conds)-1]
+	p.line, p.column = c.line, c.column
+	_, err := p.errorf(code.UnbalancedConditional, "unterminated #%s", c.directive)
+	return err
+}
+
+func isMacroName(tok Token) bool {
+	return tok.Type == TokenIdentifier || isKeyword(tok.Type)
+}
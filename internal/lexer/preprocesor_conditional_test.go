@@ -0,0 +1,134 @@
+package lexer
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPreprocesor_Conditionals(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "ifdef and ifndef",
+			input: "#define A\n#ifdef A\na\n#endif\n#ifndef A\nnot_a\n#endif\n#ifndef B\nnot_b\n#endif\n",
+			want:  "a not_b",
+		},
+		{
+			name:  "elif chain takes first true branch",
+			input: "#define V 2\n#if V == 1\none\n#elif V == 2\ntwo\n#elif V > 1\nmore\n#else\nother\n#endif\n",
+			want:  "two",
+		},
+		{
+			name:  "else",
+			input: "#if 0\nzero\n#else\nelse\n#endif\nafter",
+			want:  "else after",
+		},
+		{
+			name:  "nested in skipped branch",
+			input: "#if 0\n#if 1\ninner\n#else\ninner_else\n#endif\n#elif 1\nouter\n#endif\n",
+			want:  "outer",
+		},
+		{
+			name:  "skipped lines are not lexed",
+			input: "#if 0\nit's 1.5 @ `\n#error never\n#bogus\n#endif\nok",
+			want:  "ok",
+		},
+		{
+			name:  "invalid token starting skipped lines",
+			input: "#if 0\n1.5\n#elif 0\n'\n#endif\nok",
+			want:  "ok",
+		},
+		{
+			name:  "defined forms",
+			input: "#define A 0\n#if defined A && defined(A) && !defined B\nyes\n#endif\n",
+			want:  "yes",
+		},
+		{
+			name:  "undefined identifiers are zero",
+			input: "#if UNKNOWN || int\nno\n#else\nyes\n#endif\n",
+			want:  "yes",
+		},
+		{
+			name:  "short circuit skips division by zero",
+			input: "#if 0 && 1 / 0\nno\n#elif 1 || 1 % 0\nyes\n#endif\n",
+			want:  "yes",
+		},
+		{
+			name:  "unsigned comparison",
+			input: "#if -1 > 0u\nyes\n#endif\n#if -1 < 0\nsigned\n#endif\n",
+			want:  "yes signed",
+		},
+		{
+			name:  "arithmetic and ternary",
+			input: "#if (1 << 4 | 0x0f) == 31 && 'a' == 97 && (2 ? 7 % 4 : 9) == 3 && ~0 == -1\nyes\n#endif\n",
+			want:  "yes",
+		},
+		{
+			name:  "directive after comment in active branch",
+			input: "#if 1 // always\nyes\n#endif // done\n",
+			want:  "yes",
+		},
+		{
+			name:  "include guard",
+			input: "#ifndef GUARD\n#define GUARD\nonce\n#endif\n#ifndef GUARD\ntwice\n#endif\n",
+			want:  "once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := newTestLexerFromString(tt.input)
+			var got []string
+			for {
+				tok, err := lex.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal("unexpected error:", err)
+				}
+				got = append(got, string(tok.Raw))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, strings.Join(got, " "))
+			}
+		})
+	}
+}
+
+func TestPreprocesor_ConditionalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{name: "unterminated if", input: "x\n  #if 1\ny\n", msg: "2:3 unterminated #if"},
+		{name: "unterminated nested", input: "#ifdef A\n#else\n#ifndef B\n#endif\n", msg: "1:1 unterminated #ifdef"},
+		{name: "unterminated in skipped branch", input: "#if 0\n#if 1\n#endif\n", msg: "1:1 unterminated #if"},
+		{name: "endif without if", input: "#endif\n", msg: "#endif without #if"},
+		{name: "else after else", input: "#if 1\n#else\n#else\n#endif\n", msg: "#else after #else"},
+		{name: "elif after else", input: "#if 1\n#else\n#elif 1\n#endif\n", msg: "#elif after #else"},
+		{name: "missing expression", input: "#if\n#endif\n", msg: "#if with no expression"},
+		{name: "ifdef without name", input: "#ifdef\n#endif\n", msg: "macro name missing after #ifdef"},
+		{name: "division by zero", input: "#if 1 / 0\n#endif\n", msg: "1:1 invalid #if expression: division by zero"},
+		{name: "unbalanced parens", input: "#if (1\n#endif\n", msg: "missing )"},
+		{name: "defined without name", input: "#if defined()\n#endif\n", msg: "macro name missing after defined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := newTestLexerFromString(tt.input)
+			var err error
+			for err == nil {
+				_, err = lex.Next()
+			}
+			if err == io.EOF || !strings.Contains(err.Error(), tt.msg) {
+				t.Fatalf("expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
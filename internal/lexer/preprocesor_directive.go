@@ -1,59 +1,263 @@
 package lexer
 
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
 func (p *preprocesor) handleDirective() (Token, error) {
-	p.ppLine = p.s.line
-	tok, sameLine, err := p.nextPPToken()
+	p.ppLine, p.ppColumn = p.line, p.column
+	tok, ok, err := p.nextDirectiveToken()
 	if err != nil {
 		return Token{}, err
 	}
-	if !sameLine {
-		return p.errorf("empty directive")
+	if p.skipping() && (!ok || !isConditionalDirective(string(tok.Raw))) {
+		// other directives of skipped branch are ignored, even invalid ones
+		return p.skipDirective()
+	}
+	if f := p.file(); f.cycle != nil && (!ok || !isOpeningConditional(string(tok.Raw))) {
+		return Token{}, f.cycle
+	}
+	if !ok {
+		return p.errorf(code.InvalidDirective, "empty directive")
 	}
-	if tok.Type != TokenIdentifier {
-		return p.errorf("expected directive name")
+	if tok.Type == TokenIntegerConstant {
+		// line marker of preprocessed output, # number "file"
+		return p.handleLine(tok)
+	}
+	if !isMacroName(tok) {
+		return p.errorf(code.InvalidDirective, "expected directive name")
 	}
 
 	switch tokStr := string(tok.Raw); tokStr {
+	case "if", "ifdef", "ifndef", "elif", "else", "endif":
+		return p.handleConditional(tokStr)
 	case "define":
 		return p.handleDefineName()
+	case "undef":
+		return p.handleUndef()
+	case "include":
+		return p.handleInclude()
+	case "pragma":
+		return p.handlePragma()
+	case "error", "warning":
+		return p.handleDiagnostic(tokStr)
+	case "line":
+		return p.handleLine()
 	default:
-		return p.errorf("unsupported directive %s", tokStr)
+		return p.errorf(code.InvalidDirective, "unsupported directive %s", tokStr)
 	}
 }
 
 func (p *preprocesor) handleDefineName() (Token, error) {
-	tok, sameLine, err := p.nextPPToken()
+	tok, ok, err := p.nextDirectiveToken()
+	if err != nil {
+		return Token{}, err
+	}
+	if !ok || !isMacroName(tok) {
+		return p.errorf(code.InvalidMacroDefinition, "expected definition name")
+	}
+	if string(tok.Raw) == "defined" {
+		return Token{}, p.tokenErrorf(code.InvalidMacroDefinition, tok, "\"defined\" cannot be used as macro name")
+	}
+
+	m := &macro{name: string(tok.Raw), defined: tok}
+	body, err := p.directiveTokens()
 	if err != nil {
 		return Token{}, err
 	}
-	if !sameLine || tok.Type != TokenIdentifier {
-		return p.errorf("expected definition name")
+	// '(' right after name, without whitespace, starts parameter list
+	if len(body) > 0 && body[0].Type == TokenLParen && !body[0].spaceBefore {
+		if body, err = p.parseMacroParams(m, tok, body[1:]); err != nil {
+			return Token{}, err
+		}
+	}
+	m.body = body
+	if err := p.checkMacroBody(m, tok); err != nil {
+		return Token{}, err
 	}
 
-	macroName := string(tok.Raw)
-	var macroBody []Token
+	p.setMacro(m)
+	return p.nextUnexpanded()
+}
+
+func (p *preprocesor) handleUndef() (Token, error) {
+	toks, err := p.directiveTokens()
+	if err != nil {
+		return Token{}, err
+	}
+	// errors are reported at directive
+	p.line, p.column = p.ppLine, p.ppColumn
+	if len(toks) == 0 || !isMacroName(toks[0]) {
+		return p.errorf(code.InvalidUndef, "macro name missing after #undef")
+	}
+	if len(toks) > 1 {
+		return p.errorf(code.InvalidUndef, "extra tokens after #undef %s", toks[0].Raw)
+	}
+	delete(p.macros, string(toks[0].Raw))
+	return p.nextUnexpanded()
+}
 
+// nextDirectiveToken lexes token of directive line without macro substitution,
+// false when line ended. Token starting next line is kept for next lex.
+func (p *preprocesor) nextDirectiveToken() (Token, bool, error) {
 	for {
-		tok, sameLine, err := p.nextPPToken()
+		tokType, err := p.lex()
+		if err == io.EOF {
+			return Token{}, false, nil
+		}
+		var tokErr *tokenError
+		if errors.As(err, &tokErr) && p.line != p.ppLine {
+			// invalid token of next line is reported after directive, e.g. #line, applies
+			p.unlex(tokenNil)
+			p.file().pending.err = tokErr
+			p.lastSeenLine = p.ppLine
+			return Token{}, false, nil
+		}
 		if err != nil {
+			return Token{}, false, p.lexError(err)
+		}
+		if tokType == tokenWhitespace {
+			continue
+		}
+		if p.line != p.ppLine {
+			p.unlex(tokType)
+			// directive ended, next line can start another one
+			p.lastSeenLine = p.ppLine
+			return Token{}, false, nil
+		}
+
+		switch tokType {
+		case TokenIdentifier:
+			tokType = keywordType(p.accumulatorString())
+		case tokenDots:
+			tok, err := p.handleDots()
+			return tok, err == nil, err
+		}
+		return p.makeToken(tokType), true, nil
+	}
+}
+
+// directiveTokens lexes rest of directive line.
+func (p *preprocesor) directiveTokens() ([]Token, error) {
+	var toks []Token
+	for {
+		tok, ok, err := p.nextDirectiveToken()
+		if err != nil || !ok {
+			return toks, err
+		}
+		toks = append(toks, tok)
+	}
+}
+
+// setMacro defines macro, warning if it was defined differently before.
+func (p *preprocesor) setMacro(m *macro) {
+	if prev, ok := p.macros[m.name]; ok && !prev.sameDefinition(m) {
+		if prev.dynamic != nil {
+			p.warnf(code.MacroRedefined, m.defined, "redefining builtin macro %s", m.name)
+		} else {
+			w := p.warnf(code.MacroRedefined, m.defined, "macro %s redefined", m.name)
+			w.Notes = append(w.Notes, Note{
+				File:    prev.defined.File,
+				Line:    prev.defined.Line,
+				Column:  prev.defined.Column,
+				Span:    prev.defined.Span,
+				Message: "previous definition is here",
+			})
+		}
+	}
+	p.macros[m.name] = m
+}
+
+// handlePragma handles #pragma once, other pragmas are ignored.
+func (p *preprocesor) handlePragma() (Token, error) {
+	toks, err := p.directiveTokens()
+	if err != nil {
+		return Token{}, err
+	}
+	if len(toks) == 1 && string(toks[0].Raw) == "once" {
+		p.once[p.file().name] = true
+		return p.nextUnexpanded()
+	}
+	if p.warnUnknownPragmas {
+		name := "#pragma"
+		if len(toks) > 0 {
+			name += " " + string(toks[0].Raw)
+		}
+		p.warnf(code.UnknownPragma, p.directivePosition(), "ignoring unknown %s", name)
+	}
+	return p.nextUnexpanded()
+}
+
+// handleDiagnostic reports #error as error and #warning as warning.
+// Message is rest of line as written, it does not need to be valid tokens.
+func (p *preprocesor) handleDiagnostic(name string) (Token, error) {
+	var msg []byte
+	for {
+		data, isPartial, err := p.s.readBytesInClass(lineBody)
+		if err != nil && err != io.EOF {
 			return Token{}, err
 		}
-		if !sameLine {
-			p.setMacro(macroName, macroBody)
-			return tok, nil
+		msg = append(msg, data...)
+		if !isPartial {
+			break
 		}
-		macroBody = append(macroBody, tok)
 	}
+	text := "#" + name
+	if msg = bytes.TrimSpace(msg); len(msg) > 0 {
+		text += " " + string(msg)
+	}
+
+	p.line, p.column = p.ppLine, p.ppColumn
+	if name == "error" {
+		return p.errorf(code.ErrorDirective, "%s", text)
+	}
+	p.warnf(code.WarningDirective, p.directivePosition(), "%s", text)
+	p.lastSeenLine = p.ppLine
+	return p.nextUnexpanded()
 }
 
-func (p *preprocesor) nextPPToken() (Token, bool, error) {
-	tok, err := p.next()
+// handleLine handles #line number ["file"], setting number and file name of next line.
+// Directive is macro expanded. Line marker passes its number as first.
+func (p *preprocesor) handleLine(first ...Token) (Token, error) {
+	toks, err := p.directiveTokens()
 	if err != nil {
-		return Token{}, false, err
+		return Token{}, err
+	}
+	toks, err = p.expandTokens(append(first, toks...))
+	if err != nil {
+		return Token{}, err
+	}
+	// errors are reported at directive
+	p.line, p.column = p.ppLine, p.ppColumn
+	if len(toks) == 0 {
+		return p.errorf(code.InvalidLineDirective, "line number missing after #line")
+	}
+	number, err := strconv.ParseUint(string(toks[0].Raw), 10, 31)
+	if err != nil || toks[0].Type != TokenIntegerConstant || number == 0 {
+		return p.errorf(code.InvalidLineDirective, "#line requires number between 1 and 2147483647, got %s", toks[0].Raw)
+	}
+	f := p.file()
+	if len(toks) > 1 {
+		raw := string(toks[1].Raw)
+		if toks[1].Type != TokenStringLiteral {
+			return p.errorf(code.InvalidLineDirective, "invalid file name %s after #line", raw)
+		}
+		f.presumedName = raw[1 : len(raw)-1]
+	}
+	if len(toks) > 2 {
+		return p.errorf(code.InvalidLineDirective, "extra tokens after #line %s %s", toks[0].Raw, toks[1].Raw)
 	}
-	return tok, tok.Line == p.ppLine, nil
+	f.lineDelta = int(number) - (p.ppLine + 1)
+	return p.nextUnexpanded()
 }
 
-func (p *preprocesor) setMacro(name string, body []Token) {
-	p.macros[name] = body
+// directivePosition is position of '#' starting current directive, as seen in tokens.
+func (p *preprocesor) directivePosition() Token {
+	f := p.file()
+	return Token{File: f.displayName(), Line: p.ppLine + f.lineDelta, Column: p.ppColumn}
 }
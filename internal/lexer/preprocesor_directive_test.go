@@ -0,0 +1,141 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
+func TestPreprocesor_Directives(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		warnings []string
+	}{
+		{
+			name:  "line remaps following lines",
+			input: "a\n#line 100\nb\nc\n#define L __LINE__\nL",
+			want:  "1:a 100:b 101:c 102:103",
+		},
+		{
+			name:  "line with file name",
+			input: "#line 7 \"gen.y\"\nx __FILE__",
+			want:  `gen.y:7:x gen.y:7:"gen.y"`,
+		},
+		{
+			name:  "line is macro expanded",
+			input: "#define N 20\n#line N\nx",
+			want:  "20:x",
+		},
+		{
+			name:  "line marker of preprocessed output",
+			input: "# 12 \"board.h\"\nx\n# 3 \"main.c\"\ny",
+			want:  "board.h:12:x main.c:3:y",
+		},
+		{
+			name:     "warning",
+			input:    "#warning don't use   this   \nx\n#warning\n",
+			want:     "2:x",
+			warnings: []string{"1:1 warning: #warning don't use   this", "3:1 warning: #warning"},
+		},
+		{
+			name:     "warning position follows line",
+			input:    "#line 50\n  #warning late\n",
+			warnings: []string{"50:3 warning: #warning late"},
+		},
+		{
+			name:  "pragmas are ignored",
+			input: "#pragma once\n#pragma GCC optimize(\"O2\")\n#pragma\nx",
+			want:  "4:x",
+		},
+		{
+			name:  "error in skipped branch",
+			input: "#ifdef UNSUPPORTED\n#error unsupported target\n#endif\nx",
+			want:  "4:x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := newTestLexerFromString(tt.input)
+			var got []string
+			for {
+				tok, err := lex.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal("unexpected error:", err)
+				}
+				pos := fmt.Sprintf("%d:%s", tok.Line, tok.Raw)
+				if tok.File != "" {
+					pos = tok.File + ":" + pos
+				}
+				got = append(got, pos)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, strings.Join(got, " "))
+			}
+			var warnings []string
+			for _, w := range lex.Warnings() {
+				warnings = append(warnings, w.String())
+			}
+			if strings.Join(warnings, "\n") != strings.Join(tt.warnings, "\n") {
+				t.Fatalf("expected warnings %q, got %q", tt.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestPreprocesor_UnknownPragmaWarning(t *testing.T) {
+	lex := newTestLexerFromString("#pragma once\n#pragma pack(1)\n")
+	lex.p.warnUnknownPragmas = true
+	if _, err := lex.Next(); err != io.EOF {
+		t.Fatalf("expected end of file, got %v", err)
+	}
+	warnings := lex.Warnings()
+	if len(warnings) != 1 || warnings[0].String() != "2:1 warning: ignoring unknown #pragma pack" || warnings[0].Code != code.UnknownPragma {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
+
+func TestPreprocesor_DirectiveErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+		code  code.Code
+	}{
+		{name: "error", input: "x\n  #error unsupported target: CH32V307\n", msg: "2:3 #error unsupported target: CH32V307", code: code.ErrorDirective},
+		{name: "error after line", input: "#line 10 \"board.h\"\n#error no\n", msg: "board.h:10:1 #error no", code: code.ErrorDirective},
+		{name: "empty error", input: "#error\n", msg: "1:1 #error", code: code.ErrorDirective},
+		{name: "line without number", input: "#line\n", msg: "line number missing after #line", code: code.InvalidLineDirective},
+		{name: "line zero", input: "#line 0\n", msg: "#line requires number between 1 and 2147483647, got 0", code: code.InvalidLineDirective},
+		{name: "line too big", input: "#line 2147483648\n", msg: "#line requires number between 1 and 2147483647, got 2147483648", code: code.InvalidLineDirective},
+		{name: "line hex", input: "#line 0x10\n", msg: "#line requires number between 1 and 2147483647, got 0x10", code: code.InvalidLineDirective},
+		{name: "line bad file", input: "#line 3 file\n", msg: "invalid file name file after #line", code: code.InvalidLineDirective},
+		{name: "line extra tokens", input: "#line 3 \"a.c\" 1\n", msg: "extra tokens after #line 3 \"a.c\"", code: code.InvalidLineDirective},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := newTestLexerFromString(tt.input)
+			var err error
+			for err == nil {
+				_, err = lex.Next()
+			}
+			if err == io.EOF || !strings.Contains(err.Error(), tt.msg) {
+				t.Fatalf("expected error containing %q, got %v", tt.msg, err)
+			}
+			var lexErr *Error
+			if !errors.As(err, &lexErr) || lexErr.Code != tt.code {
+				t.Fatalf("expected error with code %s, got %#v", tt.code, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ppValue is value of #if expression, computed in intmax_t or uintmax_t as C requires.
+type ppValue struct {
+	n        int64
+	unsigned bool
+}
+
+var ppBinaryPrecedence = map[TokenType]int{
+	TokenOrOr:       1,
+	TokenAndAnd:     2,
+	TokenPipe:       3,
+	TokenCaret:      4,
+	TokenAmp:        5,
+	TokenEq:         6,
+	TokenNe:         6,
+	TokenLt:         7,
+	TokenGt:         7,
+	TokenLe:         7,
+	TokenGe:         7,
+	TokenShiftLeft:  8,
+	TokenShiftRight: 8,
+	TokenPlus:       9,
+	TokenMinus:      9,
+	TokenStar:       10,
+	TokenSlash:      10,
+	TokenPercent:    10,
+}
+
+// ppExpression parses and evaluates #if tokens in one pass.
+// Operands of short-circuited operators are parsed but not evaluated,
+// so 0 && 1 / 0 is valid.
+type ppExpression struct {
+	toks []Token
+	pos  int
+}
+
+// evalCondition evaluates #if expression: defined operators are resolved first,
+// then macros are expanded and remaining identifiers are 0.
+func (p *preprocesor) evalCondition(toks []Token) (ppValue, error) {
+	var resolved []Token
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		if tok.Type != TokenIdentifier || string(tok.Raw) != "defined" {
+			resolved = append(resolved, tok)
+			continue
+		}
+		parens := i+1 < len(toks) && toks[i+1].Type == TokenLParen
+		name := i + 1
+		if parens {
+			name++
+		}
+		if name >= len(toks) || !isMacroName(toks[name]) {
+			return ppValue{}, errors.New("macro name missing after defined")
+		}
+		if parens && (name+1 >= len(toks) || toks[name+1].Type != TokenRParen) {
+			return ppValue{}, errors.New("missing ) after defined")
+		}
+		value := "0"
+		if _, ok := p.macros[string(toks[name].Raw)]; ok {
+			value = "1"
+		}
+		resolved = append(resolved, Token{Type: TokenIntegerConstant, Raw: []byte(value), File: tok.File, Line: tok.Line, Column: tok.Column})
+		i = name
+		if parens {
+			i++
+		}
+	}
+
+	expanded, err := p.expandTokens(resolved)
+	if err != nil {
+		return ppValue{}, err
+	}
+	e := &ppExpression{toks: expanded}
+	v, err := e.conditional(true)
+	if err != nil {
+		return ppValue{}, err
+	}
+	if e.pos < len(e.toks) {
+		return ppValue{}, fmt.Errorf("unexpected %s", e.toks[e.pos].Raw)
+	}
+	return v, nil
+}
+
+func (e *ppExpression) peek() (Token, bool) {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos], true
+	}
+	return Token{}, false
+}
+
+func (e *ppExpression) conditional(eval bool) (ppValue, error) {
+	cond, err := e.binary(1, eval)
+	if err != nil {
+		return ppValue{}, err
+	}
+	if tok, ok := e.peek(); !ok || tok.Type != TokenQuestion {
+		return cond, nil
+	}
+	e.pos++
+	a, err := e.conditional(eval && cond.n != 0)
+	if err != nil {
+		return ppValue{}, err
+	}
+	if tok, ok := e.peek(); !ok || tok.Type != TokenColon {
+		return ppValue{}, errors.New("expected : in conditional expression")
+	}
+	e.pos++
+	b, err := e.conditional(eval && cond.n == 0)
+	if err != nil {
+		return ppValue{}, err
+	}
+	res := b
+	if cond.n != 0 {
+		res = a
+	}
+	res.unsigned = a.unsigned || b.unsigned
+	return res, nil
+}
+
+func (e *ppExpression) binary(minPrec int, eval bool) (ppValue, error) {
+	lhs, err := e.unary(eval)
+	if err != nil {
+		return ppValue{}, err
+	}
+	for {
+		tok, ok := e.peek()
+		prec := ppBinaryPrecedence[tok.Type]
+		if !ok || prec == 0 || prec < minPrec {
+			return lhs, nil
+		}
+		e.pos++
+		evalRHS := eval
+		switch tok.Type {
+		case TokenAndAnd:
+			evalRHS = eval && lhs.n != 0
+		case TokenOrOr:
+			evalRHS = eval && lhs.n == 0
+		}
+		rhs, err := e.binary(prec+1, evalRHS)
+		if err != nil {
+			return ppValue{}, err
+		}
+		lhs, err = applyBinary(tok.Type, lhs, rhs, evalRHS)
+		if err != nil {
+			return ppValue{}, err
+		}
+	}
+}
+
+func (e *ppExpression) unary(eval bool) (ppValue, error) {
+	tok, ok := e.peek()
+	if !ok {
+		return ppValue{}, errors.New("unexpected end of expression")
+	}
+	switch tok.Type {
+	case TokenPlus, TokenMinus, TokenTilde, TokenBang:
+		e.pos++
+		v, err := e.unary(eval)
+		if err != nil {
+			return ppValue{}, err
+		}
+		switch tok.Type {
+		case TokenMinus:
+			v.n = -v.n
+		case TokenTilde:
+			v.n = ^v.n
+		case TokenBang:
+			v = boolValue(v.n == 0)
+		}
+		return v, nil
+	case TokenLParen:
+		e.pos++
+		v, err := e.conditional(eval)
+		if err != nil {
+			return ppValue{}, err
+		}
+		if tok, ok := e.peek(); !ok || tok.Type != TokenRParen {
+			return ppValue{}, errors.New("missing )")
+		}
+		e.pos++
+		return v, nil
+	case TokenIntegerConstant:
+		e.pos++
+		return parsePPInteger(string(tok.Raw))
+	case TokenCharacterConstant:
+		e.pos++
+		return parsePPCharacter(string(tok.Raw))
+	}
+	if isMacroName(tok) {
+		// identifiers left after substitution are 0, keywords included
+		e.pos++
+		return ppValue{}, nil
+	}
+	return ppValue{}, fmt.Errorf("unexpected %s", tok.Raw)
+}
+
+func applyBinary(op TokenType, a, b ppValue, eval bool) (ppValue, error) {
+	unsigned := a.unsigned || b.unsigned
+	x, y := uint64(a.n), uint64(b.n)
+	switch op {
+	case TokenOrOr:
+		return boolValue(a.n != 0 || b.n != 0), nil
+	case TokenAndAnd:
+		return boolValue(a.n != 0 && b.n != 0), nil
+	case TokenPipe:
+		return ppValue{n: a.n | b.n, unsigned: unsigned}, nil
+	case TokenCaret:
+		return ppValue{n: a.n ^ b.n, unsigned: unsigned}, nil
+	case TokenAmp:
+		return ppValue{n: a.n & b.n, unsigned: unsigned}, nil
+	case TokenEq:
+		return boolValue(a.n == b.n), nil
+	case TokenNe:
+		return boolValue(a.n != b.n), nil
+	case TokenLt, TokenGt, TokenLe, TokenGe:
+		less, greater := a.n < b.n, a.n > b.n
+		if unsigned {
+			less, greater = x < y, x > y
+		}
+		switch op {
+		case TokenLt:
+			return boolValue(less), nil
+		case TokenGt:
+			return boolValue(greater), nil
+		case TokenLe:
+			return boolValue(!greater), nil
+		default:
+			return boolValue(!less), nil
+		}
+	case TokenShiftLeft, TokenShiftRight:
+		// result has type of left operand
+		if b.n < 0 || b.n > 63 {
+			if eval {
+				return ppValue{}, fmt.Errorf("shift by %d", b.n)
+			}
+			return ppValue{}, nil
+		}
+		if op == TokenShiftLeft {
+			return ppValue{n: a.n << b.n, unsigned: a.unsigned}, nil
+		}
+		if a.unsigned {
+			return ppValue{n: int64(x >> b.n), unsigned: true}, nil
+		}
+		return ppValue{n: a.n >> b.n}, nil
+	case TokenPlus:
+		return ppValue{n: a.n + b.n, unsigned: unsigned}, nil
+	case TokenMinus:
+		return ppValue{n: a.n - b.n, unsigned: unsigned}, nil
+	case TokenStar:
+		return ppValue{n: a.n * b.n, unsigned: unsigned}, nil
+	default:
+		if b.n == 0 {
+			if eval {
+				return ppValue{}, errors.New("division by zero")
+			}
+			return ppValue{}, nil
+		}
+		if unsigned {
+			if op == TokenSlash {
+				return ppValue{n: int64(x / y), unsigned: true}, nil
+			}
+			return ppValue{n: int64(x % y), unsigned: true}, nil
+		}
+		if a.n == math.MinInt64 && b.n == -1 {
+			// overflows intmax_t
+			return ppValue{}, nil
+		}
+		if op == TokenSlash {
+			return ppValue{n: a.n / b.n}, nil
+		}
+		return ppValue{n: a.n % b.n}, nil
+	}
+}
+
+func boolValue(b bool) ppValue {
+	if b {
+		return ppValue{n: 1}
+	}
+	return ppValue{}
+}
+
+// parsePPInteger parses integer constant with optional u and l suffixes.
+// Constants not fitting intmax_t are unsigned.
+func parsePPInteger(raw string) (ppValue, error) {
+	digits := strings.TrimRight(strings.ToLower(raw), "ul")
+	unsigned := strings.ContainsAny(raw[len(digits):], "uU")
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"):
+		base, digits = 16, digits[2:]
+	case len(digits) > 1 && digits[0] == '0':
+		base, digits = 8, digits[1:]
+	}
+	n, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return ppValue{}, fmt.Errorf("invalid integer constant %s", raw)
+	}
+	return ppValue{n: int64(n), unsigned: unsigned || n > math.MaxInt64}, nil
+}
+
+// parsePPCharacter parses character constant, with escapes lexer accepts.
+func parsePPCharacter(raw string) (ppValue, error) {
+	body := strings.TrimSuffix(strings.TrimPrefix(raw, "'"), "'")
+	if len(body) == 1 {
+		// char is signed
+		return ppValue{n: int64(int8(body[0]))}, nil
+	}
+	if len(body) == 2 && body[0] == '\\' {
+		switch body[1] {
+		case 'n':
+			return ppValue{n: '\n'}, nil
+		case 't':
+			return ppValue{n: '\t'}, nil
+		case 'r':
+			return ppValue{n: '\r'}, nil
+		case '0':
+			return ppValue{}, nil
+		case '\\', '\'':
+			return ppValue{n: int64(body[1])}, nil
+		}
+	}
+	return ppValue{}, fmt.Errorf("unsupported character constant %s", raw)
+}
@@ -0,0 +1,225 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
+var (
+	headerNameSpace = byteClassChars(' ', '\t')
+	headerNameBody  = byteClassChars('>', '\n').negate()
+)
+
+func (p *preprocesor) handleInclude() (Token, error) {
+	name, angled, err := p.includeName()
+	if err != nil {
+		return Token{}, err
+	}
+	// errors are reported at header name
+	line, column := p.line, p.column
+	rest, err := p.directiveTokens()
+	if err != nil {
+		return Token{}, err
+	}
+	p.line, p.column = line, column
+	if len(rest) > 0 {
+		return p.errorf(code.IncludeFailed, "extra tokens after #include %s", name)
+	}
+
+	resolved, fd, err := p.openInclude(name, angled)
+	if err != nil {
+		return p.errorf(code.IncludeFailed, "#include %s: %v", name, err)
+	}
+	if p.once[resolved] {
+		fd.Close()
+		return p.nextUnexpanded()
+	}
+	var cycle error
+	if chain := p.includeCycle(resolved); chain != "" {
+		_, cycle = p.errorf(code.IncludeFailed, "#include %s: include cycle %s without include guard", name, chain)
+	}
+	if err := p.pushFile(resolved, fd); err != nil {
+		fd.Close()
+		return p.errorf(code.IncludeFailed, "#include %s: %v", name, err)
+	}
+	p.file().cycle = cycle
+	return p.nextUnexpanded()
+}
+
+// includeCycle returns chain of files from name on include stack to name included
+// again, empty when name is not being included.
+func (p *preprocesor) includeCycle(name string) string {
+	for i, f := range p.files {
+		if f.name == name {
+			var chain []string
+			for _, f := range p.files[i:] {
+				chain = append(chain, f.shown)
+			}
+			return strings.Join(append(chain, p.shownName(name)), " -> ")
+		}
+	}
+	return ""
+}
+
+// includeName reads "file" or <file>. Header name in angle brackets is not token,
+// so it is read from scanner directly. Other forms are macro expanded first.
+func (p *preprocesor) includeName() (string, bool, error) {
+	if p.file().pending == nil {
+		if _, _, err := p.s.readBytesInClass(headerNameSpace); err != nil && err != io.EOF {
+			return "", false, err
+		}
+		if b, err := p.s.peekOne(); err == nil && b == '<' {
+			p.line, p.column = p.s.line, p.s.column
+			p.s.popOneFromBuffer()
+			return p.angledHeaderName()
+		}
+	}
+
+	first, ok, err := p.nextDirectiveToken()
+	if err != nil {
+		return "", false, err
+	}
+	if ok && first.Type == TokenStringLiteral {
+		raw := string(first.Raw)
+		return raw[1 : len(raw)-1], false, nil
+	}
+	rest, err := p.directiveTokens()
+	if err != nil {
+		return "", false, err
+	}
+	if ok {
+		p.line, p.column = first.Line, first.Column
+		rest = append([]Token{first}, rest...)
+	}
+	expanded, err := p.expandTokens(rest)
+	if err != nil {
+		return "", false, err
+	}
+
+	switch last := len(expanded) - 1; {
+	case last == 0 && expanded[0].Type == TokenStringLiteral:
+		raw := string(expanded[0].Raw)
+		return raw[1 : len(raw)-1], false, nil
+	case last > 0 && expanded[0].Type == TokenLt && expanded[last].Type == TokenGt:
+		var name strings.Builder
+		for _, tok := range expanded[1:last] {
+			name.Write(tok.Raw)
+		}
+		return name.String(), true, nil
+	}
+	_, err = p.errorf(code.IncludeFailed, "expected \"file\" or <file> after #include")
+	return "", false, err
+}
+
+func (p *preprocesor) angledHeaderName() (string, bool, error) {
+	var name strings.Builder
+	for {
+		data, isPartial, err := p.s.readBytesInClass(headerNameBody)
+		if err != nil && err != io.EOF {
+			return "", false, err
+		}
+		name.Write(data)
+		if !isPartial {
+			break
+		}
+	}
+	if b, err := p.s.peekOne(); err != nil || b != '>' {
+		_, err := p.errorf(code.IncludeFailed, "missing > in #include <%s", name.String())
+		return "", false, err
+	}
+	p.s.popOneFromBuffer()
+	return name.String(), true, nil
+}
+
+// openInclude finds file next to including file (only for "file") and then in include paths.
+func (p *preprocesor) openInclude(name string, angled bool) (string, fs.File, error) {
+	if p.fsys == nil {
+		return "", nil, errors.New("lexer has no file system to include from")
+	}
+	var candidates []string
+	if !angled {
+		candidates = append(candidates, path.Join(path.Dir(p.file().name), name))
+	}
+	for _, dir := range p.includePaths {
+		candidates = append(candidates, path.Join(dir, name))
+	}
+	for _, candidate := range candidates {
+		if !fs.ValidPath(candidate) {
+			continue
+		}
+		fd, err := p.fsys.Open(candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return candidate, fd, nil
+	}
+	return "", nil, fs.ErrNotExist
+}
+
+// pushFile makes included file current, rejecting too deep nesting. Include guard
+// of file included again while it is included is checked as file is read, recursion
+// it does not stop, e.g. with guard defined after #include, stops at depth limit.
+func (p *preprocesor) pushFile(name string, fd fs.File) error {
+	if len(p.files) >= p.maxIncludeDepth {
+		chain := make([]string, 0, len(p.files)+1)
+		for _, f := range p.files {
+			chain = append(chain, f.shown)
+		}
+		return fmt.Errorf("include depth limit of %d exceeded: %s", p.maxIncludeDepth, strings.Join(append(chain, p.shownName(name)), " -> "))
+	}
+
+	p.file().lastSeenLine = p.lastSeenLine
+	s := newScanner(fd, 0)
+	p.files = append(p.files, &sourceFile{name: name, shown: p.shownName(name), s: s, close: fd.Close})
+	p.s = s
+	p.lastSeenLine = 0
+	return nil
+}
+
+// shownName is name of file tokens of it carry.
+func (p *preprocesor) shownName(name string) string {
+	if p.fileName == nil {
+		return name
+	}
+	return p.fileName(name)
+}
+
+// popFile closes innermost included file and continues with one including it.
+func (p *preprocesor) popFile() error {
+	f := p.file()
+	p.files = p.files[:len(p.files)-1]
+	parent := p.file()
+	p.s = parent.s
+	p.lastSeenLine = parent.lastSeenLine
+	if f.close == nil {
+		// predefined macros are not read from file
+		return nil
+	}
+	if err := f.close(); err != nil {
+		return fmt.Errorf("close %s: %w", f.shown, err)
+	}
+	return nil
+}
+
+// closeFiles closes all files lexer opened.
+func (p *preprocesor) closeFiles() error {
+	var errs []error
+	for _, f := range p.files {
+		if f.close != nil {
+			errs = append(errs, f.close())
+		}
+	}
+	p.files = p.files[:1]
+	p.files[0].close = nil
+	p.s = p.files[0].s
+	return errors.Join(errs...)
+}
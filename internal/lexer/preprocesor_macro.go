@@ -0,0 +1,415 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
+// vaArgs is parameter name of variadic arguments.
+const vaArgs = "__VA_ARGS__"
+
+// macro is #define'd name. Body is kept as written, macros in it are expanded
+// when expansion is rescanned.
+type macro struct {
+	name string
+	body []Token
+	// defined is name token of #define, for diagnostics
+	defined Token
+	// dynamic macros like __LINE__ are computed at use
+	dynamic func(p *preprocesor, tok Token) Token
+
+	functionLike bool
+	// params of function-like macro, variadic one is last and named __VA_ARGS__
+	params   []string
+	variadic bool
+}
+
+func (m *macro) param(tok Token) int {
+	if !m.functionLike || tok.Type != TokenIdentifier {
+		return -1
+	}
+	return slices.Index(m.params, string(tok.Raw))
+}
+
+// tokenSource yields tokens before macro expansion. unread puts tokens back to its front.
+type tokenSource interface {
+	nextUnexpanded() (Token, error)
+	unread(toks ...Token)
+}
+
+// tokenList is tokenSource of macro argument expanded in isolation.
+type tokenList struct {
+	toks []Token
+}
+
+func (l *tokenList) nextUnexpanded() (Token, error) {
+	if len(l.toks) == 0 {
+		return Token{}, io.EOF
+	}
+	tok := l.toks[0]
+	l.toks = l.toks[1:]
+	return tok, nil
+}
+
+func (l *tokenList) unread(toks ...Token) {
+	l.toks = append(slices.Clone(toks), l.toks...)
+}
+
+func (p *preprocesor) unread(toks ...Token) {
+	p.readyTokens = append(slices.Clone(toks), p.readyTokens...)
+}
+
+// expandNext returns next token of src with macros expanded. Expansion is pushed back
+// to src and rescanned, tokens remember macros they come from in hide set,
+// so macro is not expanded again inside its own expansion.
+func (p *preprocesor) expandNext(src tokenSource) (Token, error) {
+	for {
+		tok, err := src.nextUnexpanded()
+		if err != nil {
+			return Token{}, err
+		}
+		if len(tok.hide) == 0 {
+			// token of source, not of macro body
+			p.invocation = tok
+		}
+		m, isMacro := p.macros[string(tok.Raw)]
+		if !isMacro || !isMacroName(tok) || slices.Contains(tok.hide, m.name) {
+			return tok, nil
+		}
+		if m.dynamic != nil {
+			value := m.dynamic(p, tok)
+			value.hide = withHidden(tok.hide, m.name)
+			return placeExpansion([]Token{value}, tok, m)[0], nil
+		}
+		expansion, ok, err := p.expandMacro(src, m, tok)
+		if err != nil {
+			return Token{}, err
+		}
+		if !ok {
+			return tok, nil
+		}
+		src.unread(expansion...)
+	}
+}
+
+// expandTokens fully expands tokens, e.g. of directive or macro argument.
+func (p *preprocesor) expandTokens(toks []Token) ([]Token, error) {
+	src := &tokenList{toks: toks}
+	var out []Token
+	for {
+		tok, err := p.expandNext(src)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tok)
+	}
+}
+
+// expandMacro substitutes invocation of macro named by tok. Name of function-like macro
+// not followed by '(' is not invocation, false is returned.
+func (p *preprocesor) expandMacro(src tokenSource, m *macro, tok Token) ([]Token, bool, error) {
+	hide := withHidden(tok.hide, m.name)
+	if !m.functionLike {
+		out, err := p.substituteBody(m, nil, hide)
+		return placeExpansion(out, tok, m), true, err
+	}
+
+	paren, err := src.nextUnexpanded()
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if paren.Type != TokenLParen {
+		src.unread(paren)
+		return nil, false, nil
+	}
+
+	args, rparen, err := p.macroArguments(src, m, tok)
+	if err != nil {
+		return nil, false, err
+	}
+	// names hidden at both ends of invocation stay hidden
+	hide = withHidden(intersectHidden(tok.hide, rparen.hide), m.name)
+	out, err := p.substituteBody(m, args, hide)
+	return placeExpansion(out, tok, m), true, err
+}
+
+// macroArguments reads arguments up to closing parenthesis, which is returned too.
+func (p *preprocesor) macroArguments(src tokenSource, m *macro, name Token) ([][]Token, Token, error) {
+	args := [][]Token{nil}
+	depth := 0
+	for {
+		tok, err := src.nextUnexpanded()
+		if err == io.EOF {
+			return nil, Token{}, p.tokenErrorf(code.InvalidMacroInvocation, name, "unterminated argument list invoking macro %s", m.name)
+		}
+		if err != nil {
+			return nil, Token{}, err
+		}
+		switch {
+		case tok.Type == TokenLParen:
+			depth++
+		case tok.Type == TokenRParen && depth == 0:
+			return p.checkArguments(m, name, args, tok)
+		case tok.Type == TokenRParen:
+			depth--
+		case tok.Type == TokenComma && depth == 0 && (!m.variadic || len(args) < len(m.params)):
+			// commas of variadic arguments are part of __VA_ARGS__
+			args = append(args, nil)
+			continue
+		}
+		args[len(args)-1] = append(args[len(args)-1], tok)
+	}
+}
+
+func (p *preprocesor) checkArguments(m *macro, name Token, args [][]Token, rparen Token) ([][]Token, Token, error) {
+	if len(m.params) == 0 && len(args) == 1 && len(args[0]) == 0 {
+		return nil, rparen, nil
+	}
+	if m.variadic && len(args) == len(m.params)-1 {
+		// empty __VA_ARGS__
+		args = append(args, nil)
+	}
+	if len(args) != len(m.params) {
+		return nil, Token{}, p.tokenErrorf(code.InvalidMacroInvocation, name, "macro %s requires %d arguments, but %d given", m.name, len(m.params), len(args))
+	}
+	return args, rparen, nil
+}
+
+// substituteBody replaces parameters in macro body, applies # and ## and adds hide set.
+// Parameters next to # and ## are replaced by argument as written, others by expanded argument.
+func (p *preprocesor) substituteBody(m *macro, args [][]Token, hide []string) ([]Token, error) {
+	expanded := make([][]Token, len(args))
+	var out []Token
+	paste := false
+	for i := 0; i < len(m.body); i++ {
+		tok := m.body[i]
+		var items []Token
+		nextIsPaste := i+1 < len(m.body) && m.body[i+1].Type == tokenPreProcGlue
+		switch idx := m.param(tok); {
+		case tok.Type == tokenPreProcGlue:
+			paste = true
+			continue
+		case tok.Type == tokenPreprocStart && m.functionLike:
+			// checked at definition to be followed by parameter
+			i++
+			items = []Token{stringify(args[m.param(m.body[i])], tok)}
+		case idx >= 0 && (paste || nextIsPaste):
+			items = slices.Clone(args[idx])
+			if len(items) == 0 {
+				// placemarker of empty argument, so ## has operand
+				items = []Token{{Type: tokenPlacemarker}}
+			}
+		case idx >= 0:
+			if expanded[idx] == nil {
+				exp, err := p.expandTokens(args[idx])
+				if err != nil {
+					return nil, err
+				}
+				expanded[idx] = append([]Token{}, exp...)
+			}
+			items = slices.Clone(expanded[idx])
+		default:
+			items = []Token{tok}
+		}
+		if idx := m.param(tok); idx >= 0 && len(items) > 0 {
+			// argument is spaced like parameter it replaces
+			items[0].spaceBefore = tok.spaceBefore
+		}
+
+		if paste && len(out) > 0 && len(items) > 0 {
+			pasted, err := p.paste(out[len(out)-1], items[0])
+			if err != nil {
+				return nil, err
+			}
+			out[len(out)-1] = pasted
+			items = items[1:]
+		}
+		paste = false
+		out = append(out, items...)
+	}
+
+	result := out[:0]
+	for _, tok := range out {
+		if tok.Type == tokenPlacemarker {
+			continue
+		}
+		tok.hide = unionHidden(tok.hide, hide)
+		result = append(result, tok)
+	}
+	return result, nil
+}
+
+// placeExpansion gives first token of expansion spacing of macro name it replaces.
+// All tokens record expansion, arguments expanded before substitution included,
+// so chain of expansions ends at macro used in source.
+func placeExpansion(toks []Token, name Token, m *macro) []Token {
+	if len(toks) > 0 {
+		toks[0].spaceBefore = name.spaceBefore
+	}
+	e := &Expansion{Macro: m.name, Site: name, Defined: m.defined}
+	for i := range toks {
+		toks[i].Expansion = e
+	}
+	return toks
+}
+
+// stringify implements # operator, whitespace between tokens becomes single space.
+func stringify(arg []Token, hash Token) Token {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, tok := range arg {
+		if i > 0 && tok.spaceBefore {
+			b.WriteByte(' ')
+		}
+		raw := string(tok.Raw)
+		if tok.Type == TokenStringLiteral || tok.Type == TokenCharacterConstant {
+			raw = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(raw)
+		}
+		b.WriteString(raw)
+	}
+	b.WriteByte('"')
+	return Token{Type: TokenStringLiteral, Raw: []byte(b.String()), File: hash.File, Line: hash.Line, Column: hash.Column, Span: hash.Span, spaceBefore: hash.spaceBefore}
+}
+
+// paste implements ## operator, concatenation must lex as single token.
+func (p *preprocesor) paste(lhs, rhs Token) (Token, error) {
+	if lhs.Type == tokenPlacemarker {
+		return rhs, nil
+	}
+	if rhs.Type == tokenPlacemarker {
+		return lhs, nil
+	}
+	text := string(lhs.Raw) + string(rhs.Raw)
+	s := newScanner(strings.NewReader(text), len(text))
+	var raw []byte
+	tokType, err := lex(s, func(data []byte) { raw = append(raw, data...) })
+	if err == nil && string(raw) == text {
+		switch tokType {
+		case TokenIdentifier:
+			tokType = keywordType(text)
+		case tokenDots:
+			tokType = map[string]TokenType{".": TokenDot, "...": TokenEllipsis}[text]
+		}
+		if tokType != tokenNil && tokType != tokenWhitespace {
+			lhs.Type = tokType
+			lhs.Raw = []byte(text)
+			lhs.hide = nil
+			return lhs, nil
+		}
+	}
+	return Token{}, p.tokenErrorf(code.InvalidTokenPaste, lhs, "pasting %q and %q does not give valid token", lhs.Raw, rhs.Raw)
+}
+
+// parseMacroParams reads parameter list of function-like macro, toks follow '('.
+// Rest of tokens is body.
+func (p *preprocesor) parseMacroParams(m *macro, name Token, toks []Token) ([]Token, error) {
+	m.functionLike = true
+	if len(toks) > 0 && toks[0].Type == TokenRParen {
+		return toks[1:], nil
+	}
+	for i := 0; ; i += 2 {
+		if i >= len(toks) {
+			return nil, p.tokenErrorf(code.InvalidMacroDefinition, name, "missing ) in parameter list of macro %s", m.name)
+		}
+		switch tok := toks[i]; {
+		case tok.Type == TokenEllipsis:
+			m.params = append(m.params, vaArgs)
+			m.variadic = true
+		case tok.Type == TokenIdentifier && string(tok.Raw) != vaArgs:
+			if slices.Contains(m.params, string(tok.Raw)) {
+				return nil, p.tokenErrorf(code.InvalidMacroDefinition, tok, "duplicate parameter %s of macro %s", tok.Raw, m.name)
+			}
+			m.params = append(m.params, string(tok.Raw))
+		default:
+			return nil, p.tokenErrorf(code.InvalidMacroDefinition, tok, "expected parameter name of macro %s, got %q", m.name, tok.Raw)
+		}
+
+		switch {
+		case i+1 < len(toks) && toks[i+1].Type == TokenRParen:
+			return toks[i+2:], nil
+		case i+1 < len(toks) && toks[i+1].Type == TokenComma && !m.variadic:
+			continue
+		default:
+			return nil, p.tokenErrorf(code.InvalidMacroDefinition, name, "missing ) in parameter list of macro %s", m.name)
+		}
+	}
+}
+
+// checkMacroBody validates use of # and ## in macro body.
+func (p *preprocesor) checkMacroBody(m *macro, name Token) error {
+	body := m.body
+	if len(body) > 0 && (body[0].Type == tokenPreProcGlue || body[len(body)-1].Type == tokenPreProcGlue) {
+		return p.tokenErrorf(code.InvalidMacroDefinition, name, "'##' cannot appear at either end of macro %s", m.name)
+	}
+	for i, tok := range body {
+		if m.functionLike && tok.Type == tokenPreprocStart && (i+1 == len(body) || m.param(body[i+1]) < 0) {
+			return p.tokenErrorf(code.InvalidMacroDefinition, tok, "'#' is not followed by parameter of macro %s", m.name)
+		}
+		if string(tok.Raw) == vaArgs && !m.variadic {
+			return p.tokenErrorf(code.InvalidMacroDefinition, tok, "__VA_ARGS__ can only appear in variadic macro")
+		}
+	}
+	return nil
+}
+
+func (p *preprocesor) tokenErrorf(c code.Code, tok Token, format string, args ...any) error {
+	return &Error{
+		Code:   c,
+		File:   tok.File,
+		Line:   tok.Line,
+		Column: tok.Column,
+		Span:   tok.Span,
+		Msg:    fmt.Sprintf(format, args...),
+		Notes:  ExpansionNotes(tok),
+	}
+}
+
+// sameDefinition reports if redefinition is identical, which is allowed silently.
+func (m *macro) sameDefinition(other *macro) bool {
+	if m.functionLike != other.functionLike || m.variadic != other.variadic ||
+		!slices.Equal(m.params, other.params) || len(m.body) != len(other.body) || m.dynamic != nil {
+		return false
+	}
+	for i, tok := range m.body {
+		o := other.body[i]
+		if tok.Type != o.Type || string(tok.Raw) != string(o.Raw) || (i > 0 && tok.spaceBefore != o.spaceBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+func withHidden(hide []string, name string) []string {
+	if slices.Contains(hide, name) {
+		return hide
+	}
+	return append(slices.Clone(hide), name)
+}
+
+func unionHidden(a, b []string) []string {
+	out := a
+	for _, name := range b {
+		out = withHidden(out, name)
+	}
+	return out
+}
+
+func intersectHidden(a, b []string) []string {
+	var out []string
+	for _, name := range a {
+		if slices.Contains(b, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,218 @@
+package lexer
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPreprocesor_Macros(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "object-like",
+			input: "#define N 4\n#define EMPTY\nint a[N] EMPTY;",
+			want:  "int a [ 4 ] ;",
+		},
+		{
+			name:  "function-like",
+			input: "#define MAX(a, b) ((a) > (b) ? (a) : (b))\nMAX(x, 1 + y)",
+			want:  "( ( x ) > ( 1 + y ) ? ( x ) : ( 1 + y ) )",
+		},
+		{
+			name:  "nested parentheses and commas in argument",
+			input: "#define FIRST(a, b) a\nFIRST(f(1, 2), 3)",
+			want:  "f ( 1 , 2 )",
+		},
+		{
+			name:  "name without parentheses is not invocation",
+			input: "#define F(x) x\nint F; F (1)",
+			want:  "int F ; 1",
+		},
+		{
+			name:  "space before parameter list makes object-like macro",
+			input: "#define F (x) x\nF(1)",
+			want:  "( x ) x ( 1 )",
+		},
+		{
+			name:  "invocation spans lines",
+			input: "#define F(a, b) a b\nF(1,\n  2)",
+			want:  "1 2",
+		},
+		{
+			name:  "no parameters",
+			input: "#define NOP() ;\nNOP()",
+			want:  ";",
+		},
+		{
+			name:  "empty argument",
+			input: "#define F(a, b) [a|b]\nF(, 2)",
+			want:  "[ | 2 ]",
+		},
+		{
+			name:  "stringification",
+			input: "#define STR(x) #x\nSTR(a  +\tb) STR(\"q\") STR()",
+			want:  `"a + b" "\"q\"" ""`,
+		},
+		{
+			name:  "stringified argument is not expanded",
+			input: "#define N 4\n#define STR(x) #x\n#define XSTR(x) STR(x)\nSTR(N) XSTR(N)",
+			want:  `"N" "4"`,
+		},
+		{
+			name:  "token pasting",
+			input: "#define REG(n) GPIO ## n ## _BASE\n#define OP(a, b) a ## b\nREG(A) OP(<, <=) OP(1, 5u) OP(, x) OP(y, )",
+			want:  "GPIOA_BASE <<= 15u x y",
+		},
+		{
+			name:  "pasted operand is not expanded",
+			input: "#define A 1\n#define CAT(a, b) a ## b\nCAT(A, B) CAT(A, )",
+			want:  "AB 1",
+		},
+		{
+			name:  "pasting makes keyword",
+			input: "#define CAT(a, b) a ## b\nCAT(in, t)",
+			want:  "int",
+		},
+		{
+			name:  "variadic",
+			input: "#define LOG(fmt, ...) printf(fmt, __VA_ARGS__)\nLOG(\"%d %d\", 1, (2, 3))",
+			want:  `printf ( "%d %d" , 1 , ( 2 , 3 ) )`,
+		},
+		{
+			name:  "only variadic",
+			input: "#define CALL(...) f(__VA_ARGS__)\nCALL() CALL(a, b)",
+			want:  "f ( ) f ( a , b )",
+		},
+		{
+			name:  "empty variadic arguments",
+			input: "#define LOG(fmt, ...) fmt __VA_ARGS__\nLOG(1)",
+			want:  "1",
+		},
+		{
+			name:  "arguments are expanded before substitution",
+			input: "#define N 4\n#define TWICE(x) x x\nTWICE(N)",
+			want:  "4 4",
+		},
+		{
+			name:  "rescan expands macros of body",
+			input: "#define SQR(x) ((x) * (x))\n#define CUBE(x) (SQR(x) * (x))\nCUBE(2)",
+			want:  "( ( ( 2 ) * ( 2 ) ) * ( 2 ) )",
+		},
+		{
+			name:  "defined later is expanded at use",
+			input: "#define A B\n#define B 2\nA",
+			want:  "2",
+		},
+		{
+			name:  "self reference is not expanded again",
+			input: "#define f(x) x + f(x)\n#define g g\nf(1) g",
+			want:  "1 + f ( 1 ) g",
+		},
+		{
+			name:  "mutual recursion stops",
+			input: "#define a b\n#define b a\na b",
+			want:  "a b",
+		},
+		{
+			name:  "function-like name from expansion invoked with following parenthesis",
+			input: "#define F(x) [x]\n#define G F\nG(1)",
+			want:  "[ 1 ]",
+		},
+		{
+			name:  "register access helpers",
+			input: "#define PERIPH_BASE 0x40000000\n#define REG32(addr) (*(volatile unsigned *)(addr))\n#define GPIO(port, off) REG32(PERIPH_BASE + GPIO ## port ## _OFFSET + (off))\nGPIO(C, 4) = 1;",
+			want:  "( * ( volatile unsigned * ) ( 0x40000000 + GPIOC_OFFSET + ( 4 ) ) ) = 1 ;",
+		},
+		{
+			name:  "undef",
+			input: "#define A 1\n#define F(x) x\nA F(2)\n#undef A\n#undef F\n#undef NEVER_DEFINED\nA F(2)",
+			want:  "1 2 A F ( 2 )",
+		},
+		{
+			name:  "line and file are of invocation",
+			input: "#define HERE __LINE__\n\nHERE\n__LINE__ __FILE__",
+			want:  `3 4 ""`,
+		},
+		{
+			name:  "function-like macro in if expression",
+			input: "#define VERSION(major, minor) ((major) * 100 + (minor))\n#if VERSION(1, 2) == 102\nyes\n#endif\n",
+			want:  "yes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := newTestLexerFromString(tt.input)
+			var got []string
+			for {
+				tok, err := lex.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal("unexpected error:", err)
+				}
+				got = append(got, string(tok.Raw))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, strings.Join(got, " "))
+			}
+		})
+	}
+}
+
+func TestPreprocesor_MacroTokenTypes(t *testing.T) {
+	lex := newTestLexerFromString("#define CAT(a, b) a ## b\nCAT(whi, le) CAT(+, =) CAT(<, <)")
+	want := []TokenType{TokenWhile, TokenPlusAssign, TokenShiftLeft}
+	for _, tokType := range want {
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if tok.Type != tokType {
+			t.Fatalf("expected type %v, got %v of %q", tokType, tok.Type, tok.Raw)
+		}
+	}
+}
+
+func TestPreprocesor_MacroErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{name: "unterminated arguments", input: "#define F(x) x\nF(1, (2)", msg: "2:1 unterminated argument list invoking macro F"},
+		{name: "too many arguments", input: "#define F(x) x\nF(1, 2)", msg: "macro F requires 1 arguments, but 2 given"},
+		{name: "too few arguments", input: "#define F(x, y) x\nF(1)", msg: "macro F requires 2 arguments, but 1 given"},
+		{name: "arguments of no parameter macro", input: "#define F() 1\nF(2)", msg: "macro F requires 0 arguments, but 1 given"},
+		{name: "missing parenthesis", input: "#define F(x x\n", msg: "1:9 missing ) in parameter list of macro F"},
+		{name: "invalid parameter", input: "#define F(1) x\n", msg: "expected parameter name of macro F"},
+		{name: "parameter after ellipsis", input: "#define F(..., x) x\n", msg: "missing ) in parameter list of macro F"},
+		{name: "duplicate parameter", input: "#define F(x, x) x\n", msg: "duplicate parameter x of macro F"},
+		{name: "stringify non parameter", input: "#define F(x) #y\n", msg: "'#' is not followed by parameter of macro F"},
+		{name: "paste at start", input: "#define F(x) ## x\n", msg: "'##' cannot appear at either end of macro F"},
+		{name: "paste at end", input: "#define F x ##\n", msg: "'##' cannot appear at either end of macro F"},
+		{name: "va args outside variadic", input: "#define F(x) __VA_ARGS__\n", msg: "__VA_ARGS__ can only appear in variadic macro"},
+		{name: "invalid paste", input: "#define CAT(a, b) a ## b\nCAT(+, -)", msg: "pasting \"+\" and \"-\" does not give valid token"},
+		{name: "undef without name", input: "#undef\n", msg: "1:1 macro name missing after #undef"},
+		{name: "undef extra tokens", input: "#undef A B\n", msg: "extra tokens after #undef A"},
+		{name: "define defined", input: "#define defined 1\n", msg: "\"defined\" cannot be used as macro name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := newTestLexerFromString(tt.input)
+			var err error
+			for err == nil {
+				_, err = lex.Next()
+			}
+			if err == io.EOF || !strings.Contains(err.Error(), tt.msg) {
+				t.Fatalf("expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
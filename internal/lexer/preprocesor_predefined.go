@@ -0,0 +1,148 @@
+package lexer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
+
+// Version of compiler, __wihajster__ is major*10000 + minor*100 + patch.
+const (
+	versionMajor = 0
+	versionMinor = 1
+	versionPatch = 0
+)
+
+// DefaultTarget is target profile when Options.Target is empty.
+const DefaultTarget = "virt"
+
+// targetMacros are predefined macros of target profiles, on top of common ones.
+var targetMacros = map[string][]string{
+	"virt":     {"__QEMU_VIRT__ 1"},
+	"ch32v003": {"__CH32V003__ 1", "__riscv_e 1"},
+}
+
+// Targets returns names of target profiles, sorted.
+func Targets() []string {
+	var names []string
+	for name := range targetMacros {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Define is macro defined or undefined on command line.
+type Define struct {
+	// Name is macro name, followed by parameter list for function-like macro
+	Name  string
+	Value string
+	// Undef removes macro, like -U NAME
+	Undef bool
+}
+
+// ParseDefine parses -D argument NAME[=value], macro without value is 1.
+func ParseDefine(arg string) Define {
+	name, value, ok := strings.Cut(arg, "=")
+	if !ok {
+		value = "1"
+	}
+	return Define{Name: name, Value: value}
+}
+
+// Warning is diagnostic that does not stop lexing.
+type Warning struct {
+	Code         code.Code
+	File         string
+	Line, Column int
+	Span         Span
+	Msg          string
+	Notes        []Note
+}
+
+func (w Warning) String() string {
+	msg := Position(w.File, w.Line, w.Column) + " warning: " + w.Msg
+	for _, note := range w.Notes {
+		msg += "\n" + note.String()
+	}
+	return msg
+}
+
+// dynamicMacros are expanded to token depending on where they are used.
+var dynamicMacros = map[string]func(p *preprocesor, tok Token) Token{
+	"__FILE__": func(p *preprocesor, tok Token) Token {
+		tok.Type = TokenStringLiteral
+		tok.Raw = []byte(strconv.Quote(p.invocation.File))
+		return tok
+	},
+	"__LINE__": func(p *preprocesor, tok Token) Token {
+		tok.Type = TokenIntegerConstant
+		tok.Raw = strconv.AppendInt(nil, int64(p.invocation.Line), 10)
+		return tok
+	},
+}
+
+// predefine defines macros of target profile and command line. They are read as
+// directives of virtual files, so errors point at them like at any other source.
+func (p *preprocesor) predefine(opts Options) error {
+	target := opts.Target
+	if target == "" {
+		target = DefaultTarget
+	}
+	targetDefines, ok := targetMacros[target]
+	if !ok {
+		return fmt.Errorf("unknown target %q, known are %s", target, strings.Join(Targets(), ", "))
+	}
+
+	var cmdline strings.Builder
+	for _, d := range opts.Defines {
+		if d.Undef {
+			fmt.Fprintf(&cmdline, "#undef %s\n", d.Name)
+			continue
+		}
+		fmt.Fprintf(&cmdline, "#define %s %s\n", d.Name, d.Value)
+	}
+	if cmdline.Len() > 0 {
+		p.pushSource("<command line>", cmdline.String())
+	}
+
+	builtin := []string{
+		"__STDC__ 1",
+		"__STDC_VERSION__ 199901L",
+		"__STDC_HOSTED__ 0",
+		"__riscv 1",
+		"__riscv_xlen 32",
+		fmt.Sprintf("__wihajster__ %d", versionMajor*10000+versionMinor*100+versionPatch),
+	}
+	var b strings.Builder
+	for _, def := range append(builtin, targetDefines...) {
+		fmt.Fprintf(&b, "#define %s\n", def)
+	}
+	p.pushSource("<built-in>", b.String())
+	return nil
+}
+
+// pushSource makes text current file, read before file including it.
+func (p *preprocesor) pushSource(name, text string) {
+	p.file().lastSeenLine = p.lastSeenLine
+	s := newScanner(strings.NewReader(text), 0)
+	p.files = append(p.files, &sourceFile{name: name, shown: name, s: s})
+	p.s = s
+	p.lastSeenLine = 0
+}
+
+// warnf records warning at tok, returned to add notes to.
+func (p *preprocesor) warnf(c code.Code, tok Token, format string, args ...any) *Warning {
+	p.warnings = append(p.warnings, Warning{
+		Code:   c,
+		File:   tok.File,
+		Line:   tok.Line,
+		Column: tok.Column,
+		Span:   tok.Span,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+	return &p.warnings[len(p.warnings)-1]
+}
@@ -1,5 +1,7 @@
 package lexer
 
+import "github.com/SQLek/wihajster/internal/diag/code"
+
 func (p *preprocesor) handleDots() (Token, error) {
 	// Very likely multiple dot tokens are invalid anyway
 	// if not, better implementation will come at later milestone
@@ -10,17 +12,17 @@ func (p *preprocesor) handleDots() (Token, error) {
 	case "...":
 		return p.makeToken(TokenEllipsis), nil
 	default:
-		return p.errorf("wanted '.' or '...', got %q", tokenStr)
+		return p.errorf(code.InvalidToken, "wanted '.' or '...', got %q", tokenStr)
 	}
 }
 
-func (p *preprocesor) handleKeywordOrSubsitution() (Token, error) {
-	tokenStr := p.accumulatorString()
-
-	if subTokens, isMacro := p.macros[tokenStr]; isMacro {
-		return p.handleSubstitution(subTokens)
-	}
+// isKeyword reports if token type is one of keywords, which directive names can be.
+func isKeyword(tokType TokenType) bool {
+	return tokType > tokenNil && tokType < TokenIdentifier
+}
 
+// keywordType returns type of keyword, or TokenIdentifier if name is not keyword.
+func keywordType(tokenStr string) TokenType {
 	tokenType := TokenIdentifier
 	switch tokenStr {
 	case "auto":
@@ -98,20 +100,5 @@ func (p *preprocesor) handleKeywordOrSubsitution() (Token, error) {
 	case "_Imaginary":
 		tokenType = Token_Imaginary
 	}
-
-	return p.makeToken(tokenType), nil
-}
-
-func (p *preprocesor) handleSubstitution(subTokens []Token) (Token, error) {
-	switch l := len(subTokens); l {
-	case 0:
-		// macro can be empty (header guard)
-		return p.next()
-	case 1:
-		return subTokens[0], nil
-
-	default:
-		p.readyTokens = subTokens[1:]
-		return subTokens[0], nil
-	}
+	return tokenType
 }
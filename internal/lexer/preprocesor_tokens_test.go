@@ -1,9 +1,12 @@
 package lexer
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
 )
 
 func TestPreprocesor_HandleDots_ValidForms(t *testing.T) {
@@ -63,6 +66,45 @@ func TestPreprocesor_HandleDots_InvalidForms(t *testing.T) {
 	}
 }
 
+func TestPreprocesor_TokenErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+		code  code.Code
+		span  Span
+	}{
+		{name: "float", input: "x = 1.5;", msg: "1:5 floating constants are not supported", code: code.UnsupportedFloat, span: Span{Start: 4, End: 5}},
+		{name: "hex float", input: "0x1p3", msg: "1:1 floating constants are not supported", code: code.UnsupportedFloat, span: Span{Start: 0, End: 3}},
+		{name: "string newline", input: "s = \"ab\n\";", msg: "1:5 missing terminating \" character", code: code.UnterminatedLiteral, span: Span{Start: 4, End: 7}},
+		{name: "string end of file", input: "s = \"ab", msg: "1:5 missing terminating \" character", code: code.UnterminatedLiteral, span: Span{Start: 4, End: 7}},
+		{name: "char newline", input: "c = 'a\n';", msg: "1:5 missing terminating ' character", code: code.UnterminatedLiteral, span: Span{Start: 4, End: 6}},
+		{name: "string escape", input: "\"a\\t\"", msg: "1:1 escape sequence \\t is not supported in string literal", code: code.UnsupportedEscape, span: Span{Start: 0, End: 3}},
+		{name: "char escape", input: "'\\x41'", msg: "1:1 escape sequence \\x is not supported in character constant", code: code.UnsupportedEscape, span: Span{Start: 0, End: 2}},
+		{name: "block comment", input: "// c\n/* x */", msg: "2:1 /* */ comments are not supported, use //", code: code.UnsupportedComment, span: Span{Start: 5, End: 7}},
+		{name: "invalid character", input: "// c\na @ b", msg: "2:3 invalid character \"@\"", code: code.InvalidToken, span: Span{Start: 7, End: 8}},
+		{name: "hex without digits", input: "x 0x;", msg: "1:3 hexadecimal constant 0x has no digits", code: code.InvalidToken, span: Span{Start: 2, End: 4}},
+		{name: "after line", input: "#line 7 \"a.c\"\n1.0", msg: "a.c:7:1 floating constants are not supported", code: code.UnsupportedFloat, span: Span{Start: 14, End: 15}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := newTestLexerFromString(tt.input)
+			var err error
+			for err == nil {
+				_, err = lex.Next()
+			}
+			var lexErr *Error
+			if !errors.As(err, &lexErr) || lexErr.Code != tt.code || lexErr.Error() != tt.msg {
+				t.Fatalf("expected %q with code %s, got %#v", tt.msg, tt.code, err)
+			}
+			if lexErr.Span != tt.span {
+				t.Fatalf("expected span %+v, got %+v", tt.span, lexErr.Span)
+			}
+		})
+	}
+}
+
 func TestLexer_Peek_PropagatesErrors(t *testing.T) {
 	t.Run("propagates EOF", func(t *testing.T) {
 		lex := newTestLexerFromString("")
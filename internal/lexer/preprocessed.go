@@ -0,0 +1,132 @@
+package lexer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxBlankLines are kept as empty lines, longer gaps are replaced by line marker.
+const maxBlankLines = 8
+
+// WritePreprocessed writes tokens of lexer as C text, like cc -E. Tokens stay on lines
+// they come from, gaps, included files and #line are described by # line "file" markers,
+// so output lexes to the same tokens, source ones at the same positions.
+// Annotated output wraps tokens of each macro expansion in /*NAME{*/ and /*}*/ comments,
+// it is for reading only, as block comments are not supported in v0.
+func WritePreprocessed(w io.Writer, l *Lexer, annotate bool) error {
+	pw := &preprocessedWriter{w: bufio.NewWriter(w), annotate: annotate}
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			pw.w.Flush()
+			return err
+		}
+		pw.write(tok)
+	}
+	pw.closeExpansion()
+	if pw.started {
+		pw.w.WriteByte('\n')
+	}
+	return pw.w.Flush()
+}
+
+type preprocessedWriter struct {
+	w        *bufio.Writer
+	annotate bool
+
+	started   bool
+	file      string
+	line      int
+	lineStart bool
+	prev      Token
+	// expansion is outermost expansion of annotated tokens being written
+	expansion *Expansion
+}
+
+func (pw *preprocessedWriter) write(tok Token) {
+	// expanded tokens are placed where macro is used
+	src := tok
+	var expansion *Expansion
+	if tok.Expansion != nil {
+		expansion = outermost(tok.Expansion)
+		src = expansion.Site
+	}
+	if expansion != pw.expansion {
+		pw.closeExpansion()
+	}
+	pw.moveTo(src)
+
+	switch {
+	case pw.lineStart:
+		pw.w.WriteString(strings.Repeat(" ", max(src.Column-1, 0)))
+	case tok.spaceBefore || wouldPaste(pw.prev, tok):
+		pw.w.WriteByte(' ')
+	}
+	if pw.annotate && expansion != nil && pw.expansion == nil {
+		pw.expansion = expansion
+		fmt.Fprintf(pw.w, "/*%s{*/", expansion.Macro)
+	}
+	pw.w.Write(tok.Raw)
+	pw.lineStart = false
+	pw.prev = tok
+}
+
+// moveTo starts line of source token, with newlines or line marker.
+func (pw *preprocessedWriter) moveTo(tok Token) {
+	gap := tok.Line - pw.line
+	switch {
+	case !pw.started:
+		pw.started = true
+		pw.marker(tok)
+	case tok.File != pw.file || gap < 0 || gap > maxBlankLines:
+		pw.w.WriteByte('\n')
+		pw.marker(tok)
+	case gap > 0:
+		pw.w.WriteString(strings.Repeat("\n", gap))
+	default:
+		return
+	}
+	pw.file, pw.line = tok.File, tok.Line
+	pw.lineStart = true
+	pw.prev = Token{}
+}
+
+func (pw *preprocessedWriter) marker(tok Token) {
+	fmt.Fprintf(pw.w, "# %d %s\n", tok.Line, strconv.Quote(tok.File))
+}
+
+func (pw *preprocessedWriter) closeExpansion() {
+	if pw.expansion == nil {
+		return
+	}
+	pw.w.WriteString("/*}*/")
+	pw.expansion = nil
+	pw.prev = Token{}
+}
+
+// outermost is expansion of macro used in source.
+func outermost(e *Expansion) *Expansion {
+	for e.Site.Expansion != nil {
+		e = e.Site.Expansion
+	}
+	return e
+}
+
+// wouldPaste reports if tokens written next to each other lex differently,
+// e.g. + and + of different macros, so space is needed between them.
+func wouldPaste(prev, tok Token) bool {
+	if len(prev.Raw) == 0 {
+		return false
+	}
+	text := string(prev.Raw) + string(tok.Raw)
+	s := newScanner(strings.NewReader(text), len(text))
+	var raw []byte
+	_, err := lex(s, func(data []byte) { raw = append(raw, data...) })
+	return err != nil || string(raw) != string(prev.Raw)
+}
@@ -84,6 +84,8 @@ type scanner struct {
 
 	// counting lines and columns further down is such a pain
 	line, column int
+	// offset is count of bytes read
+	offset int
 }
 
 func newScanner(r io.Reader, buffSize int) *scanner {
@@ -151,6 +153,7 @@ func (s *scanner) popOneFromBuffer() byte {
 	}
 
 	s.pos++
+	s.offset++
 	return b
 }
 
@@ -208,6 +211,7 @@ func (s *scanner) readBytesInClass(cls byteClass) (data []byte, isPrefix bool, e
 
 	data = s.buff[s.pos:end]
 	s.pos = end
+	s.offset += len(data)
 	isPrefix = end == s.max
 
 	s.advanceLineColumn(data)
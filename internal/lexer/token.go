@@ -115,6 +115,9 @@ const (
 	// preprocesor catches line/column on start of parsing
 	tokenWhitespace
 
+	// placemarker stands for empty macro argument operand of ##, removed after substitution
+	tokenPlacemarker
+
 	TokenEOF
 	TokenError
 )
@@ -123,7 +126,19 @@ type Token struct {
 	Type TokenType
 	Raw  []byte
 
+	// File is name of file token comes from, empty for lexer of single file.
+	// Line and File are as #line sets them, Span is where token is in file.
+	File         string
 	Line, Column int
+	Span         Span
+	// Expansion is macro expansion token comes from, nil for token of source.
+	// Position of expanded token is where it is spelled, usually in #define.
+	Expansion *Expansion
+
+	// spaceBefore is true when whitespace or comment precedes token, # operator keeps it
+	spaceBefore bool
+	// hide are macros token was expanded from, they are not expanded again in its rescan
+	hide []string
 }
 
 func (t Token) IsValid() bool {
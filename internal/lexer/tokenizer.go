@@ -1,6 +1,11 @@
 package lexer
 
-import "io"
+import (
+	"fmt"
+	"io"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
 
 var (
 	alphaByteClass = byteClassCombine(
@@ -15,6 +20,26 @@ var (
 	)
 )
 
+// tokenError is error of lexing token, preprocesor adds position of token to it.
+type tokenError struct {
+	code code.Code
+	msg  string
+	// err is ErrNotImplementedInV0 for features outside v0 subset
+	err error
+}
+
+func tokenErrorf(c code.Code, err error, format string, args ...any) *tokenError {
+	return &tokenError{code: c, msg: fmt.Sprintf(format, args...), err: err}
+}
+
+func (e *tokenError) Error() string {
+	return e.msg
+}
+
+func (e *tokenError) Unwrap() error {
+	return e.err
+}
+
 func lex(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 	b, err := s.peekOne()
 	if err != nil {
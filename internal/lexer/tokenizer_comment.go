@@ -1,5 +1,7 @@
 package lexer
 
+import "github.com/SQLek/wihajster/internal/diag/code"
+
 var whiteByteClass = byteClassChars(' ', '\n', '\r', '\t')
 
 // consumes all whitespace
@@ -39,6 +41,5 @@ func lexCommentSingleLine(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 }
 
 func lexCommentMultiLine(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
-
-	return tokenNil, ErrNotImplementedInV0
+	return tokenNil, tokenErrorf(code.UnsupportedComment, ErrNotImplementedInV0, "/* */ comments are not supported, use //")
 }
@@ -1,11 +1,11 @@
 package lexer
 
-func lexDecimalFloat(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
+import "github.com/SQLek/wihajster/internal/diag/code"
 
-	return tokenNil, ErrNotImplementedInV0
+func lexDecimalFloat(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
+	return tokenNil, tokenErrorf(code.UnsupportedFloat, ErrNotImplementedInV0, "floating constants are not supported")
 }
 
 func lexHexedecimalFloat(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
-
-	return tokenNil, ErrNotImplementedInV0
+	return tokenNil, tokenErrorf(code.UnsupportedFloat, ErrNotImplementedInV0, "floating constants are not supported")
 }
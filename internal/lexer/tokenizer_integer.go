@@ -1,8 +1,9 @@
 package lexer
 
 import (
-	"fmt"
 	"io"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
 )
 
 var (
@@ -91,7 +92,7 @@ func lexHexadecimalConstant(s *scanner, firstCall bool, buildFn tokenBuildFn) (T
 		return tokenNil, err
 	}
 	if firstCall && len(data) == 0 {
-		return tokenNil, fmt.Errorf("got 0x without value at %d:%d", s.line, s.column)
+		return tokenNil, tokenErrorf(code.InvalidToken, nil, "hexadecimal constant 0x has no digits")
 	}
 	buildFn(data)
 	if isPartial {
@@ -1,8 +1,9 @@
 package lexer
 
 import (
-	"fmt"
 	"io"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
 )
 
 // Dots and elypsis. We have 1 character look ahead. We cannot distinguish,
@@ -107,7 +108,8 @@ func lexPunctuation(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 		return lexCommentSingleLine(s, buildFn)
 
 	case tokenCommentMulti:
-		s.popOneFromBuffer()
+		// sent, so error of unsupported comment is at it
+		sendTwo()
 		return lexCommentMultiLine(s, buildFn)
 
 	case TokenShiftLeft, TokenShiftRight:
@@ -136,10 +138,9 @@ func lexPunctuation(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 		return tt, nil
 	}
 
-	return tokenNil, fmt.Errorf(
-		"invalid character in punctuation '%c%c' %w",
-		first, second, ErrNotImplementedInV0,
-	)
+	buff1Char[0] = first
+	buildFn(buff1Char)
+	return tokenNil, tokenErrorf(code.InvalidToken, nil, "invalid character %q", string(first))
 }
 
 var dotsByteClass = byteClassChars('.')
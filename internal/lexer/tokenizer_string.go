@@ -1,6 +1,10 @@
 package lexer
 
-import "fmt"
+import (
+	"io"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+)
 
 // This file handles bot string literals and character constants
 var (
@@ -14,6 +18,9 @@ func lexStringLiteral(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 	// because of recurrent calling, both on partial but on escape sequences,
 	// we have to require that start of sling literal is already read
 	data, isPartial, err := s.readBytesInClass(stringLiteralBody)
+	if err == io.EOF {
+		return tokenNil, tokenErrorf(code.UnterminatedLiteral, nil, "missing terminating \" character")
+	}
 	if err != nil {
 		return tokenNil, err
 	}
@@ -23,14 +30,14 @@ func lexStringLiteral(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 	}
 
 	switch b, err := s.peekOne(); {
+	case err == io.EOF, b == '\n':
+		return tokenNil, tokenErrorf(code.UnterminatedLiteral, nil, "missing terminating \" character")
 	case err != nil:
 		return tokenNil, err
 	case b == '"':
 		buff1Char[0] = s.popOneFromBuffer()
 		buildFn(buff1Char)
 		return TokenStringLiteral, nil
-	case b == '\n':
-		return tokenNil, fmt.Errorf("unexpected newline in string literal at %d:%d", s.line, s.column)
 	}
 
 	// we have '\\' at cursor, lets pop it and see if we have escape, or line continuation
@@ -51,7 +58,7 @@ func lexStringLiteral(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 
 	default:
 		// other escape sequencess will be handled in future
-		return tokenNil, ErrNotImplementedInV0
+		return tokenNil, tokenErrorf(code.UnsupportedEscape, ErrNotImplementedInV0, "escape sequence \\%c is not supported in string literal", b)
 	}
 }
 
@@ -59,6 +66,9 @@ func lexCharacterConstant(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 	// because of recurrent calling, both on partial but on escape sequences,
 	// we have to require that start of sling literal is already read
 	data, isPartial, err := s.readBytesInClass(charConstantBody)
+	if err == io.EOF {
+		return tokenNil, tokenErrorf(code.UnterminatedLiteral, nil, "missing terminating ' character")
+	}
 	if err != nil {
 		return tokenNil, err
 	}
@@ -68,14 +78,14 @@ func lexCharacterConstant(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 	}
 
 	switch b, err := s.peekOne(); {
+	case err == io.EOF, b == '\n':
+		return tokenNil, tokenErrorf(code.UnterminatedLiteral, nil, "missing terminating ' character")
 	case err != nil:
 		return tokenNil, err
 	case b == '\'':
 		buff1Char[0] = s.popOneFromBuffer()
 		buildFn(buff1Char)
 		return TokenCharacterConstant, nil
-	case b == '\n':
-		return tokenNil, fmt.Errorf("unexpected newline in character literal at %d:%d", s.line, s.column)
 	}
 
 	// we have '\\' at cursor, lets pop it and see if we have escape, or line continuation
@@ -96,6 +106,6 @@ func lexCharacterConstant(s *scanner, buildFn tokenBuildFn) (TokenType, error) {
 
 	default:
 		// other escape sequencess will be handled in future
-		return tokenNil, ErrNotImplementedInV0
+		return tokenNil, tokenErrorf(code.UnsupportedEscape, ErrNotImplementedInV0, "escape sequence \\%c is not supported in character constant", b)
 	}
 }
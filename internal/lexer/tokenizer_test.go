@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -193,7 +194,7 @@ func TestLex_Errors(t *testing.T) {
 			if err == nil {
 				t.Fatal("expected an error, got nil")
 			}
-			if err != tt.expectErr {
+			if !errors.Is(err, tt.expectErr) {
 				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
 			}
 		})
@@ -10,10 +10,31 @@ const (
 	TypeSpecifierVoid
 )
 
+type TypeQualifier int
+
+const (
+	TypeQualifierConst TypeQualifier = 1 << iota
+	TypeQualifierVolatile
+)
+
+func (q TypeQualifier) Has(other TypeQualifier) bool {
+	return q&other == other
+}
+
 type TypeName struct {
 	Token        lexer.Token
 	Specifier    TypeSpecifier
+	Qualifiers   TypeQualifier
 	PointerDepth int
+	// PointerQualifiers holds qualifiers of every pointer level,
+	// starting from the one closest to the specifier.
+	// Its length always equals PointerDepth.
+	PointerQualifiers []TypeQualifier
+}
+
+func (t *TypeName) addPointers(quals []TypeQualifier) {
+	t.PointerDepth += len(quals)
+	t.PointerQualifiers = append(t.PointerQualifiers, quals...)
 }
 
 type TranslationUnit struct {
@@ -26,6 +47,7 @@ type FunctionParameter struct {
 	Token lexer.Token
 	Type  TypeName
 	Name  string
+	Span  lexer.Span
 }
 
 type FunctionDefinition struct {
@@ -34,6 +56,7 @@ type FunctionDefinition struct {
 	Parameters []FunctionParameter
 	Body       BlockStatement
 	Token      lexer.Token
+	Span       lexer.Span
 }
 
 type FunctionPrototype struct {
@@ -41,13 +64,16 @@ type FunctionPrototype struct {
 	ReturnType TypeName
 	Name       string
 	Parameters []FunctionParameter
+	Span       lexer.Span
 }
 
 type Declaration struct {
 	Token       lexer.Token
 	Type        TypeName
 	Name        string
+	NameToken   lexer.Token
 	Initializer Expression
+	Span        lexer.Span
 }
 
 type Statement interface {
@@ -57,6 +83,7 @@ type Statement interface {
 type BlockStatement struct {
 	Token      lexer.Token
 	Statements []Statement
+	Span       lexer.Span
 }
 
 func (BlockStatement) statementNode() {}
@@ -64,6 +91,7 @@ func (BlockStatement) statementNode() {}
 type DeclarationStatement struct {
 	Token       lexer.Token
 	Declaration Declaration
+	Span        lexer.Span
 }
 
 func (DeclarationStatement) statementNode() {}
@@ -71,6 +99,7 @@ func (DeclarationStatement) statementNode() {}
 type ReturnStatement struct {
 	Token      lexer.Token
 	Expression Expression
+	Span       lexer.Span
 }
 
 func (ReturnStatement) statementNode() {}
@@ -78,6 +107,7 @@ func (ReturnStatement) statementNode() {}
 type ExpressionStatement struct {
 	Token      lexer.Token
 	Expression Expression
+	Span       lexer.Span
 }
 
 func (ExpressionStatement) statementNode() {}
@@ -87,6 +117,7 @@ type IfStatement struct {
 	Cond  Expression
 	Then  Statement
 	Else  Statement
+	Span  lexer.Span
 }
 
 func (IfStatement) statementNode() {}
@@ -95,6 +126,7 @@ type WhileStatement struct {
 	Token lexer.Token
 	Cond  Expression
 	Body  Statement
+	Span  lexer.Span
 }
 
 func (WhileStatement) statementNode() {}
@@ -105,6 +137,7 @@ type ForStatement struct {
 	Cond  Expression
 	Post  Expression
 	Body  Statement
+	Span  lexer.Span
 }
 
 func (ForStatement) statementNode() {}
@@ -116,6 +149,7 @@ type Expression interface {
 type IdentifierExpression struct {
 	Token lexer.Token
 	Name  string
+	Span  lexer.Span
 }
 
 func (IdentifierExpression) expressionNode() {}
@@ -123,6 +157,7 @@ func (IdentifierExpression) expressionNode() {}
 type IntegerLiteralExpression struct {
 	Token lexer.Token
 	Raw   string
+	Span  lexer.Span
 }
 
 func (IntegerLiteralExpression) expressionNode() {}
@@ -130,6 +165,7 @@ func (IntegerLiteralExpression) expressionNode() {}
 type CharacterLiteralExpression struct {
 	Token lexer.Token
 	Raw   string
+	Span  lexer.Span
 }
 
 func (CharacterLiteralExpression) expressionNode() {}
@@ -138,6 +174,7 @@ type UnaryExpression struct {
 	Token   lexer.Token
 	Op      lexer.TokenType
 	Operand Expression
+	Span    lexer.Span
 }
 
 func (UnaryExpression) expressionNode() {}
@@ -147,6 +184,7 @@ type BinaryExpression struct {
 	Op    lexer.TokenType
 	LHS   Expression
 	RHS   Expression
+	Span  lexer.Span
 }
 
 func (BinaryExpression) expressionNode() {}
@@ -155,14 +193,51 @@ type AssignmentExpression struct {
 	Token lexer.Token
 	LHS   Expression
 	RHS   Expression
+	Span  lexer.Span
 }
 
 func (AssignmentExpression) expressionNode() {}
 
+type CastExpression struct {
+	Token   lexer.Token
+	Type    TypeName
+	Operand Expression
+	Span    lexer.Span
+}
+
+func (CastExpression) expressionNode() {}
+
 type CallExpression struct {
 	Token  lexer.Token
 	Callee Expression
 	Args   []Expression
+	Span   lexer.Span
 }
 
 func (CallExpression) expressionNode() {}
+
+// ExpressionSpan returns span of expression node. Span of node covers its tokens
+// as they are in source, macro expansion by name of macro used.
+// Parentheses around expression are not part of it.
+func ExpressionSpan(expr Expression) lexer.Span {
+	switch e := expr.(type) {
+	case IdentifierExpression:
+		return e.Span
+	case IntegerLiteralExpression:
+		return e.Span
+	case CharacterLiteralExpression:
+		return e.Span
+	case UnaryExpression:
+		return e.Span
+	case BinaryExpression:
+		return e.Span
+	case AssignmentExpression:
+		return e.Span
+	case CastExpression:
+		return e.Span
+	case CallExpression:
+		return e.Span
+	default:
+		return lexer.Span{}
+	}
+}
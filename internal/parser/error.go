@@ -2,30 +2,45 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/SQLek/wihajster/internal/diag/code"
 	"github.com/SQLek/wihajster/internal/lexer"
 )
 
 type Error struct {
+	Code    code.Code
+	File    string
 	Line    int
 	Column  int
+	Span    lexer.Span
 	Message string
+	// Notes explain macro expansion of token error is at.
+	Notes []lexer.Note
 }
 
 func (e *Error) Error() string {
-	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+	msg := fmt.Sprintf("%s: %s", lexer.Position(e.File, e.Line, e.Column), e.Message)
+	for _, note := range e.Notes {
+		msg += "\n" + note.String()
+	}
+	return msg
 }
 
-func newError(tok lexer.Token, format string, args ...any) *Error {
+func newError(c code.Code, tok lexer.Token, format string, args ...any) *Error {
 	return &Error{
+		Code:    c,
+		File:    tok.File,
 		Line:    tok.Line,
 		Column:  tok.Column,
+		Span:    tok.Span,
 		Message: fmt.Sprintf(format, args...),
+		Notes:   lexer.ExpansionNotes(tok),
 	}
 }
 
-func unsupportedError(tok lexer.Token, feature string) *Error {
-	return newError(tok, "unsupported in current subset: %s", feature)
+func unsupportedError(c code.Code, tok lexer.Token, feature string) *Error {
+	return newError(c, tok, "unsupported in current subset: %s", feature)
 }
 
 type ParseErrors struct {
@@ -40,10 +55,14 @@ func (e *ParseErrors) Error() string {
 	if e.FatalLexer != nil {
 		return fmt.Sprintf("lexer error: %v", e.FatalLexer)
 	}
-	if len(e.Diagnostics) > 0 {
-		return e.Diagnostics[0].Error()
+	if len(e.Diagnostics) == 0 {
+		return "parse failed"
+	}
+	msgs := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		msgs[i] = d.Error()
 	}
-	return "parse failed"
+	return strings.Join(msgs, "\n")
 }
 
 func (e *ParseErrors) Unwrap() error {
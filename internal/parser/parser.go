@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/SQLek/wihajster/internal/diag/code"
 	"github.com/SQLek/wihajster/internal/lexer"
 )
 
@@ -20,6 +21,8 @@ type Parser struct {
 	diagnostics []*Error
 
 	last lexer.Token
+	// prev is last consumed token, end of node being parsed
+	prev lexer.Token
 }
 
 func New(tokens tokenSource) *Parser {
@@ -69,11 +72,11 @@ func (p *Parser) parseExternalDeclaration() (*FunctionDefinition, *Declaration,
 		return nil, nil, nil, false
 	}
 
-	nameTok, name, ptrDepth, ok := p.parseDeclarator("declaration name")
+	nameTok, name, ptrs, ok := p.parseDeclarator("declaration name")
 	if !ok {
 		return nil, nil, nil, false
 	}
-	typ.PointerDepth += ptrDepth
+	typ.addPointers(ptrs)
 
 	if p.accept(lexer.TokenLParen) {
 		params, ok := p.parseParameterList()
@@ -90,6 +93,7 @@ func (p *Parser) parseExternalDeclaration() (*FunctionDefinition, *Declaration,
 				ReturnType: typ,
 				Name:       name,
 				Parameters: params,
+				Span:       p.spanFrom(lexer.SourceSpan(typeTok)),
 			}
 			return nil, nil, &proto, true
 		}
@@ -105,6 +109,7 @@ func (p *Parser) parseExternalDeclaration() (*FunctionDefinition, *Declaration,
 			Name:       name,
 			Parameters: params,
 			Body:       body,
+			Span:       p.spanFrom(lexer.SourceSpan(typeTok)),
 		}
 		return &fn, nil, nil, true
 	}
@@ -116,63 +121,89 @@ func (p *Parser) parseExternalDeclaration() (*FunctionDefinition, *Declaration,
 	return nil, &decl, nil, true
 }
 func (p *Parser) parseTypeName() (lexer.Token, TypeName, bool) {
+	startTok := p.peekTok()
+	quals := p.parseTypeQualifiers()
 	tok := p.peekTok()
 
+	var spec TypeSpecifier
 	switch tok.Type {
 	case lexer.TokenInt:
-		p.nextTok()
-		return tok, TypeName{Token: tok, Specifier: TypeSpecifierInt}, true
+		spec = TypeSpecifierInt
 	case lexer.TokenChar:
-		p.nextTok()
-		return tok, TypeName{Token: tok, Specifier: TypeSpecifierChar}, true
+		spec = TypeSpecifierChar
 	case lexer.TokenVoid:
-		p.nextTok()
-		return tok, TypeName{Token: tok, Specifier: TypeSpecifierVoid}, true
+		spec = TypeSpecifierVoid
 	case lexer.TokenStruct:
-		p.addDiagnostic(unsupportedError(tok, "struct declarations"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedType, tok, "struct declarations"))
 		p.nextTok()
 		return lexer.Token{}, TypeName{}, false
 	case lexer.TokenUnion:
-		p.addDiagnostic(unsupportedError(tok, "union declarations"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedType, tok, "union declarations"))
 		p.nextTok()
 		return lexer.Token{}, TypeName{}, false
 	case lexer.TokenEnum:
-		p.addDiagnostic(unsupportedError(tok, "enum declarations"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedType, tok, "enum declarations"))
 		p.nextTok()
 		return lexer.Token{}, TypeName{}, false
 	case lexer.TokenFloat, lexer.TokenDouble:
-		p.addDiagnostic(unsupportedError(tok, "floating-point types"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedType, tok, "floating-point types"))
 		p.nextTok()
 		return lexer.Token{}, TypeName{}, false
 	default:
-		p.addDiagnostic(newError(p.errorToken(tok), "expected type specifier, got %s", tokenDescription(tok)))
+		p.addDiagnostic(newError(code.ExpectedType, p.errorToken(tok), "expected type specifier, got %s", tokenDescription(tok)))
 		return lexer.Token{}, TypeName{}, false
 	}
+	p.nextTok()
+
+	// qualifiers may appear on both sides of specifier: "volatile char" and "char volatile"
+	quals |= p.parseTypeQualifiers()
+	return startTok, TypeName{Token: startTok, Specifier: spec, Qualifiers: quals}, true
+}
+
+func (p *Parser) parseTypeQualifiers() TypeQualifier {
+	var quals TypeQualifier
+	for {
+		switch p.peekTok().Type {
+		case lexer.TokenConst:
+			quals |= TypeQualifierConst
+		case lexer.TokenVolatile:
+			quals |= TypeQualifierVolatile
+		default:
+			return quals
+		}
+		p.nextTok()
+	}
 }
 
-func (p *Parser) parseDeclarator(what string) (lexer.Token, string, int, bool) {
-	ptrDepth := 0
+// parsePointers consumes pointer declarator part, returning qualifiers of every level.
+func (p *Parser) parsePointers() []TypeQualifier {
+	var ptrs []TypeQualifier
 	for p.accept(lexer.TokenStar) {
-		ptrDepth++
+		ptrs = append(ptrs, p.parseTypeQualifiers())
 	}
+	return ptrs
+}
+
+func (p *Parser) parseDeclarator(what string) (lexer.Token, string, []TypeQualifier, bool) {
+	ptrs := p.parsePointers()
 
 	if p.peekTok().Type == lexer.TokenLParen {
 		tok := p.peekTok()
-		p.addDiagnostic(unsupportedError(tok, "function pointers"))
-		return lexer.Token{}, "", 0, false
+		p.addDiagnostic(unsupportedError(code.UnsupportedDeclarator, tok, "function pointers"))
+		return lexer.Token{}, "", nil, false
 	}
 
 	tok, name, ok := p.expectIdent(what)
 	if !ok {
-		return lexer.Token{}, "", 0, false
+		return lexer.Token{}, "", nil, false
 	}
 
 	if p.peekTok().Type == lexer.TokenLBracket {
-		p.addDiagnostic(unsupportedError(p.peekTok(), "arrays"))
-		return lexer.Token{}, "", 0, false
+		p.addDiagnostic(unsupportedError(code.UnsupportedDeclarator, p.peekTok(), "arrays"))
+		return lexer.Token{}, "", nil, false
 	}
 
-	return tok, name, ptrDepth, true
+	return tok, name, ptrs, true
 }
 
 func (p *Parser) parseParameterList() ([]FunctionParameter, bool) {
@@ -181,30 +212,30 @@ func (p *Parser) parseParameterList() ([]FunctionParameter, bool) {
 	}
 
 	if p.peekTok().Type == lexer.TokenEllipsis {
-		p.addDiagnostic(unsupportedError(p.peekTok(), "variadic functions"))
+		p.addDiagnostic(unsupportedError(code.VariadicFunction, p.peekTok(), "variadic functions"))
 		return nil, false
 	}
 
 	var params []FunctionParameter
 	for {
-		_, typ, ok := p.parseTypeName()
+		typeTok, typ, ok := p.parseTypeName()
 		if !ok {
 			return nil, false
 		}
-		tok, name, ptrDepth, ok := p.parseDeclarator("parameter name")
+		tok, name, ptrs, ok := p.parseDeclarator("parameter name")
 		if !ok {
 			return nil, false
 		}
-		typ.PointerDepth += ptrDepth
+		typ.addPointers(ptrs)
 		if typ.Specifier == TypeSpecifierVoid && typ.PointerDepth == 0 {
-			p.addDiagnostic(unsupportedError(tok, "void objects"))
+			p.addDiagnostic(unsupportedError(code.VoidObject, tok, "void objects"))
 			return nil, false
 		}
-		params = append(params, FunctionParameter{Token: tok, Type: typ, Name: name})
+		params = append(params, FunctionParameter{Token: tok, Type: typ, Name: name, Span: p.spanFrom(lexer.SourceSpan(typeTok))})
 
 		if p.accept(lexer.TokenComma) {
 			if p.peekTok().Type == lexer.TokenEllipsis {
-				p.addDiagnostic(unsupportedError(p.peekTok(), "variadic functions"))
+				p.addDiagnostic(unsupportedError(code.VariadicFunction, p.peekTok(), "variadic functions"))
 				return nil, false
 			}
 			continue
@@ -216,7 +247,7 @@ func (p *Parser) parseParameterList() ([]FunctionParameter, bool) {
 }
 
 func (p *Parser) parseDeclarationTail(typeTok lexer.Token, typ TypeName, nameTok lexer.Token, name string) (Declaration, bool) {
-	decl := Declaration{Token: typeTok, Type: typ, Name: name}
+	decl := Declaration{Token: typeTok, Type: typ, Name: name, NameToken: nameTok}
 	if p.accept(lexer.TokenAssign) {
 		initExpr, ok := p.parseExpression(0)
 		if !ok {
@@ -229,13 +260,14 @@ func (p *Parser) parseDeclarationTail(typeTok lexer.Token, typ TypeName, nameTok
 	}
 
 	if p.accept(lexer.TokenComma) {
-		p.addDiagnostic(unsupportedError(nameTok, "multiple declarators in one declaration"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedDeclarator, nameTok, "multiple declarators in one declaration"))
 		return Declaration{}, false
 	}
 
 	if !p.expectToken(lexer.TokenSemicolon, "';'") {
 		return Declaration{}, false
 	}
+	decl.Span = p.spanFrom(lexer.SourceSpan(typeTok))
 	return decl, true
 }
 
@@ -257,25 +289,25 @@ func (p *Parser) parseStatement() (Statement, bool) {
 		return p.parseWhileStatement()
 	case lexer.TokenFor:
 		return p.parseForStatement()
-	case lexer.TokenInt, lexer.TokenChar, lexer.TokenVoid:
+	case lexer.TokenInt, lexer.TokenChar, lexer.TokenVoid, lexer.TokenConst, lexer.TokenVolatile:
 		return p.parseDeclarationStatement()
 	case lexer.TokenStruct:
-		p.addDiagnostic(unsupportedError(tok, "struct declarations"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedType, tok, "struct declarations"))
 		return nil, false
 	case lexer.TokenSwitch:
-		p.addDiagnostic(unsupportedError(tok, "switch statements"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedStatement, tok, "switch statements"))
 		return nil, false
 	case lexer.TokenGoto:
-		p.addDiagnostic(unsupportedError(tok, "goto statements"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedStatement, tok, "goto statements"))
 		return nil, false
 	case lexer.TokenDo:
-		p.addDiagnostic(unsupportedError(tok, "do-while statements"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedStatement, tok, "do-while statements"))
 		return nil, false
 	case lexer.TokenBreak:
-		p.addDiagnostic(unsupportedError(tok, "break statements"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedStatement, tok, "break statements"))
 		return nil, false
 	case lexer.TokenContinue:
-		p.addDiagnostic(unsupportedError(tok, "continue statements"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedStatement, tok, "continue statements"))
 		return nil, false
 	default:
 		return p.parseExpressionStatement()
@@ -287,20 +319,20 @@ func (p *Parser) parseDeclarationStatement() (Statement, bool) {
 	if !ok {
 		return nil, false
 	}
-	nameTok, name, ptrDepth, ok := p.parseDeclarator("declaration name")
+	nameTok, name, ptrs, ok := p.parseDeclarator("declaration name")
 	if !ok {
 		return nil, false
 	}
-	typ.PointerDepth += ptrDepth
+	typ.addPointers(ptrs)
 	if typ.Specifier == TypeSpecifierVoid && typ.PointerDepth == 0 {
-		p.addDiagnostic(unsupportedError(nameTok, "void objects"))
+		p.addDiagnostic(unsupportedError(code.VoidObject, nameTok, "void objects"))
 		return nil, false
 	}
 	decl, ok := p.parseDeclarationTail(typeTok, typ, nameTok, name)
 	if !ok {
 		return nil, false
 	}
-	return DeclarationStatement{Token: typeTok, Declaration: decl}, true
+	return DeclarationStatement{Token: typeTok, Declaration: decl, Span: decl.Span}, true
 }
 
 func (p *Parser) parseBlockStatement() (BlockStatement, bool) {
@@ -314,11 +346,11 @@ func (p *Parser) parseBlockStatement() (BlockStatement, bool) {
 		tok := p.peekTok()
 		switch tok.Type {
 		case lexer.TokenEOF:
-			p.addDiagnostic(newError(open, "expected '}' before end of file"))
+			p.addDiagnostic(newError(code.ExpectedToken, open, "expected '}' before end of file"))
 			return BlockStatement{}, false
 		case lexer.TokenRBrace:
 			p.nextTok()
-			return BlockStatement{Token: open, Statements: stmts}, true
+			return BlockStatement{Token: open, Statements: stmts, Span: p.spanFrom(lexer.SourceSpan(open))}, true
 		}
 
 		stmt, stmtOK := p.parseStatement()
@@ -337,7 +369,7 @@ func (p *Parser) parseReturnStatement() (Statement, bool) {
 	}
 
 	if p.accept(lexer.TokenSemicolon) {
-		return ReturnStatement{Token: retTok}, true
+		return ReturnStatement{Token: retTok, Span: p.spanFrom(lexer.SourceSpan(retTok))}, true
 	}
 
 	expr, ok := p.parseExpression(0)
@@ -350,7 +382,7 @@ func (p *Parser) parseReturnStatement() (Statement, bool) {
 	if !p.expectToken(lexer.TokenSemicolon, "';'") {
 		return nil, false
 	}
-	return ReturnStatement{Token: retTok, Expression: expr}, true
+	return ReturnStatement{Token: retTok, Expression: expr, Span: p.spanFrom(lexer.SourceSpan(retTok))}, true
 }
 
 func (p *Parser) parseIfStatement() (Statement, bool) {
@@ -381,10 +413,10 @@ func (p *Parser) parseIfStatement() (Statement, bool) {
 		if !ok {
 			return nil, false
 		}
-		return IfStatement{Token: ifTok, Cond: cond, Then: thenStmt, Else: elseStmt}, true
+		return IfStatement{Token: ifTok, Cond: cond, Then: thenStmt, Else: elseStmt, Span: p.spanFrom(lexer.SourceSpan(ifTok))}, true
 	}
 
-	return IfStatement{Token: ifTok, Cond: cond, Then: thenStmt}, true
+	return IfStatement{Token: ifTok, Cond: cond, Then: thenStmt, Span: p.spanFrom(lexer.SourceSpan(ifTok))}, true
 }
 
 func (p *Parser) parseWhileStatement() (Statement, bool) {
@@ -410,7 +442,7 @@ func (p *Parser) parseWhileStatement() (Statement, bool) {
 		return nil, false
 	}
 
-	return WhileStatement{Token: whileTok, Cond: cond, Body: body}, true
+	return WhileStatement{Token: whileTok, Cond: cond, Body: body, Span: p.spanFrom(lexer.SourceSpan(whileTok))}, true
 }
 
 func (p *Parser) parseForStatement() (Statement, bool) {
@@ -425,7 +457,7 @@ func (p *Parser) parseForStatement() (Statement, bool) {
 	var init Statement
 	if p.accept(lexer.TokenSemicolon) {
 		init = nil
-	} else if isTypeSpecifierToken(p.peekTok().Type) {
+	} else if isTypeNameStartToken(p.peekTok().Type) {
 		stmt, ok := p.parseDeclarationStatement()
 		if !ok {
 			return nil, false
@@ -443,7 +475,7 @@ func (p *Parser) parseForStatement() (Statement, bool) {
 		if !p.expectToken(lexer.TokenSemicolon, "';'") {
 			return nil, false
 		}
-		init = ExpressionStatement{Token: tok, Expression: expr}
+		init = ExpressionStatement{Token: tok, Expression: expr, Span: p.spanFrom(lexer.SourceSpan(tok))}
 	}
 
 	var cond Expression
@@ -481,14 +513,14 @@ func (p *Parser) parseForStatement() (Statement, bool) {
 		return nil, false
 	}
 
-	return ForStatement{Token: forTok, Init: init, Cond: cond, Post: post, Body: body}, true
+	return ForStatement{Token: forTok, Init: init, Cond: cond, Post: post, Body: body, Span: p.spanFrom(lexer.SourceSpan(forTok))}, true
 }
 
 func (p *Parser) parseExpressionStatement() (Statement, bool) {
 	tok := p.peekTok()
 
 	if p.accept(lexer.TokenSemicolon) {
-		return ExpressionStatement{Token: tok}, true
+		return ExpressionStatement{Token: tok, Span: p.spanFrom(lexer.SourceSpan(tok))}, true
 	}
 
 	expr, ok := p.parseExpression(0)
@@ -501,7 +533,7 @@ func (p *Parser) parseExpressionStatement() (Statement, bool) {
 	if !p.expectToken(lexer.TokenSemicolon, "';'") {
 		return nil, false
 	}
-	return ExpressionStatement{Token: tok, Expression: expr}, true
+	return ExpressionStatement{Token: tok, Expression: expr, Span: p.spanFrom(lexer.SourceSpan(tok))}, true
 }
 
 func (p *Parser) parseExpression(minPrec int) (Expression, bool) {
@@ -521,7 +553,7 @@ func (p *Parser) parseExpression(minPrec int) (Expression, bool) {
 			if !ok {
 				return nil, false
 			}
-			lhs = AssignmentExpression{Token: tok, LHS: lhs, RHS: rhs}
+			lhs = AssignmentExpression{Token: tok, LHS: lhs, RHS: rhs, Span: p.spanFrom(ExpressionSpan(lhs))}
 			continue
 		}
 
@@ -535,7 +567,7 @@ func (p *Parser) parseExpression(minPrec int) (Expression, bool) {
 		if !ok {
 			return nil, false
 		}
-		lhs = BinaryExpression{Token: tok, Op: tok.Type, LHS: lhs, RHS: rhs}
+		lhs = BinaryExpression{Token: tok, Op: tok.Type, LHS: lhs, RHS: rhs, Span: p.spanFrom(ExpressionSpan(lhs))}
 	}
 }
 
@@ -549,18 +581,56 @@ func (p *Parser) parseUnaryExpression() (Expression, bool) {
 		if !ok {
 			return nil, false
 		}
-		return UnaryExpression{Token: tok, Op: tok.Type, Operand: op}, true
+		return UnaryExpression{Token: tok, Op: tok.Type, Operand: op, Span: p.spanFrom(lexer.SourceSpan(tok))}, true
+	case lexer.TokenLParen:
+		// cast and parenthesized expression are both starting with '(',
+		// only token after it tells them apart
+		openTok := p.nextTok()
+		if isTypeNameStartToken(p.peekTok().Type) {
+			return p.parseCastExpression(openTok)
+		}
+		expr, ok := p.parseExpression(0)
+		if !ok {
+			return nil, false
+		}
+		if !p.expectToken(lexer.TokenRParen, "')'") {
+			return nil, false
+		}
+		return p.parsePostfixOperators(expr)
 	default:
 		return p.parsePostfixExpression()
 	}
 }
 
+func (p *Parser) parseCastExpression(openTok lexer.Token) (Expression, bool) {
+	_, typ, ok := p.parseTypeName()
+	if !ok {
+		return nil, false
+	}
+	typ.addPointers(p.parsePointers())
+	if p.peekTok().Type == lexer.TokenLParen {
+		p.addDiagnostic(unsupportedError(code.UnsupportedDeclarator, p.peekTok(), "function pointers"))
+		return nil, false
+	}
+	if !p.expectToken(lexer.TokenRParen, "')'") {
+		return nil, false
+	}
+	operand, ok := p.parseUnaryExpression()
+	if !ok {
+		return nil, false
+	}
+	return CastExpression{Token: openTok, Type: typ, Operand: operand, Span: p.spanFrom(lexer.SourceSpan(openTok))}, true
+}
+
 func (p *Parser) parsePostfixExpression() (Expression, bool) {
 	expr, ok := p.parsePrimaryExpression()
 	if !ok {
 		return nil, false
 	}
+	return p.parsePostfixOperators(expr)
+}
 
+func (p *Parser) parsePostfixOperators(expr Expression) (Expression, bool) {
 	for p.accept(lexer.TokenLParen) {
 		callTok := p.last
 		var args []Expression
@@ -571,7 +641,7 @@ func (p *Parser) parsePostfixExpression() (Expression, bool) {
 					return nil, false
 				}
 				if p.peekTok().Type == lexer.TokenQuestion {
-					p.addDiagnostic(unsupportedError(p.peekTok(), "ternary operator"))
+					p.addDiagnostic(unsupportedError(code.UnsupportedOperator, p.peekTok(), "ternary operator"))
 					return nil, false
 				}
 				args = append(args, arg)
@@ -584,7 +654,7 @@ func (p *Parser) parsePostfixExpression() (Expression, bool) {
 		if !p.expectToken(lexer.TokenRParen, "')'") {
 			return nil, false
 		}
-		expr = CallExpression{Token: callTok, Callee: expr, Args: args}
+		expr = CallExpression{Token: callTok, Callee: expr, Args: args, Span: p.spanFrom(ExpressionSpan(expr))}
 	}
 
 	return expr, true
@@ -599,35 +669,21 @@ func (p *Parser) parsePrimaryExpression() (Expression, bool) {
 		if !ok {
 			return nil, false
 		}
-		return IdentifierExpression{Token: tok, Name: name}, true
+		return IdentifierExpression{Token: tok, Name: name, Span: lexer.SourceSpan(tok)}, true
 	case lexer.TokenIntegerConstant:
 		tok, raw, ok := p.expectInteger("integer literal")
 		if !ok {
 			return nil, false
 		}
-		return IntegerLiteralExpression{Token: tok, Raw: raw}, true
+		return IntegerLiteralExpression{Token: tok, Raw: raw, Span: lexer.SourceSpan(tok)}, true
 	case lexer.TokenCharacterConstant:
 		tok := p.nextTok()
-		return CharacterLiteralExpression{Token: tok, Raw: string(tok.Raw)}, true
-	case lexer.TokenLParen:
-		openTok := p.nextTok()
-		if isTypeSpecifierToken(p.peekTok().Type) {
-			p.addDiagnostic(unsupportedError(openTok, "casts"))
-			return nil, false
-		}
-		expr, ok := p.parseExpression(0)
-		if !ok {
-			return nil, false
-		}
-		if !p.expectToken(lexer.TokenRParen, "')'") {
-			return nil, false
-		}
-		return expr, true
+		return CharacterLiteralExpression{Token: tok, Raw: string(tok.Raw), Span: lexer.SourceSpan(tok)}, true
 	case lexer.TokenPlusPlus, lexer.TokenMinusMinus:
-		p.addDiagnostic(unsupportedError(tok, "increment/decrement operators"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedOperator, tok, "increment/decrement operators"))
 		return nil, false
 	default:
-		p.addDiagnostic(newError(p.errorToken(tok), "expected expression, got %s", tokenDescription(tok)))
+		p.addDiagnostic(newError(code.ExpectedExpression, p.errorToken(tok), "expected expression, got %s", tokenDescription(tok)))
 		return nil, false
 	}
 }
@@ -668,9 +724,9 @@ func (p *Parser) expect(tt lexer.TokenType, what string) (lexer.Token, bool) {
 	tok := p.nextTok()
 	if tok.Type != tt {
 		if tok.Type == lexer.TokenEOF {
-			p.addDiagnostic(newError(p.errorToken(tok), "unexpected end of file, expected %s", what))
+			p.addDiagnostic(newError(code.ExpectedToken, p.errorToken(tok), "unexpected end of file, expected %s", what))
 		} else {
-			p.addDiagnostic(newError(tok, "expected %s, got %s", what, tokenDescription(tok)))
+			p.addDiagnostic(newError(code.ExpectedToken, tok, "expected %s, got %s", what, tokenDescription(tok)))
 		}
 		return lexer.Token{}, false
 	}
@@ -701,7 +757,11 @@ func (p *Parser) accept(tt lexer.TokenType) bool {
 	return true
 }
 
+// peekTok and nextTok give EOF after lexer error, tokens past it are not reliable.
 func (p *Parser) peekTok() lexer.Token {
+	if p.fatalLexErr != nil {
+		return lexer.Token{Type: lexer.TokenEOF}
+	}
 	tok, err := p.tokens.Peek()
 	tok = p.normalizeToken(tok, err)
 	if tok.Type != lexer.TokenEOF {
@@ -711,14 +771,23 @@ func (p *Parser) peekTok() lexer.Token {
 }
 
 func (p *Parser) nextTok() lexer.Token {
+	if p.fatalLexErr != nil {
+		return lexer.Token{Type: lexer.TokenEOF}
+	}
 	tok, err := p.tokens.Next()
 	tok = p.normalizeToken(tok, err)
 	if tok.Type != lexer.TokenEOF {
 		p.last = tok
+		p.prev = tok
 	}
 	return tok
 }
 
+// spanFrom returns span from start to last consumed token.
+func (p *Parser) spanFrom(start lexer.Span) lexer.Span {
+	return start.Cover(lexer.SourceSpan(p.prev))
+}
+
 func (p *Parser) normalizeToken(tok lexer.Token, err error) lexer.Token {
 	if err != nil {
 		if !errors.Is(err, io.EOF) && p.fatalLexErr == nil {
@@ -742,23 +811,25 @@ func (p *Parser) hasDisallowedExprTail() bool {
 	tok := p.peekTok()
 	switch tok.Type {
 	case lexer.TokenQuestion:
-		p.addDiagnostic(unsupportedError(tok, "ternary operator"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedOperator, tok, "ternary operator"))
 		return true
 	case lexer.TokenComma:
-		p.addDiagnostic(unsupportedError(tok, "comma operator"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedOperator, tok, "comma operator"))
 		return true
 	case lexer.TokenPlusAssign, lexer.TokenMinusAssign, lexer.TokenStarAssign, lexer.TokenSlashAssign,
 		lexer.TokenPercentAssign, lexer.TokenShiftLeftAssign, lexer.TokenShiftRightAssign,
 		lexer.TokenAmpAssign, lexer.TokenCaretAssign, lexer.TokenPipeAssign:
-		p.addDiagnostic(unsupportedError(tok, "compound assignment operators"))
+		p.addDiagnostic(unsupportedError(code.UnsupportedOperator, tok, "compound assignment operators"))
 		return true
 	default:
 		return false
 	}
 }
 
+// addDiagnostic records parse error, unless lexer failed before, as the error
+// is then caused by input ending early.
 func (p *Parser) addDiagnostic(err *Error) {
-	if err != nil {
+	if err != nil && p.fatalLexErr == nil {
 		p.diagnostics = append(p.diagnostics, err)
 	}
 }
@@ -789,7 +860,7 @@ func (p *Parser) synchronizeTopLevel() {
 	for {
 		tok := p.peekTok()
 		switch tok.Type {
-		case lexer.TokenEOF, lexer.TokenInt, lexer.TokenChar, lexer.TokenVoid:
+		case lexer.TokenEOF, lexer.TokenInt, lexer.TokenChar, lexer.TokenVoid, lexer.TokenConst, lexer.TokenVolatile:
 			return
 		default:
 			p.nextTok()
@@ -816,6 +887,14 @@ func isTypeSpecifierToken(tt lexer.TokenType) bool {
 	}
 }
 
+func isTypeQualifierToken(tt lexer.TokenType) bool {
+	return tt == lexer.TokenConst || tt == lexer.TokenVolatile
+}
+
+func isTypeNameStartToken(tt lexer.TokenType) bool {
+	return isTypeSpecifierToken(tt) || isTypeQualifierToken(tt)
+}
+
 func tokenDescription(tok lexer.Token) string {
 	if len(tok.Raw) > 0 {
 		return fmt.Sprintf("%q", string(tok.Raw))
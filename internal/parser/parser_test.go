@@ -1,10 +1,13 @@
 package parser_test
 
 import (
+	"errors"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/SQLek/wihajster/internal/diag/code"
 	"github.com/SQLek/wihajster/internal/lexer"
 	"github.com/SQLek/wihajster/internal/parser"
 )
@@ -147,11 +150,89 @@ int main() {
 	}
 }
 
+func TestParseTranslationUnit_ParsesQualifiersAndCasts(t *testing.T) {
+	src := `
+int main() {
+	volatile char *uart = (char *)0x10000000;
+	char * const volatile p = (char *)(int)uart;
+	return (int)*uart;
+}
+`
+
+	tu := parseOK(t, src)
+	stmts := tu.Functions[0].Body.Statements
+
+	uart := stmts[0].(parser.DeclarationStatement).Declaration
+	if !uart.Type.Qualifiers.Has(parser.TypeQualifierVolatile) || uart.Type.PointerDepth != 1 {
+		t.Fatalf("expected pointer to volatile char, got %#v", uart.Type)
+	}
+	if uart.Type.PointerQualifiers[0] != 0 {
+		t.Fatalf("expected unqualified pointer level, got %v", uart.Type.PointerQualifiers[0])
+	}
+	cast, ok := uart.Initializer.(parser.CastExpression)
+	if !ok {
+		t.Fatalf("expected cast initializer, got %T", uart.Initializer)
+	}
+	if cast.Type.Specifier != parser.TypeSpecifierChar || cast.Type.PointerDepth != 1 {
+		t.Fatalf("expected cast to char*, got %#v", cast.Type)
+	}
+
+	p := stmts[1].(parser.DeclarationStatement).Declaration
+	if p.Type.Qualifiers != 0 {
+		t.Fatalf("expected unqualified char, got %v", p.Type.Qualifiers)
+	}
+	if want := parser.TypeQualifierConst | parser.TypeQualifierVolatile; p.Type.PointerQualifiers[0] != want {
+		t.Fatalf("expected const volatile pointer, got %v", p.Type.PointerQualifiers[0])
+	}
+	outer, ok := p.Initializer.(parser.CastExpression)
+	if !ok {
+		t.Fatalf("expected nested cast initializer, got %T", p.Initializer)
+	}
+	if _, ok := outer.Operand.(parser.CastExpression); !ok {
+		t.Fatalf("expected cast operand to be cast, got %T", outer.Operand)
+	}
+
+	ret := stmts[2].(parser.ReturnStatement)
+	retCast, ok := ret.Expression.(parser.CastExpression)
+	if !ok {
+		t.Fatalf("expected cast in return, got %T", ret.Expression)
+	}
+	if deref, ok := retCast.Operand.(parser.UnaryExpression); !ok || deref.Op != lexer.TokenStar {
+		t.Fatalf("expected cast to bind dereference operand, got %#v", retCast.Operand)
+	}
+}
+
+func TestParseTranslationUnit_CastBindsTighterThanCall(t *testing.T) {
+	src := `
+int main() {
+	return (int)f(1) + (g)(2);
+}
+`
+
+	tu := parseOK(t, src)
+	ret := tu.Functions[0].Body.Statements[0].(parser.ReturnStatement)
+	add, ok := ret.Expression.(parser.BinaryExpression)
+	if !ok {
+		t.Fatalf("expected addition, got %T", ret.Expression)
+	}
+	cast, ok := add.LHS.(parser.CastExpression)
+	if !ok {
+		t.Fatalf("expected cast on lhs, got %T", add.LHS)
+	}
+	if _, ok := cast.Operand.(parser.CallExpression); !ok {
+		t.Fatalf("expected cast operand to be call, got %T", cast.Operand)
+	}
+	if _, ok := add.RHS.(parser.CallExpression); !ok {
+		t.Fatalf("expected parenthesized callee to be called, got %T", add.RHS)
+	}
+}
+
 func TestParseTranslationUnit_RejectsUnsupportedSyntax(t *testing.T) {
 	tests := []struct {
 		name string
 		src  string
 		msg  string
+		code code.Code
 	}{
 		{
 			name: "variadic function",
@@ -160,7 +241,8 @@ int main(int x, ...) {
 	return x;
 }
 `,
-			msg: "unsupported in current subset: variadic functions",
+			msg:  "unsupported in current subset: variadic functions",
+			code: code.VariadicFunction,
 		},
 		{
 			name: "array declaration",
@@ -168,7 +250,8 @@ int main(int x, ...) {
 int arr[4];
 int main() { return 0; }
 `,
-			msg: "unsupported in current subset: arrays",
+			msg:  "unsupported in current subset: arrays",
+			code: code.UnsupportedDeclarator,
 		},
 		{
 			name: "switch statement",
@@ -177,16 +260,18 @@ int main() {
 	switch (1) { return 0; }
 }
 `,
-			msg: "unsupported in current subset: switch statements",
+			msg:  "unsupported in current subset: switch statements",
+			code: code.UnsupportedStatement,
 		},
 		{
-			name: "cast expression",
+			name: "function pointer cast",
 			src: `
 int main() {
-	return (int)1;
+	return (int (*)(int))0;
 }
 `,
-			msg: "unsupported in current subset: casts",
+			msg:  "unsupported in current subset: function pointers",
+			code: code.UnsupportedDeclarator,
 		},
 	}
 
@@ -196,6 +281,9 @@ int main() {
 			if !strings.Contains(err.Error(), tc.msg) {
 				t.Fatalf("expected error to contain %q, got %q", tc.msg, err.Error())
 			}
+			if err.Code != tc.code {
+				t.Fatalf("expected code %s, got %s", tc.code, err.Code)
+			}
 			if err.Line <= 0 || err.Column <= 0 {
 				t.Fatalf("expected parser error position to be populated, got %d:%d", err.Line, err.Column)
 			}
@@ -203,6 +291,93 @@ int main() {
 	}
 }
 
+func TestParseTranslationUnit_ErrorInMacroExpansion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c": {Data: []byte("#define BAD switch\nint main() {\n\tBAD (1) { return 0; }\n}\n")},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lex.Close()
+	_, err = parser.Parse(lex)
+	if err == nil {
+		t.Fatal("expected parse error but got none")
+	}
+	want := "main.c:1:13: unsupported in current subset: switch statements\n" +
+		"main.c:3:2: note: in expansion of macro BAD\n" +
+		"main.c:1:9: note: macro BAD defined here"
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected error to contain %q, got %q", want, err.Error())
+	}
+}
+
+func TestParseTranslationUnit_Spans(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.c": {Data: []byte("#define ONE 1\nint main() {\n\treturn ONE + f(2);\n}\n")},
+	}
+	lex, err := lexer.NewLexerFS(fsys, "main.c", lexer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lex.Close()
+	tu, err := parser.Parse(lex)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	fn := tu.Functions[0]
+	if want := (lexer.Span{File: "main.c", Start: 14, End: 48}); fn.Span != want {
+		t.Fatalf("expected function span %v, got %v", want, fn.Span)
+	}
+	ret := fn.Body.Statements[0].(parser.ReturnStatement)
+	if want := (lexer.Span{File: "main.c", Start: 28, End: 46}); ret.Span != want {
+		t.Fatalf("expected return span %v, got %v", want, ret.Span)
+	}
+	// expanded ONE is spanned by macro name
+	bin := ret.Expression.(parser.BinaryExpression)
+	if want := (lexer.Span{File: "main.c", Start: 35, End: 45}); bin.Span != want {
+		t.Fatalf("expected binary span %v, got %v", want, bin.Span)
+	}
+	if want := (lexer.Span{File: "main.c", Start: 35, End: 38}); parser.ExpressionSpan(bin.LHS) != want {
+		t.Fatalf("expected macro operand span %v, got %v", want, parser.ExpressionSpan(bin.LHS))
+	}
+}
+
+func TestParseErrors_ErrorListsAllDiagnostics(t *testing.T) {
+	pErrs := parseErrors(t, `
+int main() {
+	1 ?;
+	2 ?;
+	return 0;
+}
+`)
+	if len(pErrs.Diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d: %v", len(pErrs.Diagnostics), pErrs)
+	}
+	lines := strings.Split(pErrs.Error(), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "3:") || !strings.HasPrefix(lines[1], "4:") {
+		t.Fatalf("expected both diagnostics in message, got %q", pErrs.Error())
+	}
+}
+
+func TestParseErrors_StopsAtLexerError(t *testing.T) {
+	pErrs := parseErrors(t, `
+int main() {
+	return 1.5;
+	2 ?;
+}
+`)
+	var lexErr *lexer.Error
+	if !errors.As(pErrs.FatalLexer, &lexErr) || lexErr.Code != code.UnsupportedFloat || lexErr.Line != 3 || lexErr.Column != 9 {
+		t.Fatalf("expected floating constant error at 3:9, got %v", pErrs.FatalLexer)
+	}
+	// tokens after error, like "." of 1.5, would give errors without meaning
+	if len(pErrs.Diagnostics) != 0 {
+		t.Fatalf("expected no parser diagnostics after lexer error, got %v", pErrs.Diagnostics)
+	}
+}
+
 func TestParserBacklogSkeleton_GroupsPresent(t *testing.T) {
 	t.Run("declarators", func(t *testing.T) {})
 	t.Run("declarations", func(t *testing.T) {})
@@ -0,0 +1,757 @@
+package sema
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+	"github.com/SQLek/wihajster/internal/tac"
+)
+
+type functionSignature struct {
+	ReturnType string
+	Params     []string
+}
+
+// builtinFunctions are implicitly declared externals provided by host at run time,
+// e.g. by TAC evaluator. Redeclaration must match.
+var builtinFunctions = map[string]functionSignature{
+	"putchar":        {ReturnType: "i32", Params: []string{"i32"}},
+	"__wh_assert":    {ReturnType: "void", Params: []string{"i32"}},
+	"__wh_print_int": {ReturnType: "void", Params: []string{"i32"}},
+	"malloc":         {ReturnType: "void*", Params: []string{"i32"}},
+	"free":           {ReturnType: "void", Params: []string{"void*"}},
+}
+
+// libraryFunctions are builtins source may define itself, with any signature, as
+// hosted C library functions. Definition replaces builtin in whole translation unit.
+var libraryFunctions = map[string]bool{"malloc": true, "free": true}
+
+type analyzer struct {
+	*report
+	// file is file scope, with functions only
+	file  *Scope
+	scope *Scope
+
+	returnType string
+	// pos is token of statement being analyzed
+	pos lexer.Token
+}
+
+// Analyze resolves names and checks types of translation unit, reporting enabled
+// warnings in source order. Analysis continues after errors, they are returned in
+// source order as *Errors, at most Options.ErrorLimit of them. Program is returned
+// even with errors, expressions with error have ErrorType.
+func Analyze(tu *parser.TranslationUnit, opts Options) (*Program, []Warning, error) {
+	r := &report{enabled: opts.Warnings, limit: opts.ErrorLimit}
+	if r.enabled == nil {
+		r.enabled = DefaultWarnings()
+	}
+	prog := r.analyzeTranslationUnit(tu)
+	sortWarnings(r.warnings)
+	if len(r.errors) > 0 {
+		sortErrors(r.errors)
+		errs := &Errors{Diagnostics: r.errors}
+		if r.stopped() {
+			errs.Diagnostics, errs.Limit = r.errors[:r.limit], r.limit
+		}
+		return prog, r.warnings, errs
+	}
+	return prog, r.warnings, nil
+}
+
+func (r *report) analyzeTranslationUnit(tu *parser.TranslationUnit) *Program {
+	for _, decl := range tu.Declarations {
+		r.errorf(unsupportedError(code.GlobalDeclaration, decl.Token, "global declarations"))
+	}
+
+	file := newScope(nil, lexer.Span{})
+	prototypes := map[string]functionSignature{}
+	for _, name := range slices.Sorted(maps.Keys(builtinFunctions)) {
+		if libraryFunctions[name] && slices.ContainsFunc(tu.Functions, func(fn parser.FunctionDefinition) bool { return fn.Name == name }) {
+			continue
+		}
+		sig := builtinFunctions[name]
+		prototypes[name] = sig
+		file.declare(&Symbol{Kind: SymbolFunction, Name: name, Type: sig.ReturnType, Params: sig.Params})
+	}
+	definitions := map[string]functionSignature{}
+
+	for _, proto := range tu.Prototypes {
+		sig, err := signatureForFunction(proto.Token, proto.ReturnType, proto.Parameters)
+		if err != nil {
+			r.errorf(err)
+			continue
+		}
+		if prev, exists := prototypes[proto.Name]; exists {
+			if !sameSignature(prev, sig) {
+				r.errorf(newError(code.ConflictingDeclaration, proto.Token, "conflicting prototype for function %s", proto.Name))
+			} else if sym := file.names[proto.Name]; !sym.Token.IsValid() {
+				// builtin declared again, prototype is its declaration in source
+				sym.Token = proto.Token
+			}
+			continue
+		}
+		if def, exists := definitions[proto.Name]; exists && !sameSignature(def, sig) {
+			r.errorf(newError(code.ConflictingDeclaration, proto.Token, "conflicting prototype for function %s", proto.Name))
+			continue
+		}
+		prototypes[proto.Name] = sig
+		file.declare(&Symbol{Kind: SymbolFunction, Name: proto.Name, Type: sig.ReturnType, Params: sig.Params, Token: proto.Token})
+	}
+
+	// bodies of functions with invalid signature or defined again are not checked
+	valid := make([]bool, len(tu.Functions))
+	for i, pfn := range tu.Functions {
+		sig, err := signatureForFunction(pfn.Token, pfn.ReturnType, pfn.Parameters)
+		if err != nil {
+			r.errorf(err)
+			continue
+		}
+		if prev, exists := definitions[pfn.Name]; exists {
+			if sameSignature(prev, sig) {
+				r.errorf(newError(code.Redefinition, pfn.Token, "function %s defined multiple times", pfn.Name))
+			} else {
+				r.errorf(newError(code.ConflictingDeclaration, pfn.Token, "conflicting definition for function %s", pfn.Name))
+			}
+			continue
+		}
+		if proto, exists := prototypes[pfn.Name]; exists && !sameSignature(proto, sig) {
+			r.errorf(newError(code.ConflictingDeclaration, pfn.Token, "function definition does not match prototype for %s", pfn.Name))
+		}
+		definitions[pfn.Name] = sig
+		valid[i] = true
+		// definition is declaration of function callers are checked against
+		sym := file.names[pfn.Name]
+		if sym == nil {
+			sym = &Symbol{Kind: SymbolFunction, Name: pfn.Name}
+			file.declare(sym)
+		}
+		sym.Type, sym.Params, sym.Token = sig.ReturnType, sig.Params, pfn.Token
+	}
+
+	prog := &Program{Scope: file}
+	for i, pfn := range tu.Functions {
+		if r.stopped() {
+			break
+		}
+		if !valid[i] {
+			continue
+		}
+		a := &analyzer{report: r, file: file, scope: file}
+		prog.Functions = append(prog.Functions, a.analyzeFunction(pfn))
+	}
+	return prog
+}
+
+func (a *analyzer) analyzeFunction(pfn parser.FunctionDefinition) FunctionDefinition {
+	fn := FunctionDefinition{Token: pfn.Token, Span: pfn.Span, Symbol: a.file.names[pfn.Name]}
+	a.returnType = fn.Symbol.Type
+	a.pos = pfn.Token
+	// parameters are in the same scope as outermost block of body
+	fn.Scope = a.pushScope(pfn.Span)
+	defer a.popScope()
+
+	for _, param := range pfn.Parameters {
+		// signature of function is valid, so are types of parameters
+		paramType, _ := lowerObjectType(param.Token, param.Type)
+		if _, err := a.declareLocal(SymbolParameter, param.Token, param.Name, paramType); err != nil {
+			a.errorf(err)
+		}
+	}
+
+	stmts, reachable := a.analyzeBlockStatements(pfn.Body.Statements)
+	fn.Body = BlockStatement{Token: pfn.Body.Token, Span: pfn.Body.Span, Scope: fn.Scope, Statements: stmts}
+	// body not fully analyzed because of error limit may seem to reach its end
+	if reachable && !a.stopped() && a.returnType != "void" {
+		a.errorf(newError(code.MissingReturn, pfn.Token, "function %s may reach end without return", pfn.Name))
+	}
+	return fn
+}
+
+func signatureForFunction(tok lexer.Token, ret parser.TypeName, params []parser.FunctionParameter) (functionSignature, error) {
+	retType := unqualified(lowerType(ret))
+	if retType == "" {
+		return functionSignature{}, unsupportedError(code.Unsupported, tok, "function return type")
+	}
+
+	out := functionSignature{ReturnType: retType, Params: make([]string, 0, len(params))}
+	seen := map[string]struct{}{}
+	for _, param := range params {
+		paramType, err := lowerObjectType(param.Token, param.Type)
+		if err != nil {
+			return functionSignature{}, err
+		}
+		if _, exists := seen[param.Name]; exists {
+			return functionSignature{}, newError(code.Redeclaration, param.Token, "parameter %s redeclared", param.Name)
+		}
+		seen[param.Name] = struct{}{}
+		// top level qualifiers of parameters are not part of function type
+		out.Params = append(out.Params, unqualified(paramType))
+	}
+	return out, nil
+}
+
+func sameSignature(a, b functionSignature) bool {
+	return a.ReturnType == b.ReturnType && slices.Equal(a.Params, b.Params)
+}
+
+func (a *analyzer) pushScope(span lexer.Span) *Scope {
+	a.scope = newScope(a.scope, span)
+	return a.scope
+}
+
+func (a *analyzer) popScope() {
+	a.warnUnused(a.scope)
+	a.scope = a.scope.Parent
+}
+
+// declareLocal declares parameter or variable in current scope. Redeclared
+// symbol is returned with error, not visible by name.
+func (a *analyzer) declareLocal(kind SymbolKind, tok lexer.Token, name, typ string) (*Symbol, error) {
+	sym := &Symbol{Kind: kind, Name: name, Type: typ, Token: tok}
+	if _, exists := a.scope.names[name]; exists {
+		sym.Scope = a.scope
+		return sym, newError(code.Redeclaration, tok, "identifier %s redeclared in this scope", name)
+	}
+	a.warnShadow(tok, name)
+	a.scope.declare(sym)
+	return sym, nil
+}
+
+// resolveVariable finds variable or parameter visible by name, marking it used.
+// Functions are not objects, so file scope is not searched.
+func (a *analyzer) resolveVariable(name string) *Symbol {
+	for s := a.scope; s != a.file; s = s.Parent {
+		if sym, ok := s.names[name]; ok {
+			sym.Used = true
+			return sym
+		}
+	}
+	return nil
+}
+
+// analyzeBlockStatements analyzes statements and returns if end of last one is reachable.
+// Code after statement not reaching its end is checked, but not lowered.
+// Analysis stops when there are too many errors.
+func (a *analyzer) analyzeBlockStatements(stmts []parser.Statement) ([]Statement, bool) {
+	out := make([]Statement, 0, len(stmts))
+	reachable := true
+	for _, nested := range stmts {
+		if a.stopped() {
+			break
+		}
+		stmt, nestedReachable := a.analyzeStatement(nested)
+		out = append(out, stmt)
+		reachable = reachable && nestedReachable
+	}
+	return out, reachable
+}
+
+// analyzeStatement analyzes stmt, reporting its errors, and returns if its end is reachable.
+func (a *analyzer) analyzeStatement(stmt parser.Statement) (Statement, bool) {
+	if tok := statementToken(stmt); tok.IsValid() {
+		a.pos = tok
+	}
+	switch s := stmt.(type) {
+	case parser.BlockStatement:
+		block := BlockStatement{Token: s.Token, Span: s.Span, Scope: a.pushScope(s.Span)}
+		var reachable bool
+		block.Statements, reachable = a.analyzeBlockStatements(s.Statements)
+		a.popScope()
+		return block, reachable
+	case parser.DeclarationStatement:
+		return a.analyzeLocalDeclaration(s.Token, s.Span, s.Declaration), true
+	case parser.ExpressionStatement:
+		out := ExpressionStatement{Token: s.Token, Span: s.Span}
+		if s.Expression == nil {
+			return out, true
+		}
+		out.Expression = a.value(s.Expression)
+		if out.Expression.ExpressionType() != ErrorType {
+			a.warnNoEffect(out)
+		}
+		return out, true
+	case parser.ReturnStatement:
+		out := ReturnStatement{Token: s.Token, Span: s.Span}
+		if s.Expression == nil {
+			if a.returnType != "void" {
+				a.errorf(newError(code.MissingReturn, s.Token, "non-void function must return a value"))
+			}
+			return out, false
+		}
+
+		val := a.value(s.Expression)
+		switch typ := val.ExpressionType(); {
+		case a.returnType == "void":
+			a.errorf(newError(code.VoidReturnValue, s.Token, "void function must not return a value"))
+			out.Expression = val
+		case !assignable(a.returnType, typ):
+			a.errorf(newError(code.IncompatibleTypes, s.Token, "return type mismatch: expected %s, got %s", a.returnType, typ))
+			out.Expression = val
+		default:
+			out.Expression = a.implicit(s.Token, s.Expression, val, a.returnType)
+		}
+		return out, false
+	case parser.IfStatement:
+		out := IfStatement{Token: s.Token, Span: s.Span, Cond: a.condition(s.Token, "if", s.Cond)}
+		var thenReachable, elseReachable bool
+		out.Then, thenReachable = a.analyzeStatement(s.Then)
+		if s.Else == nil {
+			return out, true
+		}
+		out.Else, elseReachable = a.analyzeStatement(s.Else)
+		return out, thenReachable || elseReachable
+	case parser.WhileStatement:
+		out := WhileStatement{Token: s.Token, Span: s.Span, Cond: a.condition(s.Token, "while", s.Cond)}
+		out.Body, _ = a.analyzeStatement(s.Body)
+		return out, true
+	case parser.ForStatement:
+		out := ForStatement{Token: s.Token, Span: s.Span, Scope: a.pushScope(s.Span)}
+		defer a.popScope()
+		if s.Init != nil {
+			out.Init, _ = a.analyzeStatement(s.Init)
+		}
+		if s.Cond != nil {
+			out.Cond = a.condition(s.Token, "for", s.Cond)
+		}
+		out.Body, _ = a.analyzeStatement(s.Body)
+		if s.Post != nil {
+			out.Post = a.value(s.Post)
+		}
+		return out, true
+	default:
+		a.errorf(unsupportedError(code.Unsupported, a.pos, "statement kind"))
+		return ExpressionStatement{Token: a.pos}, true
+	}
+}
+
+func statementToken(stmt parser.Statement) lexer.Token {
+	switch s := stmt.(type) {
+	case parser.BlockStatement:
+		return s.Token
+	case parser.DeclarationStatement:
+		return s.Token
+	case parser.ExpressionStatement:
+		return s.Token
+	case parser.ReturnStatement:
+		return s.Token
+	case parser.IfStatement:
+		return s.Token
+	case parser.WhileStatement:
+		return s.Token
+	case parser.ForStatement:
+		return s.Token
+	default:
+		return lexer.Token{}
+	}
+}
+
+func expressionToken(expr parser.Expression) lexer.Token {
+	switch e := expr.(type) {
+	case parser.IdentifierExpression:
+		return e.Token
+	case parser.IntegerLiteralExpression:
+		return e.Token
+	case parser.CharacterLiteralExpression:
+		return e.Token
+	case parser.UnaryExpression:
+		return e.Token
+	case parser.BinaryExpression:
+		return e.Token
+	case parser.AssignmentExpression:
+		return e.Token
+	case parser.CastExpression:
+		return e.Token
+	case parser.CallExpression:
+		return e.Token
+	default:
+		return lexer.Token{}
+	}
+}
+
+func (a *analyzer) analyzeLocalDeclaration(tok lexer.Token, span lexer.Span, decl parser.Declaration) DeclarationStatement {
+	typ, err := lowerObjectType(decl.Token, decl.Type)
+	if err != nil {
+		// variable is still declared, so its uses are not reported as undeclared
+		a.errorf(err)
+		typ = ErrorType
+	}
+	sym, err := a.declareLocal(SymbolVariable, decl.NameToken, decl.Name, typ)
+	if err != nil {
+		a.errorf(err)
+	}
+	out := DeclarationStatement{Token: tok, Span: span, Symbol: sym}
+	if decl.Initializer == nil {
+		return out
+	}
+	value := a.value(decl.Initializer)
+	if !assignable(typ, value.ExpressionType()) {
+		a.errorf(newError(code.IncompatibleTypes, decl.Token, "initializer type mismatch for %s: expected %s, got %s", decl.Name, unqualified(typ), value.ExpressionType()))
+		out.Initializer = value
+		return out
+	}
+	out.Initializer = a.implicit(decl.Token, decl.Initializer, value, typ)
+	return out
+}
+
+// condition analyzes condition of statement, reporting one of void type.
+func (a *analyzer) condition(tok lexer.Token, what string, expr parser.Expression) Expression {
+	cond := a.value(expr)
+	if cond.ExpressionType() == "void" {
+		a.errorf(newError(code.VoidValue, tok, "%s condition cannot have void type", what))
+	}
+	return cond
+}
+
+// check returns typ, or reports err and returns ErrorType. Expressions with
+// operands of ErrorType have it without error, so one mistake is reported once.
+func (a *analyzer) check(typ string, err error) string {
+	if err != nil {
+		a.errorf(err)
+		return ErrorType
+	}
+	return typ
+}
+
+// value analyzes expr used for its value, reporting its errors.
+func (a *analyzer) value(expr parser.Expression) Expression {
+	switch e := expr.(type) {
+	case parser.IntegerLiteralExpression:
+		out := ConstantExpression{Token: e.Token, Span: e.Span, Type: "i32"}
+		value, err := decodeIntegerLiteral(e.Raw)
+		if err != nil {
+			out.Type = a.check("", newError(code.InvalidLiteral, e.Token, "invalid integer literal %q", e.Raw))
+		}
+		out.Value = value
+		return out
+	case parser.CharacterLiteralExpression:
+		out := ConstantExpression{Token: e.Token, Span: e.Span, Type: "i32"}
+		value, err := decodeCharacterLiteral(e.Raw)
+		if err != nil {
+			out.Type = a.check("", newError(code.InvalidLiteral, e.Token, "%s", err.Error()))
+		}
+		out.Value = value
+		return out
+	case parser.IdentifierExpression:
+		out := IdentifierExpression{Token: e.Token, Span: e.Span, Symbol: a.resolveVariable(e.Name)}
+		if out.Symbol == nil {
+			out.Type = a.check("", newError(code.UndeclaredIdentifier, e.Token, "use of undeclared identifier %s", e.Name))
+			return out
+		}
+		out.Type = unqualified(out.Symbol.Type)
+		return out
+	case parser.UnaryExpression:
+		out := UnaryExpression{Token: e.Token, Span: e.Span, Op: e.Op}
+		if e.Op == lexer.TokenAmp {
+			var objType string
+			out.Operand, objType = a.address(e.Operand)
+			out.Type = ErrorType
+			if objType != ErrorType {
+				out.Type = pointerTo(objType)
+			}
+			return out
+		}
+		out.Operand = a.value(e.Operand)
+		out.Type = a.check(unaryType(e, out.Operand.ExpressionType()))
+		return out
+	case parser.BinaryExpression:
+		out := BinaryExpression{Token: e.Token, Span: e.Span, Op: e.Op, LHS: a.value(e.LHS), RHS: a.value(e.RHS)}
+		lhsType, rhsType := out.LHS.ExpressionType(), out.RHS.ExpressionType()
+		if lhsType != ErrorType && rhsType != ErrorType && lhsType != "void" && rhsType != "void" {
+			a.warnComparison(e, out.LHS, out.RHS)
+		}
+		out.Type = a.check(binaryType(e, lhsType, rhsType))
+		return out
+	case parser.AssignmentExpression:
+		out := AssignmentExpression{Token: e.Token, Span: e.Span}
+		var lhsType string
+		out.LHS, lhsType = a.address(e.LHS)
+		out.RHS = a.value(e.RHS)
+		rhsType := out.RHS.ExpressionType()
+		switch {
+		case lhsType == ErrorType || rhsType == ErrorType:
+			out.Type = ErrorType
+		case isConstType(lhsType):
+			out.Type = a.check("", newError(code.AssignToConst, e.Token, "cannot assign to const-qualified object of type %s", lhsType))
+		case !assignable(lhsType, rhsType):
+			out.Type = a.check("", newError(code.IncompatibleTypes, e.Token, "assignment type mismatch: expected %s, got %s", unqualified(lhsType), rhsType))
+		default:
+			out.RHS = a.implicit(e.Token, e.RHS, out.RHS, lhsType)
+			out.Type = unqualified(lhsType)
+		}
+		return out
+	case parser.CallExpression:
+		return a.analyzeCall(e)
+	case parser.CastExpression:
+		out := CastExpression{Token: e.Token, Span: e.Span, Operand: a.value(e.Operand)}
+		out.Type = a.check(castType(e, out.Operand.ExpressionType()))
+		return out
+	default:
+		a.errorf(unsupportedError(code.Unsupported, a.pos, "expression kind"))
+		return errorExpression{Span: parser.ExpressionSpan(expr)}
+	}
+}
+
+// address analyzes expr designating object, as target of assignment or operand of &.
+// It returns expression and qualified type of object.
+func (a *analyzer) address(expr parser.Expression) (Expression, string) {
+	switch e := expr.(type) {
+	case parser.IdentifierExpression:
+		out := a.value(e)
+		if id := out.(IdentifierExpression); id.Symbol != nil {
+			return out, id.Symbol.Type
+		}
+		return out, ErrorType
+	case parser.UnaryExpression:
+		if e.Op != lexer.TokenStar {
+			break
+		}
+		out := UnaryExpression{Token: e.Token, Span: e.Span, Op: e.Op, Operand: a.value(e.Operand)}
+		elemType, err := derefType(e.Token, out.Operand.ExpressionType())
+		if out.Type = a.check(unqualified(elemType), err); out.Type == ErrorType {
+			return out, ErrorType
+		}
+		return out, elemType
+	}
+	a.errorf(unsupportedError(code.Unsupported, expressionToken(expr), "assignment target"))
+	// expression is still analyzed, for errors and types of its parts
+	return a.value(expr), ErrorType
+}
+
+// derefType returns qualified type of object pointer of type ptrType points to.
+func derefType(tok lexer.Token, ptrType string) (string, error) {
+	if ptrType == ErrorType {
+		return ErrorType, nil
+	}
+	elemType, ok := pointeeType(ptrType)
+	if !ok {
+		return "", newError(code.InvalidDereference, tok, "cannot dereference non-pointer type %s", ptrType)
+	}
+	if isVoidType(elemType) {
+		return "", newError(code.InvalidDereference, tok, "cannot dereference void* without cast")
+	}
+	return elemType, nil
+}
+
+func unaryType(e parser.UnaryExpression, operand string) (string, error) {
+	if e.Op == lexer.TokenStar {
+		elemType, err := derefType(e.Token, operand)
+		return unqualified(elemType), err
+	}
+	switch {
+	case operand == ErrorType:
+		return ErrorType, nil
+	case operand == "void":
+		return "", newError(code.VoidValue, e.Token, "unary operator requires non-void operand")
+	case isPointerType(operand):
+		return "", newError(code.InvalidOperands, e.Token, "unary operator %v does not accept pointer operand", e.Op)
+	}
+	switch e.Op {
+	case lexer.TokenPlus, lexer.TokenMinus, lexer.TokenBang, lexer.TokenTilde:
+		// char operand is promoted
+		return "i32", nil
+	default:
+		return "", unsupportedError(code.Unsupported, e.Token, "unary operator")
+	}
+}
+
+func binaryType(e parser.BinaryExpression, lhs, rhs string) (string, error) {
+	if lhs == ErrorType || rhs == ErrorType {
+		return ErrorType, nil
+	}
+	if lhs == "void" || rhs == "void" {
+		return "", newError(code.VoidValue, e.Token, "binary operator requires non-void operands")
+	}
+	if binaryOpcode(e.Op) == tac.OpcodeInvalid {
+		return "", unsupportedError(code.Unsupported, e.Token, "binary operator")
+	}
+	if e.Op == lexer.TokenAndAnd || e.Op == lexer.TokenOrOr {
+		return "i32", nil
+	}
+	if isPointerType(lhs) || isPointerType(rhs) {
+		return pointerBinaryType(e, lhs, rhs)
+	}
+	// char operands are promoted
+	return "i32", nil
+}
+
+// pointerBinaryType checks binary operators with pointer operand.
+func pointerBinaryType(e parser.BinaryExpression, lhs, rhs string) (string, error) {
+	lhsPtr, rhsPtr := isPointerType(lhs), isPointerType(rhs)
+	switch e.Op {
+	case lexer.TokenPlus:
+		if lhsPtr && rhsPtr {
+			break
+		}
+		if rhsPtr {
+			lhs = rhs
+		}
+		return unqualified(lhs), checkElementSize(e.Token, lhs)
+	case lexer.TokenMinus:
+		if !rhsPtr {
+			return unqualified(lhs), checkElementSize(e.Token, lhs)
+		}
+		if !lhsPtr || !samePointee(lhs, rhs) {
+			break
+		}
+		return "i32", checkElementSize(e.Token, lhs)
+	case lexer.TokenEq, lexer.TokenNe:
+		comparable := lhsPtr && rhsPtr && samePointee(lhs, rhs)
+		comparable = comparable || lhsPtr && isNullPointerConstant(e.RHS)
+		comparable = comparable || rhsPtr && isNullPointerConstant(e.LHS)
+		if comparable {
+			return "i32", nil
+		}
+	case lexer.TokenLt, lexer.TokenLe, lexer.TokenGt, lexer.TokenGe:
+		if lhsPtr && rhsPtr && samePointee(lhs, rhs) {
+			return "i32", nil
+		}
+	}
+	return "", newError(code.InvalidOperands, e.Token, "invalid operands to binary %s (%s and %s)", string(e.Token.Raw), lhs, rhs)
+}
+
+func checkElementSize(tok lexer.Token, ptrType string) error {
+	if elementSize(ptrType) == 0 {
+		elem, _ := pointeeType(ptrType)
+		return newError(code.InvalidOperands, tok, "arithmetic on pointer to incomplete type %s", elem)
+	}
+	return nil
+}
+
+func isNullPointerConstant(expr parser.Expression) bool {
+	lit, ok := expr.(parser.IntegerLiteralExpression)
+	if !ok {
+		return false
+	}
+	value, err := decodeIntegerLiteral(lit.Raw)
+	return err == nil && value == 0
+}
+
+func castType(e parser.CastExpression, operand string) (string, error) {
+	target := unqualified(lowerType(e.Type))
+	switch {
+	case target == "":
+		return "", unsupportedError(code.Unsupported, e.Token, "cast type")
+	case target == "void":
+		return "void", nil
+	case operand == ErrorType:
+		return ErrorType, nil
+	case operand == "void":
+		return "", newError(code.VoidValue, e.Token, "cannot cast void expression to %s", target)
+	}
+	return target, nil
+}
+
+func (a *analyzer) analyzeCall(e parser.CallExpression) Expression {
+	out := CallExpression{Token: e.Token, Span: e.Span, Type: ErrorType, Args: make([]Expression, 0, len(e.Args))}
+	callee, ok := e.Callee.(parser.IdentifierExpression)
+	if ok {
+		out.Function = a.file.names[callee.Name]
+	}
+	valid := out.Function != nil && len(e.Args) == len(out.Function.Params)
+	switch {
+	case !ok:
+		a.errorf(unsupportedError(code.Unsupported, e.Token, "function call target"))
+	case out.Function == nil:
+		a.errorf(newError(code.UndeclaredFunction, callee.Token, "call to undeclared function %s", callee.Name))
+	case !valid:
+		a.errorf(newError(code.ArgumentCount, e.Token, "function %s expects %d arguments, got %d", callee.Name, len(out.Function.Params), len(e.Args)))
+	}
+	if out.Function != nil {
+		out.Function.Used = true
+	}
+	// arguments are checked even of invalid call, for their own errors
+	for i, argExpr := range e.Args {
+		arg := a.value(argExpr)
+		out.Args = append(out.Args, arg)
+		if !valid || arg.ExpressionType() == ErrorType {
+			valid = false
+			continue
+		}
+		expected := out.Function.Params[i]
+		if !assignable(expected, arg.ExpressionType()) {
+			a.errorf(newError(code.IncompatibleTypes, e.Token, "argument %d to %s has type %s, expected %s", i+1, callee.Name, arg.ExpressionType(), expected))
+			valid = false
+			continue
+		}
+		out.Args[i] = a.implicit(e.Token, argExpr, arg, expected)
+	}
+	if valid {
+		out.Type = out.Function.Type
+	}
+	return out
+}
+
+// implicit converts value stored without cast to type of object, warning when it may lose bits.
+func (a *analyzer) implicit(tok lexer.Token, expr parser.Expression, v Expression, to string) Expression {
+	from, to := v.ExpressionType(), unqualified(to)
+	if from == to || from == ErrorType || to == ErrorType {
+		return v
+	}
+	if to == "i8" && from == "i32" {
+		if value, ok := constantValue(expr); !ok || value < -128 || value > 127 {
+			a.warnf(WarnImplicitIntConversion, tok, "implicit conversion from %s to %s may change value", from, to)
+		}
+	}
+	return CastExpression{Token: tok, Span: ExpressionSpan(v), Type: to, Operand: v, Implicit: true}
+}
+
+// decodeIntegerLiteral accepts decimal, octal and hexadecimal constants with optional suffix.
+// Octal and hexadecimal ones up to 0xFFFFFFFF wrap to int, like addresses (int *)0x80000000.
+func decodeIntegerLiteral(raw string) (int32, error) {
+	// base prefixes of C and Go are the same, leading zero means octal
+	digits := strings.TrimRight(raw, "uUlL")
+	if len(digits) > 1 && digits[0] == '0' {
+		n, err := strconv.ParseUint(digits, 0, 32)
+		if err != nil {
+			return 0, err
+		}
+		return int32(uint32(n)), nil
+	}
+	n, err := strconv.ParseInt(digits, 0, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(n), nil
+}
+
+func decodeCharacterLiteral(raw string) (int32, error) {
+	if len(raw) < 3 || raw[0] != '\'' || raw[len(raw)-1] != '\'' {
+		return 0, fmt.Errorf("invalid character literal %q", raw)
+	}
+	body := raw[1 : len(raw)-1]
+	if len(body) == 0 {
+		return 0, fmt.Errorf("invalid character literal %q", raw)
+	}
+	if body[0] != '\\' {
+		if len(body) != 1 {
+			return 0, fmt.Errorf("multi-character literals are unsupported: %q", raw)
+		}
+		return int32(body[0]), nil
+	}
+	if len(body) != 2 {
+		return 0, fmt.Errorf("invalid escape in character literal %q", raw)
+	}
+	switch body[1] {
+	case '\\':
+		return int32('\\'), nil
+	case '\'':
+		return int32('\''), nil
+	case 'n':
+		return int32('\n'), nil
+	case 't':
+		return int32('\t'), nil
+	case 'r':
+		return int32('\r'), nil
+	case '0':
+		return int32(0), nil
+	default:
+		return 0, fmt.Errorf("unsupported escape in character literal %q", raw)
+	}
+}
@@ -0,0 +1,120 @@
+package sema_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/sema"
+)
+
+func TestAnalyze_AnnotatesTypesAndSymbols(t *testing.T) {
+	src := `int f(const char *s, int n) {
+	char c = n;
+	{
+		int n = *s + c;
+		return n;
+	}
+}
+`
+	prog, _, err := sema.Analyze(parseOK(t, src), sema.Options{})
+	if err != nil {
+		t.Fatalf("analyze failed: %v", err)
+	}
+
+	f := prog.Scope.Lookup("f")
+	if f == nil || f.Kind != sema.SymbolFunction || f.Type != "i32" || strings.Join(f.Params, ",") != "const i8*,i32" {
+		t.Fatalf("unexpected symbol of f: %+v", f)
+	}
+	if f.Token.Line != 1 || f.Token.Column != 1 {
+		t.Fatalf("expected f defined at 1:1, got %d:%d", f.Token.Line, f.Token.Column)
+	}
+	if putchar := prog.Scope.Lookup("putchar"); putchar == nil || putchar.Token.IsValid() {
+		t.Fatalf("expected builtin putchar without declaration site, got %+v", putchar)
+	}
+
+	fn := prog.Functions[0]
+	if fn.Symbol != f {
+		t.Fatalf("definition is not linked to symbol of f")
+	}
+	s, n := fn.Scope.Lookup("s"), fn.Scope.Lookup("n")
+	if s.Kind != sema.SymbolParameter || s.Type != "const i8*" || n.Kind != sema.SymbolParameter {
+		t.Fatalf("unexpected parameters %+v and %+v", s, n)
+	}
+
+	// char c = n; converts parameter n implicitly
+	decl := fn.Body.Statements[0].(sema.DeclarationStatement)
+	if decl.Symbol.Kind != sema.SymbolVariable || decl.Symbol.Type != "i8" || decl.Symbol.Scope != fn.Scope {
+		t.Fatalf("unexpected symbol of c: %+v", decl.Symbol)
+	}
+	cast, ok := decl.Initializer.(sema.CastExpression)
+	if !ok || !cast.Implicit || cast.Type != "i8" {
+		t.Fatalf("expected implicit cast to i8, got %#v", decl.Initializer)
+	}
+	if id := cast.Operand.(sema.IdentifierExpression); id.Symbol != n || id.Type != "i32" {
+		t.Fatalf("expected n of parameter, got %+v", id)
+	}
+
+	// inner n shadows parameter, *s + c is promoted to int
+	block := fn.Body.Statements[1].(sema.BlockStatement)
+	if block.Scope.Parent != fn.Scope {
+		t.Fatalf("block scope is not nested in function scope")
+	}
+	inner := block.Statements[0].(sema.DeclarationStatement)
+	if inner.Symbol == n || inner.Symbol.Scope != block.Scope || block.Scope.Lookup("n") != inner.Symbol {
+		t.Fatalf("inner n is not declared in block scope")
+	}
+	sum := inner.Initializer.(sema.BinaryExpression)
+	if sum.Type != "i32" || sum.LHS.ExpressionType() != "i8" || sum.RHS.ExpressionType() != "i8" {
+		t.Fatalf("unexpected types of sum: %s = %s + %s", sum.Type, sum.LHS.ExpressionType(), sum.RHS.ExpressionType())
+	}
+	deref := sum.LHS.(sema.UnaryExpression)
+	if deref.Op != lexer.TokenStar || deref.Operand.ExpressionType() != "const i8*" {
+		t.Fatalf("unexpected dereference %+v", deref)
+	}
+	ret := block.Statements[1].(sema.ReturnStatement)
+	if id := ret.Expression.(sema.IdentifierExpression); id.Symbol != inner.Symbol {
+		t.Fatalf("return refers to %+v, expected inner n", id.Symbol)
+	}
+	if !s.Used || !n.Used || f.Used {
+		t.Fatalf("expected parameters used and f not, got %t, %t and %t", s.Used, n.Used, f.Used)
+	}
+}
+
+func TestAnalyze_ReturnsProgramWithErrors(t *testing.T) {
+	src := `int main() {
+	int x = y + 1;
+	x = (char)x;
+	return x;
+	x = z;
+}
+`
+	prog, _, err := sema.Analyze(parseOK(t, src), sema.Options{})
+	var errs *sema.Errors
+	if !errors.As(err, &errs) || len(errs.Diagnostics) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+	// code after return is checked, though it is not lowered
+	if !strings.Contains(errs.Diagnostics[1].Message, "undeclared identifier z") {
+		t.Fatalf("unexpected errors: %v", err)
+	}
+
+	stmts := prog.Functions[0].Body.Statements
+	sum := stmts[0].(sema.DeclarationStatement).Initializer.(sema.BinaryExpression)
+	if sum.Type != sema.ErrorType || sum.LHS.(sema.IdentifierExpression).Symbol != nil {
+		t.Fatalf("expected expression with error, got %+v", sum)
+	}
+	// expressions without error are still typed
+	assign := stmts[1].(sema.ExpressionStatement).Expression.(sema.AssignmentExpression)
+	promote, ok := assign.RHS.(sema.CastExpression)
+	if assign.Type != "i32" || !ok || !promote.Implicit || promote.Type != "i32" {
+		t.Fatalf("expected char converted back to int, got %+v", assign)
+	}
+	if cast := promote.Operand.(sema.CastExpression); cast.Implicit || cast.Type != "i8" {
+		t.Fatalf("unexpected explicit cast %+v", cast)
+	}
+	if len(stmts) != 4 {
+		t.Fatalf("expected all 4 statements, got %d", len(stmts))
+	}
+}
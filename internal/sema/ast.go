@@ -0,0 +1,281 @@
+package sema
+
+import "github.com/SQLek/wihajster/internal/lexer"
+
+// Typed AST is result of semantic analysis: every expression has its type and every
+// identifier its symbol. Nodes mirror these of parser, with implicit conversions
+// made explicit casts. Types are written as described in types.go.
+
+// Program is translation unit after semantic analysis.
+type Program struct {
+	// Scope is file scope, with all functions, builtin ones included.
+	Scope *Scope
+	// Functions are function definitions, in source order. Functions with
+	// invalid signature or defined again are not analyzed and missing.
+	Functions []FunctionDefinition
+}
+
+type SymbolKind int
+
+const (
+	SymbolFunction SymbolKind = iota
+	SymbolParameter
+	SymbolVariable
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case SymbolFunction:
+		return "function"
+	case SymbolParameter:
+		return "parameter"
+	case SymbolVariable:
+		return "variable"
+	default:
+		return "SymbolKind(?)"
+	}
+}
+
+// Symbol is function, parameter or variable identifiers refer to.
+type Symbol struct {
+	Kind SymbolKind
+	Name string
+	// Type is type of object, or return type of function.
+	Type string
+	// Params are types of parameters of function.
+	Params []string
+	// Token is declaration site: name of parameter or variable, start of function
+	// definition, or of prototype when there is none. Builtin functions have zero token.
+	Token lexer.Token
+	// Scope is scope symbol is declared in.
+	Scope *Scope
+	// Used is set when symbol is referred to.
+	Used bool
+}
+
+// Scope is file scope, parameters of function or block. Scopes of blocks
+// and for statements are children of scope they are in.
+type Scope struct {
+	Parent *Scope
+	// Span is of function or block, zero for file scope.
+	Span lexer.Span
+	// Symbols are in order of declaration.
+	Symbols []*Symbol
+
+	names map[string]*Symbol
+}
+
+func newScope(parent *Scope, span lexer.Span) *Scope {
+	return &Scope{Parent: parent, Span: span, names: map[string]*Symbol{}}
+}
+
+// Lookup finds symbol visible in scope by name.
+func (s *Scope) Lookup(name string) *Symbol {
+	for ; s != nil; s = s.Parent {
+		if sym, ok := s.names[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+func (s *Scope) declare(sym *Symbol) {
+	sym.Scope = s
+	s.Symbols = append(s.Symbols, sym)
+	s.names[sym.Name] = sym
+}
+
+type FunctionDefinition struct {
+	Token  lexer.Token
+	Span   lexer.Span
+	Symbol *Symbol
+	// Scope has parameters, in order, and declarations of outermost block of body.
+	Scope *Scope
+	Body  BlockStatement
+}
+
+type Statement interface {
+	statementNode()
+}
+
+type BlockStatement struct {
+	Token      lexer.Token
+	Span       lexer.Span
+	Scope      *Scope
+	Statements []Statement
+}
+
+func (BlockStatement) statementNode() {}
+
+type DeclarationStatement struct {
+	Token  lexer.Token
+	Span   lexer.Span
+	Symbol *Symbol
+	// Initializer is converted to type of variable, nil when there is none.
+	Initializer Expression
+}
+
+func (DeclarationStatement) statementNode() {}
+
+type ReturnStatement struct {
+	Token lexer.Token
+	Span  lexer.Span
+	// Expression is converted to return type, nil when there is none.
+	Expression Expression
+}
+
+func (ReturnStatement) statementNode() {}
+
+type ExpressionStatement struct {
+	Token lexer.Token
+	Span  lexer.Span
+	// Expression is nil for empty statement.
+	Expression Expression
+}
+
+func (ExpressionStatement) statementNode() {}
+
+type IfStatement struct {
+	Token lexer.Token
+	Span  lexer.Span
+	Cond  Expression
+	Then  Statement
+	Else  Statement
+}
+
+func (IfStatement) statementNode() {}
+
+type WhileStatement struct {
+	Token lexer.Token
+	Span  lexer.Span
+	Cond  Expression
+	Body  Statement
+}
+
+func (WhileStatement) statementNode() {}
+
+type ForStatement struct {
+	Token lexer.Token
+	Span  lexer.Span
+	// Scope has variable declared by Init.
+	Scope *Scope
+	Init  Statement
+	Cond  Expression
+	Post  Expression
+	Body  Statement
+}
+
+func (ForStatement) statementNode() {}
+
+// Expression is typed expression. Expression with error has type ErrorType.
+type Expression interface {
+	// ExpressionType is type of value of expression, without top level qualifiers.
+	ExpressionType() string
+}
+
+type IdentifierExpression struct {
+	Token lexer.Token
+	Span  lexer.Span
+	Type  string
+	// Symbol is nil when identifier is not declared.
+	Symbol *Symbol
+}
+
+func (e IdentifierExpression) ExpressionType() string { return e.Type }
+
+// ConstantExpression is integer or character literal.
+type ConstantExpression struct {
+	Token lexer.Token
+	Span  lexer.Span
+	Type  string
+	Value int32
+}
+
+func (e ConstantExpression) ExpressionType() string { return e.Type }
+
+type UnaryExpression struct {
+	Token   lexer.Token
+	Span    lexer.Span
+	Type    string
+	Op      lexer.TokenType
+	Operand Expression
+}
+
+func (e UnaryExpression) ExpressionType() string { return e.Type }
+
+type BinaryExpression struct {
+	Token lexer.Token
+	Span  lexer.Span
+	Type  string
+	Op    lexer.TokenType
+	LHS   Expression
+	RHS   Expression
+}
+
+func (e BinaryExpression) ExpressionType() string { return e.Type }
+
+type AssignmentExpression struct {
+	Token lexer.Token
+	Span  lexer.Span
+	Type  string
+	// LHS is identifier or dereference.
+	LHS Expression
+	// RHS is converted to type of LHS.
+	RHS Expression
+}
+
+func (e AssignmentExpression) ExpressionType() string { return e.Type }
+
+type CastExpression struct {
+	Token   lexer.Token
+	Span    lexer.Span
+	Type    string
+	Operand Expression
+	// Implicit is set for conversions of assignment, argument and return.
+	Implicit bool
+}
+
+func (e CastExpression) ExpressionType() string { return e.Type }
+
+type CallExpression struct {
+	Token lexer.Token
+	Span  lexer.Span
+	Type  string
+	// Function is nil when called function is not declared.
+	Function *Symbol
+	// Args are converted to types of parameters.
+	Args []Expression
+}
+
+func (e CallExpression) ExpressionType() string { return e.Type }
+
+// errorExpression is expression with error, in place of the one analysis could not type.
+type errorExpression struct {
+	Span lexer.Span
+}
+
+func (errorExpression) ExpressionType() string { return ErrorType }
+
+// ExpressionSpan returns span of typed expression, as parser.ExpressionSpan does.
+func ExpressionSpan(expr Expression) lexer.Span {
+	switch e := expr.(type) {
+	case IdentifierExpression:
+		return e.Span
+	case ConstantExpression:
+		return e.Span
+	case UnaryExpression:
+		return e.Span
+	case BinaryExpression:
+		return e.Span
+	case AssignmentExpression:
+		return e.Span
+	case CastExpression:
+		return e.Span
+	case CallExpression:
+		return e.Span
+	case errorExpression:
+		return e.Span
+	default:
+		return lexer.Span{}
+	}
+}
@@ -1,25 +1,102 @@
 package sema
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/SQLek/wihajster/internal/diag/code"
 	"github.com/SQLek/wihajster/internal/lexer"
 )
 
+// ErrorType is type of expression with error. Expressions using it are not
+// checked, so one mistake is reported once.
+const ErrorType = "<error>"
+
 type Error struct {
+	Code    code.Code
+	File    string
 	Line    int
 	Column  int
+	Span    lexer.Span
 	Message string
+	// Notes explain macro expansion of token error is at.
+	Notes []lexer.Note
+
+	// source is span of token in source, errors are ordered by it
+	source lexer.Span
 }
 
 func (e *Error) Error() string {
-	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+	msg := fmt.Sprintf("%s: %s", lexer.Position(e.File, e.Line, e.Column), e.Message)
+	for _, note := range e.Notes {
+		msg += "\n" + note.String()
+	}
+	return msg
+}
+
+func newError(c code.Code, tok lexer.Token, format string, args ...any) *Error {
+	return &Error{
+		Code:    c,
+		File:    tok.File,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Span:    tok.Span,
+		Message: fmt.Sprintf(format, args...),
+		Notes:   lexer.ExpansionNotes(tok),
+		source:  lexer.SourceSpan(tok),
+	}
+}
+
+func unsupportedError(c code.Code, tok lexer.Token, feature string) *Error {
+	return newError(c, tok, "unsupported in current subset: %s", feature)
+}
+
+// Errors are errors of translation unit, in source order.
+type Errors struct {
+	Diagnostics []*Error
+	// Limit is error limit analysis stopped at, 0 when all errors are reported.
+	Limit int
+}
+
+func (e *Errors) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics)+1)
+	for _, d := range e.Diagnostics {
+		msgs = append(msgs, d.Error())
+	}
+	if e.Limit > 0 {
+		msgs = append(msgs, fmt.Sprintf("too many errors emitted, stopping now [-error-limit=%d]", e.Limit))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// report collects diagnostics of translation unit.
+type report struct {
+	errors   []*Error
+	warnings []Warning
+	enabled  map[string]bool
+	limit    int
+}
+
+// errorf records err, analysis continues with next expression or statement.
+func (r *report) errorf(err error) {
+	var semaErr *Error
+	if !errors.As(err, &semaErr) {
+		semaErr = &Error{Message: err.Error()}
+	}
+	r.errors = append(r.errors, semaErr)
 }
 
-func newError(tok lexer.Token, format string, args ...any) *Error {
-	return &Error{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, args...)}
+// stopped reports if there are more errors than limit allows.
+func (r *report) stopped() bool {
+	return r.limit > 0 && len(r.errors) > r.limit
 }
 
-func unsupportedError(tok lexer.Token, feature string) *Error {
-	return newError(tok, "unsupported in current subset: %s", feature)
+// sortErrors orders errors by their position in source, as warnings are.
+func sortErrors(errs []*Error) {
+	slices.SortStableFunc(errs, func(a, b *Error) int {
+		return cmp.Or(strings.Compare(a.source.File, b.source.File), cmp.Compare(a.source.Start, b.source.Start))
+	})
 }
@@ -1,421 +1,195 @@
 package sema
 
 import (
-	"fmt"
 	"strconv"
-	"strings"
 
 	"github.com/SQLek/wihajster/internal/lexer"
 	"github.com/SQLek/wihajster/internal/parser"
 	"github.com/SQLek/wihajster/internal/tac"
 )
 
-type functionSignature struct {
-	ReturnType string
-	Params     []string
-}
-
-type variableSymbol struct {
-	Type string
-	Slot string
-}
-
-type typedValue struct {
-	Value tac.Operand
-	Type  string
-}
-
 type lowerer struct {
 	fn          *tac.Function
 	nextLabelID int
-
-	returnType string
-	functions  map[string]functionSignature
-	scopes     []map[string]variableSymbol
+	// slots are stack slots of parameters and variables
+	slots map[*Symbol]string
 }
 
+// Lower lowers translation unit to TAC, with default warnings not reported.
 func Lower(tu *parser.TranslationUnit) (tac.Module, error) {
-	if len(tu.Declarations) > 0 {
-		return tac.Module{}, unsupportedError(tu.Declarations[0].Token, "global declarations")
-	}
-
-	prototypes := map[string]functionSignature{}
-	definitions := map[string]functionSignature{}
-
-	for _, proto := range tu.Prototypes {
-		sig, err := signatureForFunction(proto.Token, proto.ReturnType, proto.Parameters)
-		if err != nil {
-			return tac.Module{}, err
-		}
-		if prev, exists := prototypes[proto.Name]; exists {
-			if !sameSignature(prev, sig) {
-				return tac.Module{}, newError(proto.Token, "conflicting prototype for function %s", proto.Name)
-			}
-			continue
-		}
-		if def, exists := definitions[proto.Name]; exists && !sameSignature(def, sig) {
-			return tac.Module{}, newError(proto.Token, "conflicting prototype for function %s", proto.Name)
-		}
-		prototypes[proto.Name] = sig
-	}
-
-	for _, pfn := range tu.Functions {
-		sig, err := signatureForFunction(pfn.Token, pfn.ReturnType, pfn.Parameters)
-		if err != nil {
-			return tac.Module{}, err
-		}
-		if prev, exists := definitions[pfn.Name]; exists {
-			if sameSignature(prev, sig) {
-				return tac.Module{}, newError(pfn.Token, "function %s defined multiple times", pfn.Name)
-			}
-			return tac.Module{}, newError(pfn.Token, "conflicting definition for function %s", pfn.Name)
-		}
-		if proto, exists := prototypes[pfn.Name]; exists && !sameSignature(proto, sig) {
-			return tac.Module{}, newError(pfn.Token, "function definition does not match prototype for %s", pfn.Name)
-		}
-		definitions[pfn.Name] = sig
-	}
-
-	functions := map[string]functionSignature{}
-	for name, sig := range prototypes {
-		functions[name] = sig
-	}
-	for name, sig := range definitions {
-		functions[name] = sig
-	}
-
-	mod := tac.Module{}
-	for _, pfn := range tu.Functions {
-		fn, err := lowerFunction(pfn, functions)
-		if err != nil {
-			return tac.Module{}, err
-		}
-		mod.Functions = append(mod.Functions, fn)
-	}
-	return mod, nil
+	mod, _, err := LowerOptions(tu, Options{})
+	return mod, err
 }
 
-func lowerFunction(pfn parser.FunctionDefinition, functions map[string]functionSignature) (tac.Function, error) {
-	retType := lowerType(pfn.ReturnType)
-	if retType == "" {
-		return tac.Function{}, unsupportedError(pfn.Token, "function return type")
-	}
-
-	fn := tac.Function{Name: "@" + pfn.Name, ReturnType: retType}
-	l := &lowerer{fn: &fn, returnType: retType, functions: functions}
-	l.pushScope()
-	defer l.popScope()
-
-	for _, param := range pfn.Parameters {
-		paramType, err := lowerObjectType(param.Token, param.Type)
-		if err != nil {
-			return tac.Function{}, err
-		}
-		if err := l.declareLocal(param.Token, param.Name, paramType); err != nil {
-			return tac.Function{}, err
-		}
-		fn.Parameters = append(fn.Parameters, tac.Parameter{Name: "%" + param.Name, Type: paramType})
-
-		slot := fn.AddInstruction(tac.OpcodeAlloca, tac.Immediate(paramType))
-		l.setLocalSlot(param.Name, slot.Text)
-		fn.AddVoidInstruction(tac.OpcodeStore, slot, tac.Param("%"+param.Name))
-	}
-
-	reachable, err := l.lowerBlockStatements(pfn.Body.Statements)
+// LowerOptions analyzes translation unit and lowers it to TAC, see Analyze for
+// warnings and errors. Warnings do not change TAC.
+func LowerOptions(tu *parser.TranslationUnit, opts Options) (tac.Module, []Warning, error) {
+	prog, warnings, err := Analyze(tu, opts)
 	if err != nil {
-		return tac.Function{}, err
-	}
-	if reachable {
-		if pfn.ReturnType.Specifier == parser.TypeSpecifierVoid {
-			fn.AddRet(tac.Operand{})
-		} else {
-			return tac.Function{}, newError(pfn.Token, "function %s may reach end without return", pfn.Name)
-		}
-	}
-
-	return fn, nil
-}
-
-func signatureForFunction(tok lexer.Token, ret parser.TypeName, params []parser.FunctionParameter) (functionSignature, error) {
-	retType := lowerType(ret)
-	if retType == "" {
-		return functionSignature{}, unsupportedError(tok, "function return type")
+		return tac.Module{}, warnings, err
 	}
-
-	out := functionSignature{ReturnType: retType, Params: make([]string, 0, len(params))}
-	seen := map[string]struct{}{}
-	for _, param := range params {
-		paramType, err := lowerObjectType(param.Token, param.Type)
-		if err != nil {
-			return functionSignature{}, err
-		}
-		if _, exists := seen[param.Name]; exists {
-			return functionSignature{}, newError(param.Token, "parameter %s redeclared", param.Name)
-		}
-		seen[param.Name] = struct{}{}
-		out.Params = append(out.Params, paramType)
-	}
-	return out, nil
+	return LowerProgram(prog), warnings, nil
 }
 
-func sameSignature(a, b functionSignature) bool {
-	if a.ReturnType != b.ReturnType || len(a.Params) != len(b.Params) {
-		return false
-	}
-	for i := range a.Params {
-		if a.Params[i] != b.Params[i] {
-			return false
-		}
-	}
-	return true
-}
-
-func lowerType(t parser.TypeName) string {
-	base := ""
-	switch t.Specifier {
-	case parser.TypeSpecifierInt:
-		base = "i32"
-	case parser.TypeSpecifierChar:
-		base = "i32"
-	case parser.TypeSpecifierVoid:
-		base = "void"
-	default:
-		return ""
-	}
-	for i := 0; i < t.PointerDepth; i++ {
-		base += "*"
-	}
-	return base
-}
-
-func lowerObjectType(tok lexer.Token, t parser.TypeName) (string, error) {
-	typ := lowerType(t)
-	if typ == "" {
-		return "", unsupportedError(tok, "declaration type")
-	}
-	if typ == "void" {
-		return "", unsupportedError(tok, "void objects")
+// LowerProgram lowers program to TAC. Program must be analyzed without errors,
+// it is not checked again.
+func LowerProgram(prog *Program) tac.Module {
+	mod := tac.Module{}
+	for _, fn := range prog.Functions {
+		l := &lowerer{slots: map[*Symbol]string{}}
+		mod.Functions = append(mod.Functions, l.lowerFunction(fn))
 	}
-	return typ, nil
+	return mod
 }
 
-func (l *lowerer) pushScope() {
-	l.scopes = append(l.scopes, map[string]variableSymbol{})
-}
+func (l *lowerer) lowerFunction(def FunctionDefinition) tac.Function {
+	fn := tac.Function{Name: "@" + def.Symbol.Name, ReturnType: tacType(def.Symbol.Type), Pos: tac.SourcePos{File: def.Token.File, Line: def.Token.Line, Column: def.Token.Column}}
+	l.fn = &fn
+	l.at(def.Token)
 
-func (l *lowerer) popScope() {
-	l.scopes = l.scopes[:len(l.scopes)-1]
-}
-
-func (l *lowerer) currentScope() map[string]variableSymbol {
-	return l.scopes[len(l.scopes)-1]
-}
-
-func (l *lowerer) setLocalSlot(name, slot string) {
-	scope := l.currentScope()
-	sym := scope[name]
-	sym.Slot = slot
-	scope[name] = sym
-}
-
-func (l *lowerer) declareLocal(tok lexer.Token, name, typ string) error {
-	scope := l.currentScope()
-	if _, exists := scope[name]; exists {
-		return newError(tok, "identifier %s redeclared in this scope", name)
+	for _, param := range def.Scope.Symbols {
+		if param.Kind != SymbolParameter {
+			continue
+		}
+		fn.Parameters = append(fn.Parameters, tac.Parameter{Name: "%" + param.Name, Type: tacType(param.Type)})
+		slot := fn.AddInstruction(tac.OpcodeAlloca, tac.Immediate(tacType(param.Type)))
+		l.slots[param] = slot.Text
+		l.storeAddress(slot, tac.Param("%"+param.Name), param.Type)
 	}
-	scope[name] = variableSymbol{Type: typ}
-	return nil
-}
 
-func (l *lowerer) resolveVariable(name string) (variableSymbol, bool) {
-	for i := len(l.scopes) - 1; i >= 0; i-- {
-		if sym, ok := l.scopes[i][name]; ok {
-			return sym, true
-		}
+	// reaching end of non-void function is error of analysis
+	if l.lowerBlockStatements(def.Body.Statements) {
+		fn.AddRet(tac.Operand{})
 	}
-	return variableSymbol{}, false
+	return fn
 }
 
-func (l *lowerer) lowerBlockStatements(stmts []parser.Statement) (bool, error) {
-	reachable := true
+// lowerBlockStatements lowers statements until one not reaching its end, code after it
+// is not lowered.
+func (l *lowerer) lowerBlockStatements(stmts []Statement) bool {
 	for _, nested := range stmts {
-		if !reachable {
-			break
-		}
-		nextReachable, err := l.lowerStatement(nested)
-		if err != nil {
-			return false, err
+		if !l.lowerStatement(nested) {
+			return false
 		}
-		reachable = nextReachable
 	}
-	return reachable, nil
+	return true
 }
 
-func (l *lowerer) lowerStatement(stmt parser.Statement) (bool, error) {
+// lowerStatement lowers stmt and returns if its end is reachable.
+func (l *lowerer) lowerStatement(stmt Statement) bool {
 	switch s := stmt.(type) {
-	case parser.BlockStatement:
-		l.pushScope()
-		reachable, err := l.lowerBlockStatements(s.Statements)
-		l.popScope()
-		return reachable, err
-	case parser.DeclarationStatement:
-		return true, l.lowerLocalDeclaration(s.Declaration)
-	case parser.ExpressionStatement:
+	case BlockStatement:
+		l.at(s.Token)
+		return l.lowerBlockStatements(s.Statements)
+	case DeclarationStatement:
+		l.at(s.Token)
+		slot := l.fn.AddInstruction(tac.OpcodeAlloca, tac.Immediate(tacType(s.Symbol.Type)))
+		l.slots[s.Symbol] = slot.Text
+		if s.Initializer != nil {
+			l.storeAddress(slot, l.lowerExpr(s.Initializer), s.Symbol.Type)
+		}
+		return true
+	case ExpressionStatement:
+		l.at(s.Token)
+		if s.Expression != nil {
+			l.lowerExpr(s.Expression)
+		}
+		return true
+	case ReturnStatement:
+		l.at(s.Token)
 		if s.Expression == nil {
-			return true, nil
-		}
-		_, err := l.lowerExpr(s.Expression)
-		return true, err
-	case parser.ReturnStatement:
-		if s.Expression == nil {
-			if l.returnType != "void" {
-				return false, newError(s.Token, "non-void function must return a value")
-			}
 			l.fn.AddRet(tac.Operand{})
-			return false, nil
-		}
-
-		val, err := l.lowerExpr(s.Expression)
-		if err != nil {
-			return false, err
-		}
-		if l.returnType == "void" {
-			return false, newError(s.Token, "void function must not return a value")
-		}
-		if val.Type != l.returnType {
-			return false, newError(s.Token, "return type mismatch: expected %s, got %s", l.returnType, val.Type)
+			return false
 		}
-		l.fn.AddRet(val.Value)
-		return false, nil
-	case parser.IfStatement:
+		l.fn.AddRet(l.lowerExpr(s.Expression))
+		return false
+	case IfStatement:
 		return l.lowerIfStatement(s)
-	case parser.WhileStatement:
+	case WhileStatement:
 		return l.lowerWhileStatement(s)
-	case parser.ForStatement:
+	case ForStatement:
 		return l.lowerForStatement(s)
 	default:
-		return false, unsupportedError(lexer.Token{}, "statement kind")
+		panic("sema: unknown statement")
 	}
 }
 
-func (l *lowerer) lowerLocalDeclaration(decl parser.Declaration) error {
-	typ, err := lowerObjectType(decl.Token, decl.Type)
-	if err != nil {
-		return err
-	}
-	if err := l.declareLocal(decl.Token, decl.Name, typ); err != nil {
-		return err
-	}
-	slot := l.fn.AddInstruction(tac.OpcodeAlloca, tac.Immediate(typ))
-	l.setLocalSlot(decl.Name, slot.Text)
-	if decl.Initializer == nil {
-		return nil
-	}
-	value, err := l.lowerExpr(decl.Initializer)
-	if err != nil {
-		return err
-	}
-	if value.Type != typ {
-		return newError(decl.Token, "initializer type mismatch for %s: expected %s, got %s", decl.Name, typ, value.Type)
-	}
-	l.fn.AddVoidInstruction(tac.OpcodeStore, slot, value.Value)
-	return nil
+// at attributes instructions emitted from now on to source position of tok.
+func (l *lowerer) at(tok lexer.Token) {
+	l.fn.SetSourcePos(tac.SourcePos{File: tok.File, Line: tok.Line, Column: tok.Column})
 }
 
-func (l *lowerer) lowerIfStatement(s parser.IfStatement) (bool, error) {
-	cond, err := l.lowerExpr(s.Cond)
-	if err != nil {
-		return false, err
-	}
-	if cond.Type == "void" {
-		return false, newError(s.Token, "if condition cannot have void type")
-	}
+func (l *lowerer) lowerIfStatement(s IfStatement) bool {
+	l.at(s.Token)
+	cond := l.lowerExpr(s.Cond)
 
 	thenLabel := l.newLabel()
 	endLabel := l.newLabel()
 	if s.Else == nil {
-		l.fn.AddBr(cond.Value, thenLabel, endLabel)
+		l.fn.AddBr(cond, thenLabel, endLabel)
 		l.fn.AddLabel(thenLabel)
-		thenReachable, err := l.lowerStatement(s.Then)
-		if err != nil {
-			return false, err
-		}
+		thenReachable := l.lowerStatement(s.Then)
+		l.at(s.Token)
 		if thenReachable {
 			l.fn.AddJmp(endLabel)
 		}
 		l.fn.AddLabel(endLabel)
-		return true, nil
+		return true
 	}
 
 	elseLabel := l.newLabel()
-	l.fn.AddBr(cond.Value, thenLabel, elseLabel)
+	l.fn.AddBr(cond, thenLabel, elseLabel)
 
 	l.fn.AddLabel(thenLabel)
-	thenReachable, err := l.lowerStatement(s.Then)
-	if err != nil {
-		return false, err
-	}
+	thenReachable := l.lowerStatement(s.Then)
+	l.at(s.Token)
 	if thenReachable {
 		l.fn.AddJmp(endLabel)
 	}
 
 	l.fn.AddLabel(elseLabel)
-	elseReachable, err := l.lowerStatement(s.Else)
-	if err != nil {
-		return false, err
-	}
+	elseReachable := l.lowerStatement(s.Else)
+	l.at(s.Token)
 	if elseReachable {
 		l.fn.AddJmp(endLabel)
 	}
 
 	if thenReachable || elseReachable {
 		l.fn.AddLabel(endLabel)
-		return true, nil
+		return true
 	}
-	return false, nil
+	return false
 }
 
-func (l *lowerer) lowerWhileStatement(s parser.WhileStatement) (bool, error) {
+func (l *lowerer) lowerWhileStatement(s WhileStatement) bool {
+	l.at(s.Token)
 	condLabel := l.newLabel()
 	bodyLabel := l.newLabel()
 	endLabel := l.newLabel()
 
 	l.fn.AddJmp(condLabel)
 	l.fn.AddLabel(condLabel)
-	cond, err := l.lowerExpr(s.Cond)
-	if err != nil {
-		return false, err
-	}
-	if cond.Type == "void" {
-		return false, newError(s.Token, "while condition cannot have void type")
-	}
-	l.fn.AddBr(cond.Value, bodyLabel, endLabel)
+	cond := l.lowerExpr(s.Cond)
+	l.fn.AddBr(cond, bodyLabel, endLabel)
 
 	l.fn.AddLabel(bodyLabel)
-	bodyReachable, err := l.lowerStatement(s.Body)
-	if err != nil {
-		return false, err
-	}
+	bodyReachable := l.lowerStatement(s.Body)
+	l.at(s.Token)
 	if bodyReachable {
 		l.fn.AddJmp(condLabel)
 	}
 
 	l.fn.AddLabel(endLabel)
-	return true, nil
+	return true
 }
 
-func (l *lowerer) lowerForStatement(s parser.ForStatement) (bool, error) {
-	l.pushScope()
-	defer l.popScope()
-
+func (l *lowerer) lowerForStatement(s ForStatement) bool {
+	l.at(s.Token)
 	if s.Init != nil {
-		reachable, err := l.lowerStatement(s.Init)
-		if err != nil {
-			return false, err
-		}
-		if !reachable {
-			return false, nil
+		if !l.lowerStatement(s.Init) {
+			return false
 		}
+		l.at(s.Token)
 	}
 
 	condLabel := l.newLabel()
@@ -426,273 +200,197 @@ func (l *lowerer) lowerForStatement(s parser.ForStatement) (bool, error) {
 	l.fn.AddJmp(condLabel)
 	l.fn.AddLabel(condLabel)
 	if s.Cond != nil {
-		cond, err := l.lowerExpr(s.Cond)
-		if err != nil {
-			return false, err
-		}
-		if cond.Type == "void" {
-			return false, newError(s.Token, "for condition cannot have void type")
-		}
-		l.fn.AddBr(cond.Value, bodyLabel, endLabel)
+		cond := l.lowerExpr(s.Cond)
+		l.fn.AddBr(cond, bodyLabel, endLabel)
 	} else {
 		l.fn.AddJmp(bodyLabel)
 	}
 
 	l.fn.AddLabel(bodyLabel)
-	bodyReachable, err := l.lowerStatement(s.Body)
-	if err != nil {
-		return false, err
-	}
+	bodyReachable := l.lowerStatement(s.Body)
+	l.at(s.Token)
 	if bodyReachable {
 		l.fn.AddJmp(postLabel)
 	}
 
 	l.fn.AddLabel(postLabel)
 	if bodyReachable && s.Post != nil {
-		if _, err := l.lowerExpr(s.Post); err != nil {
-			return false, err
-		}
+		l.lowerExpr(s.Post)
 	}
 	if bodyReachable {
 		l.fn.AddJmp(condLabel)
 	}
 
 	l.fn.AddLabel(endLabel)
-	return true, nil
+	return true
 }
 
-func (l *lowerer) lowerExpr(expr parser.Expression) (typedValue, error) {
+// lowerExpr lowers expr, returning its value. Expression of void type has no value.
+func (l *lowerer) lowerExpr(expr Expression) tac.Operand {
 	switch e := expr.(type) {
-	case parser.IntegerLiteralExpression:
-		if _, err := strconv.ParseInt(e.Raw, 10, 32); err != nil {
-			return typedValue{}, newError(e.Token, "invalid integer literal %q", e.Raw)
-		}
-		return typedValue{Value: l.fn.AddInstruction(tac.OpcodeConstI32, tac.Immediate(e.Raw)), Type: "i32"}, nil
-	case parser.CharacterLiteralExpression:
-		value, err := decodeCharacterLiteral(e.Raw)
-		if err != nil {
-			return typedValue{}, newError(e.Token, "%s", err.Error())
-		}
-		return typedValue{Value: l.fn.AddInstruction(tac.OpcodeConstI32, tac.Immediate(strconv.FormatInt(int64(value), 10))), Type: "i32"}, nil
-	case parser.IdentifierExpression:
-		sym, ok := l.resolveVariable(e.Name)
-		if !ok {
-			return typedValue{}, newError(e.Token, "use of undeclared identifier %s", e.Name)
-		}
-		return typedValue{Value: l.fn.AddInstruction(tac.OpcodeLoad, tac.StackSlotPointer(sym.Slot)), Type: sym.Type}, nil
-	case parser.UnaryExpression:
+	case ConstantExpression:
+		return l.fn.AddInstruction(tac.OpcodeConstI32, tac.Immediate(strconv.FormatInt(int64(e.Value), 10)))
+	case IdentifierExpression:
+		return l.loadAddress(tac.StackSlotPointer(l.slots[e.Symbol]), e.Symbol.Type)
+	case UnaryExpression:
 		switch e.Op {
 		case lexer.TokenStar:
-			ptr, err := l.lowerExpr(e.Operand)
-			if err != nil {
-				return typedValue{}, err
-			}
-			elemType, ok := pointeeType(ptr.Type)
-			if !ok {
-				return typedValue{}, newError(e.Token, "cannot dereference non-pointer type %s", ptr.Type)
-			}
-			if elemType == "void" {
-				return typedValue{}, newError(e.Token, "cannot dereference void* without cast")
-			}
-			return typedValue{Value: l.loadAddress(ptr.Value), Type: elemType}, nil
+			elemType, _ := pointeeType(e.Operand.ExpressionType())
+			return l.loadAddress(l.lowerExpr(e.Operand), elemType)
 		case lexer.TokenAmp:
-			addr, elemType, err := l.lowerAddress(e.Operand)
-			if err != nil {
-				return typedValue{}, err
-			}
-			return typedValue{Value: addr, Type: pointerTo(elemType)}, nil
-		}
-
-		operand, err := l.lowerExpr(e.Operand)
-		if err != nil {
-			return typedValue{}, err
-		}
-		if operand.Type == "void" {
-			return typedValue{}, newError(e.Token, "unary operator requires non-void operand")
-		}
-		if isPointerType(operand.Type) {
-			return typedValue{}, newError(e.Token, "unary operator %v does not accept pointer operand", e.Op)
+			addr, _ := l.lowerAddress(e.Operand)
+			return addr
 		}
+		operand := l.lowerExpr(e.Operand)
 		switch e.Op {
-		case lexer.TokenPlus:
-			return operand, nil
 		case lexer.TokenMinus:
-			return typedValue{Value: l.fn.AddInstruction(tac.OpcodeNeg, operand.Value), Type: operand.Type}, nil
+			return l.fn.AddInstruction(tac.OpcodeNeg, operand)
 		case lexer.TokenBang:
-			return typedValue{Value: l.fn.AddInstruction(tac.OpcodeLogicNot, operand.Value), Type: "i32"}, nil
+			return l.fn.AddInstruction(tac.OpcodeLogicNot, operand)
 		case lexer.TokenTilde:
-			return typedValue{Value: l.fn.AddInstruction(tac.OpcodeNot, operand.Value), Type: operand.Type}, nil
+			return l.fn.AddInstruction(tac.OpcodeNot, operand)
 		default:
-			return typedValue{}, unsupportedError(e.Token, "unary operator")
-		}
-	case parser.BinaryExpression:
-		lhs, err := l.lowerExpr(e.LHS)
-		if err != nil {
-			return typedValue{}, err
-		}
-		rhs, err := l.lowerExpr(e.RHS)
-		if err != nil {
-			return typedValue{}, err
-		}
-		if lhs.Type == "void" || rhs.Type == "void" {
-			return typedValue{}, newError(e.Token, "binary operator requires non-void operands")
+			return operand
 		}
+	case BinaryExpression:
+		lhs := l.lowerExpr(e.LHS)
+		rhs := l.lowerExpr(e.RHS)
 		opcode := binaryOpcode(e.Op)
-		if opcode == tac.OpcodeInvalid {
-			return typedValue{}, unsupportedError(e.Token, "binary operator")
-		}
 		if e.Op == lexer.TokenAndAnd || e.Op == lexer.TokenOrOr {
-			lhsVal := l.fn.AddInstruction(tac.OpcodeNe, lhs.Value, tac.Immediate("0"))
-			rhsVal := l.fn.AddInstruction(tac.OpcodeNe, rhs.Value, tac.Immediate("0"))
-			return typedValue{Value: l.fn.AddInstruction(opcode, lhsVal, rhsVal), Type: "i32"}, nil
-		}
-
-		resultType := lhs.Type
-		switch e.Op {
-		case lexer.TokenEq, lexer.TokenNe, lexer.TokenLt, lexer.TokenLe, lexer.TokenGt, lexer.TokenGe:
-			resultType = "i32"
-		}
-		return typedValue{Value: l.fn.AddInstruction(opcode, lhs.Value, rhs.Value), Type: resultType}, nil
-	case parser.AssignmentExpression:
-		addr, lhsType, err := l.lowerAddress(e.LHS)
-		if err != nil {
-			return typedValue{}, err
-		}
-		rhs, err := l.lowerExpr(e.RHS)
-		if err != nil {
-			return typedValue{}, err
-		}
-		if rhs.Type != lhsType {
-			return typedValue{}, newError(e.Token, "assignment type mismatch: expected %s, got %s", lhsType, rhs.Type)
-		}
-		l.storeAddress(addr, rhs.Value)
-		return rhs, nil
-	case parser.CallExpression:
-		callee, ok := e.Callee.(parser.IdentifierExpression)
-		if !ok {
-			return typedValue{}, unsupportedError(e.Token, "function call target")
-		}
-		sig, exists := l.functions[callee.Name]
-		if !exists {
-			return typedValue{}, newError(callee.Token, "call to undeclared function %s", callee.Name)
-		}
-		if len(e.Args) != len(sig.Params) {
-			return typedValue{}, newError(e.Token, "function %s expects %d arguments, got %d", callee.Name, len(sig.Params), len(e.Args))
-		}
+			lhsVal := l.fn.AddInstruction(tac.OpcodeNe, lhs, tac.Immediate("0"))
+			rhsVal := l.fn.AddInstruction(tac.OpcodeNe, rhs, tac.Immediate("0"))
+			return l.fn.AddInstruction(opcode, lhsVal, rhsVal)
+		}
+		if isPointerType(e.LHS.ExpressionType()) || isPointerType(e.RHS.ExpressionType()) {
+			return l.lowerPointerBinary(e, lhs, rhs)
+		}
+		// char operands are promoted, they already live in 32-bit values
+		return l.fn.AddInstruction(opcode, lhs, rhs)
+	case AssignmentExpression:
+		addr, typ := l.lowerAddress(e.LHS)
+		value := l.lowerExpr(e.RHS)
+		l.storeAddress(addr, value, typ)
+		return value
+	case CallExpression:
 		args := make([]tac.Operand, 0, len(e.Args))
-		for i, argExpr := range e.Args {
-			arg, err := l.lowerExpr(argExpr)
-			if err != nil {
-				return typedValue{}, err
-			}
-			expected := sig.Params[i]
-			if arg.Type != expected {
-				return typedValue{}, newError(e.Token, "argument %d to %s has type %s, expected %s", i+1, callee.Name, arg.Type, expected)
-			}
-			args = append(args, arg.Value)
+		for _, arg := range e.Args {
+			args = append(args, l.lowerExpr(arg))
 		}
-		calleeName := "@" + callee.Name
-		if sig.ReturnType == "void" {
-			l.fn.AddCallVoid(tac.FunctionSymbol(calleeName), args...)
-			return typedValue{Type: "void"}, nil
+		callee := tac.FunctionSymbol("@" + e.Function.Name)
+		if e.Type == "void" {
+			l.fn.AddCallVoid(callee, args...)
+			return tac.Operand{}
 		}
-		return typedValue{Value: l.fn.AddCall(tac.FunctionSymbol(calleeName), args...), Type: sig.ReturnType}, nil
+		return l.fn.AddCall(callee, args...)
+	case CastExpression:
+		return l.lowerCast(e)
 	default:
-		return typedValue{}, unsupportedError(lexer.Token{}, "expression kind")
+		panic("sema: unknown expression")
 	}
 }
 
-func (l *lowerer) lowerAddress(expr parser.Expression) (tac.Operand, string, error) {
+// lowerAddress lowers expr designating object, returning its address and qualified type.
+func (l *lowerer) lowerAddress(expr Expression) (tac.Operand, string) {
 	switch e := expr.(type) {
-	case parser.IdentifierExpression:
-		sym, ok := l.resolveVariable(e.Name)
-		if !ok {
-			return tac.Operand{}, "", newError(e.Token, "use of undeclared identifier %s", e.Name)
-		}
-		return tac.StackSlotPointer(sym.Slot), sym.Type, nil
-	case parser.UnaryExpression:
-		if e.Op != lexer.TokenStar {
-			break
-		}
-		ptr, err := l.lowerExpr(e.Operand)
-		if err != nil {
-			return tac.Operand{}, "", err
+	case IdentifierExpression:
+		return tac.StackSlotPointer(l.slots[e.Symbol]), e.Symbol.Type
+	case UnaryExpression:
+		elemType, _ := pointeeType(e.Operand.ExpressionType())
+		return l.lowerExpr(e.Operand), elemType
+	default:
+		panic("sema: expression is not object")
+	}
+}
+
+func (l *lowerer) lowerCast(e CastExpression) tac.Operand {
+	operand := l.lowerExpr(e.Operand)
+	from := e.Operand.ExpressionType()
+	switch {
+	case e.Type == "void":
+		return tac.Operand{}
+	case isPointerType(e.Type) == isPointerType(from):
+		// pointers are untyped in TAC, so only narrowing to char emits code
+		if e.Type == "i8" && from != "i8" {
+			return l.fn.AddInstruction(tac.OpcodeTrunc, operand, tac.Immediate("i8"))
+		}
+		return operand
+	case e.Type == "i8":
+		// bitcast keeps width of pointer, char keeps its low byte
+		operand = l.fn.AddInstruction(tac.OpcodeBitcast, operand, tac.Immediate("i32"))
+		return l.fn.AddInstruction(tac.OpcodeTrunc, operand, tac.Immediate("i8"))
+	default:
+		return l.fn.AddInstruction(tac.OpcodeBitcast, operand, tac.Immediate(tacType(e.Type)))
+	}
+}
+
+// lowerPointerBinary lowers binary operators with pointer operand.
+// Integer operands of pointer arithmetic are scaled by size of pointed-to type.
+func (l *lowerer) lowerPointerBinary(e BinaryExpression, lhs, rhs tac.Operand) tac.Operand {
+	lhsType, rhsType := e.LHS.ExpressionType(), e.RHS.ExpressionType()
+	switch e.Op {
+	case lexer.TokenPlus:
+		if isPointerType(rhsType) {
+			lhs, rhs, lhsType = rhs, lhs, rhsType
 		}
-		elemType, ok := pointeeType(ptr.Type)
-		if !ok {
-			return tac.Operand{}, "", newError(e.Token, "cannot dereference non-pointer type %s", ptr.Type)
+		return l.offsetPointer(lhs, lhsType, rhs)
+	case lexer.TokenMinus:
+		if !isPointerType(rhsType) {
+			return l.offsetPointer(lhs, lhsType, l.fn.AddInstruction(tac.OpcodeNeg, rhs))
 		}
-		if elemType == "void" {
-			return tac.Operand{}, "", newError(e.Token, "cannot dereference void* without cast")
+		diff := l.fn.AddInstruction(tac.OpcodeSub, lhs, rhs)
+		if size := elementSize(lhsType); size > 1 {
+			diff = l.fn.AddInstruction(tac.OpcodeDivS, diff, tac.Immediate(strconv.Itoa(size)))
 		}
-		return ptr.Value, elemType, nil
+		return diff
+	case lexer.TokenEq, lexer.TokenNe:
+		return l.fn.AddInstruction(binaryOpcode(e.Op), lhs, rhs)
+	default:
+		return l.fn.AddInstruction(unsignedCompareOpcode(e.Op), lhs, rhs)
 	}
-	return tac.Operand{}, "", unsupportedError(lexer.Token{}, "assignment target")
 }
 
-func isPointerType(typ string) bool {
-	return strings.HasSuffix(typ, "*")
+func (l *lowerer) offsetPointer(ptr tac.Operand, ptrType string, index tac.Operand) tac.Operand {
+	return l.fn.AddInstruction(tac.OpcodeGep, ptr, index, tac.Immediate(strconv.Itoa(elementSize(ptrType))))
 }
 
-func pointeeType(typ string) (string, bool) {
-	if !isPointerType(typ) {
-		return "", false
-	}
-	return typ[:len(typ)-1], true
+// elementSize returns size of type pointer points to, 0 for incomplete type.
+func elementSize(ptrType string) int {
+	elem, _ := pointeeType(ptrType)
+	return typeSize(elem)
 }
 
-func pointerTo(typ string) string {
-	return typ + "*"
-}
-
-func (l *lowerer) loadAddress(addr tac.Operand) tac.Operand {
+// loadAddress reads object of type typ, keeping its volatile qualifier and width.
+func (l *lowerer) loadAddress(addr tac.Operand, typ string) tac.Operand {
+	opcode := tac.OpcodeLoadIndirect
 	if addr.Kind == tac.OperandStackSlotPointer {
-		return l.fn.AddInstruction(tac.OpcodeLoad, addr)
+		opcode = tac.OpcodeLoad
+	}
+	operands := accessOperands(typ, addr)
+	if isVolatileType(typ) {
+		return l.fn.AddVolatileInstruction(opcode, operands...)
 	}
-	return l.fn.AddInstruction(tac.OpcodeLoadIndirect, addr)
+	return l.fn.AddInstruction(opcode, operands...)
 }
 
-func (l *lowerer) storeAddress(addr, value tac.Operand) {
+func (l *lowerer) storeAddress(addr, value tac.Operand, typ string) {
+	opcode := tac.OpcodeStoreIndirect
 	if addr.Kind == tac.OperandStackSlotPointer {
-		l.fn.AddVoidInstruction(tac.OpcodeStore, addr, value)
+		opcode = tac.OpcodeStore
+	}
+	operands := accessOperands(typ, addr, value)
+	if isVolatileType(typ) {
+		l.fn.AddVolatileVoidInstruction(opcode, operands...)
 		return
 	}
-	l.fn.AddVoidInstruction(tac.OpcodeStoreIndirect, addr, value)
+	l.fn.AddVoidInstruction(opcode, operands...)
 }
 
-func decodeCharacterLiteral(raw string) (int32, error) {
-	if len(raw) < 3 || raw[0] != '\'' || raw[len(raw)-1] != '\'' {
-		return 0, fmt.Errorf("invalid character literal %q", raw)
-	}
-	body := raw[1 : len(raw)-1]
-	if len(body) == 0 {
-		return 0, fmt.Errorf("invalid character literal %q", raw)
-	}
-	if body[0] != '\\' {
-		if len(body) != 1 {
-			return 0, fmt.Errorf("multi-character literals are unsupported: %q", raw)
-		}
-		return int32(body[0]), nil
-	}
-	if len(body) != 2 {
-		return 0, fmt.Errorf("invalid escape in character literal %q", raw)
-	}
-	switch body[1] {
-	case '\\':
-		return int32('\\'), nil
-	case '\'':
-		return int32('\''), nil
-	case 'n':
-		return int32('\n'), nil
-	case 't':
-		return int32('\t'), nil
-	case 'r':
-		return int32('\r'), nil
-	case '0':
-		return int32(0), nil
-	default:
-		return 0, fmt.Errorf("unsupported escape in character literal %q", raw)
+// accessOperands appends access type to memory operands when it is narrower than default i32.
+func accessOperands(typ string, operands ...tac.Operand) []tac.Operand {
+	if t := tacType(typ); t == "i8" {
+		return append(operands, tac.Immediate(t))
 	}
+	return operands
 }
 
 func binaryOpcode(op lexer.TokenType) tac.Opcode {
@@ -738,6 +436,21 @@ func binaryOpcode(op lexer.TokenType) tac.Opcode {
 	}
 }
 
+func unsignedCompareOpcode(op lexer.TokenType) tac.Opcode {
+	switch op {
+	case lexer.TokenLt:
+		return tac.OpcodeLtU
+	case lexer.TokenLe:
+		return tac.OpcodeLeU
+	case lexer.TokenGt:
+		return tac.OpcodeGtU
+	case lexer.TokenGe:
+		return tac.OpcodeGeU
+	default:
+		return tac.OpcodeInvalid
+	}
+}
+
 func (l *lowerer) newLabel() string {
 	label := ".L" + strconv.Itoa(l.nextLabelID)
 	l.nextLabelID++
@@ -2,9 +2,11 @@ package sema_test
 
 import (
 	"os"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/SQLek/wihajster/internal/diag/code"
 	"github.com/SQLek/wihajster/internal/lexer"
 	"github.com/SQLek/wihajster/internal/parser"
 	"github.com/SQLek/wihajster/internal/sema"
@@ -318,6 +320,21 @@ int main() {
 	}
 }
 
+func TestLower_RejectsInvalidAssignmentTargetAtItsPosition(t *testing.T) {
+	src := `
+int main() {
+	int x = 1;
+	x + 1 = 2;
+	return x;
+}
+`
+
+	err := lowerErr(t, src)
+	if !strings.HasPrefix(err.Error(), "4:4: unsupported in current subset: assignment target") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestLower_RejectsUnaryArithmeticOnPointer(t *testing.T) {
 	src := `
 int main() {
@@ -373,6 +390,531 @@ int main() {
 	}
 }
 
+func TestLower_ExampleHelloUART(t *testing.T) {
+	f, err := os.Open("../../examples/hello_uart.c")
+	if err != nil {
+		t.Fatalf("open example: %v", err)
+	}
+	defer f.Close()
+
+	tu, err := parser.Parse(lexer.NewLexer(f))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	mod, err := sema.Lower(tu)
+	if err != nil {
+		t.Fatalf("lower failed: %v", err)
+	}
+	var out strings.Builder
+	if err := tac.WriteModule(&out, mod); err != nil {
+		t.Fatalf("write TAC: %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{"const.i32 268435456", "bitcast %t", ", i8*", "store.ind volatile %t"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestLower_VolatileLocalAccessesAreVolatile(t *testing.T) {
+	src := `
+int main() {
+	volatile int x = 1;
+	x = 2;
+	return x;
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{"alloca i32\n", "store volatile %s", " = load volatile %s"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestLower_CastsBetweenIntegersAndPointers(t *testing.T) {
+	src := `
+int main() {
+	int x = 7;
+	int addr = (int)&x;
+	char *p = (char *)&x;
+	return *(int *)addr + (int)p - addr + (char)0 + (char)p;
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{"bitcast %t", ", i32\n", ", i32*\n", "trunc %t"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestLower_HexAndOctalConstantsWrapToInt(t *testing.T) {
+	src := `
+int main() {
+	volatile int *gpio = (volatile int *)0x80000000;
+	*gpio = 0xFFFFFFFF + 037777777777;
+	return 0x7fffffff;
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{"const.i32 -2147483648\n", "bitcast %t2, i32*\n", "%t6 = const.i32 -1\n", "const.i32 2147483647\n"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+	for _, src := range []string{"0x100000000", "2147483648", "040000000000"} {
+		err := lowerErr(t, "int main() {\n\treturn "+src+";\n}\n")
+		if !strings.Contains(err.Error(), "invalid integer literal") {
+			t.Fatalf("expected %s rejected, got %v", src, err)
+		}
+	}
+}
+
+func TestLower_QualifierRules(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		msg  string
+	}{
+		{
+			name: "assign to const",
+			src: `
+int main() {
+	const int x = 1;
+	x = 2;
+	return x;
+}
+`,
+			msg: "cannot assign to const-qualified object of type const i32",
+		},
+		{
+			name: "store through pointer to const",
+			src: `
+int main(const int *p) {
+	*p = 2;
+	return 0;
+}
+`,
+			msg: "cannot assign to const-qualified object",
+		},
+		{
+			name: "discard volatile from pointee",
+			src: `
+int main(volatile int *p) {
+	int *q = p;
+	return 0;
+}
+`,
+			msg: "initializer type mismatch for q: expected i32*, got volatile i32*",
+		},
+		{
+			name: "cast void expression",
+			src: `
+void f() {
+	return;
+}
+int main() {
+	return (int)f();
+}
+`,
+			msg: "cannot cast void expression to i32",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := lowerErr(t, tc.src)
+			if !strings.Contains(err.Error(), tc.msg) {
+				t.Fatalf("expected error containing %q, got %v", tc.msg, err)
+			}
+		})
+	}
+}
+
+func TestLower_QualifiedPrototypeParamsMatchDefinition(t *testing.T) {
+	src := `
+int id(const int x);
+int id(int x) {
+	return x;
+}
+int main() {
+	int v = 0x2a;
+	const int *p = &v;
+	return id(*p) + 010;
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{"const.i32 42", "const.i32 8"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestLower_PointerArithmeticScalesByElementSize(t *testing.T) {
+	src := `
+int main() {
+	int x = 1;
+	char c = 'a';
+	int *p = &x;
+	char *s = &c;
+	int *q = 1 + p - 1;
+	s = s + 2;
+	return q - p;
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{"alloca i8\n", " = gep %t", ", 4\n", ", 1\n", " = neg %t", " = div_s %t"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestLower_PointerComparisonsAreUnsigned(t *testing.T) {
+	src := `
+int main(int *p, int *q) {
+	return (p < q) + (p >= q) + (p == q) + (p != 0);
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{" = lt_u %t", " = ge_u %t", " = eq %t", " = ne %t"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestLower_CharNarrowingTruncates(t *testing.T) {
+	src := `
+char narrow(int v) {
+	char c = v;
+	c = c + 1;
+	return c;
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{"func @narrow(%v:i32) -> i8 {", "alloca i8", " = trunc %t", ", i8\n"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestLower_RejectsInvalidPointerArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		msg  string
+	}{
+		{name: "multiply", expr: "p * 2", msg: "invalid operands to binary * (i32* and i32)"},
+		{name: "add pointers", expr: "p + q", msg: "invalid operands to binary + (i32* and i32*)"},
+		{name: "int minus pointer", expr: "1 - p", msg: "invalid operands to binary - (i32 and i32*)"},
+		{name: "difference of unrelated pointers", expr: "p - s", msg: "invalid operands to binary - (i32* and i8*)"},
+		{name: "compare with integer", expr: "p < 1", msg: "invalid operands to binary < (i32* and i32)"},
+		{name: "equal to non-zero integer", expr: "p == 1", msg: "invalid operands to binary == (i32* and i32)"},
+		{name: "void pointer arithmetic", expr: "(int)(v + 1)", msg: "arithmetic on pointer to incomplete type void"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := `
+int main(int *p, int *q, char *s, void *v) {
+	return ` + tc.expr + `;
+}
+`
+			err := lowerErr(t, src)
+			if !strings.Contains(err.Error(), tc.msg) {
+				t.Fatalf("expected error containing %q, got %v", tc.msg, err)
+			}
+		})
+	}
+}
+
+func TestLower_BuiltinsAreImplicitlyDeclared(t *testing.T) {
+	src := `
+int putchar(int c);
+int main() {
+	__wh_print_int(putchar('x'));
+	__wh_assert(1);
+	return 0;
+}
+`
+
+	text := lowerText(t, src)
+	for _, want := range []string{"call @putchar(", "call @__wh_print_int(", "call @__wh_assert("} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected TAC to contain %q, got:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "func @putchar") {
+		t.Fatalf("builtin must stay external, got:\n%s", text)
+	}
+}
+
+func TestLower_RejectsConflictingBuiltinDeclaration(t *testing.T) {
+	err := lowerErr(t, "void putchar(char c);\nint main() { return 0; }\n")
+	if !strings.Contains(err.Error(), "conflicting prototype for function putchar") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLower_DefinitionReplacesLibraryBuiltin(t *testing.T) {
+	text := lowerText(t, "int malloc(int n);\nint main() { return malloc(2); }\nint malloc(int n) { return n; }\n")
+	if !strings.Contains(text, "func @malloc") {
+		t.Fatalf("expected malloc defined in module, got:\n%s", text)
+	}
+
+	// only library functions can be replaced
+	err := lowerErr(t, "int main() { return 0; }\nvoid putchar(char c) {}\n")
+	if !strings.Contains(err.Error(), "function definition does not match prototype for putchar") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLower_InstructionsCarryStatementPositions(t *testing.T) {
+	src := `int main() {
+	int x = 1;
+	while (x < 3) {
+		x = x + 1;
+	}
+	return x;
+}
+`
+	mod := lowerOK(t, src)
+	lines := map[int]bool{}
+	for _, inst := range mod.Functions[0].Instructions {
+		if !inst.Pos.IsValid() {
+			t.Fatalf("instruction %+v has no source position", inst)
+		}
+		lines[inst.Pos.Line] = true
+		if inst.Kind == tac.InstructionRet && inst.Pos != (tac.SourcePos{Line: 6, Column: 2}) {
+			t.Fatalf("expected ret at 6:2, got %+v", inst.Pos)
+		}
+	}
+	for _, line := range []int{2, 3, 4, 6} {
+		if !lines[line] {
+			t.Fatalf("expected instructions from line %d, got lines %v", line, lines)
+		}
+	}
+}
+
+func TestLowerOptions_Warnings(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "unused variable and parameter",
+			src:  "int f(int a, int b) {\n\tint x;\n\tint y = 1;\n\ty = b;\n\treturn 0;\n}\n",
+			want: []string{
+				"1:11: warning: unused parameter a [-Wunused-parameter]",
+				"2:6: warning: unused variable x [-Wunused-variable]",
+			},
+		},
+		{
+			name: "shadowed identifier",
+			src:  "int f(int a) {\n\tint b = a;\n\t{\n\t\tint a = b;\n\t\treturn a;\n\t}\n}\n",
+			want: []string{
+				"4:7: warning: declaration of a shadows previous declaration [-Wshadow]\n1:11: note: previous declaration is here",
+			},
+		},
+		{
+			name: "implicit narrowing",
+			src:  "char f(int a) {\n\tchar c = 'x';\n\tchar d = -128;\n\tc = a;\n\tc = (char)a;\n\treturn a + d;\n}\n",
+			want: []string{
+				"4:4: warning: implicit conversion from i32 to i8 may change value [-Wimplicit-int-conversion]",
+				"6:2: warning: implicit conversion from i32 to i8 may change value [-Wimplicit-int-conversion]",
+			},
+		},
+		{
+			name: "comparison always true or false",
+			src:  "int f(char c, int a, volatile int v) {\n\tif (a <= a) return 1;\n\tif (c < 128) return 2;\n\tif (-129 == c) return 3;\n\tif (c < 127 || v == v) return 4;\n\treturn 0;\n}\n",
+			want: []string{
+				"2:8: warning: comparison of a with itself is always true [-Wtautological-compare]",
+				"3:8: warning: comparison of i8 with 128 is always true [-Wtautological-compare]",
+				"4:11: warning: comparison of i8 with -129 is always false [-Wtautological-compare]",
+			},
+		},
+		{
+			name: "statement with no effect",
+			src:  "void g(int x) {\n\tx;\n}\nint f(int a, volatile int *p) {\n\ta + 1;\n\t*p;\n\t(void)a;\n\tg(a);\n\ta = 2;\n\treturn a;\n}\n",
+			want: []string{
+				"2:2: warning: statement with no effect [-Wunused-value]",
+				"5:2: warning: statement with no effect [-Wunused-value]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enabled := map[string]bool{}
+			for _, name := range sema.Warnings() {
+				enabled[name] = true
+			}
+			_, warnings, err := sema.LowerOptions(parseOK(t, tt.src), sema.Options{Warnings: enabled})
+			if err != nil {
+				t.Fatalf("lower failed: %v", err)
+			}
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("expected warnings:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestLowerOptions_WarningsDoNotChangeOutput(t *testing.T) {
+	src := "int f(int a, int unused) {\n\tchar c = a;\n\ta == a;\n\t{\n\t\tint a = c;\n\t\treturn a;\n\t}\n}\n"
+	all := map[string]bool{}
+	for _, name := range sema.Warnings() {
+		all[name] = true
+	}
+
+	var texts []string
+	for _, enabled := range []map[string]bool{nil, {}, all} {
+		mod, warnings, err := sema.LowerOptions(parseOK(t, src), sema.Options{Warnings: enabled})
+		if err != nil {
+			t.Fatalf("lower failed: %v", err)
+		}
+		for _, w := range warnings {
+			if !enabled[w.Name] && (enabled != nil || !sema.DefaultWarnings()[w.Name]) {
+				t.Fatalf("disabled warning reported: %v", w)
+			}
+		}
+		var out strings.Builder
+		if err := tac.WriteModule(&out, mod); err != nil {
+			t.Fatalf("write TAC: %v", err)
+		}
+		texts = append(texts, out.String())
+	}
+	if texts[0] != texts[1] || texts[1] != texts[2] {
+		t.Fatalf("TAC depends on enabled warnings:\n%s\n%s\n%s", texts[0], texts[1], texts[2])
+	}
+}
+
+func TestLowerOptions_ReportsAllErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		limit int
+		want  []string
+	}{
+		{
+			name: "errors in source order",
+			src:  "int g(int a);\nint f() {\n\tint x = y + 1;\n\treturn x + z;\n}\nint g(char a) {\n\treturn 0;\n}\n",
+			want: []string{
+				"3:10: use of undeclared identifier y",
+				"4:13: use of undeclared identifier z",
+				"6:1: function definition does not match prototype for g",
+			},
+		},
+		{
+			name: "no cascade from poisoned expressions",
+			src:  "int f(int *p) {\n\tint x = -(*q + 1);\n\tp = &r;\n\tx = (char)undefined(x);\n\tf(x);\n\treturn *p + x;\n}\n",
+			want: []string{
+				"2:13: use of undeclared identifier q",
+				"3:7: use of undeclared identifier r",
+				"4:12: call to undeclared function undefined",
+				"5:3: argument 1 to f has type i32, expected i32*",
+			},
+		},
+		{
+			name: "arguments of invalid call",
+			src:  "int f(int a) {\n\treturn f(a, b);\n}\n",
+			want: []string{
+				"2:10: function f expects 1 arguments, got 2",
+				"2:14: use of undeclared identifier b",
+			},
+		},
+		{
+			name:  "error limit",
+			src:   "int f() {\n\ta;\n\tb;\n\tc;\n}\n",
+			limit: 2,
+			want: []string{
+				"2:2: use of undeclared identifier a",
+				"3:2: use of undeclared identifier b",
+				"too many errors emitted, stopping now [-error-limit=2]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mod, _, err := sema.LowerOptions(parseOK(t, tt.src), sema.Options{ErrorLimit: tt.limit})
+			errs, ok := err.(*sema.Errors)
+			if !ok {
+				t.Fatalf("expected *sema.Errors, got %T: %v", err, err)
+			}
+			if len(mod.Functions) != 0 {
+				t.Fatalf("expected no TAC with errors, got %d functions", len(mod.Functions))
+			}
+			if err.Error() != strings.Join(tt.want, "\n") {
+				t.Fatalf("expected errors:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), err)
+			}
+			if errs.Limit != tt.limit {
+				t.Fatalf("expected limit %d, got %d", tt.limit, errs.Limit)
+			}
+		})
+	}
+}
+
+func TestLowerOptions_ErrorAndWarningCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []code.Code
+	}{
+		{
+			name: "errors",
+			src:  "int f(int *p) {\n\tconst int c = 1;\n\tc = *q;\n\tp = 1;\n\treturn f(p, p) + g();\n}\n",
+			want: []code.Code{code.UndeclaredIdentifier, code.IncompatibleTypes, code.ArgumentCount, code.UndeclaredFunction},
+		},
+		{
+			name: "warnings",
+			src:  "int f(int a) {\n\tint b = 1;\n\t{\n\t\tint b = a;\n\t\tb == b;\n\t}\n\treturn 0;\n}\n",
+			want: []code.Code{code.UnusedVariable, code.Shadow, code.UnusedValue, code.TautologicalCompare},
+		},
+	}
+
+	all := map[string]bool{}
+	for _, name := range sema.Warnings() {
+		all[name] = true
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, warnings, err := sema.LowerOptions(parseOK(t, tt.src), sema.Options{Warnings: all})
+			var got []code.Code
+			if errs, ok := err.(*sema.Errors); ok {
+				for _, e := range errs.Diagnostics {
+					got = append(got, e.Code)
+				}
+			} else if err != nil {
+				t.Fatalf("expected *sema.Errors, got %T: %v", err, err)
+			}
+			for _, w := range warnings {
+				got = append(got, w.Code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected codes %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
 func lowerText(t *testing.T, src string) string {
 	t.Helper()
 	mod := lowerOK(t, src)
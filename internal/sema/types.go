@@ -0,0 +1,196 @@
+package sema
+
+import (
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+)
+
+// Types are represented as strings, for example "i32", "volatile i32*" or "i32* const".
+// Qualifiers of non pointer type are written before base type,
+// qualifiers of pointer are written after the '*' they apply to.
+
+const (
+	qualifierConstWord    = "const"
+	qualifierVolatileWord = "volatile"
+)
+
+var qualifierStripper = strings.NewReplacer(
+	qualifierConstWord+" ", "",
+	qualifierVolatileWord+" ", "",
+	" "+qualifierConstWord, "",
+	" "+qualifierVolatileWord, "",
+)
+
+func lowerType(t parser.TypeName) string {
+	base := ""
+	switch t.Specifier {
+	case parser.TypeSpecifierInt:
+		base = "i32"
+	case parser.TypeSpecifierChar:
+		base = "i8"
+	case parser.TypeSpecifierVoid:
+		base = "void"
+	default:
+		return ""
+	}
+	if words := qualifierWords(t.Qualifiers); words != "" {
+		base = words + " " + base
+	}
+	for i := 0; i < t.PointerDepth; i++ {
+		base += "*"
+		if i < len(t.PointerQualifiers) {
+			if words := qualifierWords(t.PointerQualifiers[i]); words != "" {
+				base += " " + words
+			}
+		}
+	}
+	return base
+}
+
+func lowerObjectType(tok lexer.Token, t parser.TypeName) (string, error) {
+	typ := lowerType(t)
+	if typ == "" {
+		return "", unsupportedError(code.Unsupported, tok, "declaration type")
+	}
+	if isVoidType(typ) {
+		return "", unsupportedError(code.VoidObject, tok, "void objects")
+	}
+	return typ, nil
+}
+
+func qualifierWords(q parser.TypeQualifier) string {
+	var words []string
+	if q.Has(parser.TypeQualifierConst) {
+		words = append(words, qualifierConstWord)
+	}
+	if q.Has(parser.TypeQualifierVolatile) {
+		words = append(words, qualifierVolatileWord)
+	}
+	return strings.Join(words, " ")
+}
+
+// splitQualifiers separates top level qualifiers from type.
+func splitQualifiers(typ string) (string, parser.TypeQualifier) {
+	var quals parser.TypeQualifier
+	if i := strings.LastIndexByte(typ, '*'); i >= 0 {
+		for _, word := range strings.Fields(typ[i+1:]) {
+			quals |= qualifierFromWord(word)
+		}
+		return typ[:i+1], quals
+	}
+	for {
+		word, rest, found := strings.Cut(typ, " ")
+		if !found {
+			return typ, quals
+		}
+		q := qualifierFromWord(word)
+		if q == 0 {
+			return typ, quals
+		}
+		quals |= q
+		typ = rest
+	}
+}
+
+func qualifierFromWord(word string) parser.TypeQualifier {
+	switch word {
+	case qualifierConstWord:
+		return parser.TypeQualifierConst
+	case qualifierVolatileWord:
+		return parser.TypeQualifierVolatile
+	default:
+		return 0
+	}
+}
+
+// unqualified drops top level qualifiers, as C does for values of expressions.
+func unqualified(typ string) string {
+	base, _ := splitQualifiers(typ)
+	return base
+}
+
+func isVolatileType(typ string) bool {
+	_, quals := splitQualifiers(typ)
+	return quals.Has(parser.TypeQualifierVolatile)
+}
+
+func isConstType(typ string) bool {
+	_, quals := splitQualifiers(typ)
+	return quals.Has(parser.TypeQualifierConst)
+}
+
+func isVoidType(typ string) bool {
+	return unqualified(typ) == "void"
+}
+
+// tacType strips qualifiers on every level, TAC types carry no qualifiers.
+func tacType(typ string) string {
+	return qualifierStripper.Replace(typ)
+}
+
+func isPointerType(typ string) bool {
+	return strings.HasSuffix(unqualified(typ), "*")
+}
+
+func pointeeType(typ string) (string, bool) {
+	typ = unqualified(typ)
+	if !strings.HasSuffix(typ, "*") {
+		return "", false
+	}
+	return typ[:len(typ)-1], true
+}
+
+func pointerTo(typ string) string {
+	return typ + "*"
+}
+
+func isIntegerType(typ string) bool {
+	typ = unqualified(typ)
+	return typ == "i32" || typ == "i8"
+}
+
+// typeSize returns size in bytes of object type, or 0 for incomplete types.
+func typeSize(typ string) int {
+	switch unqualified(typ) {
+	case "i8":
+		return 1
+	case "i32":
+		return 4
+	}
+	if isPointerType(typ) {
+		return 4
+	}
+	return 0
+}
+
+// samePointee reports if pointers point to the same type, ignoring its qualifiers.
+func samePointee(a, b string) bool {
+	aElem, _ := pointeeType(a)
+	bElem, _ := pointeeType(b)
+	return unqualified(aElem) == unqualified(bElem)
+}
+
+// assignable reports if value of type src can be stored in object of type dst.
+// Integer types convert freely, pointer conversions may only add qualifiers to pointed-to type.
+// void pointer converts to and from any object pointer, as malloc result does.
+func assignable(dst, src string) bool {
+	dst, src = unqualified(dst), unqualified(src)
+	// expression with error was already reported
+	if dst == ErrorType || src == ErrorType || dst == src || isIntegerType(dst) && isIntegerType(src) {
+		return true
+	}
+	dstElem, ok := pointeeType(dst)
+	if !ok {
+		return false
+	}
+	srcElem, ok := pointeeType(src)
+	if !ok {
+		return false
+	}
+	dstBase, dstQuals := splitQualifiers(dstElem)
+	srcBase, srcQuals := splitQualifiers(srcElem)
+	return (dstBase == srcBase || dstBase == "void" || srcBase == "void") && dstQuals.Has(srcQuals)
+}
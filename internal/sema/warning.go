@@ -0,0 +1,281 @@
+package sema
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/SQLek/wihajster/internal/diag/code"
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+)
+
+// Names of warnings, as in -Wname flags.
+const (
+	WarnUnusedVariable        = "unused-variable"
+	WarnUnusedParameter       = "unused-parameter"
+	WarnShadow                = "shadow"
+	WarnImplicitIntConversion = "implicit-int-conversion"
+	WarnTautologicalCompare   = "tautological-compare"
+	WarnUnusedValue           = "unused-value"
+)
+
+// warnings maps name of warning to whether it is enabled by default.
+var warnings = map[string]bool{
+	WarnUnusedVariable:        false,
+	WarnUnusedParameter:       false,
+	WarnShadow:                false,
+	WarnImplicitIntConversion: false,
+	WarnTautologicalCompare:   true,
+	WarnUnusedValue:           true,
+}
+
+// Warnings returns names of warnings, sorted.
+func Warnings() []string {
+	var names []string
+	for name := range warnings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// DefaultWarnings returns set of warnings enabled when no -W flags are given.
+func DefaultWarnings() map[string]bool {
+	enabled := map[string]bool{}
+	for name, on := range warnings {
+		if on {
+			enabled[name] = true
+		}
+	}
+	return enabled
+}
+
+// Options configure semantic analysis.
+type Options struct {
+	// Warnings are names of enabled warnings, DefaultWarnings when nil.
+	Warnings map[string]bool
+	// ErrorLimit stops analysis after that many errors, 0 means no limit.
+	ErrorLimit int
+}
+
+// Warning is diagnostic that does not stop compilation.
+type Warning struct {
+	// Name is name of warning, as in -Wname
+	Name    string
+	Code    code.Code
+	File    string
+	Line    int
+	Column  int
+	Span    lexer.Span
+	Message string
+	Notes   []lexer.Note
+
+	// source is span of token in source, warnings are ordered by it
+	source lexer.Span
+}
+
+func (w Warning) String() string {
+	msg := fmt.Sprintf("%s: warning: %s [-W%s]", lexer.Position(w.File, w.Line, w.Column), w.Message, w.Name)
+	for _, note := range w.Notes {
+		msg += "\n" + note.String()
+	}
+	return msg
+}
+
+// warnf records warning at tok, when it is enabled.
+func (a *analyzer) warnf(name string, tok lexer.Token, format string, args ...any) *Warning {
+	if !a.enabled[name] {
+		return nil
+	}
+	a.warnings = append(a.warnings, Warning{
+		Name:    name,
+		Code:    code.ForFlag(name),
+		File:    tok.File,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Span:    tok.Span,
+		Message: fmt.Sprintf(format, args...),
+		Notes:   lexer.ExpansionNotes(tok),
+		source:  lexer.SourceSpan(tok),
+	})
+	return &a.warnings[len(a.warnings)-1]
+}
+
+// sortWarnings orders warnings by their position in source, for stable output
+// independent of order checks are done in.
+func sortWarnings(ws []Warning) {
+	slices.SortStableFunc(ws, func(a, b Warning) int {
+		return cmp.Or(strings.Compare(a.source.File, b.source.File), cmp.Compare(a.source.Start, b.source.Start))
+	})
+}
+
+// warnUnused reports variables and parameters of scope never referred to.
+func (a *analyzer) warnUnused(scope *Scope) {
+	for _, sym := range scope.Symbols {
+		switch {
+		case sym.Used:
+		case sym.Kind == SymbolParameter:
+			a.warnf(WarnUnusedParameter, sym.Token, "unused parameter %s", sym.Name)
+		default:
+			a.warnf(WarnUnusedVariable, sym.Token, "unused variable %s", sym.Name)
+		}
+	}
+}
+
+// warnShadow reports declaration of name hiding one of outer scope.
+// Functions of file scope are not reported.
+func (a *analyzer) warnShadow(tok lexer.Token, name string) {
+	for s := a.scope.Parent; s != a.file; s = s.Parent {
+		prev, ok := s.names[name]
+		if !ok {
+			continue
+		}
+		w := a.warnf(WarnShadow, tok, "declaration of %s shadows previous declaration", name)
+		if w != nil {
+			w.Notes = append(w.Notes, lexer.Note{
+				File:    prev.Token.File,
+				Line:    prev.Token.Line,
+				Column:  prev.Token.Column,
+				Span:    prev.Token.Span,
+				Message: "previous declaration is here",
+			})
+		}
+		return
+	}
+}
+
+// warnComparison reports comparisons with result known without evaluating them:
+// of variable with itself and of char with constant it can not hold.
+func (a *analyzer) warnComparison(e parser.BinaryExpression, lhs, rhs Expression) {
+	if !isComparison(e.Op) {
+		return
+	}
+	lhsID, lhsOK := lhs.(IdentifierExpression)
+	rhsID, rhsOK := rhs.(IdentifierExpression)
+	if lhsOK && rhsOK && lhsID.Symbol == rhsID.Symbol {
+		// every read of volatile may give other value
+		if !isVolatileType(lhsID.Symbol.Type) {
+			result := e.Op == lexer.TokenEq || e.Op == lexer.TokenLe || e.Op == lexer.TokenGe
+			a.warnf(WarnTautologicalCompare, e.Token, "comparison of %s with itself is always %t", lhsID.Symbol.Name, result)
+		}
+		return
+	}
+
+	op, constant := e.Op, e.RHS
+	if lhs.ExpressionType() != "i8" {
+		op, constant = mirrorComparison(e.Op), e.LHS
+		if rhs.ExpressionType() != "i8" {
+			return
+		}
+	}
+	k, ok := constantValue(constant)
+	if !ok || k >= -128 && k <= 127 {
+		return
+	}
+	// with constant out of range, comparison gives the same for all char values
+	result := compareInts(op, -128, k)
+	a.warnf(WarnTautologicalCompare, e.Token, "comparison of i8 with %d is always %t", k, result)
+}
+
+// warnNoEffect reports expression statement computing value that is not used.
+func (a *analyzer) warnNoEffect(s ExpressionStatement) {
+	if hasSideEffects(s.Expression) {
+		return
+	}
+	// casting to void discards value on purpose
+	if cast, ok := s.Expression.(CastExpression); ok && cast.Type == "void" {
+		return
+	}
+	a.warnf(WarnUnusedValue, s.Token, "statement with no effect")
+}
+
+// hasSideEffects reports if evaluating expr calls function, stores or reads volatile object.
+func hasSideEffects(expr Expression) bool {
+	switch e := expr.(type) {
+	case CallExpression, AssignmentExpression:
+		return true
+	case IdentifierExpression:
+		return e.Symbol != nil && isVolatileType(e.Symbol.Type)
+	case UnaryExpression:
+		if e.Op == lexer.TokenAmp {
+			// address of object is computed without reading it
+			deref, ok := e.Operand.(UnaryExpression)
+			return ok && hasSideEffects(deref.Operand)
+		}
+		if e.Op == lexer.TokenStar {
+			elemType, _ := pointeeType(e.Operand.ExpressionType())
+			if isVolatileType(elemType) {
+				return true
+			}
+		}
+		return hasSideEffects(e.Operand)
+	case BinaryExpression:
+		return hasSideEffects(e.LHS) || hasSideEffects(e.RHS)
+	case CastExpression:
+		return hasSideEffects(e.Operand)
+	}
+	return false
+}
+
+// constantValue evaluates integer constant expressions of literals.
+func constantValue(expr parser.Expression) (int64, bool) {
+	switch e := expr.(type) {
+	case parser.IntegerLiteralExpression:
+		value, err := decodeIntegerLiteral(e.Raw)
+		return int64(value), err == nil
+	case parser.CharacterLiteralExpression:
+		value, err := decodeCharacterLiteral(e.Raw)
+		return int64(value), err == nil
+	case parser.UnaryExpression:
+		value, ok := constantValue(e.Operand)
+		switch e.Op {
+		case lexer.TokenMinus:
+			return -value, ok
+		case lexer.TokenPlus:
+			return value, ok
+		}
+	}
+	return 0, false
+}
+
+func isComparison(op lexer.TokenType) bool {
+	switch op {
+	case lexer.TokenEq, lexer.TokenNe, lexer.TokenLt, lexer.TokenLe, lexer.TokenGt, lexer.TokenGe:
+		return true
+	}
+	return false
+}
+
+// mirrorComparison returns operator comparing swapped operands the same way.
+func mirrorComparison(op lexer.TokenType) lexer.TokenType {
+	switch op {
+	case lexer.TokenLt:
+		return lexer.TokenGt
+	case lexer.TokenLe:
+		return lexer.TokenGe
+	case lexer.TokenGt:
+		return lexer.TokenLt
+	case lexer.TokenGe:
+		return lexer.TokenLe
+	}
+	return op
+}
+
+func compareInts(op lexer.TokenType, a, b int64) bool {
+	switch op {
+	case lexer.TokenEq:
+		return a == b
+	case lexer.TokenNe:
+		return a != b
+	case lexer.TokenLt:
+		return a < b
+	case lexer.TokenLe:
+		return a <= b
+	case lexer.TokenGt:
+		return a > b
+	default:
+		return a >= b
+	}
+}
@@ -1,9 +1,13 @@
 package tac_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/SQLek/wihajster/internal/lexer"
 	"github.com/SQLek/wihajster/internal/parser"
@@ -57,3 +61,691 @@ func TestCompileAndEvaluate_Fibonacci(t *testing.T) {
 		t.Fatalf("expected @main return 55, got %d", mainRet)
 	}
 }
+
+func TestCompileAndEvaluate_HelloUART(t *testing.T) {
+	srcPath := filepath.Join("..", "..", "examples", "hello_uart.c")
+	f, err := os.Open(srcPath)
+	if err != nil {
+		t.Fatalf("open %s: %v", srcPath, err)
+	}
+	defer f.Close()
+
+	tu, err := parser.Parse(lexer.NewLexer(f))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	mod, err := sema.Lower(tu)
+	if err != nil {
+		t.Fatalf("lower: %v", err)
+	}
+
+	var uart tac.UART
+	if _, err := tac.EvaluateFunction(mod, "@_main", nil, tac.EvalOptions{Devices: []tac.Device{uart.Device()}}); err != nil {
+		t.Fatalf("evaluate @_main: %v", err)
+	}
+	if got := uart.String(); got != "Hello, World!" {
+		t.Fatalf("expected UART output %q, got %q", "Hello, World!", got)
+	}
+}
+
+func TestCompileAndEvaluate_PointerArithmetic(t *testing.T) {
+	src := `
+int main() {
+	int x = 40;
+	int y = 2;
+	int *p = &x;
+	int *end = p + 1;
+	char *bytes = (char *)p;
+	if (end - p != 1) {
+		return 1;
+	}
+	if ((char *)end - bytes != 4) {
+		return 2;
+	}
+	if (!(p < end) || end <= p) {
+		return 3;
+	}
+	if (end - 1 != p || p == 0) {
+		return 4;
+	}
+	return *(end - 1) + y;
+}
+`
+	mod := compileString(t, src)
+	got, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate @main: %v", err)
+	}
+	if got != 42 {
+		t.Fatalf("expected 42, got %d", got)
+	}
+}
+
+func TestCompileAndEvaluate_CharTruncation(t *testing.T) {
+	src := `
+char narrow(int v) {
+	return v;
+}
+int main() {
+	char c = narrow(300);
+	char *p = (char *)0x1FF;
+	return c + (char)255 + (char)p;
+}
+`
+	mod := compileString(t, src)
+	got, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate @main: %v", err)
+	}
+	if got != 42 {
+		t.Fatalf("expected 42, got %d", got)
+	}
+}
+
+func TestCompileAndEvaluate_PointerToLocalPassedToHelper(t *testing.T) {
+	src := `
+void swap(int *a, int *b) {
+	int tmp = *a;
+	*a = *b;
+	*b = tmp;
+}
+void fill(char *s, char c) {
+	*s = c;
+}
+int main() {
+	int x = 2;
+	int y = 40;
+	char c = 0;
+	swap(&x, &y);
+	fill(&c, 'A');
+	return x - y + c - 'A' + 4;
+}
+`
+	mod := compileString(t, src)
+	got, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate @main: %v", err)
+	}
+	if got != 42 {
+		t.Fatalf("expected 42, got %d", got)
+	}
+}
+
+func TestCompileAndEvaluate_DeclarationInLoopReusesSlot(t *testing.T) {
+	src := `
+int main() {
+	int i = 0;
+	int sum = 0;
+	while (i < 100000) {
+		int next = sum + 1;
+		sum = next;
+		i = i + 1;
+	}
+	return sum;
+}
+`
+	mod := compileString(t, src)
+	// loop allocates more than whole stack if every iteration got new slot
+	got, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{StepLimit: 2000000, Sanitize: true})
+	if err != nil {
+		t.Fatalf("evaluate @main: %v", err)
+	}
+	if got != 100000 {
+		t.Fatalf("expected 100000, got %d", got)
+	}
+}
+
+func TestCompileAndEvaluate_HostFunctions(t *testing.T) {
+	src := `
+int main() {
+	int i = 0;
+	while (i < 3) {
+		putchar('a' + i);
+		i = i + 1;
+	}
+	putchar('\n');
+	__wh_print_int(-42);
+	__wh_assert(i == 3);
+	return 0;
+}
+`
+	mod := compileString(t, src)
+	var out strings.Builder
+	if _, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{HostFuncs: tac.StandardHostFuncs(&out)}); err != nil {
+		t.Fatalf("evaluate @main: %v", err)
+	}
+	if got, want := out.String(), "abc\n-42\n"; got != want {
+		t.Fatalf("expected output %q, got %q", want, got)
+	}
+}
+
+func TestCompileAndEvaluate_FailedAssertion(t *testing.T) {
+	src := `
+int check(int v) {
+	__wh_assert(v > 0);
+	return v;
+}
+int main() {
+	return check(-1);
+}
+`
+	mod := compileString(t, src)
+	var out strings.Builder
+	_, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{HostFuncs: tac.StandardHostFuncs(&out)})
+	if !errors.Is(err, tac.ErrAssertionFailed) {
+		t.Fatalf("expected assertion failure, got %v", err)
+	}
+}
+
+func TestCompileAndEvaluate_Sanitize(t *testing.T) {
+	cases := []struct {
+		name  string
+		src   string
+		check string
+		line  int
+	}{
+		{
+			name: "signed add overflow",
+			src: `int main() {
+	int x = 2147483647;
+	return x + 1;
+}`,
+			check: "signed overflow",
+			line:  3,
+		},
+		{
+			name: "negation of INT_MIN",
+			src: `int main() {
+	int m = -2147483647 - 1;
+	return -m;
+}`,
+			check: "signed overflow",
+			line:  3,
+		},
+		{
+			name: "INT_MIN divided by -1",
+			src: `int main() {
+	int m = -2147483647 - 1;
+	int d = -1;
+	return m / d;
+}`,
+			check: "signed overflow",
+			line:  4,
+		},
+		{
+			name: "shift by 32",
+			src: `int main() {
+	int s = 32;
+	return 1 << s;
+}`,
+			check: "invalid shift",
+			line:  3,
+		},
+		{
+			name: "read past local",
+			src: `int main() {
+	int x = 1;
+	int *p = &x;
+	return *(p + 1);
+}`,
+			check: "out-of-bounds access",
+			line:  4,
+		},
+		{
+			name: "pointer arithmetic past end",
+			src: `int main() {
+	char c = 1;
+	char *p = &c;
+	p = p + 2;
+	return 0;
+}`,
+			check: "out-of-bounds pointer",
+			line:  4,
+		},
+		{
+			name: "uninitialized read",
+			src: `int main() {
+	int x;
+	return x;
+}`,
+			check: "uninitialized read",
+			line:  3,
+		},
+		{
+			name: "pointer to returned local",
+			src: `int *leak() {
+	int x = 1;
+	return &x;
+}
+int main() {
+	int *p = leak();
+	return *p;
+}`,
+			check: "use after return",
+			line:  7,
+		},
+		{
+			name: "use after free",
+			src: `int main() {
+	int *p = malloc(4);
+	*p = 1;
+	free(p);
+	return *p;
+}`,
+			check: "use after free",
+			line:  5,
+		},
+		{
+			name: "double free",
+			src: `int main() {
+	int *p = malloc(4);
+	free(p);
+	free(p);
+	return 0;
+}`,
+			check: "double free",
+			line:  4,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mod := compileString(t, tc.src)
+			_, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{Sanitize: true})
+			var ub *tac.UndefinedBehavior
+			if !errors.As(err, &ub) {
+				t.Fatalf("expected undefined behavior, got %v", err)
+			}
+			if ub.Check != tc.check || ub.Function != "@main" || ub.Pos.Line != tc.line {
+				t.Fatalf("expected %s in @main at line %d, got %v", tc.check, tc.line, err)
+			}
+			if inst := mod.Functions[len(mod.Functions)-1].Instructions[ub.Index]; inst.Pos != ub.Pos {
+				t.Fatalf("instruction index %d does not match position %+v", ub.Index, ub.Pos)
+			}
+		})
+	}
+}
+
+func TestCompileAndEvaluate_Heap(t *testing.T) {
+	mod := compileString(t, `int *squares(int n) {
+	int *p = malloc(n * 4);
+	int i = 0;
+	while (i < n) {
+		*(p + i) = i * i;
+		i = i + 1;
+	}
+	return p;
+}
+
+int main(int n) {
+	int *p = squares(n);
+	int sum = 0;
+	int i = 0;
+	while (i < n) {
+		sum = sum + *(p + i);
+		i = i + 1;
+	}
+	free(p);
+	return sum;
+}`)
+
+	for _, sanitize := range []bool{false, true} {
+		got, err := tac.EvaluateFunction(mod, "@main", []int32{10}, tac.EvalOptions{Sanitize: sanitize})
+		if err != nil {
+			t.Fatalf("evaluate (sanitize %v): %v", sanitize, err)
+		}
+		if got != 285 {
+			t.Fatalf("expected 285, got %d", got)
+		}
+	}
+
+	// objects of 8 bytes are adjacent, end of one is start of next
+	mod = compileString(t, `int main() {
+	int *a = malloc(8);
+	int *b = malloc(8);
+	int *e = malloc(0);
+	*(a + 1) = 2;
+	*b = 5;
+	int sum = *(a + 1) + *b;
+	free(e);
+	free(b);
+	free(a);
+	return sum;
+}`)
+	for _, sanitize := range []bool{false, true} {
+		got, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{Sanitize: sanitize})
+		if err != nil || got != 7 {
+			t.Fatalf("adjacent objects (sanitize %v): expected 7, got %d (%v)", sanitize, got, err)
+		}
+	}
+
+	// program defining malloc and free replaces builtins
+	mod = compileString(t, `int malloc(int n);
+void free(int n);
+int main() {
+	free(2);
+	return malloc(40);
+}
+int malloc(int n) {
+	return n + 2;
+}
+void free(int n) {
+	n = n + 1;
+}`)
+	got, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{Sanitize: true})
+	if err != nil || got != 42 {
+		t.Fatalf("user malloc: expected 42, got %d (%v)", got, err)
+	}
+
+	// freed memory is never reused, so stale pointer faults even without sanitizer
+	mod = compileString(t, `int main() {
+	int *p = malloc(4);
+	*p = 1;
+	free(p);
+	return *p;
+}`)
+	_, err = tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{})
+	var rt *tac.RuntimeError
+	if !errors.As(err, &rt) || rt.Kind != tac.KindMemoryFault {
+		t.Fatalf("expected memory fault, got %v", err)
+	}
+}
+
+func TestCompileAndEvaluate_ResourceBudgets(t *testing.T) {
+	mod := compileString(t, `int depth(int n) {
+	int pad = n;
+	if (n == 0) {
+		return 0;
+	}
+	return depth(n - 1) + 1;
+}
+
+int leak(int n) {
+	while (n > 0) {
+		malloc(1000);
+		n = n - 1;
+	}
+	return 0;
+}`)
+
+	cases := []struct {
+		name     string
+		fn       string
+		arg      int32
+		opts     tac.EvalOptions
+		kind     tac.RuntimeErrorKind
+		minDepth int
+	}{
+		{name: "steps", fn: "@depth", arg: 50, opts: tac.EvalOptions{StepLimit: 100}, kind: tac.KindStepLimit, minDepth: 2},
+		{name: "call depth", fn: "@depth", arg: 50, opts: tac.EvalOptions{MaxCallDepth: 10}, kind: tac.KindCallDepth, minDepth: 10},
+		{name: "stack bytes", fn: "@depth", arg: 50, opts: tac.EvalOptions{MaxStackBytes: 64}, kind: tac.KindStackOverflow, minDepth: 2},
+		{name: "heap bytes", fn: "@leak", arg: 50, opts: tac.EvalOptions{MaxHeapBytes: 4096}, kind: tac.KindHeapExhausted, minDepth: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tac.EvaluateFunction(mod, tc.fn, []int32{tc.arg}, tc.opts)
+			var rt *tac.RuntimeError
+			if !errors.As(err, &rt) || rt.Kind != tc.kind {
+				t.Fatalf("expected %s, got %v", tc.kind, err)
+			}
+			if rt.Stats.Steps == 0 || rt.Stats.MaxDepth < tc.minDepth {
+				t.Fatalf("unexpected stats %+v", rt.Stats)
+			}
+		})
+	}
+
+	// budget is on live bytes, freed memory can be allocated again
+	mod = compileString(t, `int main(int n) {
+	while (n > 0) {
+		free(malloc(1000));
+		n = n - 1;
+	}
+	return 0;
+}`)
+	if _, err := tac.EvaluateFunction(mod, "@main", []int32{50}, tac.EvalOptions{MaxHeapBytes: 1000}); err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+}
+
+func TestCompileAndEvaluate_WithoutSanitizeOverflowWraps(t *testing.T) {
+	mod := compileString(t, `int main() {
+	int x = 2147483647;
+	return x + 1;
+}`)
+	got, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate @main: %v", err)
+	}
+	if got != -2147483648 {
+		t.Fatalf("expected wrapped result, got %d", got)
+	}
+}
+
+func TestCompileAndEvaluate_RuntimeErrorCarriesCallStack(t *testing.T) {
+	src := `int div(int a, int b) {
+	if (a > 0) {
+		return a / b;
+	}
+	return 0;
+}
+int main() {
+	int z = 0;
+	return div(7, z);
+}
+`
+	mod := compileString(t, src)
+	_, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{})
+	var rt *tac.RuntimeError
+	if !errors.As(err, &rt) {
+		t.Fatalf("expected runtime error, got %v", err)
+	}
+	if rt.Kind != tac.KindDivisionByZero || rt.Function != "@div" || rt.Block == "" {
+		t.Fatalf("unexpected error %+v", rt)
+	}
+	if rt.Instruction.Opcode != tac.OpcodeDivS || rt.Instruction.Pos.Line != 3 {
+		t.Fatalf("expected div_s from line 3, got %+v", rt.Instruction)
+	}
+	if len(rt.Operands) != 2 || rt.Operands[0].Value != 7 || rt.Operands[1].Value != 0 {
+		t.Fatalf("unexpected operands %+v", rt.Operands)
+	}
+	if len(rt.Stack) != 2 || rt.Stack[0].Function != "@main" || rt.Stack[1].Index != rt.Index {
+		t.Fatalf("unexpected stack %+v", rt.Stack)
+	}
+
+	var trace strings.Builder
+	if err := rt.WriteTrace(&trace, "div.c"); err != nil {
+		t.Fatalf("write trace: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+	want := []string{
+		"runtime error: division by zero [division by zero]",
+		"",
+		"@div#" + strconv.Itoa(rt.Index) + " in " + rt.Block,
+		"",
+		"\tdiv.c:3:3",
+		"@main#" + strconv.Itoa(rt.Stack[0].Index),
+		"",
+		"\tdiv.c:9:2",
+		"",
+		"",
+	}
+	if len(lines) != len(want) || !strings.HasSuffix(lines[len(lines)-1], "call depth 2, stack 12 bytes, heap 0 bytes") {
+		t.Fatalf("unexpected trace:\n%s", trace.String())
+	}
+	for i, w := range want {
+		if w != "" && lines[i] != w {
+			t.Fatalf("trace line %d: expected %q, got %q", i, w, lines[i])
+		}
+	}
+	if !strings.Contains(lines[3], "div_s") || !strings.Contains(lines[3], "=7 %") || !strings.HasSuffix(lines[3], "=0") {
+		t.Fatalf("expected instruction with operands in trace, got %q", lines[3])
+	}
+	if !strings.Contains(lines[6], "= call @div(") {
+		t.Fatalf("expected call in caller frame, got %q", lines[6])
+	}
+}
+
+func TestCompileAndEvaluate_RuntimeErrorInHeaderShowsItsFile(t *testing.T) {
+	mod := compileFS(t, fstest.MapFS{
+		"bh.h": {Data: []byte("int div(int a, int b) {\n\treturn a / b;\n}\n")},
+		"bm.c": {Data: []byte("#include \"bh.h\"\nint main() {\n\treturn div(1, 0);\n}\n")},
+	}, "bm.c")
+	_, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{})
+	var rt *tac.RuntimeError
+	if !errors.As(err, &rt) {
+		t.Fatalf("expected runtime error, got %v", err)
+	}
+	var trace strings.Builder
+	if err := rt.WriteTrace(&trace, "bm.c"); err != nil {
+		t.Fatalf("write trace: %v", err)
+	}
+	for _, want := range []string{"\tbh.h:2:2\n", "\tbm.c:3:2\n"} {
+		if !strings.Contains(trace.String(), want) {
+			t.Fatalf("expected trace to contain %q, got:\n%s", want, trace.String())
+		}
+	}
+}
+
+const stringSource = `
+int length(char *s) {
+	int n = 0;
+	while (*(s + n) != 0) {
+		n = n + 1;
+	}
+	return n;
+}
+void copy(char *dst, char *src, int n) {
+	int i = 0;
+	while (i < n) {
+		*(dst + i) = *(src + i);
+		i = i + 1;
+	}
+}
+char *last(char *s) {
+	return s + length(s) - 1;
+}
+char first(char *s) {
+	return *s;
+}
+`
+
+func TestMachine_CallWithTypedValuesAndMemory(t *testing.T) {
+	mod := compileString(t, stringSource)
+	newMachine := func(opts tac.EvalOptions) *tac.Machine {
+		t.Helper()
+		m, err := tac.NewMachine(mod, opts)
+		if err != nil {
+			t.Fatalf("new machine: %v", err)
+		}
+		return m
+	}
+
+	m := newMachine(tac.EvalOptions{})
+	s, err := m.AllocBytes([]byte("hello\x00"))
+	if err != nil {
+		t.Fatalf("alloc: %v", err)
+	}
+	if got, err := m.Call("@length", s); err != nil || got != tac.I32(5) {
+		t.Fatalf("length: expected i32 5, got %v (%v)", got, err)
+	}
+
+	m = newMachine(tac.EvalOptions{})
+	src, _ := m.AllocBytes([]byte("copy me"))
+	dst, err := m.Alloc(7, 1)
+	if err != nil {
+		t.Fatalf("alloc: %v", err)
+	}
+	if got, err := m.Call("@copy", dst, src, tac.I32(7)); err != nil || got != tac.Void {
+		t.Fatalf("copy: expected void, got %v (%v)", got, err)
+	}
+	if out, err := m.ReadMemory(dst.Addr(), 7); err != nil || string(out) != "copy me" {
+		t.Fatalf("expected copied bytes, got %q (%v)", out, err)
+	}
+
+	m = newMachine(tac.EvalOptions{})
+	s, _ = m.AllocBytes([]byte("abc\x00"))
+	if got, err := m.Call("@last", s); err != nil || got != tac.Ptr(s.Addr()+2) {
+		t.Fatalf("last: expected %v, got %v (%v)", tac.Ptr(s.Addr()+2), got, err)
+	}
+
+	// second buffer ends where first starts, pointer to first is still of it
+	m = newMachine(tac.EvalOptions{Sanitize: true})
+	s, _ = m.AllocBytes([]byte("hello\x00\x00\x00"))
+	if next, _ := m.AllocBytes([]byte("abc\x00")); next.Addr()+4 != s.Addr() {
+		t.Fatalf("expected adjacent buffers, got %v and %v", next, s)
+	}
+	if got, err := m.Call("@length", s); err != nil || got != tac.I32(5) {
+		t.Fatalf("length of first buffer: expected i32 5, got %v (%v)", got, err)
+	}
+
+	m = newMachine(tac.EvalOptions{})
+	s, _ = m.AllocBytes([]byte{0xff})
+	if got, err := m.Call("@first", s); err != nil || got != tac.I8(-1) {
+		t.Fatalf("first: expected i8 -1, got %v (%v)", got, err)
+	}
+}
+
+func TestMachine_CallRejectsBadValues(t *testing.T) {
+	mod := compileString(t, stringSource)
+
+	m, _ := tac.NewMachine(mod, tac.EvalOptions{})
+	if _, err := m.Call("@length", tac.I32(1)); err == nil || !strings.Contains(err.Error(), "argument %s of type i8* got i32") {
+		t.Fatalf("expected argument type error, got %v", err)
+	}
+
+	// buffer without terminator is read past its end
+	m, _ = tac.NewMachine(mod, tac.EvalOptions{Sanitize: true})
+	s, _ := m.AllocBytes([]byte("abc"))
+	_, err := m.Call("@length", s)
+	var ub *tac.UndefinedBehavior
+	if !errors.As(err, &ub) || ub.Check != "out-of-bounds access" {
+		t.Fatalf("expected out-of-bounds access, got %v", err)
+	}
+
+	m, _ = tac.NewMachine(mod, tac.EvalOptions{})
+	dst, _ := m.Alloc(4, 1)
+	if _, err := m.ReadMemory(dst.Addr(), 4); err == nil || !strings.Contains(err.Error(), "uninitialized") {
+		t.Fatalf("expected uninitialized read error, got %v", err)
+	}
+}
+
+// compileFS compiles file name of fsys, positions of tokens have file names.
+func compileFS(t *testing.T, fsys fstest.MapFS, name string) tac.Module {
+	t.Helper()
+	lex, err := lexer.NewLexerFS(fsys, name, lexer.Options{})
+	if err != nil {
+		t.Fatalf("open source: %v", err)
+	}
+	tu, err := parser.Parse(lex)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	mod, err := sema.Lower(tu)
+	if err != nil {
+		t.Fatalf("lower: %v", err)
+	}
+	return mod
+}
+
+func compileString(t *testing.T, src string) tac.Module {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.c")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open source: %v", err)
+	}
+	defer f.Close()
+
+	tu, err := parser.Parse(lexer.NewLexer(f))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	mod, err := sema.Lower(tu)
+	if err != nil {
+		t.Fatalf("lower: %v", err)
+	}
+	return mod
+}
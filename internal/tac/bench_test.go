@@ -0,0 +1,42 @@
+package tac_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SQLek/wihajster/internal/lexer"
+	"github.com/SQLek/wihajster/internal/parser"
+	"github.com/SQLek/wihajster/internal/sema"
+	"github.com/SQLek/wihajster/internal/tac"
+)
+
+func BenchmarkEvaluateFunction_Fibonacci(b *testing.B) {
+	srcPath := filepath.Join("..", "..", "examples", "fibonacci.c")
+	f, err := os.Open(srcPath)
+	if err != nil {
+		b.Fatalf("open %s: %v", srcPath, err)
+	}
+	defer f.Close()
+	tu, err := parser.Parse(lexer.NewLexer(f))
+	if err != nil {
+		b.Fatalf("parse: %v", err)
+	}
+	mod, err := sema.Lower(tu)
+	if err != nil {
+		b.Fatalf("lower: %v", err)
+	}
+
+	for _, n := range []int32{30, 10000, 1000000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			// fib wraps for large n, loop of it is what is measured
+			opts := tac.EvalOptions{StepLimit: 20*int(n) + 100}
+			for i := 0; i < b.N; i++ {
+				if _, err := tac.EvaluateFunction(mod, "@fib", []int32{n}, opts); err != nil {
+					b.Fatalf("evaluate fib(%d): %v", n, err)
+				}
+			}
+		})
+	}
+}
@@ -16,6 +16,16 @@ func (f *Function) NewStackSlot() Operand {
 	return slot
 }
 
+// SetSourcePos sets position of source construct stamped on instructions added from now on.
+func (f *Function) SetSourcePos(pos SourcePos) {
+	f.pos = pos
+}
+
+func (f *Function) emit(inst Instruction) {
+	inst.Pos = f.pos
+	f.Instructions = append(f.Instructions, inst)
+}
+
 // AddInstruction appends a value-producing operation instruction and returns
 // the generated destination temporary.
 func (f *Function) AddInstruction(opcode Opcode, operands ...Operand) Operand {
@@ -23,7 +33,7 @@ func (f *Function) AddInstruction(opcode Opcode, operands ...Operand) Operand {
 	if opcode == OpcodeAlloca {
 		dst = f.NewStackSlot()
 	}
-	f.Instructions = append(f.Instructions, Instruction{
+	f.emit(Instruction{
 		Kind:           InstructionOp,
 		HasDestination: true,
 		Destination:    dst,
@@ -33,19 +43,32 @@ func (f *Function) AddInstruction(opcode Opcode, operands ...Operand) Operand {
 	return dst
 }
 
+// AddVolatileInstruction appends a value-producing volatile memory access.
+func (f *Function) AddVolatileInstruction(opcode Opcode, operands ...Operand) Operand {
+	dst := f.AddInstruction(opcode, operands...)
+	f.Instructions[len(f.Instructions)-1].Volatile = true
+	return dst
+}
+
 // AddVoidInstruction appends a side-effect operation with no destination.
 func (f *Function) AddVoidInstruction(opcode Opcode, operands ...Operand) {
-	f.Instructions = append(f.Instructions, Instruction{
+	f.emit(Instruction{
 		Kind:     InstructionOp,
 		Opcode:   opcode,
 		Operands: append([]Operand(nil), operands...),
 	})
 }
 
+// AddVolatileVoidInstruction appends a volatile memory access with no destination.
+func (f *Function) AddVolatileVoidInstruction(opcode Opcode, operands ...Operand) {
+	f.AddVoidInstruction(opcode, operands...)
+	f.Instructions[len(f.Instructions)-1].Volatile = true
+}
+
 // AddCall emits a value-producing function call.
 func (f *Function) AddCall(callee Operand, args ...Operand) Operand {
 	dst := f.NewTemp()
-	f.Instructions = append(f.Instructions, Instruction{
+	f.emit(Instruction{
 		Kind:           InstructionOp,
 		HasDestination: true,
 		Destination:    dst,
@@ -58,7 +81,7 @@ func (f *Function) AddCall(callee Operand, args ...Operand) Operand {
 
 // AddCallVoid emits a call with ignored return value.
 func (f *Function) AddCallVoid(callee Operand, args ...Operand) {
-	f.Instructions = append(f.Instructions, Instruction{
+	f.emit(Instruction{
 		Kind:       InstructionOp,
 		Opcode:     OpcodeCall,
 		CallCallee: callee.Text,
@@ -68,17 +91,17 @@ func (f *Function) AddCallVoid(callee Operand, args ...Operand) {
 
 // AddLabel appends a label instruction.
 func (f *Function) AddLabel(label string) {
-	f.Instructions = append(f.Instructions, Instruction{Kind: InstructionLabel, Label: label})
+	f.emit(Instruction{Kind: InstructionLabel, Label: label})
 }
 
 // AddJmp appends an unconditional jump instruction.
 func (f *Function) AddJmp(label string) {
-	f.Instructions = append(f.Instructions, Instruction{Kind: InstructionJmp, TrueLabel: Label(label)})
+	f.emit(Instruction{Kind: InstructionJmp, TrueLabel: Label(label)})
 }
 
 // AddBr appends a conditional branch instruction.
 func (f *Function) AddBr(condition Operand, trueLabel, falseLabel string) {
-	f.Instructions = append(f.Instructions, Instruction{
+	f.emit(Instruction{
 		Kind:       InstructionBr,
 		Condition:  condition,
 		TrueLabel:  Label(trueLabel),
@@ -93,7 +116,7 @@ func (f *Function) AddRet(value Operand) {
 		inst.HasReturnValue = true
 		inst.ReturnValue = value
 	}
-	f.Instructions = append(f.Instructions, inst)
+	f.emit(inst)
 }
 
 // SetBlock appends a label as the current block marker.
@@ -0,0 +1,311 @@
+package tac
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Coverage records executed instructions and branch edges of one module.
+// It can be shared by several evaluations of the module to aggregate them.
+// Line coverage needs source positions, so it is available only for modules lowered from C.
+type Coverage struct {
+	// Calls counts calls of each function.
+	Calls map[string]int64
+	// Blocks counts entries into basic blocks.
+	Blocks BlockCounts
+	// Branches counts edges taken by br instructions.
+	Branches map[BranchEdge]int64
+
+	funcs       []Function
+	hits        map[string][]int64
+	blockStarts map[string]map[int]string
+}
+
+// BranchEdge is true or false edge of br instruction at Index of Function.
+type BranchEdge struct {
+	Function string
+	Index    int
+	Taken    bool
+}
+
+func NewCoverage(mod Module) *Coverage {
+	c := &Coverage{
+		Calls:       map[string]int64{},
+		Blocks:      BlockCounts{},
+		Branches:    map[BranchEdge]int64{},
+		funcs:       mod.Functions,
+		hits:        map[string][]int64{},
+		blockStarts: map[string]map[int]string{},
+	}
+	for _, fn := range mod.Functions {
+		c.hits[fn.Name] = make([]int64, len(fn.Instructions))
+		c.blockStarts[fn.Name] = blockStarts(fn)
+	}
+	return c
+}
+
+// check verifies that coverage was created for module with the same functions.
+func (c *Coverage) check(mod Module) error {
+	if len(mod.Functions) != len(c.funcs) {
+		return fmt.Errorf("coverage was created for different module")
+	}
+	for _, fn := range mod.Functions {
+		if hits, ok := c.hits[fn.Name]; !ok || len(hits) != len(fn.Instructions) {
+			return fmt.Errorf("coverage was created for different module: function %s differs", fn.Name)
+		}
+	}
+	return nil
+}
+
+func (c *Coverage) enter(fn string) {
+	c.Calls[fn]++
+}
+
+func (c *Coverage) step(fn string, index int) {
+	c.hits[fn][index]++
+	if label, ok := c.blockStarts[fn][index]; ok {
+		c.Blocks[BlockRef{Function: fn, Start: index, Label: label}]++
+	}
+}
+
+func (c *Coverage) branch(fn string, index int, taken bool) {
+	c.Branches[BranchEdge{Function: fn, Index: index, Taken: taken}]++
+}
+
+// LineCoverage is execution count of one source line,
+// the highest count of instructions lowered from it.
+type LineCoverage struct {
+	// File is empty when positions have no file, see SourcePos.
+	File  string
+	Line  int
+	Count int64
+}
+
+// Lines returns coverage of every source line that produced instructions, ordered by file and line.
+func (c *Coverage) Lines() []LineCoverage {
+	type fileLine struct {
+		file string
+		line int
+	}
+	counts := map[fileLine]int64{}
+	for _, fn := range c.funcs {
+		for i, inst := range fn.Instructions {
+			if !inst.Pos.IsValid() {
+				continue
+			}
+			key := fileLine{inst.Pos.File, inst.Pos.Line}
+			if n, ok := counts[key]; !ok || c.hits[fn.Name][i] > n {
+				counts[key] = c.hits[fn.Name][i]
+			}
+		}
+	}
+	lines := make([]LineCoverage, 0, len(counts))
+	for key, n := range counts {
+		lines = append(lines, LineCoverage{File: key.file, Line: key.line, Count: n})
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].File != lines[j].File {
+			return lines[i].File < lines[j].File
+		}
+		return lines[i].Line < lines[j].Line
+	})
+	return lines
+}
+
+// branchInstruction is br of function together with its source position.
+type branchInstruction struct {
+	fn    string
+	index int
+	pos   SourcePos
+}
+
+func (c *Coverage) branchInstructions() []branchInstruction {
+	var out []branchInstruction
+	for _, fn := range c.funcs {
+		for i, inst := range fn.Instructions {
+			if inst.Kind == InstructionBr {
+				out = append(out, branchInstruction{fn: fn.Name, index: i, pos: inst.Pos})
+			}
+		}
+	}
+	return out
+}
+
+// functionPos returns position of definition of fn, or of its first positioned instruction, zero if there is none.
+func functionPos(fn Function) SourcePos {
+	if fn.Pos.IsValid() {
+		return fn.Pos
+	}
+	for _, inst := range fn.Instructions {
+		if inst.Pos.IsValid() {
+			return inst.Pos
+		}
+	}
+	return SourcePos{}
+}
+
+// WriteLCOV writes coverage as lcov tracefile readable by genhtml, with record for every
+// source file functions and lines are in. Positions without file are of sourceFile.
+func (c *Coverage) WriteLCOV(w io.Writer, sourceFile string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "TN:")
+
+	fileOf := func(pos SourcePos) string { return cmp.Or(pos.File, sourceFile) }
+	var files []string
+	seen := map[string]bool{}
+	addFile := func(pos SourcePos) {
+		if name := fileOf(pos); !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	for _, fn := range c.funcs {
+		addFile(functionPos(fn))
+	}
+	lines := c.Lines()
+	for _, l := range lines {
+		addFile(SourcePos{File: l.File})
+	}
+	sort.Strings(files)
+
+	branches := c.branchInstructions()
+	for _, file := range files {
+		fmt.Fprintf(bw, "SF:%s\n", file)
+
+		var funcs []Function
+		for _, fn := range c.funcs {
+			if fileOf(functionPos(fn)) == file {
+				funcs = append(funcs, fn)
+			}
+		}
+		hitFuncs := 0
+		for _, fn := range funcs {
+			fmt.Fprintf(bw, "FN:%d,%s\n", functionPos(fn).Line, cName(fn.Name))
+		}
+		for _, fn := range funcs {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", c.Calls[fn.Name], cName(fn.Name))
+			if c.Calls[fn.Name] > 0 {
+				hitFuncs++
+			}
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(funcs), hitFuncs)
+
+		found, hitBranches := 0, 0
+		for _, br := range branches {
+			if fileOf(br.pos) != file {
+				continue
+			}
+			found += 2
+			executed := c.hits[br.fn][br.index] > 0
+			for i, taken := range []bool{true, false} {
+				count := "-"
+				if executed {
+					n := c.Branches[BranchEdge{Function: br.fn, Index: br.index, Taken: taken}]
+					count = strconv.FormatInt(n, 10)
+					if n > 0 {
+						hitBranches++
+					}
+				}
+				fmt.Fprintf(bw, "BRDA:%d,%d,%d,%s\n", br.pos.Line, br.index, i, count)
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", found, hitBranches)
+
+		found, hitLines := 0, 0
+		for _, l := range lines {
+			if fileOf(SourcePos{File: l.File}) != file {
+				continue
+			}
+			found++
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.Line, l.Count)
+			if l.Count > 0 {
+				hitLines++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\n", found, hitLines)
+		fmt.Fprintln(bw, "end_of_record")
+	}
+	return bw.Flush()
+}
+
+// WriteSummary writes covered fraction of lines, branches and functions, followed by lines never executed,
+// prefixed with file name when positions have one.
+func (c *Coverage) WriteSummary(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	lines := c.Lines()
+	var missedFiles []string
+	missed := map[string][]int{}
+	missedLines := 0
+	for _, l := range lines {
+		if l.Count == 0 {
+			if _, ok := missed[l.File]; !ok {
+				missedFiles = append(missedFiles, l.File)
+			}
+			missed[l.File] = append(missed[l.File], l.Line)
+			missedLines++
+		}
+	}
+	branches := c.branchInstructions()
+	hitBranches := 0
+	for _, br := range branches {
+		for _, taken := range []bool{true, false} {
+			if c.Branches[BranchEdge{Function: br.fn, Index: br.index, Taken: taken}] > 0 {
+				hitBranches++
+			}
+		}
+	}
+	hitFuncs := 0
+	for _, fn := range c.funcs {
+		if c.Calls[fn.Name] > 0 {
+			hitFuncs++
+		}
+	}
+
+	fmt.Fprintf(bw, "lines:     %s\n", percent(len(lines)-missedLines, len(lines)))
+	fmt.Fprintf(bw, "branches:  %s\n", percent(hitBranches, 2*len(branches)))
+	fmt.Fprintf(bw, "functions: %s\n", percent(hitFuncs, len(c.funcs)))
+	for _, file := range missedFiles {
+		if file == "" {
+			fmt.Fprintf(bw, "not executed: lines %s\n", lineRanges(missed[file]))
+		} else {
+			fmt.Fprintf(bw, "not executed: %s lines %s\n", file, lineRanges(missed[file]))
+		}
+	}
+	return bw.Flush()
+}
+
+func percent(hit, total int) string {
+	if total == 0 {
+		return "0/0"
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%)", hit, total, 100*float64(hit)/float64(total))
+}
+
+// lineRanges formats sorted lines compactly, e.g. "3, 7-9".
+func lineRanges(lines []int) string {
+	var parts []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(lines[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cName strips TAC symbol prefix, lcov expects C function names.
+func cName(name string) string {
+	return strings.TrimPrefix(name, "@")
+}
@@ -0,0 +1,114 @@
+package tac_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/SQLek/wihajster/internal/tac"
+)
+
+const coveredSource = `int clamp(int v) {
+	if (v > 10) {
+		return 10;
+	}
+	return v;
+}
+int main() {
+	return 0;
+}
+`
+
+func TestCoverage_AggregatesRuns(t *testing.T) {
+	mod := compileString(t, coveredSource)
+	cov := tac.NewCoverage(mod)
+	for _, v := range []int32{3, 4} {
+		if _, err := tac.EvaluateFunction(mod, "@clamp", []int32{v}, tac.EvalOptions{Coverage: cov}); err != nil {
+			t.Fatalf("evaluate clamp(%d): %v", v, err)
+		}
+	}
+
+	if cov.Calls["@clamp"] != 2 || cov.Calls["@main"] != 0 {
+		t.Fatalf("unexpected calls %v", cov.Calls)
+	}
+	lines := map[int]int64{}
+	for _, l := range cov.Lines() {
+		lines[l.Line] = l.Count
+	}
+	if lines[2] != 2 || lines[3] != 0 || lines[5] != 2 || lines[8] != 0 {
+		t.Fatalf("unexpected line counts %v", lines)
+	}
+
+	var summary strings.Builder
+	if err := cov.WriteSummary(&summary); err != nil {
+		t.Fatalf("write summary: %v", err)
+	}
+	for _, want := range []string{"branches:  1/2 (50.0%)", "functions: 1/2 (50.0%)", "not executed: lines 3, 8"} {
+		if !strings.Contains(summary.String(), want) {
+			t.Fatalf("expected summary to contain %q, got:\n%s", want, summary.String())
+		}
+	}
+
+	if _, err := tac.EvaluateFunction(mod, "@clamp", []int32{11}, tac.EvalOptions{Coverage: cov}); err != nil {
+		t.Fatalf("evaluate clamp(11): %v", err)
+	}
+	var lcov strings.Builder
+	if err := cov.WriteLCOV(&lcov, "clamp.c"); err != nil {
+		t.Fatalf("write lcov: %v", err)
+	}
+	for _, want := range []string{"SF:clamp.c\n", "FN:1,clamp\n", "FNDA:3,clamp\n", "FNDA:0,main\n", "DA:3,1\n", "DA:8,0\n", "BRF:2\nBRH:2\n", "end_of_record\n"} {
+		if !strings.Contains(lcov.String(), want) {
+			t.Fatalf("expected lcov to contain %q, got:\n%s", want, lcov.String())
+		}
+	}
+	if !strings.Contains(lcov.String(), ",0,1\n") || !strings.Contains(lcov.String(), ",1,2\n") {
+		t.Fatalf("expected true edge taken once and false edge twice, got:\n%s", lcov.String())
+	}
+}
+
+func TestCoverage_RecordPerSourceFile(t *testing.T) {
+	mod := compileFS(t, fstest.MapFS{
+		"hh.h":   {Data: []byte("int helper(int v) {\n\treturn v + 1;\n}\n")},
+		"covi.c": {Data: []byte("#include \"hh.h\"\nint main() {\n\tif (0) {\n\t\treturn 1;\n\t}\n\treturn helper(1);\n}\n")},
+	}, "covi.c")
+	cov := tac.NewCoverage(mod)
+	if _, err := tac.EvaluateFunction(mod, "@main", nil, tac.EvalOptions{Coverage: cov}); err != nil {
+		t.Fatalf("evaluate main: %v", err)
+	}
+
+	var lcov strings.Builder
+	if err := cov.WriteLCOV(&lcov, "covi.c"); err != nil {
+		t.Fatalf("write lcov: %v", err)
+	}
+	records := strings.Split(strings.TrimSuffix(lcov.String(), "end_of_record\n"), "end_of_record\n")
+	if len(records) != 2 {
+		t.Fatalf("expected record of each file, got:\n%s", lcov.String())
+	}
+	for _, want := range []string{"SF:covi.c\n", "FN:2,main\n", "FNF:1\n", "BRF:2\n", "DA:4,0\n", "DA:6,1\n"} {
+		if !strings.Contains(records[0], want) {
+			t.Fatalf("expected record of covi.c to contain %q, got:\n%s", want, records[0])
+		}
+	}
+	for _, want := range []string{"SF:hh.h\n", "FN:1,helper\n", "FNDA:1,helper\n", "BRF:0\n", "DA:2,1\n", "LF:2\n"} {
+		if !strings.Contains(records[1], want) {
+			t.Fatalf("expected record of hh.h to contain %q, got:\n%s", want, records[1])
+		}
+	}
+
+	var summary strings.Builder
+	if err := cov.WriteSummary(&summary); err != nil {
+		t.Fatalf("write summary: %v", err)
+	}
+	if !strings.Contains(summary.String(), "not executed: covi.c lines 4\n") {
+		t.Fatalf("expected missed line with file, got:\n%s", summary.String())
+	}
+}
+
+func TestCoverage_RejectsDifferentModule(t *testing.T) {
+	cov := tac.NewCoverage(compileString(t, coveredSource))
+	other := compileString(t, "int main() {\n\treturn 1;\n}\n")
+	_, err := tac.EvaluateFunction(other, "@main", nil, tac.EvalOptions{Coverage: cov})
+	if err == nil || !strings.Contains(err.Error(), "different module") {
+		t.Fatalf("expected different module error, got %v", err)
+	}
+}
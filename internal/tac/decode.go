@@ -0,0 +1,191 @@
+package tac
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compiledFunction is Function decoded once per evaluation, so steps do not parse text:
+// values are resolved to frame slots or constants and labels to instruction indices.
+type compiledFunction struct {
+	Function
+	// names of frame slots, parameters first, then destinations in order of definition
+	names []string
+	code  []decodedInst
+	// allocas is number of alloca instructions, each owns one stack object per frame
+	allocas int
+}
+
+const (
+	operandConst   = -1
+	operandUnknown = -2
+)
+
+// operand is decoded value operand, name is kept for errors and tracing.
+type operand struct {
+	// slot is index of frame value, operandConst or operandUnknown
+	slot  int
+	value runtimeValue
+	name  string
+}
+
+type decodedInst struct {
+	// ops mirror Instruction.Operands; for br it is condition, for ret return value
+	ops      []operand
+	callArgs []operand
+	// reads are slot operands reported to tracer, see readOperands
+	reads []operand
+	// dst is slot of destination, -1 if there is none
+	dst int
+	// target and alt are indices of jmp/br labels, alt is false edge of br; -1 if label is missing
+	target, alt int
+
+	// imm is constant of const.* and scale of gep
+	imm runtimeValue
+	// size is allocated size of alloca and access width of memory operations
+	size int
+	// alloca is ordinal of alloca instruction
+	alloca int
+	// callee is module function called, nil for host functions
+	callee *compiledFunction
+	// err is invalid immediate, reported when instruction executes
+	err error
+}
+
+// compileModule decodes validated functions. Callees are linked by name,
+// so mutually recursive functions work.
+func compileModule(mod Module) map[string]*compiledFunction {
+	funcs := make(map[string]*compiledFunction, len(mod.Functions))
+	for _, fn := range mod.Functions {
+		funcs[fn.Name] = &compiledFunction{Function: fn}
+	}
+	for _, cf := range funcs {
+		cf.decode(funcs)
+	}
+	return funcs
+}
+
+func (cf *compiledFunction) decode(funcs map[string]*compiledFunction) {
+	slots := map[string]int{}
+	addSlot := func(name string) int {
+		if slot, ok := slots[name]; ok {
+			return slot
+		}
+		slot := len(cf.names)
+		slots[name] = slot
+		cf.names = append(cf.names, name)
+		return slot
+	}
+	for _, p := range cf.Parameters {
+		addSlot(p.Name)
+	}
+	labels := map[string]int{}
+	for i, inst := range cf.Instructions {
+		if inst.HasDestination {
+			addSlot(strings.TrimSpace(inst.Destination.Text))
+		}
+		if inst.Kind == InstructionLabel {
+			labels[inst.Label] = i
+		}
+	}
+
+	value := func(text string) operand {
+		text = strings.TrimSpace(text)
+		if slot, ok := slots[text]; ok {
+			return operand{slot: slot, name: text}
+		}
+		if n, err := strconv.ParseInt(text, 10, 32); err == nil {
+			return operand{slot: operandConst, value: runtimeValue{kind: valueI32, i32: int32(n)}, name: text}
+		}
+		return operand{slot: operandUnknown, name: text}
+	}
+	target := func(label string) int {
+		if i, ok := labels[label]; ok {
+			return i
+		}
+		return -1
+	}
+
+	cf.code = make([]decodedInst, len(cf.Instructions))
+	for i, inst := range cf.Instructions {
+		d := decodedInst{dst: -1, target: -1, alt: -1}
+		if inst.HasDestination {
+			d.dst = slots[strings.TrimSpace(inst.Destination.Text)]
+		}
+		for _, name := range readOperands(inst) {
+			if o := value(name); o.slot >= 0 {
+				d.reads = append(d.reads, o)
+			}
+		}
+
+		switch inst.Kind {
+		case InstructionJmp:
+			d.target = target(inst.TrueLabel.Text)
+		case InstructionBr:
+			d.ops = []operand{value(inst.Condition.Text)}
+			d.target = target(inst.TrueLabel.Text)
+			d.alt = target(inst.FalseLabel.Text)
+		case InstructionRet:
+			if inst.HasReturnValue {
+				d.ops = []operand{value(inst.ReturnValue.Text)}
+			}
+		case InstructionOp:
+			for _, op := range inst.Operands {
+				d.ops = append(d.ops, value(op.Text))
+			}
+			for _, arg := range inst.CallArgs {
+				d.callArgs = append(d.callArgs, value(arg.Text))
+			}
+			d.decodeOp(inst)
+			if inst.Opcode == OpcodeAlloca {
+				d.alloca = cf.allocas
+				cf.allocas++
+			}
+			if inst.Opcode == OpcodeCall {
+				d.callee = funcs[inst.CallCallee]
+			}
+		}
+		cf.code[i] = d
+	}
+}
+
+// decodeOp parses immediates of operation, ones evaluator would reject are kept in err.
+func (d *decodedInst) decodeOp(inst Instruction) {
+	ops := inst.Operands
+	switch inst.Opcode {
+	case OpcodeConstI32:
+		if len(ops) != 1 {
+			return
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(ops[0].Text), 10, 32)
+		if err != nil {
+			d.err = fmt.Errorf("invalid const.i32 operand %q", ops[0].Text)
+		}
+		d.imm = runtimeValue{kind: valueI32, i32: int32(n)}
+	case OpcodeConstI8:
+		if len(ops) != 1 {
+			return
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(ops[0].Text), 10, 8)
+		if err != nil {
+			d.err = fmt.Errorf("invalid const.i8 operand %q", ops[0].Text)
+		}
+		d.imm = runtimeValue{kind: valueI32, i32: int32(int8(n))}
+	case OpcodeAlloca:
+		if len(ops) == 1 {
+			d.size = typeSize(ops[0].Text)
+		}
+	case OpcodeLoad, OpcodeLoadIndirect, OpcodeStore, OpcodeStoreIndirect:
+		d.size = typeSize(inst.AccessType())
+	case OpcodeGep:
+		if len(ops) != 3 {
+			return
+		}
+		scale, err := strconv.Atoi(strings.TrimSpace(ops[2].Text))
+		if err != nil {
+			d.err = fmt.Errorf("invalid gep element size %q", ops[2].Text)
+		}
+		d.imm = runtimeValue{kind: valueI32, i32: int32(scale)}
+	}
+}
@@ -0,0 +1,153 @@
+package tac
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Device is a memory-mapped peripheral occupying addresses [Base, Base+Size).
+// Callbacks receive absolute address and access width in bytes.
+// Nil Load or Store makes device write-only or read-only.
+type Device struct {
+	Name  string
+	Base  int
+	Size  int
+	Load  func(addr, size int) (int32, error)
+	Store func(addr, size int, value int32) error
+}
+
+func (d Device) contains(addr int) bool {
+	return addr >= d.Base && addr < d.Base+d.Size
+}
+
+func (d Device) end() int {
+	return d.Base + d.Size
+}
+
+// checkDevices rejects empty device ranges and ranges overlapping each other, stack or heap region.
+func checkDevices(devices []Device, stackBytes int) error {
+	sorted := append([]Device(nil), devices...)
+	sorted = append(sorted, Device{Name: "stack", Base: stackBase, Size: stackBytes}, Device{Name: "heap", Base: heapBase, Size: heapLimit - heapBase})
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Base < sorted[j].Base })
+	for i, dev := range sorted {
+		if dev.Size <= 0 {
+			return fmt.Errorf("device %s has empty address range", dev.Name)
+		}
+		if i > 0 && sorted[i-1].end() > dev.Base {
+			return fmt.Errorf("device %s at %#x overlaps %s at %#x", dev.Name, dev.Base, sorted[i-1].Name, sorted[i-1].Base)
+		}
+	}
+	return nil
+}
+
+func (s *evalState) device(addr int) (Device, bool) {
+	for _, dev := range s.devices {
+		if dev.contains(addr) {
+			return dev, true
+		}
+	}
+	return Device{}, false
+}
+
+// loadIndirect reads through pointer from device mapped at address or from stack memory.
+func (s *evalState) loadIndirect(addr, size int) (runtimeValue, error) {
+	dev, ok := s.device(addr)
+	if !ok {
+		return s.loadMemory(addr, size)
+	}
+	if err := checkDeviceAccess(dev, addr, size, "load"); err != nil {
+		return runtimeValue{}, err
+	}
+	if dev.Load == nil {
+		return runtimeValue{}, &MemoryFault{Access: "load", Addr: addr, Size: size, Reason: "write-only device " + dev.Name}
+	}
+	v, err := dev.Load(addr, size)
+	if err != nil {
+		return runtimeValue{}, runtimeErrorf(KindDevice, "device %s load at %#x: %w", dev.Name, addr, err)
+	}
+	if size == 1 {
+		v = int32(int8(v))
+	}
+	return runtimeValue{kind: valueI32, i32: v}, nil
+}
+
+// storeIndirect writes through pointer to device mapped at address or to stack memory.
+func (s *evalState) storeIndirect(addr, size int, v runtimeValue) error {
+	dev, ok := s.device(addr)
+	if !ok {
+		return s.storeMemory(addr, size, v)
+	}
+	if err := checkDeviceAccess(dev, addr, size, "store"); err != nil {
+		return err
+	}
+	if dev.Store == nil {
+		return &MemoryFault{Access: "store", Addr: addr, Size: size, Reason: "read-only device " + dev.Name}
+	}
+	if v.kind != valueI32 {
+		return fmt.Errorf("store of pointer to device %s at %#x", dev.Name, addr)
+	}
+	value := v.i32
+	if size == 1 {
+		value = int32(int8(value))
+	}
+	if err := dev.Store(addr, size, value); err != nil {
+		return runtimeErrorf(KindDevice, "device %s store at %#x: %w", dev.Name, addr, err)
+	}
+	return nil
+}
+
+func checkDeviceAccess(dev Device, addr, size int, access string) error {
+	if addr%size != 0 {
+		return &MemoryFault{Access: access, Addr: addr, Size: size, Reason: "misaligned"}
+	}
+	if addr+size > dev.end() {
+		return &MemoryFault{Access: access, Addr: addr, Size: size, Reason: "crosses end of device " + dev.Name}
+	}
+	return nil
+}
+
+const (
+	// UARTBase is address of first UART of QEMU virt machine.
+	UARTBase = 0x10000000
+
+	uartSize = 8
+	uartTHR  = 0
+	uartLSR  = 5
+	// transmitter holding register and transmitter are both empty
+	uartLSRIdle = 0x60
+)
+
+// UART emulates transmit side of 16550 UART found on QEMU virt machine.
+// Bytes written to transmit register are collected in buffer.
+type UART struct {
+	out bytes.Buffer
+}
+
+// Device maps UART registers at UARTBase.
+func (u *UART) Device() Device {
+	return Device{Name: "uart0", Base: UARTBase, Size: uartSize, Load: u.load, Store: u.store}
+}
+
+// Bytes returns everything transmitted so far.
+func (u *UART) Bytes() []byte {
+	return u.out.Bytes()
+}
+
+func (u *UART) String() string {
+	return u.out.String()
+}
+
+func (u *UART) load(addr, size int) (int32, error) {
+	if addr-UARTBase == uartLSR {
+		return uartLSRIdle, nil
+	}
+	return 0, nil
+}
+
+func (u *UART) store(addr, size int, value int32) error {
+	if addr-UARTBase == uartTHR {
+		u.out.WriteByte(byte(value))
+	}
+	return nil
+}
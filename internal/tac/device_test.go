@@ -0,0 +1,168 @@
+package tac
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateFunction_DeviceReceivesAccessWidth(t *testing.T) {
+	input := `.tac v1
+
+func @main() -> i32 {
+.L0:
+  %t0 = bitcast 268435456, i8*
+  store.ind volatile %t0, 200, i8
+  %t1 = bitcast 268435460, i32*
+  %t2 = load.ind volatile %t1
+  ret %t2
+}
+`
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+
+	var stores []int
+	dev := Device{
+		Name: "regs",
+		Base: 0x10000000,
+		Size: 8,
+		Load: func(addr, size int) (int32, error) {
+			return int32(addr - 0x10000000 + size), nil
+		},
+		Store: func(addr, size int, value int32) error {
+			stores = append(stores, addr, size, int(value))
+			return nil
+		},
+	}
+	got, err := EvaluateFunction(mod, "@main", nil, EvalOptions{Devices: []Device{dev}})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if got != 8 {
+		t.Fatalf("expected load of offset 4 with width 4, got %d", got)
+	}
+	want := []int{0x10000000, 1, -56}
+	if len(stores) != len(want) || stores[0] != want[0] || stores[1] != want[1] || stores[2] != want[2] {
+		t.Fatalf("expected store %v, got %v", want, stores)
+	}
+}
+
+func TestEvaluateFunction_UARTCollectsTransmittedBytes(t *testing.T) {
+	input := `.tac v1
+
+func @main() -> i32 {
+.L0:
+  %t0 = bitcast 268435456, i8*
+  store.ind volatile %t0, 104, i8
+  store.ind volatile %t0, 105, i8
+  %t1 = gep %t0, 5, 1
+  %t2 = load.ind volatile %t1, i8
+  ret %t2
+}
+`
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+
+	var uart UART
+	got, err := EvaluateFunction(mod, "@main", nil, EvalOptions{Devices: []Device{uart.Device()}})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if got != uartLSRIdle {
+		t.Fatalf("expected idle line status %#x, got %#x", uartLSRIdle, got)
+	}
+	if uart.String() != "hi" {
+		t.Fatalf("expected UART output %q, got %q", "hi", uart.String())
+	}
+}
+
+func TestEvaluateFunction_ReportsMemoryFaultAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		addr   int
+		reason string
+	}{
+		{
+			name:   "unmapped",
+			body:   "%t0 = bitcast 4096, i32*\n  %t1 = load.ind %t0",
+			addr:   0x1000,
+			reason: "unmapped address",
+		},
+		{
+			name:   "write-only device",
+			body:   "%t0 = bitcast 536870912, i32*\n  %t1 = load.ind %t0",
+			addr:   0x20000000,
+			reason: "write-only device sink",
+		},
+		{
+			name:   "crossing device end",
+			body:   "%t0 = bitcast 536870916, i32*\n  store.ind %t0, 1",
+			addr:   0x20000004,
+			reason: "crosses end of device sink",
+		},
+	}
+
+	sink := Device{
+		Name:  "sink",
+		Base:  0x20000000,
+		Size:  6,
+		Store: func(addr, size int, value int32) error { return nil },
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			input := ".tac v1\n\nfunc @main() -> i32 {\n.L0:\n  " + tc.body + "\n  ret 0\n}\n"
+			mod, err := ParseModule(strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("parse module: %v", err)
+			}
+
+			_, err = EvaluateFunction(mod, "@main", nil, EvalOptions{Devices: []Device{sink}})
+			var fault *MemoryFault
+			if !errors.As(err, &fault) {
+				t.Fatalf("expected memory fault, got %v", err)
+			}
+			if fault.Addr != tc.addr || fault.Reason != tc.reason {
+				t.Fatalf("expected fault at %#x (%s), got %v", tc.addr, tc.reason, fault)
+			}
+		})
+	}
+}
+
+func TestEvaluateFunction_RejectsOverlappingDevices(t *testing.T) {
+	mod := Module{Functions: []Function{{Name: "@main", ReturnType: "i32"}}}
+	tests := []struct {
+		name    string
+		devices []Device
+		msg     string
+	}{
+		{
+			name:    "two devices",
+			devices: []Device{{Name: "a", Base: 0x100, Size: 8}, {Name: "b", Base: 0x104, Size: 8}},
+			msg:     "device b at 0x104 overlaps a at 0x100",
+		},
+		{
+			name:    "stack region",
+			devices: []Device{{Name: "ram", Base: stackBase + 16, Size: 4}},
+			msg:     "device ram at 0x80000010 overlaps stack",
+		},
+		{
+			name:    "empty range",
+			devices: []Device{{Name: "empty", Base: 0x100}},
+			msg:     "device empty has empty address range",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := EvaluateFunction(mod, "@main", nil, EvalOptions{Devices: tc.devices})
+			if err == nil || !strings.Contains(err.Error(), tc.msg) {
+				t.Fatalf("expected error containing %q, got %v", tc.msg, err)
+			}
+		})
+	}
+}
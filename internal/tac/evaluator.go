@@ -1,19 +1,47 @@
 package tac
 
 import (
+	"context"
 	"fmt"
-	"strconv"
 	"strings"
 )
 
 type EvalOptions struct {
 	StepLimit    int
 	MaxCallDepth int
+	// MaxStackBytes is size of stack region, 64 KiB by default.
+	MaxStackBytes int
+	// MaxHeapBytes bounds bytes of live objects allocated by malloc, 1 MiB by default.
+	MaxHeapBytes int
+
+	// Devices map address ranges to callbacks, consulted by load.ind and store.ind.
+	// Ranges cannot overlap each other, stack or heap region.
+	Devices []Device
+
+	// HostFuncs are called for functions missing in module, keyed by symbol (e.g. "@putchar").
+	HostFuncs map[string]HostFunc
+
+	// Tracer, if set, receives every executed instruction with its operand values.
+	Tracer Tracer
+	// Profile, if set, accumulates step counts. It can be shared by several evaluations.
+	Profile *Profile
+	// Coverage, if set, records executed instructions and branch edges.
+	// It must be created for evaluated module and can be shared by several evaluations.
+	Coverage *Coverage
+
+	// Sanitize traps on undefined behavior instead of executing it with wrapping semantics,
+	// see UndefinedBehavior.
+	Sanitize bool
 }
 
 const (
 	defaultStepLimit    = 100000
 	defaultMaxCallDepth = 128
+
+	// maxStackBytes keeps stack below heap region.
+	maxStackBytes = heapBase - stackBase
+	// cancelCheckInterval is number of steps between checks of context.
+	cancelCheckInterval = 1024
 )
 
 type runtimeValueKind int
@@ -27,158 +55,314 @@ type runtimeValue struct {
 	kind runtimeValueKind
 	i32  int32
 	ptr  int
-}
-
-type memoryCell struct {
-	value       runtimeValue
-	initialized bool
+	// obj is stack object pointer was derived from, nil if unknown.
+	obj *allocation
 }
 
 type evalState struct {
 	mod          Module
-	funcs        map[string]Function
+	funcs        map[string]*compiledFunction
 	steps        int
 	stepLimit    int
 	maxCallDepth int
+	maxHeapBytes int
+	// maxDepth is deepest call nesting so far
+	maxDepth int
+	devices  []Device
+	memory   *memory
+	// heap is created by first malloc or free
+	heap      *heap
+	hostFuncs map[string]HostFunc
+	tracer    Tracer
+	profile   *Profile
+	coverage  *Coverage
+	frames    []*evalFrame
+	sanitize  bool
+	// slotTypes caches types of stack slots per function, see frameInfo
+	slotTypes map[string]map[string]string
+
+	done   bool
+	result runtimeValue
 }
 
 type evalFrame struct {
-	fn       Function
-	values   map[string]runtimeValue
-	memory   map[int]memoryCell
-	nextAddr int
-	labels   map[string]int
+	fn *compiledFunction
+	// values are indexed by slot of compiledFunction, defined marks assigned ones
+	values  []runtimeValue
+	defined []bool
+	// allocas are stack objects of executed alloca instructions, by ordinal
+	allocas []*allocation
+	// pc is index of instruction being executed
+	pc int
+	// sp is stack pointer to restore on return
+	sp int
+	// callers identifies call stack in profile samples
+	callers string
+	// pending holds traced operands of call waiting for callee to return
+	pending []TraceValue
 }
 
 func EvaluateFunction(mod Module, functionName string, args []int32, opts EvalOptions) (int32, error) {
+	return EvaluateFunctionContext(context.Background(), mod, functionName, args, opts)
+}
+
+// EvaluateFunctionContext is EvaluateFunction stopped when ctx is done,
+// with RuntimeError of KindCanceled wrapping ctx.Err().
+func EvaluateFunctionContext(ctx context.Context, mod Module, functionName string, args []int32, opts EvalOptions) (int32, error) {
+	m, err := NewMachine(mod, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.Start(functionName, args); err != nil {
+		return 0, err
+	}
+	if err := m.Run(ctx); err != nil {
+		return 0, err
+	}
+	return m.Result()
+}
+
+func newEvalState(mod Module, opts EvalOptions) (*evalState, error) {
 	if opts.StepLimit <= 0 {
 		opts.StepLimit = defaultStepLimit
 	}
 	if opts.MaxCallDepth <= 0 {
 		opts.MaxCallDepth = defaultMaxCallDepth
 	}
+	if opts.MaxStackBytes <= 0 {
+		opts.MaxStackBytes = stackSize
+	}
+	if opts.MaxStackBytes > maxStackBytes {
+		return nil, fmt.Errorf("stack of %d bytes exceeds maximum of %d", opts.MaxStackBytes, maxStackBytes)
+	}
+	if opts.MaxHeapBytes <= 0 {
+		opts.MaxHeapBytes = defaultMaxHeapBytes
+	}
+
+	if err := checkDevices(opts.Devices, opts.MaxStackBytes); err != nil {
+		return nil, err
+	}
 
-	funcs := make(map[string]Function, len(mod.Functions))
 	for _, fn := range mod.Functions {
 		if err := ValidateFunctionIR(fn); err != nil {
-			return 0, err
+			return nil, err
+		}
+	}
+
+	if opts.Coverage != nil {
+		if err := opts.Coverage.check(mod); err != nil {
+			return nil, err
 		}
-		funcs[fn.Name] = fn
 	}
 
-	st := &evalState{
+	mem := newMemory(stackBase, opts.MaxStackBytes)
+	mem.sanitize = opts.Sanitize
+	return &evalState{
 		mod:          mod,
-		funcs:        funcs,
+		funcs:        compileModule(mod),
 		stepLimit:    opts.StepLimit,
 		maxCallDepth: opts.MaxCallDepth,
+		maxHeapBytes: opts.MaxHeapBytes,
+		devices:      opts.Devices,
+		memory:       mem,
+		hostFuncs:    opts.HostFuncs,
+		tracer:       opts.Tracer,
+		profile:      opts.Profile,
+		coverage:     opts.Coverage,
+		sanitize:     opts.Sanitize,
+		slotTypes:    map[string]map[string]string{},
+	}, nil
+}
+
+// enter pushes frame of module function. Host functions are not entered, see callExternal.
+func (s *evalState) enter(fn *compiledFunction, args []runtimeValue) error {
+	if len(s.frames) >= s.maxCallDepth {
+		return runtimeErrorf(KindCallDepth, "maximum call depth exceeded at %s", fn.Name)
+	}
+	if len(args) != len(fn.Parameters) {
+		return fmt.Errorf("function %s expects %d arguments, got %d", fn.Name, len(fn.Parameters), len(args))
 	}
 
-	callArgs := make([]runtimeValue, 0, len(args))
-	for _, a := range args {
-		callArgs = append(callArgs, runtimeValue{kind: valueI32, i32: a})
+	frame := &evalFrame{
+		fn:      fn,
+		values:  make([]runtimeValue, len(fn.names)),
+		defined: make([]bool, len(fn.names)),
+		allocas: make([]*allocation, fn.allocas),
+		// allocas of frame are released on return
+		sp: s.memory.sp,
 	}
-	ret, err := st.evalCall(functionName, callArgs, 0)
-	if err != nil {
-		return 0, err
+	if s.profile != nil {
+		frame.callers = s.profile.enter(fn.Function, s.frames)
+	}
+	if s.coverage != nil {
+		s.coverage.enter(fn.Name)
 	}
-	if ret.kind != valueI32 {
-		return 0, fmt.Errorf("function %s returned non-i32 value", functionName)
+	// parameters occupy first slots
+	for i := range fn.Parameters {
+		frame.set(i, args[i])
 	}
-	return ret.i32, nil
+	s.frames = append(s.frames, frame)
+	s.maxDepth = max(s.maxDepth, len(s.frames))
+	return nil
 }
 
-func (s *evalState) evalCall(functionName string, args []runtimeValue, depth int) (runtimeValue, error) {
-	if depth >= s.maxCallDepth {
-		return runtimeValue{}, fmt.Errorf("maximum call depth exceeded at %s", functionName)
+// leave pops innermost frame and completes call instruction of its caller.
+func (s *evalState) leave(ret runtimeValue) {
+	frame := s.frames[len(s.frames)-1]
+	s.memory.release(frame.sp)
+	s.frames = s.frames[:len(s.frames)-1]
+	if len(s.frames) == 0 {
+		s.done = true
+		s.result = ret
+		return
 	}
 
-	fn, ok := s.funcs[functionName]
-	if !ok {
-		return runtimeValue{}, fmt.Errorf("missing function %s", functionName)
-	}
-	if len(args) != len(fn.Parameters) {
-		return runtimeValue{}, fmt.Errorf("function %s expects %d arguments, got %d", functionName, len(fn.Parameters), len(args))
+	caller := s.frames[len(s.frames)-1]
+	inst := &caller.fn.Instructions[caller.pc]
+	if d := &caller.fn.code[caller.pc]; d.dst >= 0 {
+		caller.set(d.dst, ret)
+		s.trace(caller, inst, caller.pending, &ret)
+	} else {
+		s.trace(caller, inst, caller.pending, nil)
 	}
+	caller.pending = nil
+	caller.pc++
+}
 
-	frame := evalFrame{
-		fn:     fn,
-		values: map[string]runtimeValue{},
-		memory: map[int]memoryCell{},
-		labels: map[string]int{},
+// step executes one instruction of innermost frame.
+func (s *evalState) step() error {
+	frame := s.frames[len(s.frames)-1]
+	pc := frame.pc
+	if err := s.exec(frame); err != nil {
+		return s.runtimeError(err, frame, pc)
 	}
+	return nil
+}
 
-	for i, p := range fn.Parameters {
-		frame.values[p.Name] = args[i]
+func (s *evalState) exec(frame *evalFrame) error {
+	fn := frame.fn
+	functionName := fn.Name
+	pc := frame.pc
+	if pc >= len(fn.code) {
+		return fmt.Errorf("function %s ended without ret", functionName)
 	}
-	for i, inst := range fn.Instructions {
-		if inst.Kind == InstructionLabel {
-			frame.labels[inst.Label] = i
-		}
+
+	s.steps++
+	if s.steps > s.stepLimit {
+		return runtimeErrorf(KindStepLimit, "step limit exceeded while evaluating %s", functionName)
 	}
 
-	pc := 0
-	for pc < len(fn.Instructions) {
-		s.steps++
-		if s.steps > s.stepLimit {
-			return runtimeValue{}, fmt.Errorf("step limit exceeded while evaluating %s", functionName)
+	inst := &fn.Instructions[pc]
+	d := &fn.code[pc]
+	if s.profile != nil {
+		s.profile.step(functionName, frame.callers, pc, *inst)
+	}
+	if s.coverage != nil {
+		s.coverage.step(functionName, pc)
+	}
+	var traced []TraceValue
+	if s.tracer != nil {
+		traced = frame.traceOperands(d)
+	}
+	switch inst.Kind {
+	case InstructionLabel:
+		frame.pc++
+	case InstructionJmp:
+		s.trace(frame, inst, traced, nil)
+		if d.target < 0 {
+			return fmt.Errorf("invalid jump label %s in %s", inst.TrueLabel.Text, functionName)
+		}
+		frame.pc = d.target
+	case InstructionBr:
+		cond, err := frame.i32(d.ops[0])
+		if err != nil {
+			return err
 		}
-
-		inst := fn.Instructions[pc]
-		switch inst.Kind {
-		case InstructionLabel:
-			pc++
-		case InstructionJmp:
-			next, ok := frame.labels[inst.TrueLabel.Text]
-			if !ok {
-				return runtimeValue{}, fmt.Errorf("invalid jump label %s in %s", inst.TrueLabel.Text, functionName)
-			}
-			pc = next
-		case InstructionBr:
-			cond, err := frame.resolveI32(inst.Condition.Text)
-			if err != nil {
-				return runtimeValue{}, err
-			}
-			target := inst.FalseLabel.Text
-			if cond != 0 {
-				target = inst.TrueLabel.Text
-			}
-			next, ok := frame.labels[target]
-			if !ok {
-				return runtimeValue{}, fmt.Errorf("invalid branch label %s in %s", target, functionName)
-			}
-			pc = next
-		case InstructionRet:
-			if !inst.HasReturnValue {
-				return runtimeValue{kind: valueI32, i32: 0}, nil
-			}
-			v, err := frame.resolveValue(inst.ReturnValue.Text)
+		s.trace(frame, inst, traced, nil)
+		if s.coverage != nil {
+			s.coverage.branch(functionName, pc, cond != 0)
+		}
+		target, label := d.alt, inst.FalseLabel.Text
+		if cond != 0 {
+			target, label = d.target, inst.TrueLabel.Text
+		}
+		if target < 0 {
+			return fmt.Errorf("invalid branch label %s in %s", label, functionName)
+		}
+		frame.pc = target
+	case InstructionRet:
+		ret := runtimeValue{kind: valueI32, i32: 0}
+		if inst.HasReturnValue {
+			v, err := frame.value(d.ops[0])
 			if err != nil {
-				return runtimeValue{}, err
+				return err
 			}
-			return v, nil
-		case InstructionOp:
-			res, hasResult, err := s.evalOp(&frame, inst, depth)
+			ret = v
+		}
+		s.trace(frame, inst, traced, nil)
+		s.leave(ret)
+	case InstructionOp:
+		if d.callee != nil {
+			args, err := frame.args(d.callArgs)
 			if err != nil {
-				return runtimeValue{}, err
+				return err
 			}
-			if hasResult {
-				if !inst.HasDestination {
-					return runtimeValue{}, fmt.Errorf("opcode %s produced value without destination in %s", inst.Opcode, functionName)
-				}
-				frame.values[inst.Destination.Text] = res
+			// call completes when callee returns, see leave
+			frame.pending = traced
+			return s.enter(d.callee, args)
+		}
+		res, hasResult, err := s.evalOp(frame, inst, d)
+		if err != nil {
+			return err
+		}
+		if hasResult {
+			if d.dst < 0 {
+				return fmt.Errorf("opcode %s produced value without destination in %s", inst.Opcode, functionName)
 			}
-			pc++
-		default:
-			return runtimeValue{}, fmt.Errorf("unsupported instruction kind %d in %s", inst.Kind, functionName)
+			frame.set(d.dst, res)
+			s.trace(frame, inst, traced, &res)
+		} else {
+			s.trace(frame, inst, traced, nil)
 		}
+		frame.pc++
+	default:
+		return fmt.Errorf("unsupported instruction kind %d in %s", inst.Kind, functionName)
 	}
+	return nil
+}
 
-	return runtimeValue{}, fmt.Errorf("function %s ended without ret", functionName)
+// callExternal calls function that is not part of module.
+func (s *evalState) callExternal(functionName string, args []runtimeValue) (runtimeValue, error) {
+	if ret, ok, err := s.callHeap(functionName, args); ok {
+		return ret, err
+	}
+	if host, ok := s.hostFuncs[functionName]; ok {
+		return callHost(functionName, host, args)
+	}
+	return runtimeValue{}, runtimeErrorf(KindMissingFunction, "missing function %s", functionName)
 }
 
-func (s *evalState) evalOp(frame *evalFrame, inst Instruction, depth int) (runtimeValue, bool, error) {
+func (s *evalState) trace(frame *evalFrame, inst *Instruction, operands []TraceValue, result *runtimeValue) {
+	if s.tracer == nil {
+		return
+	}
+	ev := TraceEvent{
+		Function:    frame.fn.Name,
+		Index:       frame.pc,
+		Depth:       len(s.frames) - 1,
+		Instruction: *inst,
+		Operands:    operands,
+	}
+	if result != nil {
+		ev.HasResult = true
+		ev.Result = traceValue(inst.Destination.Text, *result)
+	}
+	s.tracer.Trace(ev)
+}
+
+func (s *evalState) evalOp(frame *evalFrame, inst *Instruction, d *decodedInst) (runtimeValue, bool, error) {
 	op := inst.Opcode
-	ops := inst.Operands
+	ops := d.ops
 
 	needCount := func(n int) error {
 		if len(ops) != n {
@@ -188,29 +372,19 @@ func (s *evalState) evalOp(frame *evalFrame, inst Instruction, depth int) (runti
 	}
 
 	switch op {
-	case OpcodeConstI32:
-		if err := needCount(1); err != nil {
-			return runtimeValue{}, false, fmt.Errorf("opcode call expects at least one operand")
-		}
-		n, err := strconv.ParseInt(strings.TrimSpace(ops[0].Text), 10, 32)
-		if err != nil {
-			return runtimeValue{}, false, fmt.Errorf("invalid const.i32 operand %q", ops[0].Text)
-		}
-		return runtimeValue{kind: valueI32, i32: int32(n)}, true, nil
-	case OpcodeConstI8:
+	case OpcodeConstI32, OpcodeConstI8:
 		if err := needCount(1); err != nil {
 			return runtimeValue{}, false, err
 		}
-		n, err := strconv.ParseInt(strings.TrimSpace(ops[0].Text), 10, 8)
-		if err != nil {
-			return runtimeValue{}, false, fmt.Errorf("invalid const.i8 operand %q", ops[0].Text)
+		if d.err != nil {
+			return runtimeValue{}, false, d.err
 		}
-		return runtimeValue{kind: valueI32, i32: int32(int8(n))}, true, nil
+		return d.imm, true, nil
 	case OpcodeCopy:
 		if err := needCount(1); err != nil {
 			return runtimeValue{}, false, err
 		}
-		v, err := frame.resolveValue(ops[0].Text)
+		v, err := frame.value(ops[0])
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
@@ -219,81 +393,82 @@ func (s *evalState) evalOp(frame *evalFrame, inst Instruction, depth int) (runti
 		if err := needCount(1); err != nil {
 			return runtimeValue{}, false, err
 		}
-		addr := frame.nextAddr
-		frame.nextAddr++
-		frame.memory[addr] = memoryCell{}
-		return runtimeValue{kind: valuePtr, ptr: addr}, true, nil
-	case OpcodeLoad:
-		if err := needCount(1); err != nil {
-			return runtimeValue{}, false, err
+		// alloca executed again, e.g. in loop, reuses its object like slot of compiled frame
+		if obj := frame.allocas[d.alloca]; obj != nil {
+			s.memory.reuse(obj)
+			return runtimeValue{kind: valuePtr, ptr: obj.start, obj: obj}, true, nil
 		}
-		ptr, err := frame.resolvePtr(ops[0].Text)
+		obj, err := s.memory.alloc(d.size, d.size)
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		cell, ok := frame.memory[ptr]
-		if !ok || !cell.initialized {
-			return runtimeValue{}, false, fmt.Errorf("load from uninitialized memory at %d", ptr)
+		frame.allocas[d.alloca] = obj
+		return runtimeValue{kind: valuePtr, ptr: obj.start, obj: obj}, true, nil
+	case OpcodeLoad:
+		ptr, err := s.accessPointer(frame, d, "load")
+		if err != nil {
+			return runtimeValue{}, false, err
 		}
-		return cell.value, true, nil
+		v, err := s.loadMemory(ptr, d.size)
+		return v, err == nil, err
 	case OpcodeLoadIndirect:
-		if err := needCount(1); err != nil {
+		ptr, err := s.accessPointer(frame, d, "load")
+		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		ptr, err := frame.resolvePtr(ops[0].Text)
+		v, err := s.loadIndirect(ptr, d.size)
+		return v, err == nil, err
+	case OpcodeStore:
+		ptr, err := s.accessPointer(frame, d, "store")
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		cell, ok := frame.memory[ptr]
-		if !ok || !cell.initialized {
-			return runtimeValue{}, false, fmt.Errorf("load from uninitialized memory at %d", ptr)
-		}
-		return cell.value, true, nil
-	case OpcodeStore:
-		if err := needCount(2); err != nil {
+		val, err := frame.value(ops[1])
+		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		ptr, err := frame.resolvePtr(ops[0].Text)
+		return runtimeValue{}, false, s.storeMemory(ptr, d.size, val)
+	case OpcodeStoreIndirect:
+		ptr, err := s.accessPointer(frame, d, "store")
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		val, err := frame.resolveValue(ops[1].Text)
+		val, err := frame.value(ops[1])
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		frame.memory[ptr] = memoryCell{value: val, initialized: true}
-		return runtimeValue{}, false, nil
-	case OpcodeStoreIndirect:
+		return runtimeValue{}, false, s.storeIndirect(ptr, d.size, val)
+	case OpcodeBitcast:
 		if err := needCount(2); err != nil {
 			return runtimeValue{}, false, err
 		}
-		ptr, err := frame.resolvePtr(ops[0].Text)
+		v, err := frame.value(ops[0])
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		val, err := frame.resolveValue(ops[1].Text)
-		if err != nil {
-			return runtimeValue{}, false, err
+		if isPointerTypeName(inst.Operands[1].Text) {
+			if v.kind == valueI32 {
+				v = runtimeValue{kind: valuePtr, ptr: int(uint32(v.i32))}
+			}
+			return v, true, nil
+		}
+		if v.kind == valuePtr {
+			v = runtimeValue{kind: valueI32, i32: int32(v.ptr)}
 		}
-		frame.memory[ptr] = memoryCell{value: val, initialized: true}
-		return runtimeValue{}, false, nil
+		return v, true, nil
 	case OpcodeCall:
 		if inst.CallCallee == "" {
 			return runtimeValue{}, false, fmt.Errorf("opcode call requires call callee")
 		}
-		argv := make([]runtimeValue, 0, len(inst.CallArgs))
-		for _, a := range inst.CallArgs {
-			v, err := frame.resolveValue(a.Text)
-			if err != nil {
-				return runtimeValue{}, false, err
-			}
-			argv = append(argv, v)
+		argv, err := frame.args(d.callArgs)
+		if err != nil {
+			return runtimeValue{}, false, err
 		}
-		ret, err := s.evalCall(inst.CallCallee, argv, depth+1)
+		ret, err := s.callExternal(inst.CallCallee, argv)
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		if !inst.HasDestination {
+		if d.dst < 0 {
 			return runtimeValue{}, false, nil
 		}
 		return ret, true, nil
@@ -301,10 +476,15 @@ func (s *evalState) evalOp(frame *evalFrame, inst Instruction, depth int) (runti
 		if err := needCount(1); err != nil {
 			return runtimeValue{}, false, err
 		}
-		a, err := frame.resolveI32(ops[0].Text)
+		a, err := frame.i32(ops[0])
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
+		if s.sanitize {
+			if err := sanitizeArith(op, a, 0); err != nil {
+				return runtimeValue{}, false, err
+			}
+		}
 		switch op {
 		case OpcodeNeg:
 			return runtimeValue{kind: valueI32, i32: -a}, true, nil
@@ -316,18 +496,74 @@ func (s *evalState) evalOp(frame *evalFrame, inst Instruction, depth int) (runti
 			}
 			return runtimeValue{kind: valueI32, i32: 0}, true, nil
 		}
-	case OpcodeAdd, OpcodeSub, OpcodeMul, OpcodeDivS, OpcodeModS, OpcodeAnd, OpcodeOr, OpcodeXor, OpcodeShl, OpcodeShrS, OpcodeEq, OpcodeNe, OpcodeLtS, OpcodeLeS, OpcodeGtS, OpcodeGeS:
+	case OpcodeGep:
+		if err := needCount(3); err != nil {
+			return runtimeValue{}, false, err
+		}
+		base, err := frame.value(ops[0])
+		if err != nil {
+			return runtimeValue{}, false, err
+		}
+		if base.kind != valuePtr {
+			return runtimeValue{}, false, fmt.Errorf("expected pointer value")
+		}
+		index, err := frame.i32(ops[1])
+		if err != nil {
+			return runtimeValue{}, false, err
+		}
+		if d.err != nil {
+			return runtimeValue{}, false, d.err
+		}
+		scale := int(d.imm.i32)
+		res := runtimeValue{kind: valuePtr, ptr: int(uint32(base.ptr + int(index)*scale)), obj: base.obj}
+		if s.sanitize {
+			if err := sanitizePointer(res); err != nil {
+				return runtimeValue{}, false, err
+			}
+		}
+		return res, true, nil
+	case OpcodeTrunc:
 		if err := needCount(2); err != nil {
 			return runtimeValue{}, false, err
 		}
-		a, err := frame.resolveI32(ops[0].Text)
+		v, err := frame.i32(ops[0])
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
-		b, err := frame.resolveI32(ops[1].Text)
+		switch inst.Operands[1].Text {
+		case "i8":
+			return runtimeValue{kind: valueI32, i32: int32(int8(v))}, true, nil
+		case "i32":
+			return runtimeValue{kind: valueI32, i32: v}, true, nil
+		default:
+			return runtimeValue{}, false, fmt.Errorf("invalid trunc type %q", inst.Operands[1].Text)
+		}
+	case OpcodeAdd, OpcodeSub, OpcodeMul, OpcodeDivS, OpcodeModS, OpcodeAnd, OpcodeOr, OpcodeXor, OpcodeShl, OpcodeShrS, OpcodeEq, OpcodeNe, OpcodeLtS, OpcodeLeS, OpcodeGtS, OpcodeGeS,
+		OpcodeLtU, OpcodeLeU, OpcodeGtU, OpcodeGeU:
+		if err := needCount(2); err != nil {
+			return runtimeValue{}, false, err
+		}
+		av, err := frame.value(ops[0])
 		if err != nil {
 			return runtimeValue{}, false, err
 		}
+		bv, err := frame.value(ops[1])
+		if err != nil {
+			return runtimeValue{}, false, err
+		}
+		if av.kind == valuePtr || bv.kind == valuePtr {
+			if s.sanitize && op == OpcodeSub && av.kind == valuePtr && bv.kind == valuePtr && av.obj != bv.obj {
+				return runtimeValue{}, false, &UndefinedBehavior{Check: "pointer difference", Detail: "pointers into different objects"}
+			}
+			res, err := evalPointerBinary(op, av, bv)
+			return res, err == nil, err
+		}
+		a, b := av.i32, bv.i32
+		if s.sanitize {
+			if err := sanitizeArith(op, a, b); err != nil {
+				return runtimeValue{}, false, err
+			}
+		}
 		switch op {
 		case OpcodeAdd:
 			return runtimeValue{kind: valueI32, i32: a + b}, true, nil
@@ -337,12 +573,12 @@ func (s *evalState) evalOp(frame *evalFrame, inst Instruction, depth int) (runti
 			return runtimeValue{kind: valueI32, i32: a * b}, true, nil
 		case OpcodeDivS:
 			if b == 0 {
-				return runtimeValue{}, false, fmt.Errorf("division by zero")
+				return runtimeValue{}, false, runtimeErrorf(KindDivisionByZero, "division by zero")
 			}
 			return runtimeValue{kind: valueI32, i32: a / b}, true, nil
 		case OpcodeModS:
 			if b == 0 {
-				return runtimeValue{}, false, fmt.Errorf("modulo by zero")
+				return runtimeValue{}, false, runtimeErrorf(KindDivisionByZero, "modulo by zero")
 			}
 			return runtimeValue{kind: valueI32, i32: a % b}, true, nil
 		case OpcodeAnd:
@@ -365,14 +601,94 @@ func (s *evalState) evalOp(frame *evalFrame, inst Instruction, depth int) (runti
 			return boolI32(a <= b), true, nil
 		case OpcodeGtS:
 			return boolI32(a > b), true, nil
-		default:
+		case OpcodeGeS:
 			return boolI32(a >= b), true, nil
+		case OpcodeLtU:
+			return boolI32(uint32(a) < uint32(b)), true, nil
+		case OpcodeLeU:
+			return boolI32(uint32(a) <= uint32(b)), true, nil
+		case OpcodeGtU:
+			return boolI32(uint32(a) > uint32(b)), true, nil
+		default:
+			return boolI32(uint32(a) >= uint32(b)), true, nil
 		}
 	default:
 		return runtimeValue{}, false, fmt.Errorf("opcode %s not supported by evaluator v1", op)
 	}
 }
 
+// evalPointerBinary handles binary operations with at least one pointer operand.
+// Pointers are byte addresses and integer operand is treated as address,
+// so null pointer compares equal to 0.
+func evalPointerBinary(op Opcode, a, b runtimeValue) (runtimeValue, error) {
+	x, y := uint32(a.address()), uint32(b.address())
+	switch op {
+	case OpcodeSub:
+		if a.kind == valuePtr && b.kind == valuePtr {
+			return runtimeValue{kind: valueI32, i32: int32(x - y)}, nil
+		}
+	case OpcodeEq:
+		return boolI32(x == y), nil
+	case OpcodeNe:
+		return boolI32(x != y), nil
+	case OpcodeLtU:
+		return boolI32(x < y), nil
+	case OpcodeLeU:
+		return boolI32(x <= y), nil
+	case OpcodeGtU:
+		return boolI32(x > y), nil
+	case OpcodeGeU:
+		return boolI32(x >= y), nil
+	}
+	return runtimeValue{}, fmt.Errorf("opcode %s does not accept pointer operand", op)
+}
+
+// accessPointer resolves address operand of memory access and, with sanitizer, checks it against its object.
+func (s *evalState) accessPointer(frame *evalFrame, d *decodedInst, access string) (int, error) {
+	v, err := frame.value(d.ops[0])
+	if err != nil {
+		return 0, err
+	}
+	if v.kind != valuePtr {
+		return 0, fmt.Errorf("expected pointer value")
+	}
+	if s.sanitize {
+		if err := sanitizeAccess(v, d.size, access); err != nil {
+			return 0, err
+		}
+	}
+	return v.ptr, nil
+}
+
+func (v runtimeValue) address() int {
+	if v.kind == valuePtr {
+		return v.ptr
+	}
+	return int(v.i32)
+}
+
+const pointerSize = 4
+
+// typeSize returns size in bytes of TAC type, as used by alloca and memory access.
+func typeSize(typ string) int {
+	if strings.TrimSpace(typ) == "i8" {
+		return 1
+	}
+	return 4
+}
+
+// sizeTypeName is integer type of access width.
+func sizeTypeName(size int) string {
+	if size == 1 {
+		return "i8"
+	}
+	return "i32"
+}
+
+func isPointerTypeName(typ string) bool {
+	return typ == "ptr" || strings.HasSuffix(typ, "*")
+}
+
 func boolI32(v bool) runtimeValue {
 	if v {
 		return runtimeValue{kind: valueI32, i32: 1}
@@ -380,20 +696,37 @@ func boolI32(v bool) runtimeValue {
 	return runtimeValue{kind: valueI32, i32: 0}
 }
 
-func (f *evalFrame) resolveValue(token string) (runtimeValue, error) {
-	token = strings.TrimSpace(token)
-	if v, ok := f.values[token]; ok {
-		return v, nil
+func (f *evalFrame) set(slot int, v runtimeValue) {
+	f.values[slot] = v
+	f.defined[slot] = true
+}
+
+func (f *evalFrame) value(o operand) (runtimeValue, error) {
+	switch {
+	case o.slot >= 0:
+		if f.defined[o.slot] {
+			return f.values[o.slot], nil
+		}
+	case o.slot == operandConst:
+		return o.value, nil
 	}
-	n, err := strconv.ParseInt(token, 10, 32)
-	if err == nil {
-		return runtimeValue{kind: valueI32, i32: int32(n)}, nil
+	return runtimeValue{}, fmt.Errorf("unknown value %s", o.name)
+}
+
+func (f *evalFrame) args(ops []operand) ([]runtimeValue, error) {
+	argv := make([]runtimeValue, 0, len(ops))
+	for _, o := range ops {
+		v, err := f.value(o)
+		if err != nil {
+			return nil, err
+		}
+		argv = append(argv, v)
 	}
-	return runtimeValue{}, fmt.Errorf("unknown value %s", token)
+	return argv, nil
 }
 
-func (f *evalFrame) resolveI32(token string) (int32, error) {
-	v, err := f.resolveValue(token)
+func (f *evalFrame) i32(o operand) (int32, error) {
+	v, err := f.value(o)
 	if err != nil {
 		return 0, err
 	}
@@ -402,14 +735,3 @@ func (f *evalFrame) resolveI32(token string) (int32, error) {
 	}
 	return v.i32, nil
 }
-
-func (f *evalFrame) resolvePtr(token string) (int, error) {
-	v, err := f.resolveValue(token)
-	if err != nil {
-		return 0, err
-	}
-	if v.kind != valuePtr {
-		return 0, fmt.Errorf("expected pointer value")
-	}
-	return v.ptr, nil
-}
@@ -1,8 +1,12 @@
 package tac
 
 import (
+	"context"
+	"errors"
+	"math"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvaluateFunction_BasicArithmeticAndBranch(t *testing.T) {
@@ -98,6 +102,251 @@ func @fact(%n:i32) -> i32 {
 	}
 }
 
+func TestEvaluateFunction_PointerToLocalValidInCallee(t *testing.T) {
+	input := `.tac v1
+
+func @set(%p:i32*, %v:i32) -> void {
+.L0:
+  store.ind %p, %v
+  ret
+}
+
+func @main() -> i32 {
+.L0:
+  %s0 = alloca i32
+  %s1 = alloca i32*
+  store %s1, %s0
+  %t0 = load %s1
+  call @set(%t0, 7)
+  %t1 = load %s0
+  ret %t1
+}
+`
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+
+	got, err := EvaluateFunction(mod, "@main", nil, EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if got != 7 {
+		t.Fatalf("expected 7, got %d", got)
+	}
+}
+
+func TestEvaluateFunction_ByteAccess(t *testing.T) {
+	input := `.tac v1
+
+func @main() -> i32 {
+.L0:
+  %s0 = alloca i32
+  store %s0, 0
+  %t0 = bitcast %s0, i8*
+  %t1 = gep %t0, 1, 1
+  store.ind %t1, -1, i8
+  %t2 = load.ind %t1, i8
+  %t3 = load %s0
+  %t4 = add %t2, %t3
+  ret %t4
+}
+`
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+
+	got, err := EvaluateFunction(mod, "@main", nil, EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	// sign-extended byte plus little-endian word 0x0000ff00
+	if got != 0xff00-1 {
+		t.Fatalf("expected %d, got %d", 0xff00-1, got)
+	}
+}
+
+func TestEvaluateFunction_HostFuncs(t *testing.T) {
+	input := `.tac v1
+
+func @main() -> i32 {
+.L0:
+  %t0 = alloca i32
+  %t1 = call @twice(21)
+  %t2 = call @addr(%t0)
+  %t3 = ne %t2, 0
+  %t4 = add %t1, %t3
+  ret %t4
+}
+`
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+
+	host := map[string]HostFunc{
+		"@twice": {Params: 1, Call: func(args []int32) (int32, error) { return 2 * args[0], nil }},
+		"@addr":  {Params: 1, Call: func(args []int32) (int32, error) { return args[0], nil }},
+	}
+	got, err := EvaluateFunction(mod, "@main", nil, EvalOptions{HostFuncs: host})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if got != 43 {
+		t.Fatalf("expected 43, got %d", got)
+	}
+
+	host["@twice"] = HostFunc{Params: 2, Call: host["@twice"].Call}
+	_, err = EvaluateFunction(mod, "@main", nil, EvalOptions{HostFuncs: host})
+	if err == nil || !strings.Contains(err.Error(), "function @twice expects 2 arguments, got 1") {
+		t.Fatalf("expected arity error, got %v", err)
+	}
+}
+
+func TestEvaluateFunction_RuntimeErrorKinds(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		opts EvalOptions
+		kind RuntimeErrorKind
+	}{
+		{name: "division", body: "  %t0 = div_s 1, 0\n  ret %t0", kind: KindDivisionByZero},
+		{name: "unknown value", body: "  ret %nope", kind: KindInvalidProgram},
+		{name: "missing function", body: "  %t0 = call @nope()\n  ret %t0", kind: KindMissingFunction},
+		{name: "uninitialized", body: "  %t0 = alloca i32\n  %t1 = load %t0\n  ret %t1", kind: KindUninitializedRead},
+		{name: "null load", body: "  %t0 = bitcast 0, ptr\n  %t1 = load.ind %t0\n  ret %t1", kind: KindMemoryFault},
+		{name: "step limit", body: "  jmp .L0", opts: EvalOptions{StepLimit: 10}, kind: KindStepLimit},
+		{name: "call depth", body: "  %t0 = call @f()\n  ret %t0", kind: KindCallDepth},
+		{name: "overflow", body: "  %t0 = add 2147483647, 1\n  ret %t0", opts: EvalOptions{Sanitize: true}, kind: KindUndefinedBehavior},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := ".tac v1\n\nfunc @f() -> i32 {\n.L0:\n" + tc.body + "\n}\n"
+			mod, err := ParseModule(strings.NewReader(src))
+			if err != nil {
+				t.Fatalf("parse module: %v", err)
+			}
+			_, err = EvaluateFunction(mod, "@f", nil, tc.opts)
+			var rt *RuntimeError
+			if !errors.As(err, &rt) {
+				t.Fatalf("expected runtime error, got %v", err)
+			}
+			if rt.Kind != tc.kind || rt.Function != "@f" || rt.Block != ".L0" || len(rt.Stack) == 0 {
+				t.Fatalf("expected %s in @f .L0, got %s (%v)", tc.kind, rt.Kind, err)
+			}
+		})
+	}
+}
+
+func TestEvaluateFunctionContext_Canceled(t *testing.T) {
+	input := `.tac v1
+
+func @spin() -> i32 {
+.L0:
+  jmp .L0
+}
+`
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = EvaluateFunctionContext(ctx, mod, "@spin", nil, EvalOptions{StepLimit: math.MaxInt})
+	var rt *RuntimeError
+	if !errors.As(err, &rt) || rt.Kind != KindCanceled || rt.Function != "@spin" {
+		t.Fatalf("expected canceled evaluation, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected error wrapping deadline, got %v", err)
+	}
+	if rt.Stats.Steps == 0 || rt.Stats.MaxDepth != 1 {
+		t.Fatalf("unexpected stats %+v", rt.Stats)
+	}
+
+	// already canceled context stops before first step
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	m, err := NewMachine(mod, EvalOptions{})
+	if err != nil {
+		t.Fatalf("new machine: %v", err)
+	}
+	if err := m.Start("@spin", nil); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := m.Run(ctx); !errors.Is(err, context.Canceled) || m.Steps() != 0 {
+		t.Fatalf("expected cancellation before any step, got %v after %d steps", err, m.Steps())
+	}
+	if err := m.Step(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("machine should stay stopped, got %v", err)
+	}
+}
+
+func TestMachine_StepsAndExposesFrames(t *testing.T) {
+	input := `.tac v1
+
+func @inc(%x:i32) -> i32 {
+.L0:
+  %t0 = add %x, 1
+  ret %t0
+}
+
+func @main() -> i32 {
+.L0:
+  %s0 = alloca i8
+  %t0 = call @inc(41)
+  ret %t0
+}
+`
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+	m, err := NewMachine(mod, EvalOptions{})
+	if err != nil {
+		t.Fatalf("new machine: %v", err)
+	}
+	if err := m.Start("@main", nil); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// label, alloca, call entering @inc, label of @inc
+	for i := 0; i < 4; i++ {
+		if err := m.Step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+
+	loc, ok := m.Location()
+	if !ok || loc.Function != "@inc" || loc.Index != 1 || loc.Depth != 1 {
+		t.Fatalf("unexpected location %+v", loc)
+	}
+	frames := m.Frames()
+	if len(frames) != 2 || frames[0].Function != "@main" || frames[0].Index != 2 {
+		t.Fatalf("unexpected frames %+v", frames)
+	}
+	if len(frames[1].Values) != 1 || frames[1].Values[0].Name != "%x" || frames[1].Values[0].Value != 41 {
+		t.Fatalf("unexpected callee values %+v", frames[1].Values)
+	}
+	slots := frames[0].Slots
+	if len(slots) != 1 || slots[0].Name != "%s0" || slots[0].Type != "i8" || slots[0].Initialized {
+		t.Fatalf("unexpected caller slots %+v", slots)
+	}
+
+	for !m.Done() {
+		if err := m.Step(); err != nil {
+			t.Fatalf("step: %v", err)
+		}
+	}
+	got, err := m.Result()
+	if err != nil || got != 42 {
+		t.Fatalf("expected 42, got %d (%v)", got, err)
+	}
+	if err := m.Step(); err == nil || !strings.Contains(err.Error(), "already finished") {
+		t.Fatalf("expected finished error, got %v", err)
+	}
+}
+
 func TestEvaluateFunction_Errors(t *testing.T) {
 	tests := []struct {
 		name string
@@ -161,6 +410,24 @@ func @f() -> i32 {
 			fn:  "@f",
 			msg: "not enabled",
 		},
+		{
+			name: "invalid immediate reported when executed",
+			mod: `.tac v1
+
+func @f(%c:i32) -> i32 {
+.L0:
+  br %c, .L1, .L2
+.L1:
+  %t0 = const.i32 abc
+  ret %t0
+.L2:
+  ret 7
+}
+`,
+			fn:   "@f",
+			args: []int32{1},
+			msg:  `invalid const.i32 operand "abc"`,
+		},
 		{
 			name: "uninitialized load",
 			mod: `.tac v1
@@ -175,6 +442,72 @@ func @f() -> i32 {
 			fn:  "@f",
 			msg: "uninitialized memory",
 		},
+		{
+			name: "misaligned load",
+			mod: `.tac v1
+
+func @f() -> i32 {
+.L0:
+  %t0 = alloca i32
+  store %t0, 1
+  %t1 = gep %t0, 1, 1
+  %t2 = load.ind %t1
+  ret %t2
+}
+`,
+			fn:  "@f",
+			msg: "load of 4 bytes at 0x8000fffd: misaligned",
+		},
+		{
+			name: "null pointer load",
+			mod: `.tac v1
+
+func @f() -> i32 {
+.L0:
+  %t0 = bitcast 0, i32*
+  %t1 = load.ind %t0
+  ret %t1
+}
+`,
+			fn:  "@f",
+			msg: "memory fault: load of 4 bytes at 0x0: unmapped address",
+		},
+		{
+			name: "dangling pointer to released frame",
+			mod: `.tac v1
+
+func @leak() -> i32* {
+.L0:
+  %t0 = alloca i32
+  store %t0, 1
+  ret %t0
+}
+
+func @f() -> i32 {
+.L0:
+  %t0 = call @leak()
+  %t1 = load.ind %t0
+  ret %t1
+}
+`,
+			fn:  "@f",
+			msg: "below stack pointer",
+		},
+		{
+			name: "pointer stored as byte",
+			mod: `.tac v1
+
+func @f() -> i32 {
+.L0:
+  %t0 = alloca i32
+  %t1 = bitcast %t0, i8*
+  store.ind %t1, %t0, i8
+  ret 0
+}
+`,
+			fn:  "@f",
+			msg: "store of pointer as i8",
+		},
 		{
 			name: "step limit",
 			mod: `.tac v1
@@ -0,0 +1,237 @@
+package tac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Heap region starts 128 MiB above stack, past largest stack evaluator accepts.
+	heapBase  = 0x88000000
+	heapLimit = 0xc0000000
+	// heapAlign is alignment of every heap object, enough for any TAC type.
+	heapAlign = 8
+
+	defaultMaxHeapBytes = 1 << 20
+)
+
+// heap backs malloc and free builtins. Every object has its own storage and
+// Limit bounds bytes of live objects.
+// Heap cells are bytes, limit bounds bytes of live objects.
+type heap struct {
+	next int
+	// objects are live objects sorted by address
+	objects  []*heapObject
+	pointers map[int]*allocation
+	limit    int
+	live     int
+	peak     int
+	sanitize bool
+}
+
+type heapObject struct {
+	*allocation
+	bytes []byte
+	init  []bool
+}
+
+func newHeap(limit int, sanitize bool) *heap {
+	return &heap{next: heapBase, pointers: map[int]*allocation{}, limit: limit, sanitize: sanitize}
+}
+
+func (h *heap) contains(addr int) bool {
+	return addr >= heapBase && addr < heapLimit
+}
+
+// malloc allocates size uninitialized bytes. Zero size still gets unique address.
+func (h *heap) malloc(size int) (*allocation, error) {
+	if h.live+size > h.limit {
+		return nil, runtimeErrorf(KindHeapExhausted, "heap budget of %d bytes exhausted allocating %d bytes (%d live)", h.limit, size, h.live)
+	}
+	addr := h.next
+	end := addr + max(size, 1)
+	if end > heapLimit {
+		return nil, runtimeErrorf(KindHeapExhausted, "heap address space exhausted allocating %d bytes", size)
+	}
+	h.next = (end + heapAlign - 1) / heapAlign * heapAlign
+	obj := &heapObject{
+		allocation: &allocation{start: addr, size: size, live: true, heap: true},
+		bytes:      make([]byte, size),
+		init:       make([]bool, size),
+	}
+	// addresses grow, so appending keeps objects sorted
+	h.objects = append(h.objects, obj)
+	h.live += size
+	h.peak = max(h.peak, h.live)
+	return obj.allocation, nil
+}
+
+// free releases object starting at addr. Freeing anything else is undefined behavior,
+// reported even without sanitizer as evaluation cannot continue meaningfully.
+func (h *heap) free(p runtimeValue) error {
+	addr := p.address()
+	i, ok := h.find(addr)
+	if !ok || h.objects[i].start != addr {
+		check := "invalid free"
+		if p.obj != nil && p.obj.heap && !p.obj.live && p.obj.start == addr {
+			check = "double free"
+		}
+		return &UndefinedBehavior{Check: check, Detail: fmt.Sprintf("free of %#x", addr)}
+	}
+	obj := h.objects[i]
+	obj.live = false
+	h.live -= obj.size
+	for a := range h.pointers {
+		if a >= obj.start && a < obj.start+obj.size {
+			delete(h.pointers, a)
+		}
+	}
+	h.objects = append(h.objects[:i], h.objects[i+1:]...)
+	return nil
+}
+
+// find returns index of live object containing addr, or index object at addr would
+// be inserted at if there is none. Zero size object contains its start, as malloc
+// reserves address of it.
+func (h *heap) find(addr int) (int, bool) {
+	i := sort.Search(len(h.objects), func(i int) bool { return h.objects[i].start+max(h.objects[i].size, 1) > addr })
+	if i < len(h.objects) && addr >= h.objects[i].start {
+		return i, true
+	}
+	return i, false
+}
+
+// objectAt returns live object containing addr, or ending at it when none contains it.
+func (h *heap) objectAt(addr int) *allocation {
+	i, ok := h.find(addr)
+	if ok {
+		return h.objects[i].allocation
+	}
+	if i > 0 && h.objects[i-1].start+h.objects[i-1].size == addr {
+		return h.objects[i-1].allocation
+	}
+	return nil
+}
+
+// object returns live object holding access of size bytes at addr.
+func (h *heap) object(addr, size int, access string) (*heapObject, error) {
+	if addr%size != 0 {
+		return nil, &MemoryFault{Access: access, Addr: addr, Size: size, Reason: "misaligned"}
+	}
+	i, ok := h.find(addr)
+	if !ok || !h.objects[i].contains(addr, size) {
+		if addr < h.next {
+			return nil, &MemoryFault{Access: access, Addr: addr, Size: size, Reason: "outside live heap object"}
+		}
+		return nil, &MemoryFault{Access: access, Addr: addr, Size: size, Reason: "unmapped address"}
+	}
+	return h.objects[i], nil
+}
+
+func (h *heap) load(addr, size int) (runtimeValue, error) {
+	obj, err := h.object(addr, size, "load")
+	if err != nil {
+		return runtimeValue{}, err
+	}
+	off := addr - obj.start
+	for i := off; i < off+size; i++ {
+		if !obj.init[i] {
+			if h.sanitize {
+				return runtimeValue{}, &UndefinedBehavior{Check: "uninitialized read", Detail: fmt.Sprintf("load of %d bytes at %#x", size, addr)}
+			}
+			return runtimeValue{}, runtimeErrorf(KindUninitializedRead, "load from uninitialized memory at %#x", addr)
+		}
+	}
+	if size == 1 {
+		return runtimeValue{kind: valueI32, i32: int32(int8(obj.bytes[off]))}, nil
+	}
+	word := binary.LittleEndian.Uint32(obj.bytes[off:])
+	if p, ok := h.pointers[addr]; ok {
+		return runtimeValue{kind: valuePtr, ptr: int(word), obj: p}, nil
+	}
+	return runtimeValue{kind: valueI32, i32: int32(word)}, nil
+}
+
+func (h *heap) store(addr, size int, v runtimeValue) error {
+	obj, err := h.object(addr, size, "store")
+	if err != nil {
+		return err
+	}
+	if v.kind == valuePtr && size != pointerSize {
+		return fmt.Errorf("store of pointer as %s at %#x", sizeTypeName(size), addr)
+	}
+	off := addr - obj.start
+	if len(h.pointers) > 0 {
+		for a := addr - pointerSize + 1; a < addr+size; a++ {
+			delete(h.pointers, a)
+		}
+	}
+	if size == 1 {
+		obj.bytes[off] = byte(v.i32)
+	} else {
+		binary.LittleEndian.PutUint32(obj.bytes[off:], uint32(v.address()))
+		if v.kind == valuePtr {
+			h.pointers[addr] = v.obj
+		}
+	}
+	for i := off; i < off+size; i++ {
+		obj.init[i] = true
+	}
+	return nil
+}
+
+// callHeap runs malloc or free builtin, false if function is neither.
+func (s *evalState) callHeap(functionName string, args []runtimeValue) (runtimeValue, bool, error) {
+	if functionName != "@malloc" && functionName != "@free" {
+		return runtimeValue{}, false, nil
+	}
+	if len(args) != 1 {
+		return runtimeValue{}, true, fmt.Errorf("function %s expects 1 argument, got %d", functionName, len(args))
+	}
+	if s.heap == nil {
+		// most programs never allocate, heap is created on first use
+		s.heap = newHeap(s.maxHeapBytes, s.sanitize)
+	}
+	if functionName == "@free" {
+		if args[0].address() == 0 {
+			return runtimeValue{kind: valueI32}, true, nil
+		}
+		return runtimeValue{kind: valueI32}, true, s.heap.free(args[0])
+	}
+	if args[0].kind != valueI32 {
+		return runtimeValue{}, true, fmt.Errorf("malloc size must be i32")
+	}
+	if args[0].i32 < 0 {
+		// size_t wraps to size no allocator can satisfy
+		return runtimeValue{kind: valuePtr}, true, nil
+	}
+	obj, err := s.heap.malloc(int(args[0].i32))
+	if err != nil {
+		return runtimeValue{}, true, err
+	}
+	return runtimeValue{kind: valuePtr, ptr: obj.start, obj: obj}, true, nil
+}
+
+// loadMemory reads stack or heap, devices are not consulted.
+func (s *evalState) loadMemory(addr, size int) (runtimeValue, error) {
+	if s.heap != nil && s.heap.contains(addr) {
+		return s.heap.load(addr, size)
+	}
+	return s.memory.load(addr, size)
+}
+
+func (s *evalState) storeMemory(addr, size int, v runtimeValue) error {
+	if s.heap != nil && s.heap.contains(addr) {
+		return s.heap.store(addr, size, v)
+	}
+	return s.memory.store(addr, size, v)
+}
+
+// objectAt returns live stack or heap object containing address, nil if there is none.
+func (s *evalState) objectAt(addr int) *allocation {
+	if s.heap != nil && s.heap.contains(addr) {
+		return s.heap.objectAt(addr)
+	}
+	return s.memory.objectAt(addr)
+}
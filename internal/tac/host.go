@@ -0,0 +1,56 @@
+package tac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// HostFunc is Go implementation of function called from evaluated code.
+// Pointer arguments are passed to Call as their addresses.
+type HostFunc struct {
+	Params int
+	Call   func(args []int32) (int32, error)
+}
+
+// ErrAssertionFailed is returned by __wh_assert called with zero.
+var ErrAssertionFailed = errors.New("assertion failed")
+
+// StandardHostFuncs returns builtins declared by sema, printing to out.
+func StandardHostFuncs(out io.Writer) map[string]HostFunc {
+	return map[string]HostFunc{
+		"@putchar": {Params: 1, Call: func(args []int32) (int32, error) {
+			c := byte(args[0])
+			if _, err := out.Write([]byte{c}); err != nil {
+				// EOF of C stdio
+				return -1, nil
+			}
+			return int32(c), nil
+		}},
+		"@__wh_assert": {Params: 1, Call: func(args []int32) (int32, error) {
+			if args[0] == 0 {
+				return 0, ErrAssertionFailed
+			}
+			return 0, nil
+		}},
+		"@__wh_print_int": {Params: 1, Call: func(args []int32) (int32, error) {
+			_, err := fmt.Fprintln(out, args[0])
+			return 0, err
+		}},
+	}
+}
+
+func callHost(name string, fn HostFunc, args []runtimeValue) (runtimeValue, error) {
+	if len(args) != fn.Params {
+		return runtimeValue{}, fmt.Errorf("function %s expects %d arguments, got %d", name, fn.Params, len(args))
+	}
+	argv := make([]int32, 0, len(args))
+	for _, a := range args {
+		argv = append(argv, int32(a.address()))
+	}
+	ret, err := fn.Call(argv)
+	if err != nil {
+		return runtimeValue{}, runtimeErrorf(KindHostFunction, "host function %s: %w", name, err)
+	}
+	return runtimeValue{kind: valueI32, i32: ret}, nil
+}
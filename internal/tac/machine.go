@@ -0,0 +1,228 @@
+package tac
+
+import (
+	"context"
+	"fmt"
+)
+
+// Machine is evaluator driven from outside one instruction at a time,
+// e.g. by debugger. EvaluateFunction runs Machine to completion.
+type Machine struct {
+	st      *evalState
+	entry   string
+	started bool
+	err     error
+}
+
+// NewMachine validates module and prepares evaluation with given options.
+func NewMachine(mod Module, opts EvalOptions) (*Machine, error) {
+	st, err := newEvalState(mod, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Machine{st: st}, nil
+}
+
+// Start enters function with i32 arguments. Machine can be started only once,
+// see StartValues for arguments of other types.
+func (m *Machine) Start(functionName string, args []int32) error {
+	if m.started {
+		return fmt.Errorf("machine already started")
+	}
+	callArgs := make([]runtimeValue, 0, len(args))
+	for _, a := range args {
+		callArgs = append(callArgs, runtimeValue{kind: valueI32, i32: a})
+	}
+	return m.start(functionName, callArgs)
+}
+
+func (m *Machine) start(functionName string, callArgs []runtimeValue) error {
+	m.started = true
+	m.entry = functionName
+
+	fn, ok := m.st.funcs[functionName]
+	if !ok {
+		ret, err := m.st.callExternal(functionName, callArgs)
+		if err != nil {
+			m.err = err
+			return err
+		}
+		m.st.done = true
+		m.st.result = ret
+		return nil
+	}
+	if err := m.st.enter(fn, callArgs); err != nil {
+		m.err = err
+		return err
+	}
+	return nil
+}
+
+// Step executes one instruction. Call of module function only enters callee,
+// the call completes with step of callee ret. After error machine stays stopped.
+func (m *Machine) Step() error {
+	if m.err != nil {
+		return m.err
+	}
+	if !m.started {
+		return fmt.Errorf("machine not started")
+	}
+	if m.st.done {
+		return fmt.Errorf("evaluation of %s already finished", m.entry)
+	}
+	if err := m.st.step(); err != nil {
+		m.err = err
+		return err
+	}
+	return nil
+}
+
+// Run steps machine until entry function returns, evaluation fails or ctx is done.
+// Context is checked every 1024 steps, cancellation stops machine like any other error.
+func (m *Machine) Run(ctx context.Context) error {
+	for n := 0; !m.Done(); n++ {
+		if n%cancelCheckInterval == 0 && m.err == nil && m.started && len(m.st.frames) > 0 {
+			if err := ctx.Err(); err != nil {
+				frame := m.st.frames[len(m.st.frames)-1]
+				m.err = m.st.runtimeError(&RuntimeError{Kind: KindCanceled, Err: fmt.Errorf("evaluation canceled: %w", err)}, frame, frame.pc)
+				return m.err
+			}
+		}
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns resource usage so far, also after error.
+func (m *Machine) Stats() Stats {
+	return m.st.stats()
+}
+
+// Done reports whether entry function returned.
+func (m *Machine) Done() bool {
+	return m.st.done
+}
+
+// Err returns error that stopped machine, if any.
+func (m *Machine) Err() error {
+	return m.err
+}
+
+// Steps returns number of executed instructions.
+func (m *Machine) Steps() int {
+	return m.st.steps
+}
+
+// Result returns value returned by entry function.
+func (m *Machine) Result() (int32, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	if !m.st.done {
+		return 0, fmt.Errorf("evaluation of %s not finished", m.entry)
+	}
+	if m.st.result.kind != valueI32 {
+		return 0, fmt.Errorf("function %s returned non-i32 value", m.entry)
+	}
+	return m.st.result.i32, nil
+}
+
+// Location is position of innermost active call, cheaper to get than Frames.
+type Location struct {
+	Function string
+	Index    int
+	// Depth is number of callers of Function.
+	Depth       int
+	Instruction Instruction
+}
+
+// Location returns position of next instruction to execute, false if no call is active.
+func (m *Machine) Location() (Location, bool) {
+	if len(m.st.frames) == 0 {
+		return Location{}, false
+	}
+	f := m.st.frames[len(m.st.frames)-1]
+	loc := Location{Function: f.fn.Name, Index: f.pc, Depth: len(m.st.frames) - 1}
+	if f.pc < len(f.fn.Instructions) {
+		loc.Instruction = f.fn.Instructions[f.pc]
+	}
+	return loc, true
+}
+
+// Frame is snapshot of one active call.
+type Frame struct {
+	Function string
+	// Index is position of next instruction to execute, or of call waiting for callee.
+	Index       int
+	Instruction Instruction
+	// Values holds parameters and temporaries in order of definition.
+	Values []TraceValue
+	Slots  []Slot
+}
+
+// Slot is stack slot created by alloca together with its current content.
+type Slot struct {
+	Name        string
+	Type        string
+	Address     int
+	Initialized bool
+	Value       TraceValue
+}
+
+// Frames returns active calls, outermost first.
+func (m *Machine) Frames() []Frame {
+	return m.st.snapshot()
+}
+
+func (s *evalState) snapshot() []Frame {
+	frames := make([]Frame, 0, len(s.frames))
+	for _, f := range s.frames {
+		frames = append(frames, s.frameInfo(f))
+	}
+	return frames
+}
+
+func (s *evalState) frameInfo(f *evalFrame) Frame {
+	out := Frame{Function: f.fn.Name, Index: f.pc}
+	if f.pc < len(f.fn.Instructions) {
+		out.Instruction = f.fn.Instructions[f.pc]
+	}
+
+	slotTypes := s.slotTypesOf(f.fn.Function)
+	// slots are ordered parameters first, then in order of definition
+	for slot, name := range f.fn.names {
+		if !f.defined[slot] {
+			continue
+		}
+		v := f.values[slot]
+		typ, isSlot := slotTypes[name]
+		if !isSlot {
+			out.Values = append(out.Values, traceValue(name, v))
+			continue
+		}
+		slot := Slot{Name: name, Type: typ, Address: v.ptr}
+		if content, err := s.memory.load(v.ptr, typeSize(typ)); err == nil {
+			slot.Initialized = true
+			slot.Value = traceValue(name, content)
+		}
+		out.Slots = append(out.Slots, slot)
+	}
+	return out
+}
+
+// slotTypesOf maps stack slots of function to their allocated type.
+func (s *evalState) slotTypesOf(fn Function) map[string]string {
+	if types, ok := s.slotTypes[fn.Name]; ok {
+		return types
+	}
+	types := map[string]string{}
+	for _, inst := range fn.Instructions {
+		if inst.Kind == InstructionOp && inst.Opcode == OpcodeAlloca && inst.HasDestination && len(inst.Operands) == 1 {
+			types[inst.Destination.Text] = inst.Operands[0].Text
+		}
+	}
+	s.slotTypes[fn.Name] = types
+	return types
+}
@@ -0,0 +1,201 @@
+package tac
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Stack region is placed where RAM starts on QEMU virt machine.
+	stackBase = 0x80000000
+	stackSize = 64 * 1024
+)
+
+// memory is single byte-addressed space shared by all frames of one evaluation,
+// so pointer to local stays valid in callee.
+// Stack grows down from top of region, each frame releases its allocations on return.
+type memory struct {
+	base  int
+	bytes []byte
+	init  []bool
+	// pointers marks addresses where whole pointer was stored,
+	// so it can be loaded back as pointer and not as plain integer, with its object.
+	pointers map[int]*allocation
+	sp       int
+	// low is lowest stack pointer so far, for Stats
+	low int
+	// allocs are live allocations, the most recent last.
+	allocs []*allocation
+	// sanitize reports uninitialized reads as undefined behavior.
+	sanitize bool
+}
+
+// allocation is stack object created by alloca or heap object created by malloc.
+// Pointers derived from it remember it, so sanitizer can check their bounds and lifetime.
+type allocation struct {
+	start int
+	size  int
+	live  bool
+	heap  bool
+}
+
+func (a *allocation) contains(addr, size int) bool {
+	return addr >= a.start && addr+size <= a.start+a.size
+}
+
+func newMemory(base, size int) *memory {
+	return &memory{
+		base:     base,
+		bytes:    make([]byte, size),
+		init:     make([]bool, size),
+		pointers: map[int]*allocation{},
+		sp:       base + size,
+		low:      base + size,
+	}
+}
+
+func (m *memory) top() int {
+	return m.base + len(m.bytes)
+}
+
+// alloc reserves size bytes aligned to align on stack.
+// Reused stack memory is uninitialized again.
+func (m *memory) alloc(size, align int) (*allocation, error) {
+	addr := alignDown(m.sp-size, align)
+	if addr < m.base {
+		return nil, runtimeErrorf(KindStackOverflow, "stack overflow allocating %d bytes (budget %d bytes)", size, len(m.bytes))
+	}
+	m.sp = addr
+	m.low = min(m.low, addr)
+	for i := addr; i < addr+size; i++ {
+		m.init[i-m.base] = false
+	}
+	m.clearPointers(addr, size)
+	a := &allocation{start: addr, size: size, live: true}
+	m.allocs = append(m.allocs, a)
+	return a, nil
+}
+
+// objectAt returns live allocation containing address, or ending at it when none
+// contains it, as allocation placed right after another starts where that one ends.
+// It is nil if there is none.
+func (m *memory) objectAt(addr int) *allocation {
+	var end *allocation
+	for i := len(m.allocs) - 1; i >= 0; i-- {
+		a := m.allocs[i]
+		if a.contains(addr, 1) {
+			return a
+		}
+		if end == nil && addr == a.start+a.size {
+			end = a
+		}
+	}
+	return end
+}
+
+// reuse makes object of alloca executed again uninitialized, as new object would be.
+func (m *memory) reuse(a *allocation) {
+	for i := a.start; i < a.start+a.size; i++ {
+		m.init[i-m.base] = false
+	}
+	m.clearPointers(a.start, a.size)
+}
+
+// release frees every allocation below sp, which becomes new stack pointer.
+func (m *memory) release(sp int) {
+	m.sp = sp
+	for len(m.allocs) > 0 && m.allocs[len(m.allocs)-1].start < sp {
+		m.allocs[len(m.allocs)-1].live = false
+		m.allocs = m.allocs[:len(m.allocs)-1]
+	}
+}
+
+func (m *memory) load(addr, size int) (runtimeValue, error) {
+	if err := m.check(addr, size, "load"); err != nil {
+		return runtimeValue{}, err
+	}
+	off := addr - m.base
+	for i := off; i < off+size; i++ {
+		if !m.init[i] {
+			if m.sanitize {
+				return runtimeValue{}, &UndefinedBehavior{Check: "uninitialized read", Detail: fmt.Sprintf("load of %d bytes at %#x", size, addr)}
+			}
+			return runtimeValue{}, runtimeErrorf(KindUninitializedRead, "load from uninitialized memory at %#x", addr)
+		}
+	}
+	if size == 1 {
+		return runtimeValue{kind: valueI32, i32: int32(int8(m.bytes[off]))}, nil
+	}
+	word := binary.LittleEndian.Uint32(m.bytes[off:])
+	if obj, ok := m.pointers[addr]; ok {
+		return runtimeValue{kind: valuePtr, ptr: int(word), obj: obj}, nil
+	}
+	return runtimeValue{kind: valueI32, i32: int32(word)}, nil
+}
+
+func (m *memory) store(addr, size int, v runtimeValue) error {
+	if err := m.check(addr, size, "store"); err != nil {
+		return err
+	}
+	if v.kind == valuePtr && size != pointerSize {
+		return fmt.Errorf("store of pointer as %s at %#x", sizeTypeName(size), addr)
+	}
+	off := addr - m.base
+	m.clearPointers(addr, size)
+	if size == 1 {
+		m.bytes[off] = byte(v.i32)
+	} else {
+		binary.LittleEndian.PutUint32(m.bytes[off:], uint32(v.address()))
+		if v.kind == valuePtr {
+			m.pointers[addr] = v.obj
+		}
+	}
+	for i := off; i < off+size; i++ {
+		m.init[i] = true
+	}
+	return nil
+}
+
+func (m *memory) contains(addr int) bool {
+	return addr >= m.base && addr < m.top()
+}
+
+// check validates that access is naturally aligned and lies in live part of stack.
+func (m *memory) check(addr, size int, access string) error {
+	if addr%size != 0 {
+		return &MemoryFault{Access: access, Addr: addr, Size: size, Reason: "misaligned"}
+	}
+	if !m.contains(addr) || addr+size > m.top() {
+		return &MemoryFault{Access: access, Addr: addr, Size: size, Reason: "unmapped address"}
+	}
+	if addr < m.sp {
+		return &MemoryFault{Access: access, Addr: addr, Size: size, Reason: fmt.Sprintf("below stack pointer %#x", m.sp)}
+	}
+	return nil
+}
+
+// clearPointers drops pointer marks of every word overlapping [addr, addr+size).
+func (m *memory) clearPointers(addr, size int) {
+	if len(m.pointers) == 0 {
+		return
+	}
+	for a := addr - pointerSize + 1; a < addr+size; a++ {
+		delete(m.pointers, a)
+	}
+}
+
+// MemoryFault is runtime fault of access that is not backed by RAM or device.
+type MemoryFault struct {
+	Access string
+	Addr   int
+	Size   int
+	Reason string
+}
+
+func (f *MemoryFault) Error() string {
+	return fmt.Sprintf("memory fault: %s of %d bytes at %#x: %s", f.Access, f.Size, f.Addr, f.Reason)
+}
+
+func alignDown(addr, align int) int {
+	return addr / align * align
+}
@@ -7,6 +7,9 @@ import (
 	"strings"
 )
 
+// volatileModifier follows opcode of memory access, e.g. "store.ind volatile %t0, %t1".
+const volatileModifier = "volatile"
+
 func ParseModule(r io.Reader) (Module, error) {
 	p := parser{reader: bufio.NewReader(r)}
 	return p.parse()
@@ -285,6 +288,13 @@ func parseInstruction(line string) (Instruction, error) {
 	inst.Opcode = opcode
 
 	rest := strings.TrimSpace(strings.TrimPrefix(right, tokens[0]))
+	if len(tokens) > 1 && tokens[1] == volatileModifier {
+		if !opcode.IsMemoryAccess() {
+			return Instruction{}, fmt.Errorf("opcode %s cannot be volatile", opcode)
+		}
+		inst.Volatile = true
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, volatileModifier))
+	}
 	if opcode == OpcodeCall {
 		callee, args, err := parseCallOperands(rest)
 		if err != nil {
@@ -203,3 +203,56 @@ func TestWriteModule_CallRoundTripStructuredFields(t *testing.T) {
 		t.Fatalf("unexpected reparsed call: %#v", inst)
 	}
 }
+
+func TestParseModule_VolatileMemoryAccessRoundTrip(t *testing.T) {
+	input := `.tac v1
+
+func @poke(%v:i32) -> void {
+.L0:
+  %t0 = const.i32 268435456
+  %t1 = bitcast %t0, i32*
+  store.ind volatile %t1, %v
+  %t2 = load.ind volatile %t1
+  store.ind %t1, %t2
+  ret
+}
+`
+
+	mod, err := ParseModule(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	insts := mod.Functions[0].Instructions
+	if !insts[3].Volatile || !insts[4].Volatile || insts[5].Volatile {
+		t.Fatalf("unexpected volatile flags: %v %v %v", insts[3].Volatile, insts[4].Volatile, insts[5].Volatile)
+	}
+	if insts[3].Operands[0].Text != "%t1" {
+		t.Fatalf("volatile modifier leaked into operands: %#v", insts[3].Operands)
+	}
+
+	var out strings.Builder
+	if err := WriteModule(&out, mod); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+	for _, want := range []string{"  store.ind volatile %t1, %v\n", "  %t2 = load.ind volatile %t1\n", "  store.ind %t1, %t2\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestParseModule_RejectsVolatileNonMemoryOpcode(t *testing.T) {
+	input := `.tac v1
+
+func @bad(%a:i32) -> i32 {
+.L0:
+  %t0 = add volatile %a, 1
+  ret %t0
+}
+`
+
+	_, err := ParseModule(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "opcode add cannot be volatile") {
+		t.Fatalf("expected volatile rejection, got %v", err)
+	}
+}
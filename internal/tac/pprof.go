@@ -0,0 +1,147 @@
+package tac
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// WritePprof writes profile in gzipped protobuf format read by `go tool pprof`.
+// Every TAC function is pprof function and every instruction is a location
+// with line equal to instruction index plus one, samples count executed steps.
+func (p *Profile) WritePprof(w io.Writer) error {
+	b := &pprofBuilder{strings: map[string]int64{"": 0}, stringTable: []string{""}, functions: map[string]uint64{}, locations: map[stackEntry]uint64{}}
+
+	// sample_type and period_type
+	valueType := b.valueType("steps", "count")
+	b.out.bytes(1, valueType)
+
+	keys := make([]sampleKey, 0, len(p.samples))
+	for k := range p.samples {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].callers != keys[j].callers {
+			return keys[i].callers < keys[j].callers
+		}
+		if keys[i].function != keys[j].function {
+			return keys[i].function < keys[j].function
+		}
+		return keys[i].index < keys[j].index
+	})
+	for _, k := range keys {
+		// leaf first
+		ids := []uint64{b.location(stackEntry{function: k.function, index: k.index})}
+		callers := p.stacks[k.callers]
+		for i := len(callers) - 1; i >= 0; i-- {
+			ids = append(ids, b.location(callers[i]))
+		}
+		var sample protoBuffer
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{uint64(p.samples[k])})
+		b.out.bytes(2, sample.buf)
+	}
+
+	b.out.buf = append(b.out.buf, b.locationsBuf.buf...)
+	b.out.buf = append(b.out.buf, b.functionsBuf.buf...)
+	for _, s := range b.stringTable {
+		b.out.bytes(6, []byte(s))
+	}
+	b.out.bytes(11, valueType)
+	b.out.varint(12, 1)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.out.buf); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type pprofBuilder struct {
+	out          protoBuffer
+	locationsBuf protoBuffer
+	functionsBuf protoBuffer
+	strings      map[string]int64
+	stringTable  []string
+	functions    map[string]uint64
+	locations    map[stackEntry]uint64
+}
+
+func (b *pprofBuilder) str(s string) int64 {
+	if id, ok := b.strings[s]; ok {
+		return id
+	}
+	id := int64(len(b.stringTable))
+	b.strings[s] = id
+	b.stringTable = append(b.stringTable, s)
+	return id
+}
+
+func (b *pprofBuilder) valueType(typ, unit string) []byte {
+	var vt protoBuffer
+	vt.varint(1, uint64(b.str(typ)))
+	vt.varint(2, uint64(b.str(unit)))
+	return vt.buf
+}
+
+func (b *pprofBuilder) function(name string) uint64 {
+	if id, ok := b.functions[name]; ok {
+		return id
+	}
+	id := uint64(len(b.functions) + 1)
+	b.functions[name] = id
+	var fn protoBuffer
+	fn.varint(1, id)
+	fn.varint(2, uint64(b.str(name)))
+	fn.varint(3, uint64(b.str(name)))
+	b.functionsBuf.bytes(5, fn.buf)
+	return id
+}
+
+func (b *pprofBuilder) location(e stackEntry) uint64 {
+	if id, ok := b.locations[e]; ok {
+		return id
+	}
+	id := uint64(len(b.locations) + 1)
+	b.locations[e] = id
+	var line protoBuffer
+	line.varint(1, b.function(e.function))
+	line.varint(2, uint64(e.index+1))
+	var loc protoBuffer
+	loc.varint(1, id)
+	loc.bytes(4, line.buf)
+	b.locationsBuf.bytes(4, loc.buf)
+	return id
+}
+
+// protoBuffer encodes protocol buffer fields, just enough for profile.proto.
+type protoBuffer struct {
+	buf []byte
+}
+
+func (p *protoBuffer) rawVarint(v uint64) {
+	for v >= 0x80 {
+		p.buf = append(p.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	p.buf = append(p.buf, byte(v))
+}
+
+func (p *protoBuffer) varint(field int, v uint64) {
+	p.rawVarint(uint64(field)<<3 | 0)
+	p.rawVarint(v)
+}
+
+func (p *protoBuffer) bytes(field int, data []byte) {
+	p.rawVarint(uint64(field)<<3 | 2)
+	p.rawVarint(uint64(len(data)))
+	p.buf = append(p.buf, data...)
+}
+
+func (p *protoBuffer) packed(field int, values []uint64) {
+	var inner protoBuffer
+	for _, v := range values {
+		inner.rawVarint(v)
+	}
+	p.bytes(field, inner.buf)
+}
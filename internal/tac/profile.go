@@ -0,0 +1,266 @@
+package tac
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile aggregates execution counts of one or more evaluations.
+// Every executed instruction, labels included, counts as one step,
+// so totals match step limit of EvalOptions.
+type Profile struct {
+	// Opcodes counts steps by opcode name; jmp, br, ret and label count under their keywords.
+	Opcodes   map[string]int64
+	Functions map[string]*FunctionProfile
+	Blocks    BlockCounts
+
+	blockStarts map[string]map[int]string
+	samples     map[sampleKey]int64
+	stacks      map[string][]stackEntry
+}
+
+// FunctionProfile counts calls and steps executed in function body, callees excluded.
+type FunctionProfile struct {
+	Calls int64
+	Steps int64
+}
+
+// BlockRef identifies basic block by function and index of its first instruction,
+// the same as Start of cfg.BasicBlock. Label is informational.
+type BlockRef struct {
+	Function string
+	Start    int
+	Label    string
+}
+
+// BlockCounts is number of entries into each basic block.
+// It can be saved with WriteBlockCounts and fed back to code layout.
+type BlockCounts map[BlockRef]int64
+
+// Count returns entries of block starting at instruction start of function.
+func (c BlockCounts) Count(function string, start int) int64 {
+	for ref, n := range c {
+		if ref.Function == function && ref.Start == start {
+			return n
+		}
+	}
+	return 0
+}
+
+type stackEntry struct {
+	function string
+	index    int
+}
+
+// sampleKey is executed instruction together with its callers.
+type sampleKey struct {
+	callers  string
+	function string
+	index    int
+}
+
+func NewProfile() *Profile {
+	return &Profile{
+		Opcodes:     map[string]int64{},
+		Functions:   map[string]*FunctionProfile{},
+		Blocks:      BlockCounts{},
+		blockStarts: map[string]map[int]string{},
+		samples:     map[sampleKey]int64{},
+		stacks:      map[string][]stackEntry{},
+	}
+}
+
+// enter records call of fn and returns key of its callers for later samples.
+func (p *Profile) enter(fn Function, frames []*evalFrame) string {
+	fp := p.Functions[fn.Name]
+	if fp == nil {
+		fp = &FunctionProfile{}
+		p.Functions[fn.Name] = fp
+	}
+	fp.Calls++
+
+	if _, ok := p.blockStarts[fn.Name]; !ok {
+		p.blockStarts[fn.Name] = blockStarts(fn)
+	}
+
+	callers := make([]stackEntry, 0, len(frames))
+	parts := make([]string, 0, len(frames))
+	for _, f := range frames {
+		callers = append(callers, stackEntry{function: f.fn.Name, index: f.pc})
+		parts = append(parts, f.fn.Name+"#"+strconv.Itoa(f.pc))
+	}
+	key := strings.Join(parts, ";")
+	if _, ok := p.stacks[key]; !ok {
+		p.stacks[key] = callers
+	}
+	return key
+}
+
+func (p *Profile) step(fn string, callers string, index int, inst Instruction) {
+	p.Opcodes[instructionName(inst)]++
+	p.Functions[fn].Steps++
+	if label, ok := p.blockStarts[fn][index]; ok {
+		p.Blocks[BlockRef{Function: fn, Start: index, Label: label}]++
+	}
+	p.samples[sampleKey{callers: callers, function: fn, index: index}]++
+}
+
+// blockStarts maps first instruction of each basic block to its label.
+func blockStarts(fn Function) map[int]string {
+	labelDefs := map[string]int{}
+	for i, inst := range fn.Instructions {
+		if inst.Kind == InstructionLabel {
+			labelDefs[inst.Label] = i
+		}
+	}
+	starts := map[int]string{}
+	blocks, err := collectIRBlocks(fn, labelDefs)
+	if err != nil {
+		// evaluated functions are validated, so it cannot happen
+		return starts
+	}
+	for _, b := range blocks {
+		starts[b.start] = b.label
+	}
+	return starts
+}
+
+func instructionName(inst Instruction) string {
+	switch inst.Kind {
+	case InstructionLabel:
+		return "label"
+	case InstructionJmp:
+		return "jmp"
+	case InstructionBr:
+		return "br"
+	case InstructionRet:
+		return "ret"
+	default:
+		return inst.Opcode.String()
+	}
+}
+
+// WriteText writes human readable summary, hottest entries first.
+func (p *Profile) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "functions:")
+	names := make([]string, 0, len(p.Functions))
+	for name := range p.Functions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := p.Functions[names[i]], p.Functions[names[j]]
+		if a.Steps != b.Steps {
+			return a.Steps > b.Steps
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fp := p.Functions[name]
+		fmt.Fprintf(bw, "  %-24s %10d steps %8d calls\n", name, fp.Steps, fp.Calls)
+	}
+
+	fmt.Fprintln(bw, "blocks:")
+	for _, ref := range p.Blocks.sorted() {
+		fmt.Fprintf(bw, "  %-24s %10d\n", ref.String(), p.Blocks[ref])
+	}
+
+	fmt.Fprintln(bw, "opcodes:")
+	ops := make([]string, 0, len(p.Opcodes))
+	for op := range p.Opcodes {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if p.Opcodes[ops[i]] != p.Opcodes[ops[j]] {
+			return p.Opcodes[ops[i]] > p.Opcodes[ops[j]]
+		}
+		return ops[i] < ops[j]
+	})
+	for _, op := range ops {
+		fmt.Fprintf(bw, "  %-24s %10d\n", op, p.Opcodes[op])
+	}
+
+	return bw.Flush()
+}
+
+func (r BlockRef) String() string {
+	if r.Label != "" {
+		return r.Function + " " + r.Label
+	}
+	return fmt.Sprintf("%s #%d", r.Function, r.Start)
+}
+
+// sorted orders blocks by count, hottest first, then by position.
+func (c BlockCounts) sorted() []BlockRef {
+	refs := make([]BlockRef, 0, len(c))
+	for ref := range c {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if c[refs[i]] != c[refs[j]] {
+			return c[refs[i]] > c[refs[j]]
+		}
+		if refs[i].Function != refs[j].Function {
+			return refs[i].Function < refs[j].Function
+		}
+		return refs[i].Start < refs[j].Start
+	})
+	return refs
+}
+
+const blockCountsHeader = "# wihajster block counts v1"
+
+// WriteBlockCounts writes counts as lines "<function> <start> <label|-> <count>".
+func WriteBlockCounts(w io.Writer, counts BlockCounts) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, blockCountsHeader)
+	for _, ref := range counts.sorted() {
+		label := ref.Label
+		if label == "" {
+			label = "-"
+		}
+		fmt.Fprintf(bw, "%s %d %s %d\n", ref.Function, ref.Start, label, counts[ref])
+	}
+	return bw.Flush()
+}
+
+// ReadBlockCounts parses output of WriteBlockCounts. Counts of repeated blocks are summed,
+// so files of several runs can be concatenated.
+func ReadBlockCounts(r io.Reader) (BlockCounts, error) {
+	counts := BlockCounts{}
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected function, start, label and count", lineNo)
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid block start %q", lineNo, fields[1])
+		}
+		n, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid count %q", lineNo, fields[3])
+		}
+		label := fields[2]
+		if label == "-" {
+			label = ""
+		}
+		counts[BlockRef{Function: fields[0], Start: start, Label: label}] += n
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
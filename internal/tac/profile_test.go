@@ -0,0 +1,161 @@
+package tac
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+const profiledModule = `.tac v1
+
+func @sum(%n:i32) -> i32 {
+.L0:
+  %t0 = le_s %n, 0
+  br %t0, .L1, .L2
+.L1:
+  ret 0
+.L2:
+  %t1 = sub %n, 1
+  %t2 = call @sum(%t1)
+  %t3 = add %n, %t2
+  ret %t3
+}
+
+func @main() -> i32 {
+.L0:
+  %t0 = call @sum(3)
+  ret %t0
+}
+`
+
+func TestEvaluateFunction_Profile(t *testing.T) {
+	mod, err := ParseModule(strings.NewReader(profiledModule))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+
+	prof := NewProfile()
+	for i := 0; i < 2; i++ {
+		if _, err := EvaluateFunction(mod, "@main", nil, EvalOptions{Profile: prof}); err != nil {
+			t.Fatalf("evaluate: %v", err)
+		}
+	}
+
+	if got := prof.Functions["@sum"].Calls; got != 8 {
+		t.Fatalf("expected 8 calls of @sum, got %d", got)
+	}
+	// per run: 4 entries of .L0, 1 of .L1, 3 of .L2 in @sum
+	sum := mod.Functions[0]
+	if got := prof.Blocks.Count("@sum", 0); got != 8 {
+		t.Fatalf("expected entry block count 8, got %d", got)
+	}
+	if got := prof.Blocks.Count("@sum", 3); got != 2 {
+		t.Fatalf("expected .L1 count 2, got %d", got)
+	}
+	if got := prof.Blocks.Count("@sum", 5); got != 6 {
+		t.Fatalf("expected .L2 count 6, got %d", got)
+	}
+	if sum.Instructions[5].Label != ".L2" {
+		t.Fatalf("test expects .L2 at index 5")
+	}
+	if prof.Opcodes["add"] != 6 || prof.Opcodes["br"] != 8 || prof.Opcodes["call"] != 8 {
+		t.Fatalf("unexpected opcode counts %v", prof.Opcodes)
+	}
+
+	var text strings.Builder
+	if err := prof.WriteText(&text); err != nil {
+		t.Fatalf("write text: %v", err)
+	}
+	for _, want := range []string{"functions:", "@sum", "blocks:", "@sum .L2", "opcodes:", "add"} {
+		if !strings.Contains(text.String(), want) {
+			t.Fatalf("expected text profile to contain %q, got:\n%s", want, text.String())
+		}
+	}
+}
+
+func TestBlockCountsRoundTrip(t *testing.T) {
+	counts := BlockCounts{
+		{Function: "@main", Start: 0, Label: ".L0"}: 3,
+		{Function: "@main", Start: 4}:               1,
+	}
+	var buf bytes.Buffer
+	if err := WriteBlockCounts(&buf, counts); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// concatenated files are summed
+	twice := buf.String() + buf.String()
+	got, err := ReadBlockCounts(strings.NewReader(twice))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(got) != 2 || got.Count("@main", 0) != 6 || got.Count("@main", 4) != 2 {
+		t.Fatalf("unexpected counts %v", got)
+	}
+
+	if _, err := ReadBlockCounts(strings.NewReader("@main x .L0 1\n")); err == nil || !strings.Contains(err.Error(), "line 1: invalid block start") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestProfile_WritePprof(t *testing.T) {
+	mod, err := ParseModule(strings.NewReader(profiledModule))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+	prof := NewProfile()
+	if _, err := EvaluateFunction(mod, "@main", nil, EvalOptions{Profile: prof}); err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := prof.WritePprof(&buf); err != nil {
+		t.Fatalf("write pprof: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %v", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read profile: %v", err)
+	}
+	for _, want := range []string{"steps", "count", "@main", "@sum"} {
+		if !bytes.Contains(raw, []byte(want)) {
+			t.Fatalf("expected string table to contain %q", want)
+		}
+	}
+}
+
+func TestEvaluateFunction_TextTracer(t *testing.T) {
+	mod, err := ParseModule(strings.NewReader(profiledModule))
+	if err != nil {
+		t.Fatalf("parse module: %v", err)
+	}
+
+	var out strings.Builder
+	if _, err := EvaluateFunction(mod, "@sum", []int32{1}, EvalOptions{Tracer: NewTextTracer(&out)}); err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		"@sum#1 %t0 = le_s %n, 0 ; %n=1 => 0",
+		"@sum#2 br %t0, .L1, .L2 ; %t0=0",
+		"@sum#6 %t1 = sub %n, 1 ; %n=1 => 0",
+		"  @sum#1 %t0 = le_s %n, 0 ; %n=0 => 1",
+		"  @sum#2 br %t0, .L1, .L2 ; %t0=1",
+		"  @sum#4 ret 0",
+		"@sum#7 %t2 = call @sum(%t1) ; %t1=0 => 0",
+		"@sum#8 %t3 = add %n, %t2 ; %n=1 %t2=0 => 1",
+		"@sum#9 ret %t3 ; %t3=1",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d trace lines, got:\n%s", len(want), out.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("line %d: expected %q, got %q", i, want[i], lines[i])
+		}
+	}
+}
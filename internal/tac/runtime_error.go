@@ -0,0 +1,199 @@
+package tac
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// RuntimeErrorKind classifies evaluation failures.
+type RuntimeErrorKind int
+
+const (
+	// KindInvalidProgram is TAC evaluator cannot execute, e.g. read of unknown value or pointer used as i32.
+	KindInvalidProgram RuntimeErrorKind = iota
+	KindDivisionByZero
+	KindMemoryFault
+	KindUninitializedRead
+	KindStackOverflow
+	KindUndefinedBehavior
+	KindStepLimit
+	KindCallDepth
+	KindMissingFunction
+	KindHostFunction
+	KindDevice
+	// KindHeapExhausted is malloc over EvalOptions.MaxHeapBytes, stack budget is KindStackOverflow.
+	KindHeapExhausted
+	// KindCanceled is evaluation stopped by context, Err wraps ctx.Err().
+	KindCanceled
+)
+
+var runtimeErrorKindNames = map[RuntimeErrorKind]string{
+	KindInvalidProgram: "invalid program", KindDivisionByZero: "division by zero", KindMemoryFault: "memory fault",
+	KindUninitializedRead: "uninitialized read", KindStackOverflow: "stack overflow", KindUndefinedBehavior: "undefined behavior",
+	KindStepLimit: "step limit", KindCallDepth: "call depth", KindMissingFunction: "missing function",
+	KindHostFunction: "host function", KindDevice: "device", KindHeapExhausted: "heap exhausted",
+	KindCanceled: "canceled",
+}
+
+func (k RuntimeErrorKind) String() string {
+	if name, ok := runtimeErrorKindNames[k]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+// RuntimeError is failure of instruction during evaluation.
+// Err is underlying error, e.g. *MemoryFault or *UndefinedBehavior, reachable with errors.As.
+type RuntimeError struct {
+	Kind RuntimeErrorKind
+	Err  error
+
+	Function string
+	Index    int
+	// Block is label of basic block containing instruction, empty for unlabeled entry block.
+	Block       string
+	Instruction Instruction
+	// Operands are values instruction read, as reported to Tracer.
+	Operands []TraceValue
+	// Stack holds active calls, outermost first like Machine.Frames; failing call is last.
+	Stack []Frame
+	// Stats is resource usage up to failure.
+	Stats Stats
+}
+
+// Stats is resource usage of evaluation.
+type Stats struct {
+	Steps int
+	// MaxDepth is deepest call nesting, entry function alone is depth 1.
+	MaxDepth int
+	// StackBytes and HeapBytes are peak stack usage and peak bytes of live heap objects.
+	StackBytes int
+	HeapBytes  int
+}
+
+func (s *evalState) stats() Stats {
+	st := Stats{Steps: s.steps, MaxDepth: s.maxDepth, StackBytes: s.memory.top() - s.memory.low}
+	if s.heap != nil {
+		st.HeapBytes = s.heap.peak
+	}
+	return st
+}
+
+// runtimeErrorf creates error of kind, located later by evaluator.
+func runtimeErrorf(kind RuntimeErrorKind, format string, args ...any) error {
+	return &RuntimeError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *RuntimeError) Error() string {
+	var ub *UndefinedBehavior
+	if errors.As(e.Err, &ub) {
+		// already names location
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v at %s#%d", e.Err, e.Function, e.Index)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// WriteTrace writes error and call stack, innermost call first, like Go panic trace.
+// Source positions of instructions lowered from C are printed as file:line:column,
+// with sourceFile for positions without file.
+func (e *RuntimeError) WriteTrace(w io.Writer, sourceFile string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "runtime error: %v [%s]\n\n", e.Err, e.Kind)
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		f := e.Stack[i]
+		fmt.Fprintf(bw, "%s#%d", f.Function, f.Index)
+		if i == len(e.Stack)-1 && e.Block != "" {
+			fmt.Fprintf(bw, " in %s", e.Block)
+		}
+		bw.WriteByte('\n')
+
+		line, err := FormatInstruction(f.Instruction)
+		if err != nil {
+			line = instructionName(f.Instruction)
+		}
+		fmt.Fprintf(bw, "\t%s", line)
+		if i == len(e.Stack)-1 && len(e.Operands) > 0 {
+			bw.WriteString(" ;")
+			for _, op := range e.Operands {
+				fmt.Fprintf(bw, " %s=%s", op.Name, op)
+			}
+		}
+		bw.WriteByte('\n')
+
+		if pos := f.Instruction.Pos; pos.IsValid() {
+			if file := cmp.Or(pos.File, sourceFile); file != "" {
+				fmt.Fprintf(bw, "\t%s:%d:%d\n", file, pos.Line, pos.Column)
+			} else {
+				fmt.Fprintf(bw, "\tline %d:%d\n", pos.Line, pos.Column)
+			}
+		}
+	}
+	st := e.Stats
+	fmt.Fprintf(bw, "\n%d steps, call depth %d, stack %d bytes, heap %d bytes\n", st.Steps, st.MaxDepth, st.StackBytes, st.HeapBytes)
+	return bw.Flush()
+}
+
+// runtimeError locates err raised by instruction pc of innermost frame.
+func (s *evalState) runtimeError(err error, frame *evalFrame, pc int) *RuntimeError {
+	var rt *RuntimeError
+	if !errors.As(err, &rt) || rt.Function != "" {
+		rt = &RuntimeError{Kind: classifyError(err), Err: err}
+	}
+	fn := frame.fn
+	var ub *UndefinedBehavior
+	if errors.As(err, &ub) && ub.Function == "" {
+		ub.Function = fn.Name
+		ub.Index = pc
+		ub.Pos = fn.Instructions[pc].Pos
+	}
+
+	rt.Function = fn.Name
+	rt.Index = pc
+	rt.Block = blockLabel(fn.Function, pc)
+	if pc < len(fn.Instructions) {
+		rt.Instruction = fn.Instructions[pc]
+		rt.Operands = frame.traceOperands(&fn.code[pc])
+	}
+	rt.Stack = s.snapshot()
+	rt.Stats = s.stats()
+	return rt
+}
+
+func classifyError(err error) RuntimeErrorKind {
+	var fault *MemoryFault
+	var ub *UndefinedBehavior
+	switch {
+	case errors.As(err, &fault):
+		return KindMemoryFault
+	case errors.As(err, &ub):
+		return KindUndefinedBehavior
+	default:
+		return KindInvalidProgram
+	}
+}
+
+// blockLabel returns label of basic block containing instruction index.
+func blockLabel(fn Function, index int) string {
+	starts := blockStarts(fn)
+	keys := make([]int, 0, len(starts))
+	for start := range starts {
+		keys = append(keys, start)
+	}
+	sort.Ints(keys)
+	label := ""
+	for _, start := range keys {
+		if start > index {
+			break
+		}
+		label = starts[start]
+	}
+	return label
+}
@@ -0,0 +1,97 @@
+package tac
+
+import (
+	"fmt"
+	"math"
+)
+
+// UndefinedBehavior is reported by evaluator with Sanitize option
+// when program does something C leaves undefined.
+type UndefinedBehavior struct {
+	// Check names violated rule, e.g. "signed overflow" or "out-of-bounds access".
+	Check  string
+	Detail string
+
+	Function string
+	Index    int
+	// Pos is C source position of instruction, if module was lowered from C.
+	Pos SourcePos
+}
+
+func (u *UndefinedBehavior) Error() string {
+	msg := fmt.Sprintf("undefined behavior: %s: %s in %s#%d", u.Check, u.Detail, u.Function, u.Index)
+	switch {
+	case u.Pos.File != "":
+		msg += fmt.Sprintf(" (%s:%d:%d)", u.Pos.File, u.Pos.Line, u.Pos.Column)
+	case u.Pos.IsValid():
+		msg += fmt.Sprintf(" (line %d, column %d)", u.Pos.Line, u.Pos.Column)
+	}
+	return msg
+}
+
+// sanitizeArith checks signed integer operation of evaluated C code,
+// b is ignored for neg.
+func sanitizeArith(op Opcode, a, b int32) error {
+	x, y := int64(a), int64(b)
+	var wide int64
+	var sign string
+	switch op {
+	case OpcodeAdd:
+		wide, sign = x+y, "+"
+	case OpcodeSub:
+		wide, sign = x-y, "-"
+	case OpcodeMul:
+		wide, sign = x*y, "*"
+	case OpcodeNeg:
+		if a == math.MinInt32 {
+			return &UndefinedBehavior{Check: "signed overflow", Detail: fmt.Sprintf("neg of %d", a)}
+		}
+		return nil
+	case OpcodeDivS, OpcodeModS:
+		if a == math.MinInt32 && b == -1 {
+			return &UndefinedBehavior{Check: "signed overflow", Detail: fmt.Sprintf("%s of %d by -1", op, a)}
+		}
+		return nil
+	case OpcodeShl, OpcodeShrS:
+		if b < 0 || b > 31 {
+			return &UndefinedBehavior{Check: "invalid shift", Detail: fmt.Sprintf("%s by %d", op, b)}
+		}
+		return nil
+	default:
+		return nil
+	}
+	if wide < math.MinInt32 || wide > math.MaxInt32 {
+		return &UndefinedBehavior{Check: "signed overflow", Detail: fmt.Sprintf("%d %s %d", a, sign, b)}
+	}
+	return nil
+}
+
+// sanitizeAccess checks that access of size bytes through pointer stays in live object it points to.
+// Pointers without object, like ones cast from integer, are not checked.
+func sanitizeAccess(p runtimeValue, size int, access string) error {
+	if p.obj == nil {
+		return nil
+	}
+	if !p.obj.live && p.obj.heap {
+		return &UndefinedBehavior{Check: "use after free", Detail: fmt.Sprintf("%s of %d bytes at %#x in freed heap object", access, size, p.ptr)}
+	}
+	if !p.obj.live {
+		return &UndefinedBehavior{Check: "use after return", Detail: fmt.Sprintf("%s of %d bytes at %#x in released stack object", access, size, p.ptr)}
+	}
+	if !p.obj.contains(p.ptr, size) {
+		return &UndefinedBehavior{Check: "out-of-bounds access", Detail: fmt.Sprintf("%s of %d bytes at %#x outside %s", access, size, p.ptr, p.obj)}
+	}
+	return nil
+}
+
+// sanitizePointer checks result of pointer arithmetic, which can point into object or just past its end.
+func sanitizePointer(p runtimeValue) error {
+	if p.obj == nil || (p.ptr >= p.obj.start && p.ptr <= p.obj.start+p.obj.size) {
+		return nil
+	}
+	return &UndefinedBehavior{Check: "out-of-bounds pointer", Detail: fmt.Sprintf("pointer %#x outside %s", p.ptr, p.obj)}
+}
+
+func (a *allocation) String() string {
+	return fmt.Sprintf("object of %d bytes at %#x", a.size, a.start)
+}
@@ -0,0 +1,119 @@
+package tac
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tracer receives every instruction executed by evaluator, labels excluded.
+// Instruction is reported when it completes, so call comes after instructions of callee.
+type Tracer interface {
+	Trace(ev TraceEvent)
+}
+
+// TraceEvent describes one executed instruction.
+type TraceEvent struct {
+	Function string
+	// Index is position of instruction in Function.Instructions.
+	Index       int
+	Depth       int
+	Instruction Instruction
+	// Operands are values of temporaries, parameters and slots read by instruction.
+	Operands  []TraceValue
+	HasResult bool
+	Result    TraceValue
+}
+
+// TraceValue is a named runtime value. Pointers carry their address in Value.
+type TraceValue struct {
+	Name    string
+	Value   int64
+	Pointer bool
+}
+
+func (v TraceValue) String() string {
+	if v.Pointer {
+		return fmt.Sprintf("%#x", v.Value)
+	}
+	return fmt.Sprintf("%d", v.Value)
+}
+
+func traceValue(name string, v runtimeValue) TraceValue {
+	if v.kind == valuePtr {
+		return TraceValue{Name: name, Value: int64(v.ptr), Pointer: true}
+	}
+	return TraceValue{Name: name, Value: int64(v.i32)}
+}
+
+// NewTextTracer returns tracer writing one line per instruction:
+//
+//	@main#3 %t2 = add %t0, %t1 ; %t0=1 %t1=2 => 3
+//
+// Callee lines are indented by call depth. Write errors stop further output.
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: w}
+}
+
+type textTracer struct {
+	w   io.Writer
+	err error
+}
+
+func (t *textTracer) Trace(ev TraceEvent) {
+	if t.err != nil {
+		return
+	}
+	line, err := formatInstruction(ev.Instruction)
+	if err != nil {
+		line = instructionName(ev.Instruction)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s#%d %s", strings.Repeat("  ", ev.Depth), ev.Function, ev.Index, line)
+	if len(ev.Operands) > 0 || ev.HasResult {
+		b.WriteString(" ;")
+	}
+	for _, op := range ev.Operands {
+		fmt.Fprintf(&b, " %s=%s", op.Name, op)
+	}
+	if ev.HasResult {
+		fmt.Fprintf(&b, " => %s", ev.Result)
+	}
+	b.WriteByte('\n')
+	_, t.err = io.WriteString(t.w, b.String())
+}
+
+// readOperands lists value names instruction reads, in operand order.
+func readOperands(inst Instruction) []string {
+	var names []string
+	switch inst.Kind {
+	case InstructionBr:
+		names = append(names, inst.Condition.Text)
+	case InstructionRet:
+		if inst.HasReturnValue {
+			names = append(names, inst.ReturnValue.Text)
+		}
+	case InstructionOp:
+		for _, op := range inst.Operands {
+			if op.Kind != OperandImmediate {
+				names = append(names, op.Text)
+			}
+		}
+		for _, arg := range inst.CallArgs {
+			if arg.Kind != OperandImmediate {
+				names = append(names, arg.Text)
+			}
+		}
+	}
+	return names
+}
+
+func (f *evalFrame) traceOperands(d *decodedInst) []TraceValue {
+	values := make([]TraceValue, 0, len(d.reads))
+	for _, o := range d.reads {
+		if f.defined[o.slot] {
+			values = append(values, traceValue(o.name, f.values[o.slot]))
+		}
+	}
+	return values
+}
@@ -10,10 +10,26 @@ type Function struct {
 	Name       string
 	Parameters []Parameter
 	ReturnType string
+	// Pos is C source position of function definition, zero if unknown.
+	Pos SourcePos
 
 	Instructions []Instruction
 
 	nextTempID int
+	pos        SourcePos
+}
+
+// SourcePos is position in C source an instruction was lowered from.
+// Zero value means unknown, e.g. for TAC parsed from text.
+type SourcePos struct {
+	// File is name of source file, empty when lexer had none.
+	File   string
+	Line   int
+	Column int
+}
+
+func (p SourcePos) IsValid() bool {
+	return p.Line > 0
 }
 
 type Parameter struct {
@@ -63,6 +79,13 @@ const (
 	OpcodeStore
 	OpcodeLoadIndirect
 	OpcodeStoreIndirect
+	OpcodeBitcast
+	OpcodeTrunc
+	OpcodeGep
+	OpcodeLtU
+	OpcodeLeU
+	OpcodeGtU
+	OpcodeGeU
 )
 
 var opcodeNames = map[Opcode]string{
@@ -71,6 +94,8 @@ var opcodeNames = map[Opcode]string{
 	OpcodeAnd: "and", OpcodeOr: "or", OpcodeXor: "xor", OpcodeShl: "shl", OpcodeShrS: "shr_s",
 	OpcodeEq: "eq", OpcodeNe: "ne", OpcodeLtS: "lt_s", OpcodeLeS: "le_s", OpcodeGtS: "gt_s", OpcodeGeS: "ge_s",
 	OpcodeNeg: "neg", OpcodeNot: "not", OpcodeLogicNot: "logic_not", OpcodeCall: "call", OpcodeAlloca: "alloca", OpcodeLoad: "load", OpcodeStore: "store", OpcodeLoadIndirect: "load.ind", OpcodeStoreIndirect: "store.ind",
+	OpcodeBitcast: "bitcast", OpcodeTrunc: "trunc", OpcodeGep: "gep",
+	OpcodeLtU: "lt_u", OpcodeLeU: "le_u", OpcodeGtU: "gt_u", OpcodeGeU: "ge_u",
 }
 
 var coreOpcodeByName = map[string]Opcode{}
@@ -86,13 +111,23 @@ func ParseOpcode(name string) (Opcode, bool, bool) {
 		return op, true, false
 	}
 	switch name {
-	case "gep", "zext", "sext", "trunc", "bitcast", "phi":
+	case "zext", "sext", "phi":
 		return OpcodeInvalid, false, true
 	default:
 		return OpcodeInvalid, false, false
 	}
 }
 
+// IsMemoryAccess reports if opcode reads or writes memory and can be marked volatile.
+func (o Opcode) IsMemoryAccess() bool {
+	switch o {
+	case OpcodeLoad, OpcodeStore, OpcodeLoadIndirect, OpcodeStoreIndirect:
+		return true
+	default:
+		return false
+	}
+}
+
 func (o Opcode) String() string {
 	if name, ok := opcodeNames[o]; ok {
 		return name
@@ -140,12 +175,18 @@ type Instruction struct {
 	CallCallee     string
 	CallArgs       []ValueRef
 
+	// Volatile memory access must be kept as is by every pass and backend.
+	// It cannot be removed, merged with other access or reordered with other volatile access.
+	Volatile bool
+
 	Condition  Operand
 	TrueLabel  Operand
 	FalseLabel Operand
 
 	HasReturnValue bool
 	ReturnValue    Operand
+
+	Pos SourcePos
 }
 
 func VerifyInstruction(inst Instruction) error {
@@ -177,6 +218,9 @@ func VerifyInstruction(inst Instruction) error {
 		if inst.Opcode == OpcodeInvalid {
 			return fmt.Errorf("operation requires a valid opcode")
 		}
+		if inst.Volatile && !inst.Opcode.IsMemoryAccess() {
+			return fmt.Errorf("opcode %s cannot be volatile", inst.Opcode)
+		}
 		return verifyOpcodeOperands(inst)
 	default:
 		return fmt.Errorf("unsupported instruction kind %d", inst.Kind)
@@ -206,7 +250,8 @@ func verifyOpcodeOperands(inst Instruction) error {
 		if len(inst.Operands) != 1 || !valueKind(inst.Operands[0].Kind) {
 			return fmt.Errorf("opcode %s operand 1 must be a value", inst.Opcode)
 		}
-	case OpcodeAdd, OpcodeSub, OpcodeMul, OpcodeDivS, OpcodeModS, OpcodeAnd, OpcodeOr, OpcodeXor, OpcodeShl, OpcodeShrS, OpcodeEq, OpcodeNe, OpcodeLtS, OpcodeLeS, OpcodeGtS, OpcodeGeS:
+	case OpcodeAdd, OpcodeSub, OpcodeMul, OpcodeDivS, OpcodeModS, OpcodeAnd, OpcodeOr, OpcodeXor, OpcodeShl, OpcodeShrS, OpcodeEq, OpcodeNe, OpcodeLtS, OpcodeLeS, OpcodeGtS, OpcodeGeS,
+		OpcodeLtU, OpcodeLeU, OpcodeGtU, OpcodeGeU:
 		if len(inst.Operands) != 2 || !valueKind(inst.Operands[0].Kind) || !valueKind(inst.Operands[1].Kind) {
 			return fmt.Errorf("opcode %s expects two value operands", inst.Opcode)
 		}
@@ -217,21 +262,29 @@ func verifyOpcodeOperands(inst Instruction) error {
 	case OpcodeAlloca:
 		return requireKinds(OperandImmediate)
 	case OpcodeLoad:
-		if len(inst.Operands) != 1 || inst.Operands[0].Kind != OperandStackSlotPointer {
+		if !hasAccessOperands(inst, 1) || inst.Operands[0].Kind != OperandStackSlotPointer {
 			return fmt.Errorf("opcode load expects one stack slot pointer operand")
 		}
 	case OpcodeStore:
-		if len(inst.Operands) != 2 || inst.Operands[0].Kind != OperandStackSlotPointer || !valueKind(inst.Operands[1].Kind) {
+		if !hasAccessOperands(inst, 2) || inst.Operands[0].Kind != OperandStackSlotPointer || !valueKind(inst.Operands[1].Kind) {
 			return fmt.Errorf("opcode store expects stack slot pointer and value operands")
 		}
 	case OpcodeLoadIndirect:
-		if len(inst.Operands) != 1 || !valueKind(inst.Operands[0].Kind) {
+		if !hasAccessOperands(inst, 1) || !valueKind(inst.Operands[0].Kind) {
 			return fmt.Errorf("opcode load.ind expects one value pointer operand")
 		}
 	case OpcodeStoreIndirect:
-		if len(inst.Operands) != 2 || !valueKind(inst.Operands[0].Kind) || !valueKind(inst.Operands[1].Kind) {
+		if !hasAccessOperands(inst, 2) || !valueKind(inst.Operands[0].Kind) || !valueKind(inst.Operands[1].Kind) {
 			return fmt.Errorf("opcode store.ind expects value pointer and value operands")
 		}
+	case OpcodeBitcast, OpcodeTrunc:
+		if len(inst.Operands) != 2 || !valueKind(inst.Operands[0].Kind) || inst.Operands[1].Kind != OperandImmediate {
+			return fmt.Errorf("opcode %s expects value and type operands", inst.Opcode)
+		}
+	case OpcodeGep:
+		if len(inst.Operands) != 3 || !valueKind(inst.Operands[0].Kind) || !valueKind(inst.Operands[1].Kind) || inst.Operands[2].Kind != OperandImmediate {
+			return fmt.Errorf("opcode gep expects pointer, index and element size operands")
+		}
 	case OpcodeCall:
 		if inst.CallCallee == "" {
 			return fmt.Errorf("opcode call requires call callee")
@@ -256,6 +309,35 @@ func verifyOpcodeOperands(inst Instruction) error {
 	return nil
 }
 
+// hasAccessOperands checks memory access has n operands, optionally followed by access type.
+func hasAccessOperands(inst Instruction, n int) bool {
+	switch len(inst.Operands) {
+	case n:
+		return true
+	case n + 1:
+		return inst.Operands[n].Kind == OperandImmediate && isAccessType(inst.Operands[n].Text)
+	default:
+		return false
+	}
+}
+
+func isAccessType(typ string) bool {
+	return typ == "i8" || typ == "i32"
+}
+
+// AccessType returns width of load or store. It is given by optional trailing type operand,
+// access without it is i32 wide, which also covers pointers.
+func (inst Instruction) AccessType() string {
+	n := 1
+	if inst.Opcode == OpcodeStore || inst.Opcode == OpcodeStoreIndirect {
+		n = 2
+	}
+	if len(inst.Operands) == n+1 {
+		return inst.Operands[n].Text
+	}
+	return "i32"
+}
+
 func isFunctionSymbol(name string) bool {
 	return len(name) > 1 && name[0] == '@'
 }
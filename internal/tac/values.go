@@ -0,0 +1,217 @@
+package tac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ValueType is type of value exchanged with evaluated code.
+type ValueType int
+
+const (
+	ValueI32 ValueType = iota
+	ValueI8
+	// ValuePtr is address in evaluator memory, see Machine.Alloc.
+	ValuePtr
+	// ValueVoid is result of function returning void.
+	ValueVoid
+)
+
+var valueTypeNames = map[ValueType]string{ValueI32: "i32", ValueI8: "i8", ValuePtr: "ptr", ValueVoid: "void"}
+
+func (t ValueType) String() string {
+	if name, ok := valueTypeNames[t]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+// Value is typed argument or result of evaluated function.
+// Int holds integer sign-extended to 32 bits, or address of pointer.
+type Value struct {
+	Type ValueType
+	Int  int32
+}
+
+func I32(v int32) Value { return Value{Type: ValueI32, Int: v} }
+func I8(v int8) Value   { return Value{Type: ValueI8, Int: int32(v)} }
+func Ptr(addr uint32) Value {
+	return Value{Type: ValuePtr, Int: int32(addr)}
+}
+
+// Void is result of void function.
+var Void = Value{Type: ValueVoid}
+
+// Addr returns address held by pointer value.
+func (v Value) Addr() uint32 {
+	return uint32(v.Int)
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case ValuePtr:
+		return fmt.Sprintf("ptr %#x", v.Addr())
+	case ValueVoid:
+		return "void"
+	default:
+		return fmt.Sprintf("%s %d", v.Type, v.Int)
+	}
+}
+
+// valueTypeOf maps TAC type name to value type.
+func valueTypeOf(typ string) ValueType {
+	switch {
+	case typ == "void":
+		return ValueVoid
+	case typ == "i8":
+		return ValueI8
+	case isPointerTypeName(typ):
+		return ValuePtr
+	default:
+		return ValueI32
+	}
+}
+
+// runtimeValueOf converts argument, pointers into memory get object they point into.
+func (s *evalState) runtimeValueOf(v Value) runtimeValue {
+	if v.Type != ValuePtr {
+		return runtimeValue{kind: valueI32, i32: v.Int}
+	}
+	addr := int(v.Addr())
+	return runtimeValue{kind: valuePtr, ptr: addr, obj: s.objectAt(addr)}
+}
+
+// StartValues enters function like Start, with arguments checked against its parameter types.
+// Arguments of i8 parameters must fit in i8.
+func (m *Machine) StartValues(functionName string, args []Value) error {
+	if m.started {
+		return fmt.Errorf("machine already started")
+	}
+	if fn, ok := m.st.funcs[functionName]; ok {
+		if len(args) != len(fn.Parameters) {
+			return fmt.Errorf("function %s expects %d arguments, got %d", functionName, len(fn.Parameters), len(args))
+		}
+		for i, p := range fn.Parameters {
+			if err := checkArgument(p, args[i]); err != nil {
+				return fmt.Errorf("function %s: %w", functionName, err)
+			}
+		}
+	}
+	callArgs := make([]runtimeValue, 0, len(args))
+	for _, a := range args {
+		callArgs = append(callArgs, m.st.runtimeValueOf(a))
+	}
+	return m.start(functionName, callArgs)
+}
+
+func checkArgument(p Parameter, v Value) error {
+	want := valueTypeOf(p.Type)
+	switch {
+	case want == ValueI8 && v.Type == ValueI32 && v.Int != int32(int8(v.Int)):
+		return fmt.Errorf("argument %s: %d does not fit in i8", p.Name, v.Int)
+	case want == ValueI8 && v.Type == ValueI32, want == ValueI32 && v.Type == ValueI8:
+		return nil
+	case want != v.Type:
+		return fmt.Errorf("argument %s of type %s got %s", p.Name, p.Type, v.Type)
+	}
+	return nil
+}
+
+// ResultValue returns value returned by entry function, typed by its return type.
+// Functions outside module (host functions) return i32.
+func (m *Machine) ResultValue() (Value, error) {
+	if m.err != nil {
+		return Value{}, m.err
+	}
+	if !m.st.done {
+		return Value{}, fmt.Errorf("evaluation of %s not finished", m.entry)
+	}
+	ret := m.st.result
+	typ := ValueI32
+	if fn, ok := m.st.funcs[m.entry]; ok {
+		typ = valueTypeOf(fn.ReturnType)
+	}
+	switch typ {
+	case ValueVoid:
+		return Void, nil
+	case ValuePtr:
+		return Ptr(uint32(ret.address())), nil
+	case ValueI8:
+		return I8(int8(ret.address())), nil
+	default:
+		if ret.kind == valuePtr {
+			return Value{}, fmt.Errorf("function %s returned pointer as %s", m.entry, m.st.funcs[m.entry].ReturnType)
+		}
+		return I32(ret.i32), nil
+	}
+}
+
+// Call starts function with typed arguments and runs it to completion.
+func (m *Machine) Call(functionName string, args ...Value) (Value, error) {
+	if err := m.StartValues(functionName, args); err != nil {
+		return Value{}, err
+	}
+	if err := m.Run(context.Background()); err != nil {
+		return Value{}, err
+	}
+	return m.ResultValue()
+}
+
+// Alloc reserves size bytes of evaluator stack before function is started,
+// e.g. for input buffers. Memory stays valid after function returns, so it can be read back.
+func (m *Machine) Alloc(size, align int) (Value, error) {
+	if m.started {
+		return Value{}, fmt.Errorf("memory must be allocated before machine is started")
+	}
+	if size <= 0 || align <= 0 || align&(align-1) != 0 {
+		return Value{}, fmt.Errorf("invalid allocation of %d bytes aligned to %d", size, align)
+	}
+	obj, err := m.st.memory.alloc(size, align)
+	if err != nil {
+		return Value{}, unlocated(err)
+	}
+	return Ptr(uint32(obj.start)), nil
+}
+
+// AllocBytes allocates copy of data, e.g. NUL terminated C string.
+func (m *Machine) AllocBytes(data []byte) (Value, error) {
+	p, err := m.Alloc(max(len(data), 1), 4)
+	if err != nil {
+		return Value{}, err
+	}
+	return p, m.WriteMemory(p.Addr(), data)
+}
+
+// WriteMemory stores bytes at address, marking them initialized.
+func (m *Machine) WriteMemory(addr uint32, data []byte) error {
+	for i, b := range data {
+		if err := m.st.storeMemory(int(addr)+i, 1, runtimeValue{kind: valueI32, i32: int32(b)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMemory returns n bytes at address. Uninitialized bytes are error,
+// as they are when read by evaluated code.
+func (m *Machine) ReadMemory(addr uint32, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := m.st.loadMemory(int(addr)+i, 1)
+		if err != nil {
+			return nil, unlocated(err)
+		}
+		out = append(out, byte(v.i32))
+	}
+	return out, nil
+}
+
+// unlocated unwraps runtime error raised outside of any instruction.
+func unlocated(err error) error {
+	var rt *RuntimeError
+	if errors.As(err, &rt) && rt.Function == "" {
+		return rt.Err
+	}
+	return err
+}
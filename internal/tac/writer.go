@@ -53,6 +53,11 @@ func formatParams(params []Parameter) string {
 	return strings.Join(parts, ", ")
 }
 
+// FormatInstruction renders single instruction in TAC text syntax, without indentation.
+func FormatInstruction(inst Instruction) (string, error) {
+	return formatInstruction(inst)
+}
+
 func formatInstruction(inst Instruction) (string, error) {
 	switch inst.Kind {
 	case InstructionLabel:
@@ -68,6 +73,9 @@ func formatInstruction(inst Instruction) (string, error) {
 		return "ret " + inst.ReturnValue.Text, nil
 	case InstructionOp:
 		line := inst.Opcode.String()
+		if inst.Volatile {
+			line += " " + volatileModifier
+		}
 		if inst.Opcode == OpcodeCall {
 			line += " " + formatCallInstructionOperands(inst)
 		} else if len(inst.Operands) > 0 {
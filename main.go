@@ -1,30 +1,65 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/SQLek/wihajster/internal/debugger"
+	"github.com/SQLek/wihajster/internal/diag"
+	"github.com/SQLek/wihajster/internal/diag/code"
 	"github.com/SQLek/wihajster/internal/lexer"
 	"github.com/SQLek/wihajster/internal/parser"
 	"github.com/SQLek/wihajster/internal/sema"
 	"github.com/SQLek/wihajster/internal/tac"
 )
 
+// errReported is returned when failure is already described by printed diagnostics.
+var errReported = errors.New("compilation failed")
+
 func main() {
 	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		if !errors.Is(err, errReported) {
+			fmt.Fprintln(os.Stderr, err)
+		}
 		os.Exit(1)
 	}
 }
 
 func run(args []string, stdout, stderr *os.File) error {
+	if len(args) > 0 && args[0] == "debug" {
+		return runDebug(args[1:], os.Stdin, stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "run" {
+		return runProgram(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "explain" {
+		return runExplain(args[1:], stdout, stderr)
+	}
+
 	fs := flag.NewFlagSet("wihajster", flag.ContinueOnError)
 	fs.SetOutput(stderr)
 
-	outPath := fs.String("o", "", "write TAC output to file (default: stdout)")
+	outPath := fs.String("o", "", "write output to file (default: stdout)")
+	preprocessOnly := fs.Bool("E", false, "only preprocess, write C text instead of TAC")
+	annotate := fs.Bool("annotate", false, "with -E, mark tokens of macro expansions with /*NAME{*/ and /*}*/")
+	var pp preprocessorFlags
+	pp.register(fs)
 	fs.Usage = func() {
-		fmt.Fprintf(stderr, "Usage: %s [-o output.tac] <input.c>\n", fs.Name())
+		fmt.Fprintf(stderr, "Usage: %s [-o output.tac] [-E [-annotate]] [-I dir]... [-D name[=value]]... [-U name]... [-target profile] <input.c>\n       %s run [flags] <input.c|input.tac>\n       %s debug [-entry fn] [-sanitize] <input.c|input.tac>\n       %s explain [code]\n", fs.Name(), fs.Name(), fs.Name(), fs.Name())
 		fs.PrintDefaults()
 	}
 
@@ -36,37 +71,498 @@ func run(args []string, stdout, stderr *os.File) error {
 		return fmt.Errorf("expected exactly one input C file")
 	}
 
-	inPath := fs.Arg(0)
-	in, err := os.Open(inPath)
+	var output bytes.Buffer
+	if *preprocessOnly {
+		if err := preprocessFile(&output, fs.Arg(0), pp, *annotate, stderr); err != nil {
+			return err
+		}
+	} else {
+		mod, err := compileFile(fs.Arg(0), pp, stderr)
+		if err != nil {
+			return err
+		}
+		if err := tac.WriteModule(&output, mod); err != nil {
+			return fmt.Errorf("write TAC: %w", err)
+		}
+	}
+
+	out := stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("create output %q: %w", *outPath, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if _, err := output.WriteTo(out); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	return nil
+}
+
+// preprocessFile writes C file after preprocessing, see lexer.WritePreprocessed.
+func preprocessFile(w io.Writer, inPath string, pp preprocessorFlags, annotate bool, stderr io.Writer) error {
+	lex, err := pp.open(inPath)
 	if err != nil {
 		return fmt.Errorf("open input %q: %w", inPath, err)
 	}
-	defer in.Close()
+	defer lex.Close()
+
+	err = lexer.WritePreprocessed(w, lex, annotate)
+	return pp.report(stderr, inPath, lex, nil, err)
+}
+
+// compileFile lowers C file to TAC, writing diagnostics to stderr.
+func compileFile(inPath string, pp preprocessorFlags, stderr io.Writer) (tac.Module, error) {
+	lex, err := pp.open(inPath)
+	if err != nil {
+		return tac.Module{}, fmt.Errorf("open input %q: %w", inPath, err)
+	}
+	defer lex.Close()
 
-	lex := lexer.NewLexer(in)
+	var (
+		mod      tac.Module
+		warnings []sema.Warning
+	)
 	tu, err := parser.Parse(lex)
+	if err == nil {
+		mod, warnings, err = sema.LowerOptions(tu, sema.Options{Warnings: pp.warnings, ErrorLimit: pp.errorLimit})
+	}
+	return mod, pp.report(stderr, inPath, lex, warnings, err)
+}
+
+func runDebug(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("wihajster debug", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	entry := fs.String("entry", "@main", "function to run")
+	sanitize := fs.Bool("sanitize", false, "stop on undefined behavior like signed overflow")
+	var pp preprocessorFlags
+	pp.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [-entry fn] [-sanitize] [-I dir]... [-D name[=value]]... <input.c|input.tac>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one input file")
+	}
+
+	mod, err := loadModule(fs.Arg(0), pp, stderr)
 	if err != nil {
 		return err
 	}
 
-	mod, err := sema.Lower(tu)
+	var uart tac.UART
+	opts := tac.EvalOptions{
+		Devices:   []tac.Device{uart.Device()},
+		HostFuncs: tac.StandardHostFuncs(stdout),
+		Sanitize:  *sanitize,
+	}
+	err = debugger.New(mod, *entry, opts, stdout).Run(stdin)
+	if uart.String() != "" {
+		fmt.Fprintf(stdout, "uart0 output: %q\n", uart.String())
+	}
+	return err
+}
+
+// report prints warnings of lexer and sema and diagnostics of err in chosen format.
+// When err is reported or -Werror fails on warnings, errReported is returned.
+func (pp preprocessorFlags) report(stderr io.Writer, inPath string, lex *lexer.Lexer, warnings []sema.Warning, err error) error {
+	diags := diag.FromWarnings(lex.Warnings())
+	diags = append(diags, diag.FromSemaWarnings(warnings)...)
+	diags = append(diags, diag.FromError(err)...)
+	if pp.werror {
+		diag.Werror(diags)
+	}
+	diags = diag.Limit(diags, pp.errorLimit)
+	printer := diag.Printer{Format: pp.diagnostics, Files: osFiles{}}
+	if wd, wdErr := os.Getwd(); wdErr == nil {
+		// relative paths in SARIF are resolved against working directory
+		dir := "/" + strings.TrimPrefix(filepath.ToSlash(wd), "/")
+		if !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+		printer.Root = (&url.URL{Scheme: "file", Path: dir}).String()
+	}
+	if printErr := printer.Print(stderr, diags); printErr != nil {
+		return errors.Join(err, printErr)
+	}
+	if errs, _ := diag.Count(diags); err != nil || errs > 0 {
+		return errReported
+	}
+	return nil
+}
+
+// loadModule parses TAC file or compiles C file, depending on extension.
+func loadModule(inPath string, pp preprocessorFlags, stderr io.Writer) (tac.Module, error) {
+	if !strings.HasSuffix(inPath, ".tac") {
+		return compileFile(inPath, pp, stderr)
+	}
+	in, err := os.Open(inPath)
 	if err != nil {
+		return tac.Module{}, fmt.Errorf("open input %q: %w", inPath, err)
+	}
+	defer in.Close()
+	return tac.ParseModule(in)
+}
+
+// preprocessorFlags are C preprocessor and diagnostic flags of commands compiling C.
+type preprocessorFlags struct {
+	includePaths stringList
+	// defines of -D and -U, in order given
+	defines            []lexer.Define
+	target             string
+	warnUnknownPragmas bool
+	// warnings are names of enabled sema warnings
+	warnings    map[string]bool
+	werror      bool
+	diagnostics diag.Format
+	// errorLimit stops compilation after that many errors, 0 means no limit
+	errorLimit int
+}
+
+func (pp *preprocessorFlags) register(fs *flag.FlagSet) {
+	fs.Var(&pp.includePaths, "I", "add directory to #include search path, repeat for more")
+	fs.Func("D", "define macro `name[=value]`, value is 1 if omitted, repeat for more", func(arg string) error {
+		pp.defines = append(pp.defines, lexer.ParseDefine(arg))
+		return nil
+	})
+	fs.Func("U", "undefine macro `name`, including predefined one, repeat for more", func(name string) error {
+		pp.defines = append(pp.defines, lexer.Define{Name: name, Undef: true})
+		return nil
+	})
+	fs.BoolVar(&pp.warnUnknownPragmas, "Wunknown-pragmas", false, "warn about ignored #pragma")
+	fs.BoolFunc("Wno-unknown-pragmas", "do not warn about ignored #pragma", func(string) error {
+		pp.warnUnknownPragmas = false
+		return nil
+	})
+	pp.warnings = sema.DefaultWarnings()
+	for _, name := range sema.Warnings() {
+		fs.BoolFunc("W"+name, "enable "+name+" warning", func(string) error {
+			pp.warnings[name] = true
+			return nil
+		})
+		fs.BoolFunc("Wno-"+name, "disable "+name+" warning", func(string) error {
+			delete(pp.warnings, name)
+			return nil
+		})
+	}
+	fs.BoolFunc("Wall", "enable all warnings, -Wno-name after it disables one", func(string) error {
+		for _, name := range sema.Warnings() {
+			pp.warnings[name] = true
+		}
+		pp.warnUnknownPragmas = true
+		return nil
+	})
+	fs.BoolVar(&pp.werror, "Werror", false, "make warnings errors")
+	fs.IntVar(&pp.errorLimit, "error-limit", 0, "stop after `N` errors, 0 means no limit")
+	pp.target = lexer.DefaultTarget
+	targets := lexer.Targets()
+	fs.Func("target", "target `profile` selecting predefined macros: "+strings.Join(targets, ", ")+" (default "+lexer.DefaultTarget+")", func(name string) error {
+		if !slices.Contains(targets, name) {
+			return fmt.Errorf("unknown target %q", name)
+		}
+		pp.target = name
+		return nil
+	})
+	pp.diagnostics = diag.FormatText
+	fs.Func("diagnostics-format", "`format` of diagnostics on stderr: "+strings.Join(diag.Formats(), ", ")+" (default text)", func(name string) error {
+		format, err := diag.ParseFormat(name)
+		pp.diagnostics = format
 		return err
+	})
+}
+
+// open creates lexer of C file. Lexer resolves #include in fs.FS, so whole file system
+// is opened at root and paths are made relative to it. Files are shown by paths as
+// given, see fileNames.
+func (pp preprocessorFlags) open(inPath string) (*lexer.Lexer, error) {
+	name, err := rootRelative(inPath)
+	if err != nil {
+		return nil, err
+	}
+	opts := lexer.Options{Target: pp.target, Defines: pp.defines, WarnUnknownPragmas: pp.warnUnknownPragmas}
+	for _, dir := range pp.includePaths {
+		rel, err := rootRelative(dir)
+		if err != nil {
+			return nil, err
+		}
+		opts.IncludePaths = append(opts.IncludePaths, rel)
+	}
+	if opts.FileName, err = fileNames(inPath, pp.includePaths); err != nil {
+		return nil, err
 	}
+	abs, err := filepath.Abs(inPath)
+	if err != nil {
+		return nil, err
+	}
+	return lexer.NewLexerFS(os.DirFS(filesystemRoot(abs)), name, opts)
+}
 
-	out := stdout
-	if *outPath != "" {
-		f, err := os.Create(*outPath)
+// fileNames maps names of files in root file system back to paths as given on command
+// line, as other compilers show them: input file as given, files found in its directory
+// or in -I directory joined to that directory as given, other ones by absolute path.
+func fileNames(inPath string, includePaths []string) (func(string) string, error) {
+	input, err := rootRelative(inPath)
+	if err != nil {
+		return nil, err
+	}
+	type dir struct{ name, given string }
+	var dirs []dir
+	for _, given := range append([]string{filepath.Dir(inPath)}, includePaths...) {
+		name, err := rootRelative(given)
 		if err != nil {
-			return fmt.Errorf("create output %q: %w", *outPath, err)
+			return nil, err
 		}
-		defer f.Close()
-		out = f
+		dirs = append(dirs, dir{name: name, given: given})
 	}
+	abs, err := filepath.Abs(inPath)
+	if err != nil {
+		return nil, err
+	}
+	root := filesystemRoot(abs)
+	return func(name string) string {
+		if name == input {
+			return inPath
+		}
+		// innermost directory wins, like -I inside directory of input
+		best := -1
+		for i, d := range dirs {
+			if (d.name == "." || strings.HasPrefix(name, d.name+"/")) && (best < 0 || len(d.name) > len(dirs[best].name)) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return filepath.Join(root, filepath.FromSlash(name))
+		}
+		rest := name
+		if d := dirs[best]; d.name != "." {
+			rest = strings.TrimPrefix(name, d.name+"/")
+		}
+		return filepath.Join(dirs[best].given, filepath.FromSlash(rest))
+	}, nil
+}
+
+func filesystemRoot(abs string) string {
+	return filepath.VolumeName(abs) + string(filepath.Separator)
+}
 
-	if err := tac.WriteModule(out, mod); err != nil {
-		return fmt.Errorf("write TAC: %w", err)
+func rootRelative(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(filesystemRoot(abs), abs)
+	if err != nil {
+		return "", err
 	}
+	return filepath.ToSlash(rel), nil
+}
+
+// osFiles opens files by paths as lexer shows them, relative to working directory or
+// absolute, for excerpts of diagnostics.
+type osFiles struct{}
+
+func (osFiles) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// stringList collects repeated string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
 	return nil
 }
+
+// argSets collects repeated -args flags, each one is separate run.
+type argSets [][]int32
+
+func (a *argSets) String() string {
+	return fmt.Sprint([][]int32(*a))
+}
+
+func (a *argSets) Set(value string) error {
+	var args []int32
+	for _, field := range strings.Fields(value) {
+		n, err := strconv.ParseInt(field, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid argument %q", field)
+		}
+		args = append(args, int32(n))
+	}
+	*a = append(*a, args)
+	return nil
+}
+
+// runExplain describes diagnostic code, or lists all codes when none is given.
+func runExplain(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("wihajster explain", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [code]\n", fs.Name())
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return fmt.Errorf("expected at most one diagnostic code")
+	}
+
+	w := bufio.NewWriter(stdout)
+	if fs.NArg() == 0 {
+		for _, info := range code.All() {
+			fmt.Fprintf(w, "%s  %s\n", info.Code, info.Title)
+		}
+		return w.Flush()
+	}
+	info, ok := code.Lookup(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("unknown diagnostic code %q, %s without code lists them", fs.Arg(0), fs.Name())
+	}
+	fmt.Fprintf(w, "%s: %s\n\n%s\n", info.Code, info.Title, info.Text)
+	if info.Flag != "" {
+		fmt.Fprintf(w, "\nEnabled by -W%s, disabled by -Wno-%s.\n", info.Flag, info.Flag)
+	}
+	for _, example := range []struct{ name, src string }{{"Rejected", info.Rejected}, {"Accepted", info.Accepted}} {
+		fmt.Fprintf(w, "\n%s:\n\n", example.name)
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(example.src, "\n"), "\n") {
+			fmt.Fprintf(w, "    %s", line)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+func runProgram(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("wihajster run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	entry := fs.String("entry", "@main", "function to run")
+	sanitize := fs.Bool("sanitize", false, "stop on undefined behavior like signed overflow")
+	coveragePath := fs.String("coverage", "", "write lcov coverage of all runs to file and print summary")
+	steps := fs.Int("steps", 0, "step limit of each run, 0 for default")
+	stackBytes := fs.Int("stack", 0, "stack size in bytes, 0 for default 64 KiB")
+	heapBytes := fs.Int("heap", 0, "limit of live heap bytes, 0 for default 1 MiB")
+	timeout := fs.Duration("timeout", 0, "abort each run after duration, 0 for no timeout")
+	var pp preprocessorFlags
+	pp.register(fs)
+	var runs argSets
+	fs.Var(&runs, "args", "space separated integer arguments of entry function, repeat for more runs")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [-entry fn] [-sanitize] [-coverage out.lcov] [-steps n] [-stack n] [-heap n] [-timeout d] [-I dir]... [-D name[=value]]... [-args \"1 2\"]... <input.c|input.tac>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one input file")
+	}
+	if len(runs) == 0 {
+		runs = argSets{nil}
+	}
+
+	mod, err := loadModule(fs.Arg(0), pp, stderr)
+	if err != nil {
+		return err
+	}
+
+	var coverage *tac.Coverage
+	if *coveragePath != "" {
+		coverage = tac.NewCoverage(mod)
+	}
+	// interrupt aborts run with trace instead of killing process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var failed []error
+	for run, runArgs := range runs {
+		var uart tac.UART
+		opts := tac.EvalOptions{
+			StepLimit:     *steps,
+			MaxStackBytes: *stackBytes,
+			MaxHeapBytes:  *heapBytes,
+			Devices:       []tac.Device{uart.Device()},
+			HostFuncs:     tac.StandardHostFuncs(stdout),
+			Sanitize:      *sanitize,
+			Coverage:      coverage,
+		}
+		ret, err := evaluate(ctx, mod, *entry, runArgs, opts, *timeout)
+		if uart.String() != "" {
+			fmt.Fprintf(stdout, "uart0 output: %q\n", uart.String())
+		}
+		var rt *tac.RuntimeError
+		if errors.As(err, &rt) {
+			source := fs.Arg(0)
+			if strings.HasSuffix(source, ".tac") {
+				source = ""
+			}
+			rt.WriteTrace(stderr, source)
+			err = fmt.Errorf("evaluation of %s failed", *entry)
+		}
+		if err != nil {
+			// failed run does not stop others, coverage of all of them is written
+			failed = append(failed, err)
+			if len(runs) > 1 {
+				fmt.Fprintf(stderr, "run %d: %v\n", run+1, err)
+			}
+			if ctx.Err() != nil {
+				// interrupted, remaining runs would be aborted as well
+				break
+			}
+			continue
+		}
+		fmt.Fprintf(stderr, "%s returned %d\n", *entry, ret)
+	}
+
+	if coverage != nil {
+		if err := writeCoverage(coverage, *coveragePath, fs.Arg(0), stderr); err != nil {
+			return err
+		}
+	}
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(runs) == 1:
+		return failed[0]
+	default:
+		return fmt.Errorf("%d of %d runs failed: %w", len(failed), len(runs), failed[0])
+	}
+}
+
+// writeCoverage writes lcov tracefile of all runs and prints its summary.
+func writeCoverage(coverage *tac.Coverage, path, source string, stderr io.Writer) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create coverage %q: %w", path, err)
+	}
+	defer out.Close()
+	if err := coverage.WriteLCOV(out, source); err != nil {
+		return fmt.Errorf("write coverage: %w", err)
+	}
+	return coverage.WriteSummary(stderr)
+}
+
+func evaluate(ctx context.Context, mod tac.Module, entry string, args []int32, opts tac.EvalOptions, timeout time.Duration) (int32, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return tac.EvaluateFunctionContext(ctx, mod, entry, args, opts)
+}